@@ -1,17 +1,24 @@
 package main
 
 import (
+	"bytes"
+	"context"
 	"encoding/json"
-	"errors"
 	"flag"
 	"fmt"
 	"io"
 	"os"
-	"path/filepath"
+	"os/user"
 	"sort"
+	"strings"
+	"time"
 
+	"github.com/sasano8/kvtool/internal/audit"
 	"github.com/sasano8/kvtool/internal/commands"
 	"github.com/sasano8/kvtool/internal/convert"
+	"github.com/sasano8/kvtool/internal/fsutil"
+	"github.com/sasano8/kvtool/internal/redact"
+	"github.com/sasano8/kvtool/internal/stores"
 )
 
 type cliCommand struct {
@@ -27,9 +34,21 @@ var _commands = map[string]cliCommand{
 	"init":        {run: initCmd, help: "init config"},
 	"store":       {run: storeCmd, help: "load config and dispatch store"},
 	"vault":       {run: commands.VaultCmd, help: "Vault KV -> JSON (data only)"},
+	"agent":       {run: commands.AgentCmd, help: "render templates from stores and keep them fresh"},
+	"watch":       {run: commands.WatchCmd, help: "stream store changes as JSON lines"},
+	"serve":       {run: commands.ServeCmd, help: "serve stores over the KV API (gRPC and HTTP)"},
+	"get":         {run: commands.GetCmd, help: "read a path locally or from a KV server"},
+	"remote":      {run: commands.RemoteCmd, help: "get/head/ls/watch against a KV server"},
+	"cache":       {run: commands.CacheCmd, help: "list or purge the on-disk store cache"},
+	"encrypt":     {run: commands.EncryptCmd, help: ".env -> encrypted .env (age recipients)"},
+	"decrypt":     {run: commands.DecryptCmd, help: "encrypted .env -> .env or JSON"},
+	"edit":        {run: commands.EditCmd, help: "edit an encrypted .env in $EDITOR"},
+	"rewrap":      {run: commands.RewrapCmd, help: "re-wrap or replace the data key of an encrypted .env"},
+	"local":       {run: commands.LocalCmd, help: "manage the local encrypted vault"},
 }
 
 func main() {
+	os.Args = append(os.Args[:1], globalFlags(os.Args[1:])...)
 	if len(os.Args) < 2 {
 		usage()
 		os.Exit(1)
@@ -52,6 +71,20 @@ func main() {
 		initCmd(os.Args[2:])
 	case "store":
 		storeCmd(os.Args[2:])
+	case "agent":
+		_commands["agent"].run(os.Args[2:])
+	case "watch":
+		_commands["watch"].run(os.Args[2:])
+	case "serve":
+		_commands["serve"].run(os.Args[2:])
+	case "get":
+		_commands["get"].run(os.Args[2:])
+	case "remote":
+		_commands["remote"].run(os.Args[2:])
+	case "cache":
+		_commands["cache"].run(os.Args[2:])
+	case "encrypt", "decrypt", "edit", "rewrap", "local":
+		_commands[cmd].run(os.Args[2:])
 	default:
 		fmt.Fprintf(os.Stderr, "unknown command: %s\n\n", cmd)
 		usage()
@@ -59,11 +92,40 @@ func main() {
 	}
 }
 
+// globalFlags はコマンド名より前のオプションを処理して残りを返す
+func globalFlags(args []string) []string {
+	mode := os.Getenv("KVTOOL_REDACT")
+	for len(args) > 0 && strings.HasPrefix(args[0], "-") {
+		name, value, hasValue := strings.Cut(strings.TrimLeft(args[0], "-"), "=")
+		if name != "redact" {
+			break
+		}
+		mode = "full"
+		if hasValue {
+			mode = value
+		}
+		args = args[1:]
+	}
+	r, err := redact.ParseMode(mode)
+	if err != nil {
+		fmt.Fprintln(os.Stderr, "ERROR:", err)
+		os.Exit(2)
+	}
+	redact.SetGlobal(r)
+	return args
+}
+
 func usage() {
 	fmt.Fprintf(os.Stderr, `kvtool - key-value conversion tool
 
 Usage:
-  kvtool <command> [options]
+  kvtool [-redact[=full|partial]] <command> [options]
+
+Global options:
+  -redact       mask secret values (*PASSWORD*, *TOKEN*, *SECRET* keys and
+                high-entropy strings) in output and error messages;
+                -redact=partial keeps two characters at both ends
+                (default: KVTOOL_REDACT)
 
 Commands:
   json          JSON -> JSON
@@ -72,6 +134,17 @@ Commands:
   json2env      JSON -> .env
   init
   store
+  agent         render templates from stores and keep them fresh
+  watch         stream store changes as JSON lines
+  serve         serve stores over the KV API (gRPC and HTTP)
+  get           read a path locally or from a KV server
+  remote        get/head/ls/watch against a KV server
+  cache         list or purge the on-disk store cache
+  encrypt       .env -> encrypted .env (age recipients)
+  decrypt       encrypted .env -> .env or JSON
+  edit          edit an encrypted .env in $EDITOR
+  rewrap        re-wrap or replace the data key of an encrypted .env
+  local         manage the local encrypted vault (init|set|get|rm|ls|passwd)
 
 Run "kvtool <command> -h" for command options.
 `)
@@ -116,7 +189,7 @@ type nopWriteCloser struct{ io.Writer }
 func (nwc nopWriteCloser) Close() error { return nil }
 
 func exitErr(err error) {
-	fmt.Fprintln(os.Stderr, "error:", err)
+	fmt.Fprintln(os.Stderr, "error:", redact.Global().Error(err))
 	os.Exit(1)
 }
 
@@ -146,6 +219,13 @@ func jsonCmd(args []string) {
 	}
 	defer out.Close()
 
+	if rd := redact.Global(); rd != nil {
+		b, err := io.ReadAll(in)
+		if err != nil {
+			exitErr(err)
+		}
+		in = io.NopCloser(bytes.NewReader(rd.JSON("", b)))
+	}
 	if _, err := io.Copy(out, in); err != nil {
 		exitErr(err)
 	}
@@ -204,15 +284,6 @@ func env2jsonCmd(args []string) {
 	}
 }
 
-type StoreConfig struct {
-	Version    float64                     `json:"version"`
-	Namespaces map[string]map[string]Store `json:"namespaces"`
-}
-type Store struct {
-	Type string         `json:"type"`
-	Args map[string]any `json:"args"`
-}
-
 func initCmd(args []string) {
 	fs := flag.NewFlagSet("init", flag.ContinueOnError)
 	fs.SetOutput(os.Stderr)
@@ -241,14 +312,14 @@ func initCmd(args []string) {
 			fmt.Fprintf(os.Stderr, "ERROR: %s already exists (use -force to overwrite)\n", *outPath)
 			os.Exit(1)
 		} else if !os.IsNotExist(err) {
-			fmt.Fprintf(os.Stderr, "ERROR: stat %s: %v\n", *outPath, err)
+			fmt.Fprintf(os.Stderr, "ERROR: stat %s: %v\n", *outPath, redact.Global().Error(err))
 			os.Exit(1)
 		}
 	}
 
-	payload := StoreConfig{
+	payload := stores.Config{
 		Version: 0.1,
-		Namespaces: map[string]map[string]Store{
+		Namespaces: map[string]map[string]stores.StoreConfig{
 			"default": {
 				".env": {
 					Type: ".env",
@@ -260,24 +331,15 @@ func initCmd(args []string) {
 		},
 	}
 
-	if err := writeJSONFileAtomic(*outPath, payload, *pretty); err != nil {
-		fmt.Fprintln(os.Stderr, "ERROR:", err)
+	if err := writeJSONFile(*outPath, payload, *pretty); err != nil {
+		fmt.Fprintln(os.Stderr, "ERROR:", redact.Global().Error(err))
 		os.Exit(1)
 	}
 
 	fmt.Println("wrote:", *outPath)
 }
 
-func writeJSONFileAtomic(path string, v any, pretty bool) error {
-	// 親ディレクトリ作成
-	dir := filepath.Dir(path)
-	if dir != "." {
-		if err := os.MkdirAll(dir, 0o755); err != nil {
-			return fmt.Errorf("mkdir %s: %w", dir, err)
-		}
-	}
-
-	// JSON生成
+func writeJSONFile(path string, v any, pretty bool) error {
 	var (
 		b   []byte
 		err error
@@ -290,18 +352,7 @@ func writeJSONFileAtomic(path string, v any, pretty bool) error {
 	if err != nil {
 		return fmt.Errorf("marshal json: %w", err)
 	}
-	b = append(b, '\n')
-
-	// atomic write（同一FS上なら rename は原子的）
-	tmp := path + ".tmp"
-	if err := os.WriteFile(tmp, b, 0o644); err != nil {
-		return fmt.Errorf("write tmp %s: %w", tmp, err)
-	}
-	if err := os.Rename(tmp, path); err != nil {
-		_ = os.Remove(tmp)
-		return fmt.Errorf("rename to %s: %w", path, err)
-	}
-	return nil
+	return fsutil.WriteFileAtomic(path, append(b, '\n'), 0o644)
 }
 
 func storeCmd(args []string) {
@@ -310,9 +361,12 @@ func storeCmd(args []string) {
 
 	configPath := fs.String("config", ".kvtool.json", "config file path")
 	ns := fs.String("ns", "default", "namespace name")
+	auditSpec := fs.String("audit", os.Getenv("KVTOOL_AUDIT"), "audit sinks, comma separated: stderr, file:<path>, syslog[:<tag>] (default: KVTOOL_AUDIT)")
+	auditKey := fs.String("audit-hmac-key", "", "file holding the audit HMAC key (default: KVTOOL_AUDIT_HMAC_KEY)")
 
 	fs.Usage = func() {
-		fmt.Fprintln(os.Stderr, `Usage: mytool read -config <path> [-ns default] [-store ".env"]`)
+		fmt.Fprintln(os.Stderr, `Usage: mytool read -config <path> [-ns default] [-store ".env"]
+       mytool store <uri>   (vault://secret/app#password, dotenv://./.env#KEY, env://HOME, kv://default/.env/KEY)`)
 		fs.PrintDefaults()
 	}
 
@@ -330,84 +384,134 @@ func storeCmd(args []string) {
 		os.Exit(2)
 	}
 
-	cfg, err := loadConfig(*configPath)
-	if err != nil {
-		fmt.Fprintln(os.Stderr, "ERROR:", err)
-		os.Exit(1)
+	// URI なら設定ファイルを介さずにストアを開く（kv:// は設定ファイルの ns/store）
+	var ref stores.Ref
+	if stores.IsURI(storeKey) {
+		var err error
+		if ref, err = stores.ParseRef(storeKey); err != nil {
+			fmt.Fprintln(os.Stderr, "ERROR:", redact.Global().Error(err))
+			os.Exit(2)
+		}
+		if ref.Namespace != "" {
+			*ns, storeKey = ref.Namespace, ref.StoreKey
+		}
+	}
+
+	k, store := ref.Store.Name, ref.Store
+	if ref.Scheme == "" || ref.Namespace != "" {
+		cfg, err := stores.LoadConfig(*configPath)
+		if err != nil {
+			fmt.Fprintln(os.Stderr, "ERROR:", redact.Global().Error(err))
+			os.Exit(1)
+		}
+
+		k, store, err = cfg.Lookup(*ns, storeKey)
+		if err != nil {
+			fmt.Fprintln(os.Stderr, "ERROR:", redact.Global().Error(err))
+			os.Exit(1)
+		}
+	} else {
+		*ns = ref.Scheme
 	}
 
-	k, store, err := getStoreKV(cfg, *ns, storeKey)
+	// stdout には値を出すので、監査ログが混ざると出力を壊す
+	for _, spec := range strings.Split(*auditSpec, ",") {
+		if strings.TrimSpace(spec) == "stdout" {
+			fmt.Fprintln(os.Stderr, "ERROR: audit sink stdout would mix with the output of store; use stderr, file:<path> or syslog")
+			os.Exit(2)
+		}
+	}
+	logger, err := audit.Open(*auditSpec, *auditKey)
 	if err != nil {
-		fmt.Fprintln(os.Stderr, "ERROR:", err)
+		fmt.Fprintln(os.Stderr, "ERROR:", redact.Global().Error(err))
 		os.Exit(1)
 	}
+	defer logger.Close()
+	if logger != nil && !logger.Signed() {
+		fmt.Fprintln(os.Stderr, "WARNING: audit entries are not signed; set -audit-hmac-key or KVTOOL_AUDIT_HMAC_KEY")
+	}
+	// 監査ログやキャッシュは stores 経由でしか効かない
+	if logger != nil || store.Cache != nil || ref.Scheme != "" {
+		readStore(logger, *ns, k, store, ref.Key)
+		return
+	}
 
 	dispatchStore(k, store)
 }
 
-func dispatchStore(storeKey string, st Store) {
-	switch st.Type {
-	case "env":
-		env2jsonCmd(mapToFlagArgs(st.Args))
-	case ".env":
-		dotenv2jsonCmd(mapToFlagArgs(st.Args))
-	case "vault":
-		// _commands["vault"].run(mapToFlagArgs(st.Args))  // 循環参照になってしまう
-		commands.VaultCmd(mapToFlagArgs(st.Args))
-	// case "json":
-	default:
-		fmt.Fprintf(os.Stderr, "unknown store type: %q (key=%q)\n", st.Type, storeKey)
-		os.Exit(1)
-	}
-}
+// readStore はストアを読んで監査ログを書いてから出力する。key があればその値だけ。
+// 監査ログが書けなければ値は出力しない。
+func readStore(logger *audit.Logger, ns, storeKey string, st stores.StoreConfig, key string) {
+	ctx := context.Background()
+	start := time.Now()
 
-func loadConfig(path string) (StoreConfig, error) {
-	b, err := os.ReadFile(path)
-	if err != nil {
-		return StoreConfig{}, fmt.Errorf("read %s: %w", path, err)
+	var (
+		data map[string]any
+		v    any
+	)
+	s, err := stores.Open(st)
+	if err == nil {
+		data, err = s.Read(ctx)
+	}
+	if err == nil {
+		v, err = stores.Ref{Key: key, Store: st}.Value(data)
+	}
+
+	e := audit.Entry{
+		Identity:   localUser(),
+		AuthMethod: "local",
+		Command:    "store",
+		Operation:  "read",
+		Namespace:  ns,
+		Store:      storeKey,
+		Outcome:    audit.OutcomeSuccess,
+		DurationMS: float64(time.Since(start).Microseconds()) / 1000,
+	}
+	if key != "" {
+		e.Keys = []string{key}
+	} else {
+		for k := range data {
+			e.Keys = append(e.Keys, k)
+		}
 	}
-
-	var cfg StoreConfig
-	if err := json.Unmarshal(b, &cfg); err != nil {
-		return StoreConfig{}, fmt.Errorf("parse json %s: %w", path, err)
+	if err != nil {
+		e.Outcome = audit.OutcomeError
+		e.Error = err.Error()
 	}
-	if cfg.Namespaces == nil {
-		cfg.Namespaces = map[string]map[string]Store{}
+	if aerr := logger.Log(ctx, e); aerr != nil {
+		exitErr(aerr)
 	}
-	return cfg, nil
-}
-
-// nsName が空なら "default" 扱い、storeKey が空なら「その namespace に1件だけならそれを採用」
-func getStoreKV(cfg StoreConfig, nsName, storeKey string) (string, Store, error) {
-	if nsName == "" {
-		nsName = "default"
+	if err != nil {
+		exitErr(err)
 	}
 
-	ns, ok := cfg.Namespaces[nsName]
-	if !ok {
-		return "", Store{}, fmt.Errorf("namespace %q not found", nsName)
-	}
-	if len(ns) == 0 {
-		return "", Store{}, fmt.Errorf("namespace %q has no stores", nsName)
+	enc := json.NewEncoder(os.Stdout)
+	enc.SetIndent("", "  ")
+	if err := enc.Encode(redact.Global().Value(key, v)); err != nil {
+		exitErr(err)
 	}
+}
 
-	// storeKey 指定があるならそれを取りに行く
-	if storeKey != "" {
-		st, ok := ns[storeKey]
-		if !ok {
-			return "", Store{}, fmt.Errorf("store %q not found in namespace %q", storeKey, nsName)
-		}
-		return storeKey, st, nil
+func localUser() string {
+	if u, err := user.Current(); err == nil {
+		return u.Username
 	}
+	return os.Getenv("USER")
+}
 
-	// storeKey 未指定なら「1件だけならそれを採用」、複数ならエラー
-	if len(ns) == 1 {
-		for k, st := range ns {
-			return k, st, nil
-		}
+func dispatchStore(storeKey string, st stores.StoreConfig) {
+	switch st.Type {
+	case "env":
+		env2jsonCmd(mapToFlagArgs(st.Args))
+	case ".env":
+		dotenv2jsonCmd(mapToFlagArgs(st.Args))
+	case "vault":
+		// _commands["vault"].run(mapToFlagArgs(st.Args))  // 循環参照になってしまう
+		commands.VaultCmd(mapToFlagArgs(st.Args))
+	default:
+		// それ以外は stores に登録された型（未登録なら stores.Open がエラーにする）
+		readStore(nil, "", storeKey, st, "")
 	}
-
-	return "", Store{}, errors.New(`multiple stores exist; specify -store (e.g. -store ".env")`)
 }
 
 func mapToFlagArgs(m map[string]any) []string {
@@ -0,0 +1,156 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+// TestMain はこのテストバイナリを kvtool 本体としても使えるようにする
+func TestMain(m *testing.M) {
+	if os.Getenv("KVTOOL_TEST_MAIN") == "1" {
+		main()
+		os.Exit(0)
+	}
+	os.Exit(m.Run())
+}
+
+// kvtool はテストバイナリを kvtool として実行し、stdout と stderr を返す
+func kvtool(t *testing.T, env []string, args ...string) (string, string, error) {
+	t.Helper()
+	cmd := exec.Command(os.Args[0], args...)
+	cmd.Env = append(append(os.Environ(), "KVTOOL_TEST_MAIN=1", "KVTOOL_AUDIT=", "KVTOOL_REDACT="), env...)
+	var stdout, stderr bytes.Buffer
+	cmd.Stdout, cmd.Stderr = &stdout, &stderr
+	err := cmd.Run()
+	return stdout.String(), stderr.String(), err
+}
+
+// storeConfig は default 名前空間にストアを 1 つだけ持つ設定ファイルを書く
+func storeConfig(t *testing.T, name string, st map[string]any) string {
+	t.Helper()
+	b, err := json.Marshal(map[string]any{
+		"version":    0.1,
+		"namespaces": map[string]any{"default": map[string]any{name: st}},
+	})
+	require.NoError(t, err)
+	path := filepath.Join(t.TempDir(), ".kvtool.json")
+	require.NoError(t, os.WriteFile(path, b, 0o644))
+	return path
+}
+
+// storeOutput は kvtool store の出力を JSON として返す
+func storeOutput(t *testing.T, env []string, args ...string) map[string]any {
+	t.Helper()
+	stdout, stderr, err := kvtool(t, env, append([]string{"store"}, args...)...)
+	require.NoError(t, err, stderr)
+	var out map[string]any
+	require.NoError(t, json.Unmarshal([]byte(stdout), &out), stdout)
+	return out
+}
+
+// TestStoreDispatch は kvtool store が組み込みの型と stores に登録された型の
+// どちらも開けることを確かめる（各ストアの中身は stores のテストで見る）
+func TestStoreDispatch(t *testing.T) {
+	tests := []struct {
+		name  string
+		setup func(t *testing.T, dir string) (args map[string]any, env []string)
+		typ   string
+		want  map[string]any
+	}{
+		{
+			name: ".env",
+			typ:  ".env",
+			setup: func(t *testing.T, dir string) (map[string]any, []string) {
+				in := filepath.Join(dir, ".env")
+				require.NoError(t, os.WriteFile(in, []byte("USER=app\n"), 0o600))
+				return map[string]any{"input": in}, nil
+			},
+			want: map[string]any{"USER": "app"},
+		},
+		{
+			name: "dir",
+			typ:  "dir",
+			setup: func(t *testing.T, dir string) (map[string]any, []string) {
+				require.NoError(t, os.WriteFile(filepath.Join(dir, "db_password"), []byte("s3cret\n"), 0o600))
+				return map[string]any{"path": dir}, nil
+			},
+			want: map[string]any{"db_password": "s3cret"},
+		},
+		{
+			name: "command",
+			typ:  "command",
+			setup: func(t *testing.T, dir string) (map[string]any, []string) {
+				in := filepath.Join(dir, "creds.json")
+				require.NoError(t, os.WriteFile(in, []byte(`{"user": "app"}`), 0o600))
+				// 認証ヘルパーの代わりにこのバイナリの kvtool json を実行する
+				return map[string]any{
+					"command": []any{os.Args[0], "json", "-i", in},
+					"env":     map[string]any{"KVTOOL_TEST_MAIN": "1"},
+				}, nil
+			},
+			want: map[string]any{"user": "app"},
+		},
+		{
+			name: "local",
+			typ:  "local",
+			setup: func(t *testing.T, dir string) (map[string]any, []string) {
+				key := filepath.Join(dir, "key")
+				env := []string{
+					"KVTOOL_LOCAL_VAULT=" + filepath.Join(dir, "local.vault"),
+					"KVTOOL_LOCAL_KEY_FILE=" + key,
+					"KVTOOL_LOCAL_PASSPHRASE=",
+				}
+				_, stderr, err := kvtool(t, env, "local", "init", "-key-file", key)
+				require.NoError(t, err, stderr)
+				_, stderr, err = kvtool(t, env, "local", "set", "-ns", "app", "TOKEN", "s3cret")
+				require.NoError(t, err, stderr)
+				return map[string]any{"namespace": "app"}, env
+			},
+			want: map[string]any{"TOKEN": "s3cret"},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			args, env := tt.setup(t, t.TempDir())
+			cfg := storeConfig(t, "s", map[string]any{"type": tt.typ, "args": args})
+			require.Equal(t, tt.want, storeOutput(t, env, "-config", cfg, "s"))
+		})
+	}
+
+	cfg := storeConfig(t, "bad", map[string]any{"type": "no-such-type"})
+	_, stderr, err := kvtool(t, nil, "store", "-config", cfg, "bad")
+	require.Error(t, err)
+	require.Contains(t, stderr, `unknown store type "no-such-type"`)
+}
+
+func TestStoreAudit(t *testing.T) {
+	r := require.New(t)
+	dir := t.TempDir()
+	r.NoError(os.WriteFile(filepath.Join(dir, "token"), []byte("s3cret"), 0o600))
+	cfg := storeConfig(t, "mounted", map[string]any{"type": "dir", "args": map[string]any{"path": dir}})
+
+	// stdout の監査ログは値の出力を壊すので受け付けない
+	_, stderr, err := kvtool(t, []string{"KVTOOL_AUDIT=stdout"}, "store", "-config", cfg, "mounted")
+	r.Error(err)
+	r.Contains(stderr, "audit sink stdout")
+
+	// stderr なら出力は JSON のまま。鍵が無ければ警告する
+	stdout, stderr, err := kvtool(t, []string{"KVTOOL_AUDIT=stderr", "KVTOOL_AUDIT_HMAC_KEY="}, "store", "-config", cfg, "mounted")
+	r.NoError(err, stderr)
+	var out map[string]any
+	r.NoError(json.Unmarshal([]byte(stdout), &out), stdout)
+	r.Equal(map[string]any{"token": "s3cret"}, out)
+	r.Contains(stderr, `"keys":["token"]`)
+	r.Contains(stderr, "WARNING: audit entries are not signed")
+
+	_, stderr, err = kvtool(t, []string{"KVTOOL_AUDIT=stderr", "KVTOOL_AUDIT_HMAC_KEY=k"}, "store", "-config", cfg, "mounted")
+	r.NoError(err, stderr)
+	r.Contains(stderr, `"hmac":"hmac-sha256:`)
+	r.NotContains(stderr, "WARNING")
+}
@@ -0,0 +1,362 @@
+package agent
+
+import (
+	"bytes"
+	"context"
+	"crypto/sha256"
+	"errors"
+	"fmt"
+	"log"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"text/template"
+	"time"
+
+	"gopkg.in/yaml.v3"
+
+	"github.com/sasano8/kvtool/internal/fsutil"
+	"github.com/sasano8/kvtool/internal/stores"
+)
+
+// Config is the agent config file (agent.yml).
+type Config struct {
+	// ストアコンフィグ（.kvtool.json）のパス
+	Config     string        `yaml:"config"`
+	Interval   time.Duration `yaml:"interval"`
+	MaxBackoff time.Duration `yaml:"max_backoff"`
+	Templates  []Template    `yaml:"templates"`
+}
+
+// Template declares one template -> destination file.
+type Template struct {
+	Source      string `yaml:"source"`   // テンプレートファイル
+	Contents    string `yaml:"contents"` // インラインテンプレート（source と排他）
+	Destination string `yaml:"destination"`
+	Perms       string `yaml:"perms"` // 8進数表記（例: "0600"）
+
+	// レンダリング結果が変わった時だけ実行する（シェルは経由しない）
+	Command        []string      `yaml:"command"`
+	CommandTimeout time.Duration `yaml:"command_timeout"`
+}
+
+func LoadConfig(path string) (Config, error) {
+	b, err := os.ReadFile(path)
+	if err != nil {
+		return Config{}, fmt.Errorf("read %s: %w", path, err)
+	}
+
+	var cfg Config
+	if err := yaml.Unmarshal(b, &cfg); err != nil {
+		return Config{}, fmt.Errorf("parse yaml %s: %w", path, err)
+	}
+	if cfg.Config == "" {
+		cfg.Config = ".kvtool.json"
+	}
+	if cfg.Interval <= 0 {
+		cfg.Interval = time.Minute
+	}
+	if cfg.MaxBackoff <= 0 {
+		cfg.MaxBackoff = 5 * time.Minute
+	}
+	for i, t := range cfg.Templates {
+		if t.Destination == "" {
+			return Config{}, fmt.Errorf("templates[%d]: missing destination", i)
+		}
+		if (t.Source == "") == (t.Contents == "") {
+			return Config{}, fmt.Errorf("templates[%d]: specify exactly one of source or contents", i)
+		}
+		if _, err := t.mode(); err != nil {
+			return Config{}, fmt.Errorf("templates[%d]: %w", i, err)
+		}
+	}
+	return cfg, nil
+}
+
+func (t Template) mode() (os.FileMode, error) {
+	if t.Perms == "" {
+		return 0o644, nil
+	}
+	n, err := strconv.ParseUint(t.Perms, 8, 32)
+	if err != nil {
+		return 0, fmt.Errorf("invalid perms %q: %w", t.Perms, err)
+	}
+	return os.FileMode(n), nil
+}
+
+type Agent struct {
+	cfg    Config
+	stores stores.Config
+
+	// destination -> 最後に書き込んだ内容のハッシュ
+	rendered map[string][32]byte
+
+	Logger     *log.Logger
+	RunCommand func(ctx context.Context, argv []string) error
+}
+
+func New(cfg Config, sc stores.Config) *Agent {
+	return &Agent{
+		cfg:        cfg,
+		stores:     sc,
+		rendered:   map[string][32]byte{},
+		Logger:     log.New(os.Stderr, "agent: ", log.LstdFlags),
+		RunCommand: runCommand,
+	}
+}
+
+// Run renders every template until ctx is cancelled. Stores implementing
+// stores.Watcher trigger a new round when they change; if every store a
+// round read is watched the agent waits for them, otherwise it also polls
+// each interval. Failed rounds are retried with exponential backoff.
+func (a *Agent) Run(ctx context.Context) error {
+	wake := make(chan struct{}, 1)
+	watched := map[[2]string]bool{}
+	backoff := time.Duration(0)
+	for {
+		wait := a.cfg.Interval
+		_, opened, err := a.renderAll(ctx)
+		poll := err != nil
+		if err != nil {
+			if ctx.Err() != nil {
+				return nil
+			}
+			backoff = nextBackoff(backoff, a.cfg.MaxBackoff)
+			wait = backoff
+			a.Logger.Printf("render failed (retry in %s): %v", wait, err)
+		} else {
+			backoff = 0
+		}
+
+		for id, st := range opened {
+			if _, ok := st.(stores.Watcher); !ok {
+				poll = true
+				continue
+			}
+			if !watched[id] {
+				watched[id] = true
+				a.watch(ctx, id, st, wake)
+			}
+		}
+
+		// 全部 Watcher ならタイマーは使わず通知を待つ
+		timer := time.NewTimer(wait)
+		if !poll {
+			timer.Stop()
+		}
+		select {
+		case <-ctx.Done():
+			timer.Stop()
+			return nil
+		case <-timer.C:
+		case <-wake:
+			timer.Stop()
+		}
+	}
+}
+
+// watch は st が変わるたびに wake へ通知する（ctx が終わるまで）
+func (a *Agent) watch(ctx context.Context, id [2]string, st stores.Store, wake chan<- struct{}) {
+	trigger := stores.Changes(ctx, st, a.cfg.Interval, func(err error) {
+		a.Logger.Printf("watch %s/%s: %v", id[0], id[1], err)
+	})
+	go func() {
+		for {
+			select {
+			case <-ctx.Done():
+				return
+			case <-trigger:
+				select {
+				case wake <- struct{}{}:
+				default:
+				}
+			}
+		}
+	}()
+}
+
+func nextBackoff(cur, max time.Duration) time.Duration {
+	if cur <= 0 {
+		return time.Second
+	}
+	cur *= 2
+	if cur > max {
+		return max
+	}
+	return cur
+}
+
+// round は 1 回のレンダリングで読んだストア。同じラウンド内ではストアを1回だけ読む
+type round struct {
+	data   map[[2]string]map[string]any
+	opened map[[2]string]stores.Store
+}
+
+// RenderOnce renders all templates and returns the destinations that changed.
+// A failing template does not stop the others; the errors are joined.
+func (a *Agent) RenderOnce(ctx context.Context) ([]string, error) {
+	changed, _, err := a.renderAll(ctx)
+	return changed, err
+}
+
+func (a *Agent) renderAll(ctx context.Context) ([]string, map[[2]string]stores.Store, error) {
+	r := &round{data: map[[2]string]map[string]any{}, opened: map[[2]string]stores.Store{}}
+	var (
+		changed []string
+		errs    []error
+	)
+
+	for _, t := range a.cfg.Templates {
+		out, err := a.render(ctx, t, r)
+		if err != nil {
+			errs = append(errs, fmt.Errorf("render %s: %w", t.Destination, err))
+			continue
+		}
+
+		sum := sha256.Sum256(out)
+		prev, seen := a.rendered[t.Destination]
+		if seen && prev == sum {
+			continue
+		}
+		if !seen && sameFile(t.Destination, sum) {
+			// 起動直後で内容が既に一致しているならフックは走らせない
+			a.rendered[t.Destination] = sum
+			continue
+		}
+
+		mode, _ := t.mode()
+		if err := fsutil.WriteFileAtomic(t.Destination, out, mode); err != nil {
+			errs = append(errs, err)
+			continue
+		}
+		changed = append(changed, t.Destination)
+		a.Logger.Printf("rendered %s", t.Destination)
+
+		if len(t.Command) > 0 {
+			if err := a.runHook(ctx, t); err != nil {
+				// ゼロ値はどの内容のハッシュとも一致しないので、次のラウンドで書き込みとフックをやり直す
+				a.rendered[t.Destination] = [32]byte{}
+				errs = append(errs, fmt.Errorf("command for %s: %w", t.Destination, err))
+				continue
+			}
+		}
+		a.rendered[t.Destination] = sum
+	}
+	return changed, r.opened, errors.Join(errs...)
+}
+
+func (a *Agent) runHook(ctx context.Context, t Template) error {
+	if t.CommandTimeout > 0 {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeout(ctx, t.CommandTimeout)
+		defer cancel()
+	}
+	return a.RunCommand(ctx, t.Command)
+}
+
+func (a *Agent) render(ctx context.Context, t Template, r *round) ([]byte, error) {
+	src := t.Contents
+	name := t.Destination
+	if t.Source != "" {
+		b, err := os.ReadFile(t.Source)
+		if err != nil {
+			return nil, err
+		}
+		src = string(b)
+		name = filepath.Base(t.Source)
+	}
+
+	storeFn := func(ns, key string) (map[string]any, error) {
+		id := [2]string{ns, key}
+		if v, ok := r.data[id]; ok {
+			return v, nil
+		}
+		_, sc, err := a.stores.Lookup(ns, key)
+		if err != nil {
+			return nil, err
+		}
+		st, err := stores.Open(sc)
+		if err != nil {
+			return nil, err
+		}
+		r.opened[id] = st
+		data, err := st.Read(ctx)
+		if err != nil {
+			return nil, fmt.Errorf("read store %s/%s: %w", ns, key, err)
+		}
+		r.data[id] = data
+		return data, nil
+	}
+
+	funcs := template.FuncMap{
+		"store": storeFn,
+		"secret": func(ns, key, field string) (any, error) {
+			data, err := storeFn(ns, key)
+			if err != nil {
+				return nil, err
+			}
+			v, ok := data[field]
+			if !ok {
+				return nil, fmt.Errorf("key %q not found in store %s/%s", field, ns, key)
+			}
+			return v, nil
+		},
+		// {{ uri "vault://secret/app#password" }} のように URI で値を参照する
+		"uri": func(s string) (any, error) {
+			ref, err := stores.ParseRef(s)
+			if err != nil {
+				return nil, err
+			}
+			var data map[string]any
+			if ref.Namespace != "" {
+				data, err = storeFn(ref.Namespace, ref.StoreKey)
+			} else {
+				id := [2]string{"uri", strings.SplitN(s, "#", 2)[0]}
+				data = r.data[id]
+				if data == nil {
+					var st stores.Store
+					if st, err = stores.Open(ref.Store); err == nil {
+						r.opened[id] = st
+						data, err = st.Read(ctx)
+					}
+					if err != nil {
+						return nil, fmt.Errorf("read %s: %w", ref.Store.Name, err)
+					}
+					r.data[id] = data
+				}
+			}
+			if err != nil {
+				return nil, err
+			}
+			return ref.Value(data)
+		},
+		"env": os.Getenv,
+	}
+
+	tmpl, err := template.New(name).Option("missingkey=error").Funcs(funcs).Parse(src)
+	if err != nil {
+		return nil, err
+	}
+	var buf bytes.Buffer
+	if err := tmpl.Execute(&buf, nil); err != nil {
+		return nil, err
+	}
+	return buf.Bytes(), nil
+}
+
+func sameFile(path string, sum [32]byte) bool {
+	b, err := os.ReadFile(path)
+	if err != nil {
+		return false
+	}
+	return sha256.Sum256(b) == sum
+}
+
+func runCommand(ctx context.Context, argv []string) error {
+	cmd := exec.CommandContext(ctx, argv[0], argv[1:]...)
+	cmd.Stdout = os.Stderr
+	cmd.Stderr = os.Stderr
+	return cmd.Run()
+}
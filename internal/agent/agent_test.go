@@ -0,0 +1,208 @@
+package agent
+
+import (
+	"context"
+	"errors"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+
+	"github.com/sasano8/kvtool/internal/stores"
+)
+
+func TestRenderOnce(t *testing.T) {
+	r := require.New(t)
+	dir := t.TempDir()
+
+	envPath := filepath.Join(dir, ".env")
+	r.NoError(os.WriteFile(envPath, []byte("USER=alice\nPASSWORD=secret\n"), 0o644))
+
+	sc := stores.Config{
+		Namespaces: map[string]map[string]stores.StoreConfig{
+			"default": {
+				".env": {Type: ".env", Args: map[string]any{"input": envPath}},
+			},
+		},
+	}
+	dest := filepath.Join(dir, "out", "app.conf")
+	cfg := Config{
+		Templates: []Template{{
+			Contents:    `user={{ secret "default" ".env" "USER" }} pass={{ (store "default" ".env").PASSWORD }}`,
+			Destination: dest,
+			Perms:       "0600",
+			Command:     []string{"reload"},
+		}},
+	}
+
+	a := New(cfg, sc)
+	var hooks int
+	a.RunCommand = func(ctx context.Context, argv []string) error {
+		hooks++
+		return nil
+	}
+
+	changed, err := a.RenderOnce(context.Background())
+	r.NoError(err)
+	r.Equal([]string{dest}, changed)
+	r.Equal(1, hooks)
+
+	b, err := os.ReadFile(dest)
+	r.NoError(err)
+	r.Equal("user=alice pass=secret", string(b))
+
+	fi, err := os.Stat(dest)
+	r.NoError(err)
+	r.Equal(os.FileMode(0o600), fi.Mode().Perm())
+
+	// 値が変わらなければ書き込みもフックも発生しない
+	changed, err = a.RenderOnce(context.Background())
+	r.NoError(err)
+	r.Empty(changed)
+	r.Equal(1, hooks)
+
+	r.NoError(os.WriteFile(envPath, []byte("USER=bob\nPASSWORD=secret\n"), 0o644))
+	changed, err = a.RenderOnce(context.Background())
+	r.NoError(err)
+	r.Equal([]string{dest}, changed)
+	r.Equal(2, hooks)
+
+	// 再起動直後でファイル内容が一致していればフックは走らない
+	a2 := New(cfg, sc)
+	a2.RunCommand = a.RunCommand
+	changed, err = a2.RenderOnce(context.Background())
+	r.NoError(err)
+	r.Empty(changed)
+	r.Equal(2, hooks)
+}
+
+func TestRenderOnceMissingKey(t *testing.T) {
+	r := require.New(t)
+	dir := t.TempDir()
+
+	envPath := filepath.Join(dir, ".env")
+	r.NoError(os.WriteFile(envPath, []byte("USER=alice\n"), 0o644))
+
+	sc := stores.Config{
+		Namespaces: map[string]map[string]stores.StoreConfig{
+			"default": {".env": {Type: ".env", Args: map[string]any{"input": envPath}}},
+		},
+	}
+	dest := filepath.Join(dir, "app.conf")
+	a := New(Config{Templates: []Template{{
+		Contents:    `{{ secret "default" ".env" "NOPE" }}`,
+		Destination: dest,
+	}}}, sc)
+
+	_, err := a.RenderOnce(context.Background())
+	r.Error(err)
+	_, err = os.Stat(dest)
+	r.True(os.IsNotExist(err))
+}
+
+func TestRenderOnceHookFailure(t *testing.T) {
+	r := require.New(t)
+	dir := t.TempDir()
+
+	envPath := filepath.Join(dir, ".env")
+	r.NoError(os.WriteFile(envPath, []byte("USER=alice\n"), 0o644))
+	sc := stores.Config{
+		Namespaces: map[string]map[string]stores.StoreConfig{
+			"default": {".env": {Type: ".env", Args: map[string]any{"input": envPath}}},
+		},
+	}
+	dest := filepath.Join(dir, "app.conf")
+	broken := filepath.Join(dir, "broken.conf")
+	a := New(Config{Templates: []Template{
+		{Contents: `{{ secret "default" ".env" "NOPE" }}`, Destination: broken},
+		{Contents: `{{ secret "default" ".env" "USER" }}`, Destination: dest, Command: []string{"reload"}},
+	}}, sc)
+	hookErr := errors.New("reload failed")
+	a.RunCommand = func(ctx context.Context, argv []string) error { return hookErr }
+
+	// 1つ目のテンプレートが失敗しても2つ目は書き込まれ、エラーは両方返る
+	changed, err := a.RenderOnce(context.Background())
+	r.ErrorContains(err, broken)
+	r.ErrorIs(err, hookErr)
+	r.Equal([]string{dest}, changed)
+
+	// フックが成功するまで内容が同じでもやり直す
+	var hooks int
+	a.RunCommand = func(ctx context.Context, argv []string) error {
+		hooks++
+		return nil
+	}
+	changed, err = a.RenderOnce(context.Background())
+	r.Error(err)
+	r.Equal([]string{dest}, changed)
+	r.Equal(1, hooks)
+
+	changed, _ = a.RenderOnce(context.Background())
+	r.Empty(changed)
+	r.Equal(1, hooks)
+}
+
+func TestRunWatch(t *testing.T) {
+	r := require.New(t)
+	dir := t.TempDir()
+
+	envPath := filepath.Join(dir, ".env")
+	r.NoError(os.WriteFile(envPath, []byte("USER=alice\n"), 0o644))
+	sc := stores.Config{
+		Namespaces: map[string]map[string]stores.StoreConfig{
+			"default": {".env": {Type: ".env", Args: map[string]any{"input": envPath}}},
+		},
+	}
+	dest := filepath.Join(dir, "app.conf")
+	// ポーリングでは間に合わない間隔にして、通知で再レンダリングされることを見る
+	a := New(Config{Interval: time.Hour, Templates: []Template{
+		{Contents: `{{ secret "default" ".env" "USER" }}`, Destination: dest},
+	}}, sc)
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	go func() { _ = a.Run(ctx) }()
+
+	read := func() string {
+		b, _ := os.ReadFile(dest)
+		return string(b)
+	}
+	r.Eventually(func() bool { return read() == "alice" }, 5*time.Second, 20*time.Millisecond)
+	r.NoError(os.WriteFile(envPath, []byte("USER=bob\n"), 0o644))
+	r.Eventually(func() bool { return read() == "bob" }, 5*time.Second, 20*time.Millisecond)
+}
+
+func TestNextBackoff(t *testing.T) {
+	r := require.New(t)
+	r.Equal(1e9, float64(nextBackoff(0, 1e10)))
+	r.Equal(2e9, float64(nextBackoff(1e9, 1e10)))
+	r.Equal(1e10, float64(nextBackoff(8e9, 1e10)))
+}
+
+func TestRenderURI(t *testing.T) {
+	r := require.New(t)
+	dir := t.TempDir()
+
+	envPath := filepath.Join(dir, ".env")
+	r.NoError(os.WriteFile(envPath, []byte("DB_HOST=db\n"), 0o644))
+	t.Setenv("KVTOOL_AGENT_TEST", "prod")
+
+	sc := stores.Config{
+		Namespaces: map[string]map[string]stores.StoreConfig{
+			"default": {".env": {Type: ".env", Args: map[string]any{"input": envPath}}},
+		},
+	}
+	dest := filepath.Join(dir, "app.conf")
+	a := New(Config{Templates: []Template{{
+		Contents:    `{{ uri "dotenv://` + envPath + `#DB_HOST" }} {{ uri "kv://default/.env/DB_HOST" }} {{ uri "env://KVTOOL_AGENT_TEST" }}`,
+		Destination: dest,
+	}}}, sc)
+
+	_, err := a.RenderOnce(context.Background())
+	r.NoError(err)
+	b, err := os.ReadFile(dest)
+	r.NoError(err)
+	r.Equal("db db prod", string(b))
+}
@@ -0,0 +1,173 @@
+// Package audit writes a JSON-lines audit trail of secret access.
+// Entries record which keys were returned, never their values.
+package audit
+
+import (
+	"context"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+)
+
+const (
+	OutcomeSuccess = "success"
+	OutcomeDenied  = "denied"
+	OutcomeError   = "error"
+)
+
+// ErrAuditFailed is returned when no sink could record an entry.
+// Like Vault, callers must then fail the request instead of serving it.
+var ErrAuditFailed = errors.New("audit log failed")
+
+type Entry struct {
+	Time       time.Time `json:"time"`
+	Identity   string    `json:"identity"`
+	AuthMethod string    `json:"auth_method,omitempty"`
+	Command    string    `json:"command"`   // serve, store, ...
+	Operation  string    `json:"operation"` // read, list, write, delete, watch
+	Namespace  string    `json:"namespace,omitempty"`
+	Store      string    `json:"store,omitempty"`
+	Path       string    `json:"path,omitempty"`
+	Keys       []string  `json:"keys,omitempty"`
+	Outcome    string    `json:"outcome"`
+	Error      string    `json:"error,omitempty"`
+	DurationMS float64   `json:"duration_ms"`
+	HMAC       string    `json:"hmac,omitempty"`
+}
+
+// Sink receives one JSON line (without the trailing newline) per entry.
+type Sink interface {
+	Write(line []byte) error
+	Close() error
+}
+
+type Logger struct {
+	sinks []Sink
+	key   []byte
+}
+
+// New returns a Logger writing to every sink. If key is not empty each entry
+// carries an HMAC-SHA256 of its own JSON encoding (see Verify).
+func New(key []byte, sinks ...Sink) *Logger {
+	return &Logger{sinks: sinks, key: key}
+}
+
+// Signed reports whether entries carry an HMAC.
+func (l *Logger) Signed() bool {
+	return l != nil && len(l.key) > 0
+}
+
+// Log writes e to the sinks. It fails only if no sink accepted the entry.
+func (l *Logger) Log(ctx context.Context, e Entry) error {
+	if l == nil {
+		return nil
+	}
+	if e.Time.IsZero() {
+		e.Time = time.Now().UTC()
+	}
+	e.Keys = append([]string(nil), e.Keys...)
+	sort.Strings(e.Keys)
+
+	line, err := l.encode(e)
+	if err != nil {
+		return fmt.Errorf("%w: %v", ErrAuditFailed, err)
+	}
+
+	var errs []error
+	for _, s := range l.sinks {
+		if err := s.Write(line); err != nil {
+			errs = append(errs, err)
+		}
+	}
+	if len(l.sinks) > 0 && len(errs) == len(l.sinks) {
+		return fmt.Errorf("%w: %w", ErrAuditFailed, errors.Join(errs...))
+	}
+	return nil
+}
+
+func (l *Logger) encode(e Entry) ([]byte, error) {
+	e.HMAC = ""
+	b, err := json.Marshal(e)
+	if err != nil || len(l.key) == 0 {
+		return b, err
+	}
+	e.HMAC = "hmac-sha256:" + sign(l.key, b)
+	return json.Marshal(e)
+}
+
+func sign(key, b []byte) string {
+	m := hmac.New(sha256.New, key)
+	m.Write(b)
+	return hex.EncodeToString(m.Sum(nil))
+}
+
+// Verify checks the HMAC of one audit line.
+func Verify(key, line []byte) error {
+	var e Entry
+	if err := json.Unmarshal(line, &e); err != nil {
+		return err
+	}
+	got, ok := strings.CutPrefix(e.HMAC, "hmac-sha256:")
+	if !ok {
+		return errors.New("audit entry has no hmac")
+	}
+	e.HMAC = ""
+	b, err := json.Marshal(e)
+	if err != nil {
+		return err
+	}
+	if !hmac.Equal([]byte(got), []byte(sign(key, b))) {
+		return errors.New("audit entry hmac mismatch")
+	}
+	return nil
+}
+
+func (l *Logger) Close() error {
+	if l == nil {
+		return nil
+	}
+	var errs []error
+	for _, s := range l.sinks {
+		if err := s.Close(); err != nil {
+			errs = append(errs, err)
+		}
+	}
+	return errors.Join(errs...)
+}
+
+// writerSink はファイルや stdout 向け。複数 goroutine から呼ばれるのでロックする
+type writerSink struct {
+	mu    sync.Mutex
+	w     interface{ Write([]byte) (int, error) }
+	sync  func() error
+	close func() error
+}
+
+func (s *writerSink) Write(line []byte) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	buf := make([]byte, 0, len(line)+1)
+	buf = append(append(buf, line...), '\n')
+	if _, err := s.w.Write(buf); err != nil {
+		return err
+	}
+	if s.sync != nil {
+		return s.sync()
+	}
+	return nil
+}
+
+func (s *writerSink) Close() error {
+	if s.close != nil {
+		return s.close()
+	}
+	return nil
+}
@@ -0,0 +1,125 @@
+package audit
+
+import (
+	"bufio"
+	"context"
+	"errors"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+type memSink struct {
+	lines []string
+	err   error
+}
+
+func (s *memSink) Write(line []byte) error {
+	if s.err != nil {
+		return s.err
+	}
+	s.lines = append(s.lines, string(line))
+	return nil
+}
+
+func (s *memSink) Close() error { return nil }
+
+func TestLogHMAC(t *testing.T) {
+	r := require.New(t)
+	key := []byte("k")
+	sink := &memSink{}
+	l := New(key, sink)
+
+	r.NoError(l.Log(context.Background(), Entry{
+		Identity:  "ci",
+		Command:   "serve",
+		Operation: "read",
+		Path:      "default/vault",
+		Keys:      []string{"username", "password"},
+		Outcome:   OutcomeSuccess,
+	}))
+	r.Len(sink.lines, 1)
+	line := sink.lines[0]
+	r.Contains(line, `"keys":["password","username"]`)
+	r.Contains(line, `"hmac":"hmac-sha256:`)
+	r.NoError(Verify(key, []byte(line)))
+
+	// 改ざんや鍵違いは検出できる
+	r.Error(Verify(key, []byte(strings.Replace(line, `"ci"`, `"admin"`, 1))))
+	r.Error(Verify([]byte("other"), []byte(line)))
+}
+
+func TestLogSinkFailure(t *testing.T) {
+	r := require.New(t)
+	ok := &memSink{}
+	bad := &memSink{err: errors.New("disk full")}
+
+	// 1つでも書ければ成功
+	r.NoError(New(nil, bad, ok).Log(context.Background(), Entry{Outcome: OutcomeSuccess}))
+	r.Len(ok.lines, 1)
+	r.NotContains(ok.lines[0], "hmac")
+
+	err := New(nil, bad, &memSink{err: errors.New("closed")}).Log(context.Background(), Entry{})
+	r.ErrorIs(err, ErrAuditFailed)
+
+	var nilLogger *Logger
+	r.NoError(nilLogger.Log(context.Background(), Entry{}))
+}
+
+func TestOpenFileSink(t *testing.T) {
+	r := require.New(t)
+	p := filepath.Join(t.TempDir(), "audit.log")
+
+	l, err := Open("file:"+p, "")
+	r.NoError(err)
+	r.NoError(l.Log(context.Background(), Entry{Identity: "a"}))
+	r.NoError(l.Log(context.Background(), Entry{Identity: "b"}))
+	r.NoError(l.Close())
+
+	f, err := os.Open(p)
+	r.NoError(err)
+	defer f.Close()
+	var n int
+	for sc := bufio.NewScanner(f); sc.Scan(); n++ {
+		r.True(strings.HasPrefix(sc.Text(), "{"))
+	}
+	r.Equal(2, n)
+
+	fi, err := os.Stat(p)
+	r.NoError(err)
+	r.Equal(os.FileMode(0o600), fi.Mode().Perm())
+
+	r.False(l.Signed())
+
+	_, err = Open("nope", "")
+	r.Error(err)
+	l, err = Open("", "")
+	r.NoError(err)
+	r.Nil(l)
+}
+
+func TestOpenHMACKey(t *testing.T) {
+	r := require.New(t)
+	dir := t.TempDir()
+	keyFile := filepath.Join(dir, "hmac.key")
+	r.NoError(os.WriteFile(keyFile, []byte("k\n"), 0o600))
+
+	l, err := Open("stderr", keyFile)
+	r.NoError(err)
+	r.True(l.Signed())
+	r.NoError(l.Close())
+
+	// 空の鍵ファイルは署名なしにせずエラーにする
+	empty := filepath.Join(dir, "empty.key")
+	r.NoError(os.WriteFile(empty, []byte("\n"), 0o600))
+	_, err = Open("stderr", empty)
+	r.ErrorContains(err, "is empty")
+
+	t.Setenv("KVTOOL_AUDIT_HMAC_KEY", "k")
+	l, err = Open("stderr", "")
+	r.NoError(err)
+	r.True(l.Signed())
+}
@@ -0,0 +1,77 @@
+package audit
+
+import (
+	"fmt"
+	"os"
+	"strings"
+)
+
+// OpenSink opens a sink from its spec:
+//
+//	stdout
+//	stderr
+//	file:<path>
+//	syslog[:<tag>]
+func OpenSink(spec string) (Sink, error) {
+	kind, arg, _ := strings.Cut(spec, ":")
+	switch kind {
+	case "stdout":
+		return &writerSink{w: os.Stdout}, nil
+	case "stderr":
+		return &writerSink{w: os.Stderr}, nil
+	case "file":
+		if arg == "" {
+			return nil, fmt.Errorf("audit sink %q: missing path", spec)
+		}
+		f, err := os.OpenFile(arg, os.O_WRONLY|os.O_APPEND|os.O_CREATE, 0o600)
+		if err != nil {
+			return nil, fmt.Errorf("audit sink %q: %w", spec, err)
+		}
+		// 監査ログはリクエストの成否に関わるので毎回ディスクに落とす
+		return &writerSink{w: f, sync: f.Sync, close: f.Close}, nil
+	case "syslog":
+		if arg == "" {
+			arg = "kvtool"
+		}
+		return openSyslog(arg)
+	default:
+		return nil, fmt.Errorf("unknown audit sink %q (stdout, stderr, file:<path>, syslog[:<tag>])", spec)
+	}
+}
+
+// Open builds a Logger from comma separated sink specs and an optional HMAC key file.
+// An empty spec returns a nil Logger, which logs nothing. Without a key file
+// or KVTOOL_AUDIT_HMAC_KEY the entries are not signed; see Logger.Signed.
+func Open(specs, hmacKeyFile string) (*Logger, error) {
+	if specs == "" {
+		return nil, nil
+	}
+
+	var key []byte
+	if hmacKeyFile != "" {
+		b, err := os.ReadFile(hmacKeyFile)
+		if err != nil {
+			return nil, fmt.Errorf("read audit hmac key: %w", err)
+		}
+		key = []byte(strings.TrimSpace(string(b)))
+		// 空の鍵で黙って署名なしになるのを防ぐ
+		if len(key) == 0 {
+			return nil, fmt.Errorf("audit hmac key %s is empty", hmacKeyFile)
+		}
+	} else if k := os.Getenv("KVTOOL_AUDIT_HMAC_KEY"); k != "" {
+		key = []byte(k)
+	}
+
+	var sinks []Sink
+	for _, spec := range strings.Split(specs, ",") {
+		s, err := OpenSink(strings.TrimSpace(spec))
+		if err != nil {
+			for _, opened := range sinks {
+				_ = opened.Close()
+			}
+			return nil, err
+		}
+		sinks = append(sinks, s)
+	}
+	return New(key, sinks...), nil
+}
@@ -0,0 +1,9 @@
+//go:build windows || plan9
+
+package audit
+
+import "errors"
+
+func openSyslog(tag string) (Sink, error) {
+	return nil, errors.New("syslog audit sink is not supported on this platform")
+}
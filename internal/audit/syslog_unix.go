@@ -0,0 +1,27 @@
+//go:build !windows && !plan9
+
+package audit
+
+import (
+	"log/syslog"
+)
+
+type syslogSink struct {
+	w *syslog.Writer
+}
+
+func openSyslog(tag string) (Sink, error) {
+	w, err := syslog.New(syslog.LOG_INFO|syslog.LOG_AUTH, tag)
+	if err != nil {
+		return nil, err
+	}
+	return &syslogSink{w: w}, nil
+}
+
+func (s *syslogSink) Write(line []byte) error {
+	return s.w.Info(string(line))
+}
+
+func (s *syslogSink) Close() error {
+	return s.w.Close()
+}
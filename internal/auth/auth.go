@@ -0,0 +1,62 @@
+package auth
+
+import (
+	"context"
+	"crypto/tls"
+	"fmt"
+	"net/http"
+	"strings"
+)
+
+// Identity is who made a request.
+type Identity struct {
+	Name   string `json:"name"`   // token 名, "cert:<CN>" または "anonymous"
+	Method string `json:"method"` // token, cert, anonymous
+}
+
+var Anonymous = Identity{Name: "anonymous", Method: "anonymous"}
+
+// Authenticate identifies the request by its bearer token, or else by its
+// verified TLS client certificate. A request with neither is anonymous;
+// an unknown token is rejected rather than downgraded to anonymous.
+func (p *Policy) Authenticate(r *http.Request) (Identity, error) {
+	return p.AuthenticateCredentials(r.Header.Get("Authorization"), r.TLS)
+}
+
+// AuthenticateCredentials is Authenticate for any transport: authorization
+// is the value of the Authorization header (gRPC metadata "authorization")
+// and state the TLS state of the connection, nil without TLS.
+func (p *Policy) AuthenticateCredentials(authorization string, state *tls.ConnectionState) (Identity, error) {
+	if authorization != "" {
+		token, ok := strings.CutPrefix(authorization, "Bearer ")
+		if !ok {
+			return Identity{}, fmt.Errorf("%w: unsupported Authorization scheme", ErrUnauthenticated)
+		}
+		name, ok := p.lookupToken(strings.TrimSpace(token))
+		if !ok {
+			return Identity{}, fmt.Errorf("%w: invalid token", ErrUnauthenticated)
+		}
+		return Identity{Name: name, Method: "token"}, nil
+	}
+
+	// VerifiedChains は ClientCAs で検証できた証明書がある時だけ入る
+	if state != nil && len(state.VerifiedChains) > 0 && len(state.VerifiedChains[0]) > 0 {
+		cn := state.VerifiedChains[0][0].Subject.CommonName
+		return Identity{Name: "cert:" + cn, Method: "cert"}, nil
+	}
+	return Anonymous, nil
+}
+
+type ctxKey struct{}
+
+func NewContext(ctx context.Context, id Identity) context.Context {
+	return context.WithValue(ctx, ctxKey{}, id)
+}
+
+// FromContext returns the identity stored by NewContext, or Anonymous.
+func FromContext(ctx context.Context) Identity {
+	if id, ok := ctx.Value(ctxKey{}).(Identity); ok {
+		return id
+	}
+	return Anonymous
+}
@@ -0,0 +1,239 @@
+// Package auth authenticates KV server requests and evaluates ACL policies.
+package auth
+
+import (
+	"crypto/sha256"
+	"crypto/subtle"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"os"
+	"slices"
+	"strings"
+
+	"gopkg.in/yaml.v3"
+)
+
+var (
+	ErrUnauthenticated  = errors.New("unauthenticated")
+	ErrPermissionDenied = errors.New("permission denied")
+)
+
+type Capability string
+
+const (
+	CapRead  Capability = "read"
+	CapList  Capability = "list"
+	CapWrite Capability = "write"
+	// deny は他のルールの許可より優先する
+	CapDeny Capability = "deny"
+)
+
+// Policy is the policy file of "kvtool serve -policy".
+//
+//	tokens:
+//	  - name: ci
+//	    token_sha256: "<hex of sha256(token)>"
+//	rules:
+//	  - identities: ["ci", "cert:deploy-bot"]
+//	    paths: ["default/**"]
+//	    capabilities: [read, list]
+//	  - identities: ["ci"]
+//	    paths: ["default/.env/PASSWORD"]
+//	    capabilities: [deny]
+//
+// A deny rule also hides the values it matches from reads of the paths
+// above them (see Filter).
+type Policy struct {
+	Tokens []Token `yaml:"tokens"`
+	Rules  []Rule  `yaml:"rules"`
+}
+
+type Token struct {
+	Name string `yaml:"name"`
+	// どちらか一方。平文の token はテスト用途を想定
+	Token       string `yaml:"token"`
+	TokenSHA256 string `yaml:"token_sha256"`
+}
+
+type Rule struct {
+	// "<token name>", "cert:<CN>", "anonymous" または glob
+	Identities   []string     `yaml:"identities"`
+	Paths        []string     `yaml:"paths"`
+	Capabilities []Capability `yaml:"capabilities"`
+}
+
+func LoadPolicy(path string) (*Policy, error) {
+	b, err := os.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("read %s: %w", path, err)
+	}
+	var p Policy
+	if err := yaml.Unmarshal(b, &p); err != nil {
+		return nil, fmt.Errorf("parse yaml %s: %w", path, err)
+	}
+	if err := p.validate(); err != nil {
+		return nil, fmt.Errorf("%s: %w", path, err)
+	}
+	return &p, nil
+}
+
+func (p *Policy) validate() error {
+	for i, t := range p.Tokens {
+		if t.Name == "" {
+			return fmt.Errorf("tokens[%d]: missing name", i)
+		}
+		if (t.Token == "") == (t.TokenSHA256 == "") {
+			return fmt.Errorf("tokens[%d]: specify exactly one of token or token_sha256", i)
+		}
+		if t.TokenSHA256 != "" {
+			if b, err := hex.DecodeString(t.TokenSHA256); err != nil || len(b) != sha256.Size {
+				return fmt.Errorf("tokens[%d]: token_sha256 must be 64 hex chars", i)
+			}
+		}
+	}
+	for i, r := range p.Rules {
+		for _, c := range r.Capabilities {
+			switch c {
+			case CapRead, CapList, CapWrite, CapDeny:
+			default:
+				return fmt.Errorf("rules[%d]: unknown capability %q", i, c)
+			}
+		}
+	}
+	return nil
+}
+
+// lookupToken は定数時間でトークンを照合し、一致した名前を返す
+func (p *Policy) lookupToken(token string) (string, bool) {
+	sum := sha256.Sum256([]byte(token))
+	name, found := "", false
+	for _, t := range p.Tokens {
+		want := t.TokenSHA256
+		if t.Token != "" {
+			s := sha256.Sum256([]byte(t.Token))
+			want = hex.EncodeToString(s[:])
+		}
+		wb, _ := hex.DecodeString(want)
+		if subtle.ConstantTimeCompare(sum[:], wb) == 1 && !found {
+			name, found = t.Name, true
+		}
+	}
+	return name, found
+}
+
+// Allowed reports whether id may use capability c on path ("<ns>/<store>/<key>").
+func (p *Policy) Allowed(id Identity, c Capability, path string) bool {
+	path = strings.Trim(path, "/")
+	allowed := false
+	for _, r := range p.Rules {
+		if !matchAny(r.Identities, id.Name) || !matchAny(r.Paths, path) {
+			continue
+		}
+		for _, rc := range r.Capabilities {
+			switch rc {
+			case CapDeny:
+				return false
+			case c:
+				allowed = true
+			}
+		}
+	}
+	return allowed
+}
+
+// Denied reports whether a deny rule for id matches path.
+func (p *Policy) Denied(id Identity, path string) bool {
+	path = strings.Trim(path, "/")
+	for _, r := range p.Rules {
+		if matchAny(r.Identities, id.Name) && matchAny(r.Paths, path) && slices.Contains(r.Capabilities, CapDeny) {
+			return true
+		}
+	}
+	return false
+}
+
+// Filter returns v, the value at path, without the object entries that a
+// deny rule for id matches, checking nested objects too. A capability on a
+// path covers the values below it, so this is what keeps a denied key out of
+// a whole-store read, a list or a watch. hidden reports whether anything was
+// removed.
+func (p *Policy) Filter(id Identity, path string, v any) (out any, hidden bool) {
+	m, ok := v.(map[string]any)
+	if !ok {
+		return v, false
+	}
+	path = strings.Trim(path, "/")
+	res := make(map[string]any, len(m))
+	for k, x := range m {
+		sub := k
+		if path != "" {
+			sub = path + "/" + k
+		}
+		if p.Denied(id, sub) {
+			hidden = true
+			continue
+		}
+		x, h := p.Filter(id, sub, x)
+		res[k], hidden = x, hidden || h
+	}
+	return res, hidden
+}
+
+// Authorize is Allowed returning ErrPermissionDenied.
+func (p *Policy) Authorize(id Identity, c Capability, path string) error {
+	if !p.Allowed(id, c, path) {
+		return fmt.Errorf("%w: %s cannot %s %q", ErrPermissionDenied, id.Name, c, path)
+	}
+	return nil
+}
+
+func matchAny(patterns []string, s string) bool {
+	for _, p := range patterns {
+		if Match(strings.Trim(p, "/"), s) {
+			return true
+		}
+	}
+	return false
+}
+
+// Match reports whether s matches the glob pattern.
+// "*" matches within a path segment, "**" matches across segments
+// (including none, so "default/**" also matches "default").
+func Match(pattern, s string) bool {
+	if pattern == "" {
+		return s == ""
+	}
+	if strings.HasPrefix(pattern, "**") {
+		rest := strings.TrimPrefix(strings.TrimPrefix(pattern, "**"), "/")
+		if rest == "" {
+			return true
+		}
+		for i := 0; i <= len(s); i++ {
+			if (i == 0 || s[i-1] == '/') && Match(rest, s[i:]) {
+				return true
+			}
+		}
+		return false
+	}
+	if strings.HasPrefix(pattern, "/**") && s == "" {
+		return true
+	}
+
+	switch pattern[0] {
+	case '*':
+		for i := 0; i <= len(s); i++ {
+			if i > 0 && s[i-1] == '/' {
+				break
+			}
+			if Match(pattern[1:], s[i:]) {
+				return true
+			}
+		}
+		return false
+	case '?':
+		return s != "" && s[0] != '/' && Match(pattern[1:], s[1:])
+	default:
+		return s != "" && s[0] == pattern[0] && Match(pattern[1:], s[1:])
+	}
+}
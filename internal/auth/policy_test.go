@@ -0,0 +1,169 @@
+package auth
+
+import (
+	"crypto/sha256"
+	"crypto/tls"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/hex"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestMatch(t *testing.T) {
+	tests := []struct {
+		pattern string
+		s       string
+		want    bool
+	}{
+		{"default/.env", "default/.env", true},
+		{"default/.env", "default/.env/A", false},
+		{"default/*", "default/.env", true},
+		{"default/*", "default/.env/A", false},
+		{"default/*/A", "default/vault/A", true},
+		{"default/**", "default", true},
+		{"default/**", "default/vault", true},
+		{"default/**", "default/vault/password", true},
+		{"default/**", "defaults/vault", false},
+		{"**", "", true},
+		{"**/password", "prod/vault/password", true},
+		{"**/password", "prod/vault/password2", false},
+		{"prod/vault/DB_*", "prod/vault/DB_HOST", true},
+		{"prod/vault/DB_?", "prod/vault/DB_X", true},
+		{"prod/vault/DB_?", "prod/vault/DB_XY", false},
+		{"cert:*", "cert:deploy-bot", true},
+		{"", "", true},
+		{"", "a", false},
+	}
+	for _, tt := range tests {
+		require.Equal(t, tt.want, Match(tt.pattern, tt.s), "Match(%q, %q)", tt.pattern, tt.s)
+	}
+}
+
+func TestAllowed(t *testing.T) {
+	p := &Policy{Rules: []Rule{
+		{Identities: []string{"ci"}, Paths: []string{"default/**"}, Capabilities: []Capability{CapRead, CapList}},
+		{Identities: []string{"ci"}, Paths: []string{"default/vault/root_*"}, Capabilities: []Capability{CapDeny}},
+		{Identities: []string{"admin"}, Paths: []string{"**"}, Capabilities: []Capability{CapRead, CapList, CapWrite}},
+		{Identities: []string{"cert:*"}, Paths: []string{"prod/app", "prod/app/*"}, Capabilities: []Capability{CapRead}},
+		{Identities: []string{"anonymous"}, Paths: []string{""}, Capabilities: []Capability{CapList}},
+	}}
+
+	tests := []struct {
+		name string
+		id   string
+		cap  Capability
+		path string
+		want bool
+	}{
+		{"read in namespace", "ci", CapRead, "default/vault/password", true},
+		{"read whole store", "ci", CapRead, "default/vault", true},
+		{"list namespace", "ci", CapList, "default", true},
+		{"no write", "ci", CapWrite, "default/vault/password", false},
+		{"deny wins", "ci", CapRead, "default/vault/root_token", false},
+		{"other namespace", "ci", CapRead, "prod/app", false},
+		{"admin writes anywhere", "admin", CapWrite, "prod/app/x", true},
+		{"cert read", "cert:deploy-bot", CapRead, "prod/app/DB", true},
+		{"cert no list", "cert:deploy-bot", CapList, "prod/app", false},
+		{"cert not nested", "cert:deploy-bot", CapRead, "prod/app/a/b", false},
+		{"anonymous root list", "anonymous", CapList, "/", true},
+		{"anonymous read", "anonymous", CapRead, "default/vault", false},
+		{"unknown identity", "mallory", CapRead, "default/vault", false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			id := Identity{Name: tt.id}
+			require.Equal(t, tt.want, p.Allowed(id, tt.cap, tt.path))
+			err := p.Authorize(id, tt.cap, tt.path)
+			require.Equal(t, !tt.want, errors.Is(err, ErrPermissionDenied))
+		})
+	}
+}
+
+func TestFilter(t *testing.T) {
+	r := require.New(t)
+	p := &Policy{Rules: []Rule{
+		{Identities: []string{"ci"}, Paths: []string{"default/**"}, Capabilities: []Capability{CapRead, CapList}},
+		{Identities: []string{"ci"}, Paths: []string{"default/vault/root_*", "default/vault/db/password"}, Capabilities: []Capability{CapDeny}},
+	}}
+	ci := Identity{Name: "ci"}
+	data := map[string]any{
+		"root_token": "x",
+		"user":       "app",
+		"db":         map[string]any{"host": "db.local", "password": "s3cret"},
+	}
+
+	// ストア全体を読んでも deny されたキーは返らない
+	got, hidden := p.Filter(ci, "default/vault", data)
+	r.True(hidden)
+	r.Equal(map[string]any{"user": "app", "db": map[string]any{"host": "db.local"}}, got)
+	r.Len(data, 3, "input is not modified")
+
+	got, hidden = p.Filter(ci, "default/vault/db", data["db"])
+	r.True(hidden)
+	r.Equal(map[string]any{"host": "db.local"}, got)
+
+	got, hidden = p.Filter(ci, "default/vault/user", "app")
+	r.False(hidden)
+	r.Equal("app", got)
+
+	got, hidden = p.Filter(Identity{Name: "admin"}, "default/vault", data)
+	r.False(hidden)
+	r.Equal(data, got)
+}
+
+func TestAuthenticate(t *testing.T) {
+	sum := sha256.Sum256([]byte("s3cret"))
+	p := &Policy{Tokens: []Token{
+		{Name: "ci", TokenSHA256: hex.EncodeToString(sum[:])},
+		{Name: "dev", Token: "plain"},
+	}}
+	require.NoError(t, p.validate())
+
+	certReq := httptest.NewRequest("GET", "/", nil)
+	certReq.TLS = &tls.ConnectionState{VerifiedChains: [][]*x509.Certificate{{
+		{Subject: pkix.Name{CommonName: "deploy-bot"}},
+	}}}
+	unverified := httptest.NewRequest("GET", "/", nil)
+	unverified.TLS = &tls.ConnectionState{PeerCertificates: []*x509.Certificate{
+		{Subject: pkix.Name{CommonName: "mallory"}},
+	}}
+
+	cases := []struct {
+		name    string
+		header  string
+		req     *http.Request
+		want    Identity
+		wantErr bool
+	}{
+		{name: "hashed token", header: "Bearer s3cret", want: Identity{Name: "ci", Method: "token"}},
+		{name: "plain token", header: "Bearer plain", want: Identity{Name: "dev", Method: "token"}},
+		{name: "bad token", header: "Bearer nope", wantErr: true},
+		{name: "bad scheme", header: "Basic Zm9vOmJhcg==", wantErr: true},
+		{name: "no credentials", want: Anonymous},
+		{name: "verified cert", req: certReq, want: Identity{Name: "cert:deploy-bot", Method: "cert"}},
+		{name: "unverified cert", req: unverified, want: Anonymous},
+	}
+	for _, tt := range cases {
+		t.Run(tt.name, func(t *testing.T) {
+			r := httptest.NewRequest("GET", "/", nil)
+			if tt.req != nil {
+				r = tt.req
+			}
+			if tt.header != "" {
+				r.Header.Set("Authorization", tt.header)
+			}
+			id, err := p.Authenticate(r)
+			if tt.wantErr {
+				require.ErrorIs(t, err, ErrUnauthenticated)
+				return
+			}
+			require.NoError(t, err)
+			require.Equal(t, tt.want, id)
+		})
+	}
+}
@@ -0,0 +1,255 @@
+// Package client talks to the KV service served by "kvtool serve".
+package client
+
+import (
+	"bytes"
+	"context"
+	"crypto/tls"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+	"sync"
+
+	"google.golang.org/grpc"
+
+	"github.com/sasano8/kvtool/internal/kvapi"
+	"github.com/sasano8/kvtool/internal/kvpb"
+)
+
+var (
+	// ErrIntegrity は受信したストリームが FileMetaFinal と一致しない（破損・途中切断）ことを示す
+	ErrIntegrity = errors.New("integrity check failed")
+	ErrNotFound  = errors.New("not found")
+	// 401/403。再試行しても結果は変わらない
+	ErrUnauthenticated  = errors.New("unauthenticated")
+	ErrPermissionDenied = errors.New("permission denied")
+)
+
+// Client speaks gRPC to the server and falls back to the HTTP mapping
+// when the server (or a proxy in between) does not accept gRPC.
+type Client struct {
+	BaseURL string
+	HTTP    *http.Client
+	// 空でなければ Authorization: Bearer で送る（gRPC では metadata）
+	Token string
+	// gRPC の TLS 設定。https の BaseURL で nil ならシステムの CA で検証する
+	TLS *tls.Config
+	// ProtocolGRPC, ProtocolHTTP または空（gRPC を試し、使えなければ HTTP）
+	Protocol string
+
+	mu   sync.Mutex
+	conn *grpc.ClientConn
+	// gRPC が使えないと分かったら以降は HTTP だけを使う
+	httpOnly bool
+}
+
+func New(baseURL string) *Client {
+	if !strings.Contains(baseURL, "://") {
+		baseURL = "http://" + baseURL
+	}
+	return &Client{
+		BaseURL: strings.TrimRight(baseURL, "/"),
+		HTTP:    http.DefaultClient,
+	}
+}
+
+func (c *Client) newRequest(ctx context.Context, method, prefix, path string, q url.Values) (*http.Request, error) {
+	req, err := http.NewRequestWithContext(ctx, method, c.url(prefix, path, q), nil)
+	if err != nil {
+		return nil, err
+	}
+	if c.Token != "" {
+		req.Header.Set("Authorization", "Bearer "+c.Token)
+	}
+	return req, nil
+}
+
+func (c *Client) url(prefix, path string, q url.Values) string {
+	u := c.BaseURL + prefix + strings.TrimLeft(path, "/")
+	if len(q) > 0 {
+		u += "?" + q.Encode()
+	}
+	return u
+}
+
+// Get reads path and verifies its length and hash against the trailers
+// before returning. Nothing is returned unless the whole content is verified.
+func (c *Client) Get(ctx context.Context, path, jsonpath string) ([]byte, kvapi.FileMeta, error) {
+	kv, err := c.grpcClient()
+	if err != nil {
+		return nil, kvapi.FileMeta{}, err
+	}
+	if kv != nil {
+		b, meta, err := c.getGRPC(ctx, kv, path, jsonpath)
+		if !c.fallback(err) {
+			return b, meta, fromStatus(err)
+		}
+	}
+
+	q := url.Values{}
+	if jsonpath != "" {
+		q.Set("jsonpath", jsonpath)
+	}
+	req, err := c.newRequest(ctx, http.MethodGet, "/v1/kv/", path, q)
+	if err != nil {
+		return nil, kvapi.FileMeta{}, err
+	}
+	res, err := c.HTTP.Do(req)
+	if err != nil {
+		return nil, kvapi.FileMeta{}, err
+	}
+	defer res.Body.Close()
+	if err := checkStatus(res); err != nil {
+		return nil, kvapi.FileMeta{}, err
+	}
+
+	var buf bytes.Buffer
+	h := kvapi.NewHasher()
+	if _, err := io.Copy(io.MultiWriter(&buf, h), res.Body); err != nil {
+		if ctx.Err() != nil {
+			return nil, kvapi.FileMeta{}, err
+		}
+		return nil, kvapi.FileMeta{}, fmt.Errorf("%w: truncated stream after %d bytes: %v", ErrIntegrity, buf.Len(), err)
+	}
+
+	// トレーラーはボディを読み切った後に確定する
+	want, err := finalFromTrailer(res.Trailer)
+	if err != nil {
+		return nil, kvapi.FileMeta{}, err
+	}
+	got := h.Final()
+	if got.ContentLength != want.ContentLength {
+		return nil, kvapi.FileMeta{}, fmt.Errorf("%w: content length %d, expected %d", ErrIntegrity, got.ContentLength, want.ContentLength)
+	}
+	if got.Hash != want.Hash {
+		return nil, kvapi.FileMeta{}, fmt.Errorf("%w: hash %s, expected %s", ErrIntegrity, got.Hash, want.Hash)
+	}
+
+	return buf.Bytes(), kvapi.FileMeta{
+		ContentType:   res.Header.Get("Content-Type"),
+		ContentLength: got.ContentLength,
+		Etag:          strings.Trim(res.Header.Get("ETag"), `"`),
+	}, nil
+}
+
+// Head returns the meta of path without its content.
+func (c *Client) Head(ctx context.Context, path, jsonpath string) (kvapi.FileMeta, error) {
+	kv, err := c.grpcClient()
+	if err != nil {
+		return kvapi.FileMeta{}, err
+	}
+	if kv != nil {
+		meta, err := kv.Head(c.outgoing(ctx), &kvpb.FileRequest{Path: path, Jsonpath: jsonpath})
+		if !c.fallback(err) {
+			if err != nil {
+				return kvapi.FileMeta{}, fromStatus(err)
+			}
+			return kvapi.FileMeta{ContentType: meta.GetContentType(), ContentLength: meta.GetContentLength(), Etag: meta.GetEtag()}, nil
+		}
+	}
+
+	q := url.Values{}
+	if jsonpath != "" {
+		q.Set("jsonpath", jsonpath)
+	}
+	req, err := c.newRequest(ctx, http.MethodHead, "/v1/kv/", path, q)
+	if err != nil {
+		return kvapi.FileMeta{}, err
+	}
+	res, err := c.HTTP.Do(req)
+	if err != nil {
+		return kvapi.FileMeta{}, err
+	}
+	defer res.Body.Close()
+	if err := checkStatus(res); err != nil {
+		return kvapi.FileMeta{}, err
+	}
+	return kvapi.FileMeta{
+		ContentType:   res.Header.Get("Content-Type"),
+		ContentLength: res.ContentLength,
+		Etag:          strings.Trim(res.Header.Get("ETag"), `"`),
+	}, nil
+}
+
+// List returns the names under prefix ("", "<ns>", "<ns>/<store>[/<prefix>]").
+func (c *Client) List(ctx context.Context, prefix string) ([]string, error) {
+	kv, err := c.grpcClient()
+	if err != nil {
+		return nil, err
+	}
+	if kv != nil {
+		res, err := kv.List(c.outgoing(ctx), &kvpb.ListRequest{Prefix: prefix})
+		if !c.fallback(err) {
+			if err != nil {
+				return nil, fromStatus(err)
+			}
+			return res.GetKeys(), nil
+		}
+	}
+
+	req, err := c.newRequest(ctx, http.MethodGet, "/v1/list/", prefix, nil)
+	if err != nil {
+		return nil, err
+	}
+	res, err := c.HTTP.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	defer res.Body.Close()
+	if err := checkStatus(res); err != nil {
+		return nil, err
+	}
+	var out kvapi.ListResponse
+	if err := json.NewDecoder(res.Body).Decode(&out); err != nil {
+		return nil, fmt.Errorf("decode list: %w", err)
+	}
+	return out.Keys, nil
+}
+
+func finalFromTrailer(tr http.Header) (kvapi.FileMetaFinal, error) {
+	length, hash := tr.Get(kvapi.TrailerContentLength), tr.Get(kvapi.TrailerHash)
+	if length == "" || hash == "" {
+		return kvapi.FileMetaFinal{}, fmt.Errorf("%w: missing %s/%s trailers (truncated stream?)", ErrIntegrity, kvapi.TrailerContentLength, kvapi.TrailerHash)
+	}
+	n, err := strconv.ParseInt(length, 10, 64)
+	if err != nil {
+		return kvapi.FileMetaFinal{}, fmt.Errorf("%w: invalid %s %q", ErrIntegrity, kvapi.TrailerContentLength, length)
+	}
+	if !strings.HasPrefix(hash, kvapi.HashAlgorithm+":") {
+		return kvapi.FileMetaFinal{}, fmt.Errorf("%w: unsupported hash algorithm in %q", ErrIntegrity, hash)
+	}
+	return kvapi.FileMetaFinal{ContentLength: n, Hash: hash}, nil
+}
+
+func IsNotFound(err error) bool {
+	return errors.Is(err, ErrNotFound)
+}
+
+func checkStatus(res *http.Response) error {
+	if res.StatusCode < 300 {
+		return nil
+	}
+	var body struct {
+		Error string `json:"error"`
+	}
+	_ = json.NewDecoder(io.LimitReader(res.Body, 1<<20)).Decode(&body)
+	msg := body.Error
+	if msg == "" {
+		msg = res.Status
+	}
+	// HEAD はボディが無いのでステータスだけで判断する
+	switch res.StatusCode {
+	case http.StatusNotFound:
+		return fmt.Errorf("%w: %s", ErrNotFound, msg)
+	case http.StatusUnauthorized:
+		return fmt.Errorf("%w: %s", ErrUnauthenticated, msg)
+	case http.StatusForbidden:
+		return fmt.Errorf("%w: %s", ErrPermissionDenied, msg)
+	}
+	return fmt.Errorf("server: %s", msg)
+}
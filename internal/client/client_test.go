@@ -0,0 +1,166 @@
+package client
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strconv"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+
+	"github.com/sasano8/kvtool/internal/kvapi"
+	"github.com/sasano8/kvtool/internal/server"
+	"github.com/sasano8/kvtool/internal/stores"
+)
+
+func TestGet(t *testing.T) {
+	for _, protocol := range []string{ProtocolGRPC, ProtocolHTTP} {
+		t.Run(protocol, func(t *testing.T) { testGet(t, protocol) })
+	}
+}
+
+func testGet(t *testing.T, protocol string) {
+	r := require.New(t)
+	envPath := filepath.Join(t.TempDir(), ".env")
+	r.NoError(os.WriteFile(envPath, []byte("USER=alice\n"), 0o644))
+
+	s := server.New(stores.Config{Namespaces: map[string]map[string]stores.StoreConfig{
+		"default": {".env": {Type: ".env", Args: map[string]any{"input": envPath}}},
+	}})
+	ts := httptest.NewServer(s.Handler())
+	defer ts.Close()
+
+	c := New(ts.URL)
+	c.Protocol = protocol
+	defer c.Close()
+	b, meta, err := c.Get(context.Background(), "/default/.env", "")
+	r.NoError(err)
+	r.JSONEq(`{"USER":"alice"}`, string(b))
+	r.Equal(int64(len(b)), meta.ContentLength)
+	r.NotEmpty(meta.Etag)
+
+	b, _, err = c.Get(context.Background(), "default/.env", "$.USER")
+	r.NoError(err)
+	r.Equal("\"alice\"\n", string(b))
+
+	_, _, err = c.Get(context.Background(), "default/.env/NOPE", "")
+	r.True(errors.Is(err, ErrNotFound))
+
+	head, err := c.Head(context.Background(), "default/.env", "")
+	r.NoError(err)
+	r.Equal(meta, head)
+
+	keys, err := c.List(context.Background(), "default/.env")
+	r.NoError(err)
+	r.Equal([]string{"USER"}, keys)
+
+	// 最新の etag から再開すると、次の変更まで何も届かない
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+	var events []kvapi.WatchEvent
+	go func() {
+		time.Sleep(300 * time.Millisecond)
+		_ = os.WriteFile(envPath, []byte("USER=bob\n"), 0o644)
+	}()
+	err = c.Watch(ctx, "default/.env", "", meta.Etag, func(ev kvapi.WatchEvent) error {
+		events = append(events, ev)
+		return errStop
+	})
+	r.ErrorIs(err, errStop)
+	r.Len(events, 1)
+	r.Equal(kvapi.EventPut, events[0].Type)
+	r.NotEqual(meta.Etag, events[0].Etag)
+}
+
+var errStop = errors.New("stop")
+
+func TestProtocol(t *testing.T) {
+	r := require.New(t)
+	envPath := filepath.Join(t.TempDir(), ".env")
+	r.NoError(os.WriteFile(envPath, []byte("USER=alice\n"), 0o644))
+	s := server.New(stores.Config{Namespaces: map[string]map[string]stores.StoreConfig{
+		"default": {".env": {Type: ".env", Args: map[string]any{"input": envPath}}},
+	}})
+
+	// gRPC を受け付けない（HTTP の対応だけの）サーバーには HTTP で話す
+	rest := httptest.NewServer(s.HTTPHandler())
+	defer rest.Close()
+	both := httptest.NewServer(s.Handler())
+	defer both.Close()
+
+	for _, tt := range []struct {
+		url, protocol string
+		httpOnly      bool
+	}{
+		{both.URL, "", false},
+		{both.URL, ProtocolGRPC, false},
+		{both.URL, ProtocolHTTP, false},
+		{rest.URL, "", true},
+		{rest.URL, ProtocolHTTP, false},
+	} {
+		c := New(tt.url)
+		c.Protocol = tt.protocol
+		b, meta, err := c.Get(context.Background(), "default/.env", "")
+		r.NoError(err, tt)
+		r.JSONEq(`{"USER":"alice"}`, string(b))
+		r.NotEmpty(meta.Etag)
+		keys, err := c.List(context.Background(), "default")
+		r.NoError(err, tt)
+		r.Equal([]string{".env"}, keys)
+		_, err = c.Head(context.Background(), "default/.env/NOPE", "")
+		r.True(IsNotFound(err), "%v: %v", tt, err)
+		r.Equal(tt.httpOnly, c.httpOnly, tt)
+		r.NoError(c.Close())
+	}
+
+	c := New(rest.URL)
+	c.Protocol = ProtocolGRPC
+	_, _, err := c.Get(context.Background(), "default/.env", "")
+	r.Error(err)
+	r.NoError(c.Close())
+}
+
+// 本来の内容 body に対するトレーラーを付けて、実際には sent を送るサーバー
+func fakeServer(body, sent string, abort bool) *httptest.Server {
+	return httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		h := kvapi.NewHasher()
+		_, _ = h.Write([]byte(body))
+		final := h.Final()
+
+		w.Header().Set("Trailer", kvapi.TrailerContentLength+", "+kvapi.TrailerHash)
+		_, _ = w.Write([]byte(sent))
+		if abort {
+			w.(http.Flusher).Flush()
+			panic(http.ErrAbortHandler)
+		}
+		w.Header().Set(kvapi.TrailerContentLength, strconv.FormatInt(final.ContentLength, 10))
+		w.Header().Set(kvapi.TrailerHash, final.Hash)
+	}))
+}
+
+func TestGetIntegrity(t *testing.T) {
+	r := require.New(t)
+	const body = `{"USER":"alice"}` + "\n"
+
+	ts := fakeServer(body, body, false)
+	b, _, err := New(ts.URL).Get(context.Background(), "default/.env", "")
+	ts.Close()
+	r.NoError(err)
+	r.Equal(body, string(b))
+
+	for name, ts := range map[string]*httptest.Server{
+		"corrupted": fakeServer(body, `{"USER":"mallory"}`+"\n", false),
+		"short":     fakeServer(body, body[:10], false),
+		"truncated": fakeServer(body, body[:10], true),
+	} {
+		b, _, err := New(ts.URL).Get(context.Background(), "default/.env", "")
+		ts.Close()
+		r.True(errors.Is(err, ErrIntegrity), "%s: %v", name, err)
+		r.Nil(b, name)
+	}
+}
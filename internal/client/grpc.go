@@ -0,0 +1,210 @@
+package client
+
+import (
+	"bytes"
+	"context"
+	"crypto/tls"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"net/url"
+
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/credentials"
+	"google.golang.org/grpc/credentials/insecure"
+	"google.golang.org/grpc/metadata"
+	"google.golang.org/grpc/status"
+
+	"github.com/sasano8/kvtool/internal/kvapi"
+	"github.com/sasano8/kvtool/internal/kvpb"
+)
+
+// Client.Protocol
+const (
+	ProtocolGRPC = "grpc"
+	ProtocolHTTP = "http"
+)
+
+// grpcClient は gRPC を使う時だけ KVClient を返す（HTTP を使うなら nil）
+func (c *Client) grpcClient() (kvpb.KVClient, error) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	switch c.Protocol {
+	case "", ProtocolGRPC:
+	case ProtocolHTTP:
+		return nil, nil
+	default:
+		return nil, fmt.Errorf("unknown protocol %q (grpc or http)", c.Protocol)
+	}
+	if c.httpOnly {
+		return nil, nil
+	}
+	if c.conn == nil {
+		conn, err := c.dial()
+		if err != nil {
+			return nil, err
+		}
+		c.conn = conn
+	}
+	return kvpb.NewKVClient(c.conn), nil
+}
+
+// dial は BaseURL の host に接続する（実際の接続は最初の RPC で行われる）
+func (c *Client) dial() (*grpc.ClientConn, error) {
+	u, err := url.Parse(c.BaseURL)
+	if err != nil {
+		return nil, err
+	}
+	creds, port := insecure.NewCredentials(), "80"
+	if u.Scheme == "https" {
+		cfg := c.TLS
+		if cfg == nil {
+			cfg = &tls.Config{MinVersion: tls.VersionTLS12}
+		}
+		creds, port = credentials.NewTLS(cfg), "443"
+	}
+	if u.Port() != "" {
+		port = u.Port()
+	}
+	return grpc.NewClient(net.JoinHostPort(u.Hostname(), port), grpc.WithTransportCredentials(creds))
+}
+
+// fallback は err が gRPC を使えないことを示していれば、以降を HTTP に切り替えて true を返す。
+// サーバーが HTTP/2 や gRPC を受け付けない時は Unavailable か Unimplemented になる
+func (c *Client) fallback(err error) bool {
+	if c.Protocol != "" {
+		return false
+	}
+	switch status.Code(err) {
+	case codes.Unavailable, codes.Unimplemented:
+		c.mu.Lock()
+		c.httpOnly = true
+		c.mu.Unlock()
+		return true
+	}
+	return false
+}
+
+// Close closes the gRPC connection, if any.
+func (c *Client) Close() error {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if c.conn == nil {
+		return nil
+	}
+	err := c.conn.Close()
+	c.conn = nil
+	return err
+}
+
+// outgoing は token を metadata に載せる
+func (c *Client) outgoing(ctx context.Context) context.Context {
+	if c.Token == "" {
+		return ctx
+	}
+	return metadata.AppendToOutgoingContext(ctx, "authorization", "Bearer "+c.Token)
+}
+
+// fromStatus は gRPC のステータスを HTTP と同じエラーにする（それ以外はそのまま）
+func fromStatus(err error) error {
+	if err == nil {
+		return nil
+	}
+	st, ok := status.FromError(err)
+	if !ok {
+		return err
+	}
+	switch st.Code() {
+	case codes.NotFound:
+		return fmt.Errorf("%w: %s", ErrNotFound, st.Message())
+	case codes.Unauthenticated:
+		return fmt.Errorf("%w: %s", ErrUnauthenticated, st.Message())
+	case codes.PermissionDenied:
+		return fmt.Errorf("%w: %s", ErrPermissionDenied, st.Message())
+	}
+	return fmt.Errorf("server: %s", st.Message())
+}
+
+// getGRPC は Read を受け取り、FileMetaFinal で長さとハッシュを確かめてから返す。
+// 受信前のエラーは fallback で判断できるようにそのまま返す
+func (c *Client) getGRPC(ctx context.Context, kv kvpb.KVClient, path, jsonpath string) ([]byte, kvapi.FileMeta, error) {
+	stream, err := kv.Read(c.outgoing(ctx), &kvpb.FileRequest{Path: path, Jsonpath: jsonpath})
+	if err != nil {
+		return nil, kvapi.FileMeta{}, err
+	}
+
+	var (
+		meta  *kvpb.FileMeta
+		final *kvpb.FileMetaFinal
+		buf   bytes.Buffer
+	)
+	h := kvapi.NewHasher()
+	for {
+		res, err := stream.Recv()
+		if errors.Is(err, io.EOF) {
+			break
+		}
+		if err != nil {
+			if meta == nil {
+				return nil, kvapi.FileMeta{}, err
+			}
+			if ctx.Err() != nil {
+				return nil, kvapi.FileMeta{}, ctx.Err()
+			}
+			return nil, kvapi.FileMeta{}, fmt.Errorf("%w: truncated stream after %d bytes: %v", ErrIntegrity, buf.Len(), err)
+		}
+		switch p := res.GetPart().(type) {
+		case *kvpb.FileResponse_Meta:
+			meta = p.Meta
+		case *kvpb.FileResponse_Chunk:
+			buf.Write(p.Chunk)
+			_, _ = h.Write(p.Chunk)
+		case *kvpb.FileResponse_Final:
+			final = p.Final
+		}
+	}
+
+	if meta == nil || final == nil {
+		return nil, kvapi.FileMeta{}, fmt.Errorf("%w: missing FileMeta/FileMetaFinal (truncated stream?)", ErrIntegrity)
+	}
+	got := h.Final()
+	if got.ContentLength != final.GetContentLength() {
+		return nil, kvapi.FileMeta{}, fmt.Errorf("%w: content length %d, expected %d", ErrIntegrity, got.ContentLength, final.GetContentLength())
+	}
+	if got.Hash != final.GetHash() {
+		return nil, kvapi.FileMeta{}, fmt.Errorf("%w: hash %s, expected %s", ErrIntegrity, got.Hash, final.GetHash())
+	}
+	return buf.Bytes(), kvapi.FileMeta{
+		ContentType:   meta.GetContentType(),
+		ContentLength: got.ContentLength,
+		Etag:          meta.GetEtag(),
+	}, nil
+}
+
+// watchGRPC は watchOnce の gRPC 版。サーバーがヘッダーを返したら接続できたとみなす。
+// 接続前のエラーは fallback で判断できるようにそのまま返す
+func (c *Client) watchGRPC(ctx context.Context, kv kvpb.KVClient, path, jsonpath string, etag *string, fn func(kvapi.WatchEvent) error) (bool, error) {
+	stream, err := kv.Watch(c.outgoing(ctx), &kvpb.FileRequest{Path: path, Jsonpath: jsonpath, Etag: *etag})
+	if err != nil {
+		return false, err
+	}
+	// エラーで終わった時は nil が返り、エラーは Recv で受け取る
+	md, _ := stream.Header()
+	connected := md != nil
+	for {
+		ev, err := stream.Recv()
+		if err != nil {
+			return connected, err
+		}
+		typ := kvapi.EventPut
+		if ev.GetType() == kvpb.WatchEvent_DELETE {
+			typ = kvapi.EventDelete
+		}
+		*etag = ev.GetEtag()
+		if err := fn(kvapi.WatchEvent{Type: typ, Path: ev.GetPath(), Etag: ev.GetEtag()}); err != nil {
+			return true, callbackError{err}
+		}
+	}
+}
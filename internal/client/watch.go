@@ -0,0 +1,112 @@
+package client
+
+import (
+	"bufio"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/url"
+	"strings"
+	"time"
+
+	"github.com/sasano8/kvtool/internal/kvapi"
+)
+
+// Watch streams change events of path to fn until ctx is cancelled.
+// On disconnect it reconnects with backoff and resumes from the last seen etag,
+// so changes made while disconnected are still delivered (once, as the latest state).
+func (c *Client) Watch(ctx context.Context, path, jsonpath, etag string, fn func(kvapi.WatchEvent) error) error {
+	backoff := time.Duration(0)
+	for {
+		connected, err := c.watchOnce(ctx, path, jsonpath, &etag, fn)
+		if ctx.Err() != nil {
+			return nil
+		}
+		var cbErr callbackError
+		if errors.As(err, &cbErr) {
+			return cbErr.err
+		}
+		if IsNotFound(err) || errors.Is(err, ErrUnauthenticated) || errors.Is(err, ErrPermissionDenied) {
+			return err
+		}
+		if connected {
+			backoff = 0
+		}
+		if backoff == 0 {
+			backoff = time.Second
+		} else if backoff < 30*time.Second {
+			backoff *= 2
+		}
+		select {
+		case <-ctx.Done():
+			return nil
+		case <-time.After(backoff):
+		}
+	}
+}
+
+type callbackError struct{ err error }
+
+func (e callbackError) Error() string { return e.err.Error() }
+
+func (c *Client) watchOnce(ctx context.Context, path, jsonpath string, etag *string, fn func(kvapi.WatchEvent) error) (bool, error) {
+	kv, err := c.grpcClient()
+	if err != nil {
+		return false, err
+	}
+	if kv != nil {
+		connected, err := c.watchGRPC(ctx, kv, path, jsonpath, etag, fn)
+		if connected || !c.fallback(err) {
+			return connected, fromStatus(err)
+		}
+	}
+
+	q := url.Values{}
+	if jsonpath != "" {
+		q.Set("jsonpath", jsonpath)
+	}
+	req, err := c.newRequest(ctx, http.MethodGet, "/v1/watch/", path, q)
+	if err != nil {
+		return false, err
+	}
+	req.Header.Set("Accept", "text/event-stream")
+	if *etag != "" {
+		req.Header.Set("Last-Event-ID", *etag)
+	}
+
+	res, err := c.HTTP.Do(req)
+	if err != nil {
+		return false, err
+	}
+	defer res.Body.Close()
+	if err := checkStatus(res); err != nil {
+		return false, err
+	}
+
+	sc := bufio.NewScanner(res.Body)
+	var data string
+	for sc.Scan() {
+		line := sc.Text()
+		switch {
+		case line == "":
+			if data == "" {
+				continue
+			}
+			var ev kvapi.WatchEvent
+			if err := json.Unmarshal([]byte(data), &ev); err != nil {
+				return true, fmt.Errorf("decode event: %w", err)
+			}
+			data = ""
+			*etag = ev.Etag
+			if err := fn(ev); err != nil {
+				return true, callbackError{err}
+			}
+		case strings.HasPrefix(line, "data:"):
+			data += strings.TrimSpace(strings.TrimPrefix(line, "data:"))
+		}
+		// id/event/コメント（heartbeat）は data に全て含まれるので読み捨てる
+	}
+	return true, sc.Err()
+}
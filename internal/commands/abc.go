@@ -4,6 +4,8 @@ import (
 	"fmt"
 	"io"
 	"os"
+
+	"github.com/sasano8/kvtool/internal/redact"
 )
 
 type nopWriteCloser struct{ io.Writer }
@@ -11,7 +13,7 @@ type nopWriteCloser struct{ io.Writer }
 func (nwc nopWriteCloser) Close() error { return nil }
 
 func exitErr(err error) {
-	fmt.Fprintln(os.Stderr, "error:", err)
+	fmt.Fprintln(os.Stderr, "error:", redact.Global().Error(err))
 	os.Exit(1)
 }
 
@@ -0,0 +1,70 @@
+package commands
+
+import (
+	"context"
+	"flag"
+	"fmt"
+	"os"
+	"os/signal"
+	"syscall"
+
+	"github.com/sasano8/kvtool/internal/agent"
+	"github.com/sasano8/kvtool/internal/stores"
+)
+
+func AgentCmd(args []string) {
+	fs := flag.NewFlagSet("agent", flag.ContinueOnError)
+	fs.SetOutput(os.Stderr)
+
+	configPath := fs.String("config", "agent.yml", "agent config file path")
+	once := fs.Bool("once", false, "render once and exit")
+
+	fs.Usage = func() {
+		fmt.Fprintln(os.Stderr, `Usage:
+  kvtool agent -config agent.yml [-once]
+
+Example agent.yml:
+  config: .kvtool.json   # store config
+  interval: 30s          # poll interval for stores that cannot be watched
+  templates:
+    - contents: 'DB_PASSWORD={{ secret "default" "vault" "password" }}'
+      destination: /etc/app/app.env
+      perms: "0600"
+      command: ["systemctl", "reload", "app"]
+
+Template functions:
+  store "<ns>" "<store>"            all values of a configured store
+  secret "<ns>" "<store>" "<key>"   one value of a configured store
+  uri "<uri>"                       a value by URI, e.g. uri "vault://secret/app#password"
+  env "<NAME>"                      an environment variable`)
+		fs.PrintDefaults()
+	}
+
+	if err := fs.Parse(args); err != nil {
+		os.Exit(2)
+	}
+
+	cfg, err := agent.LoadConfig(*configPath)
+	if err != nil {
+		exitErr(err)
+	}
+	sc, err := stores.LoadConfig(cfg.Config)
+	if err != nil {
+		exitErr(err)
+	}
+
+	// SIGTERM/SIGINT で現在のラウンドを終えてから終了する
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+	defer stop()
+
+	a := agent.New(cfg, sc)
+	if *once {
+		if _, err := a.RenderOnce(ctx); err != nil {
+			exitErr(err)
+		}
+		return
+	}
+	if err := a.Run(ctx); err != nil {
+		exitErr(err)
+	}
+}
@@ -0,0 +1,113 @@
+package commands
+
+import (
+	"flag"
+	"fmt"
+	"os"
+	"strings"
+	"text/tabwriter"
+	"time"
+
+	"github.com/sasano8/kvtool/internal/stores"
+)
+
+const cacheUsage = `Usage:
+  kvtool cache ls    [-json]
+  kvtool cache purge [<ns>/<store> | <key> ...]
+
+Manages the encrypted on-disk cache of stores configured with
+"cache": {"ttl": "5m", "stale_if_error": "24h"}.
+purge without arguments removes every entry.
+
+Env:
+  KVTOOL_CACHE_DIR, KVTOOL_CACHE_KEY_FILE`
+
+func CacheCmd(args []string) {
+	if len(args) < 1 {
+		fmt.Fprintln(os.Stderr, cacheUsage)
+		os.Exit(2)
+	}
+	sub, args := args[0], args[1:]
+
+	fs := flag.NewFlagSet("cache "+sub, flag.ContinueOnError)
+	fs.SetOutput(os.Stderr)
+	asJSON := fs.Bool("json", false, "ls: print entries as JSON (without values)")
+	fs.Usage = func() {
+		fmt.Fprintln(os.Stderr, cacheUsage)
+		fs.PrintDefaults()
+	}
+	if err := fs.Parse(args); err != nil {
+		os.Exit(2)
+	}
+
+	cache, err := stores.DefaultDiskCache()
+	if err != nil {
+		exitErr(err)
+	}
+	entries, err := cache.List()
+	if err != nil {
+		exitErr(err)
+	}
+
+	switch sub {
+	case "ls":
+		if fs.NArg() != 0 {
+			fs.Usage()
+			os.Exit(2)
+		}
+		if *asJSON {
+			type item struct {
+				Key       string    `json:"key"`
+				Name      string    `json:"name"`
+				Type      string    `json:"type"`
+				FetchedAt time.Time `json:"fetched_at"`
+			}
+			items := make([]item, 0, len(entries))
+			for _, e := range entries {
+				items = append(items, item{e.Key, e.Name, e.Type, e.FetchedAt})
+			}
+			writeJSON("", items)
+			return
+		}
+		tw := tabwriter.NewWriter(os.Stdout, 0, 4, 2, ' ', 0)
+		fmt.Fprintln(tw, "KEY\tNAME\tTYPE\tFETCHED\tAGE")
+		for _, e := range entries {
+			if e.FetchedAt.IsZero() {
+				// 別の鍵で書かれたなどで読めないエントリ
+				fmt.Fprintf(tw, "%s\t-\t-\t-\t-\n", e.Key)
+				continue
+			}
+			age := time.Since(e.FetchedAt).Truncate(time.Second)
+			fmt.Fprintf(tw, "%s\t%s\t%s\t%s\t%s\n", e.Key, e.Name, e.Type, e.FetchedAt.Local().Format(time.RFC3339), age)
+		}
+		_ = tw.Flush()
+
+	case "purge":
+		n := 0
+		for _, e := range entries {
+			if fs.NArg() > 0 && !matchesAny(e, fs.Args()) {
+				continue
+			}
+			if err := cache.Delete(e.Key); err != nil {
+				exitErr(err)
+			}
+			n++
+		}
+		fmt.Fprintf(os.Stderr, "purged %d entries\n", n)
+
+	default:
+		fmt.Fprintf(os.Stderr, "unknown cache command: %s\n\n", sub)
+		fmt.Fprintln(os.Stderr, cacheUsage)
+		os.Exit(2)
+	}
+}
+
+// matchesAny は名前の完全一致かキーの前方一致で判定する
+func matchesAny(e *stores.CacheEntry, names []string) bool {
+	for _, n := range names {
+		if e.Name == n || strings.HasPrefix(e.Key, n) {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,386 @@
+package commands
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+
+	"github.com/sasano8/kvtool/internal/convert"
+	"github.com/sasano8/kvtool/internal/encdotenv"
+	"github.com/sasano8/kvtool/internal/fsutil"
+	"github.com/sasano8/kvtool/internal/redact"
+	"github.com/sasano8/kvtool/internal/stores"
+)
+
+// stringsFlag は -r a -r b のように繰り返し指定できるフラグ
+type stringsFlag []string
+
+func (f *stringsFlag) String() string     { return strings.Join(*f, ",") }
+func (f *stringsFlag) Set(v string) error { *f = append(*f, v); return nil }
+
+func EncryptCmd(args []string) {
+	fs := flag.NewFlagSet("encrypt", flag.ContinueOnError)
+	fs.SetOutput(os.Stderr)
+
+	var inPath, outPath string
+	fs.StringVar(&inPath, "i", "", "plain .env file (default: stdin)")
+	fs.StringVar(&outPath, "o", "", "encrypted output (default: stdout)")
+	var recipients stringsFlag
+	fs.Var(&recipients, "r", "age recipient (age1...), repeatable (default: KVTOOL_AGE_RECIPIENTS, comma separated)")
+	recipientsFile := fs.String("R", "", "file with one age recipient per line")
+	var transit stringsFlag
+	fs.Var(&transit, "transit", "Vault Transit key ([mount/]name, mount defaults to transit), repeatable; uses VAULT_ADDR/VAULT_TOKEN")
+
+	fs.Usage = func() {
+		fmt.Fprintln(os.Stderr, `Usage:
+  kvtool encrypt -r age1... [-r age1...] [-R recipients.txt] [-transit [mount/]key] [-i .env] [-o .env.enc]
+
+Keys stay readable, values are encrypted. Commit the .env.enc file and read it
+with "kvtool decrypt", "kvtool edit" or a store of type ".env.enc".`)
+		fs.PrintDefaults()
+	}
+	if err := fs.Parse(args); err != nil {
+		os.Exit(2)
+	}
+
+	rcpts, err := encRecipients(recipients, *recipientsFile, transit)
+	if err != nil {
+		exitErr(err)
+	}
+
+	in, err := readInput(inPath)
+	if err != nil {
+		exitErr(err)
+	}
+	plain, err := convert.ParseDotenv(bytes.NewReader(in))
+	if err != nil {
+		exitErr(err)
+	}
+
+	f, err := encdotenv.Encrypt(context.Background(), plain, rcpts...)
+	if err != nil {
+		exitErr(err)
+	}
+	if err := writeOutput(outPath, f.Marshal()); err != nil {
+		exitErr(err)
+	}
+}
+
+func DecryptCmd(args []string) {
+	fs := flag.NewFlagSet("decrypt", flag.ContinueOnError)
+	fs.SetOutput(os.Stderr)
+
+	var inPath, outPath string
+	fs.StringVar(&inPath, "i", "", "encrypted .env file (default: stdin)")
+	fs.StringVar(&outPath, "o", "", "output (default: stdout)")
+	identity := fs.String("identity", "", "age identity file (default: KVTOOL_AGE_KEY, KVTOOL_AGE_KEY_FILE or <config dir>/kvtool/age.key)")
+	format := fs.String("format", "env", "output format: env or json")
+
+	fs.Usage = func() {
+		fmt.Fprintln(os.Stderr, `Usage: kvtool decrypt [-identity age.key] [-format env|json] [-i .env.enc] [-o .env]`)
+		fs.PrintDefaults()
+	}
+	if err := fs.Parse(args); err != nil {
+		os.Exit(2)
+	}
+	if *format != "env" && *format != "json" {
+		exitErr(fmt.Errorf("unknown format %q", *format))
+	}
+
+	in, err := readInput(inPath)
+	if err != nil {
+		exitErr(err)
+	}
+	f, err := encdotenv.Parse(bytes.NewReader(in))
+	if err != nil {
+		exitErr(err)
+	}
+	ids, err := stores.EncKeys{IdentityFile: *identity}.Identities(f)
+	if err != nil {
+		exitErr(err)
+	}
+	plain, err := f.Decrypt(context.Background(), ids...)
+	if err != nil {
+		exitErr(err)
+	}
+
+	var buf bytes.Buffer
+	if *format == "json" {
+		enc := json.NewEncoder(&buf)
+		enc.SetIndent("", "  ")
+		err = enc.Encode(redact.Global().StringMap(plain))
+	} else {
+		err = convert.WriteDotenv(&buf, anyMap(plain))
+	}
+	if err != nil {
+		exitErr(err)
+	}
+	if err := writeOutput(outPath, buf.Bytes()); err != nil {
+		exitErr(err)
+	}
+}
+
+// EditCmd decrypts the file into a private temp file, opens $VISUAL/$EDITOR
+// and re-encrypts with the same data key, so unchanged values keep their
+// ciphertext and recipients do not need to be given again.
+func EditCmd(args []string) {
+	fs := flag.NewFlagSet("edit", flag.ContinueOnError)
+	fs.SetOutput(os.Stderr)
+	identity := fs.String("identity", "", "age identity file (default: KVTOOL_AGE_KEY, KVTOOL_AGE_KEY_FILE or <config dir>/kvtool/age.key)")
+
+	fs.Usage = func() {
+		fmt.Fprintln(os.Stderr, `Usage: kvtool edit [-identity age.key] <file.env.enc>`)
+		fs.PrintDefaults()
+	}
+	if err := fs.Parse(args); err != nil {
+		os.Exit(2)
+	}
+	if fs.NArg() != 1 {
+		fs.Usage()
+		os.Exit(2)
+	}
+	path := fs.Arg(0)
+	ctx := context.Background()
+
+	b, err := os.ReadFile(path)
+	if err != nil {
+		exitErr(err)
+	}
+	f, err := encdotenv.Parse(bytes.NewReader(b))
+	if err != nil {
+		exitErr(err)
+	}
+	ids, err := stores.EncKeys{IdentityFile: *identity}.Identities(f)
+	if err != nil {
+		exitErr(err)
+	}
+	key, err := f.DataKey(ctx, ids...)
+	if err != nil {
+		exitErr(err)
+	}
+	plain, err := f.Decrypt(ctx, ids...)
+	if err != nil {
+		exitErr(err)
+	}
+
+	edited, err := editPlain(plain)
+	if err != nil {
+		exitErr(err)
+	}
+	if edited == nil {
+		fmt.Fprintln(os.Stderr, "no changes")
+		return
+	}
+	if err := f.Update(key, edited); err != nil {
+		exitErr(err)
+	}
+
+	fi, err := os.Stat(path)
+	if err != nil {
+		exitErr(err)
+	}
+	if err := fsutil.WriteFileAtomic(path, f.Marshal(), fi.Mode().Perm()); err != nil {
+		exitErr(err)
+	}
+}
+
+// editPlain は平文を 0600 の一時ファイルに書いてエディタで開く。変更が無ければ nil。
+func editPlain(plain map[string]string) (map[string]string, error) {
+	dir, err := os.MkdirTemp("", "kvtool-edit-")
+	if err != nil {
+		return nil, err
+	}
+	defer os.RemoveAll(dir)
+
+	var buf bytes.Buffer
+	// エディタに渡すので -redact でも伏せない
+	if err := convert.FormatDotenv(&buf, anyMap(plain)); err != nil {
+		return nil, err
+	}
+	tmp := filepath.Join(dir, "edit.env")
+	if err := os.WriteFile(tmp, buf.Bytes(), 0o600); err != nil {
+		return nil, err
+	}
+
+	editor := os.Getenv("VISUAL")
+	if editor == "" {
+		editor = os.Getenv("EDITOR")
+	}
+	if editor == "" {
+		editor = "vi"
+	}
+	// EDITOR="code --wait" のような引数付きも許す
+	parts := strings.Fields(editor)
+	cmd := exec.Command(parts[0], append(parts[1:], tmp)...)
+	cmd.Stdin, cmd.Stdout, cmd.Stderr = os.Stdin, os.Stdout, os.Stderr
+	if err := cmd.Run(); err != nil {
+		return nil, fmt.Errorf("editor %q: %w", editor, err)
+	}
+
+	after, err := os.ReadFile(tmp)
+	if err != nil {
+		return nil, err
+	}
+	if bytes.Equal(after, buf.Bytes()) {
+		return nil, nil
+	}
+	return convert.ParseDotenv(bytes.NewReader(after))
+}
+
+// RewrapCmd wraps the data key again for the file's current recipients
+// (picking up the latest version of rotated Vault Transit keys), or
+// re-encrypts the file with a new data key for a new set of recipients.
+func RewrapCmd(args []string) {
+	fs := flag.NewFlagSet("rewrap", flag.ContinueOnError)
+	fs.SetOutput(os.Stderr)
+	identity := fs.String("identity", "", "age identity file (default: KVTOOL_AGE_KEY, KVTOOL_AGE_KEY_FILE or <config dir>/kvtool/age.key)")
+	var recipients, transit stringsFlag
+	fs.Var(&recipients, "r", "new age recipient (age1...), repeatable")
+	recipientsFile := fs.String("R", "", "file with one new age recipient per line")
+	fs.Var(&transit, "transit", "new Vault Transit key ([mount/]name), repeatable")
+
+	fs.Usage = func() {
+		fmt.Fprintln(os.Stderr, `Usage:
+  kvtool rewrap [-identity age.key] <file.env.enc>
+  kvtool rewrap [-identity age.key] [-r age1...] [-R recipients.txt] [-transit [mount/]key] <file.env.enc>
+
+Without -r/-R/-transit the same data key is wrapped again for the current
+recipients, e.g. after "vault write -f transit/keys/<key>/rotate"; values are
+not re-encrypted.
+
+With them the recipients are replaced and every value is re-encrypted with a
+new data key, so a removed recipient cannot decrypt the file even with a data
+key it unwrapped before.`)
+		fs.PrintDefaults()
+	}
+	if err := fs.Parse(args); err != nil {
+		os.Exit(2)
+	}
+	if fs.NArg() != 1 {
+		fs.Usage()
+		os.Exit(2)
+	}
+	path := fs.Arg(0)
+	ctx := context.Background()
+
+	b, err := os.ReadFile(path)
+	if err != nil {
+		exitErr(err)
+	}
+	f, err := encdotenv.Parse(bytes.NewReader(b))
+	if err != nil {
+		exitErr(err)
+	}
+	keys := stores.EncKeys{IdentityFile: *identity}
+	ids, err := keys.Identities(f)
+	if err != nil {
+		exitErr(err)
+	}
+	key, err := f.DataKey(ctx, ids...)
+	if err != nil {
+		exitErr(err)
+	}
+
+	if len(recipients) == 0 && *recipientsFile == "" && len(transit) == 0 {
+		client, err := keys.VaultClient()
+		if err != nil && f.HasStanza("transit") {
+			exitErr(err)
+		}
+		rcpts, err := f.Recipients(client)
+		if err != nil {
+			exitErr(err)
+		}
+		if err := f.Wrap(ctx, key, rcpts...); err != nil {
+			exitErr(err)
+		}
+	} else {
+		rcpts, err := encRecipients(recipients, *recipientsFile, transit)
+		if err != nil {
+			exitErr(err)
+		}
+		// 外した受信者が以前のデータ鍵で読めないように鍵ごと替える
+		if _, err := f.Rekey(ctx, key, rcpts...); err != nil {
+			exitErr(err)
+		}
+	}
+	fi, err := os.Stat(path)
+	if err != nil {
+		exitErr(err)
+	}
+	if err := fsutil.WriteFileAtomic(path, f.Marshal(), fi.Mode().Perm()); err != nil {
+		exitErr(err)
+	}
+}
+
+func encRecipients(ageFlags []string, ageFile string, transit []string) ([]encdotenv.Recipient, error) {
+	if len(ageFlags) == 0 && ageFile == "" && len(transit) == 0 {
+		for _, r := range strings.Split(os.Getenv("KVTOOL_AGE_RECIPIENTS"), ",") {
+			if r = strings.TrimSpace(r); r != "" {
+				ageFlags = append(ageFlags, r)
+			}
+		}
+	}
+
+	var out []encdotenv.Recipient
+	for _, s := range ageFlags {
+		r, err := encdotenv.ParseAgeRecipient(s)
+		if err != nil {
+			return nil, fmt.Errorf("recipient %q: %w", s, err)
+		}
+		out = append(out, r)
+	}
+	if ageFile != "" {
+		f, err := os.Open(ageFile)
+		if err != nil {
+			return nil, err
+		}
+		defer f.Close()
+		rs, err := encdotenv.ParseAgeRecipients(f)
+		if err != nil {
+			return nil, fmt.Errorf("%s: %w", ageFile, err)
+		}
+		for _, r := range rs {
+			out = append(out, r)
+		}
+	}
+	if len(transit) > 0 {
+		client, err := stores.EncKeys{}.VaultClient()
+		if err != nil {
+			return nil, err
+		}
+		for _, t := range transit {
+			k, err := encdotenv.ParseTransitKey(client, t)
+			if err != nil {
+				return nil, err
+			}
+			out = append(out, k)
+		}
+	}
+	if len(out) == 0 {
+		return nil, errors.New("no recipients: use -r, -R, -transit or KVTOOL_AGE_RECIPIENTS")
+	}
+	return out, nil
+}
+
+func readInput(path string) ([]byte, error) {
+	if path == "" {
+		return io.ReadAll(os.Stdin)
+	}
+	return os.ReadFile(path)
+}
+
+func anyMap(m map[string]string) map[string]any {
+	out := make(map[string]any, len(m))
+	for k, v := range m {
+		out[k] = v
+	}
+	return out
+}
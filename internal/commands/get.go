@@ -0,0 +1,140 @@
+package commands
+
+import (
+	"context"
+	"errors"
+	"flag"
+	"fmt"
+	"os"
+	"strings"
+
+	"github.com/sasano8/kvtool/internal/client"
+	"github.com/sasano8/kvtool/internal/fsutil"
+	"github.com/sasano8/kvtool/internal/redact"
+	"github.com/sasano8/kvtool/internal/server"
+	"github.com/sasano8/kvtool/internal/stores"
+)
+
+func GetCmd(args []string) {
+	fs := flag.NewFlagSet("get", flag.ContinueOnError)
+	fs.SetOutput(os.Stderr)
+
+	var outPath string
+	fs.StringVar(&outPath, "o", "", "output file (default: stdout)")
+	fs.StringVar(&outPath, "output", "", "output file (default: stdout)")
+
+	configPath := fs.String("config", ".kvtool.json", "config file path (local mode)")
+	remote := fs.String("remote", "", "KV server address (e.g. http://127.0.0.1:8080)")
+	query := fs.String("jsonpath", "", "JSONPath applied to the value (e.g. $.password)")
+
+	fs.Usage = func() {
+		fmt.Fprintln(os.Stderr, `Usage:
+  kvtool get [-remote <server>] [-jsonpath <expr>] [-o <file>] <ns>/<store>[/<key>]
+  kvtool get [-jsonpath <expr>] [-o <file>] <uri>
+
+URIs address a value without a config entry:
+  vault://secret/app/prod#password   dotenv://./.env#DB_HOST
+  env://HOME                          kv://default/vault/password
+Only kv:// URIs can be used with -remote.
+
+With -remote the content is verified against the length and hash sent by the
+server and written only if it matches (exit code 3 on mismatch).`)
+		fs.PrintDefaults()
+	}
+
+	if err := fs.Parse(args); err != nil {
+		os.Exit(2)
+	}
+	if fs.NArg() != 1 {
+		fs.Usage()
+		os.Exit(2)
+	}
+	path := fs.Arg(0)
+	ctx := context.Background()
+
+	var (
+		b   []byte
+		err error
+	)
+	switch {
+	case *remote != "":
+		if path, err = kvPath(path); err == nil {
+			c := client.New(*remote)
+			b, _, err = c.Get(ctx, path, *query)
+			c.Close()
+		}
+	case stores.IsURI(path):
+		var ref stores.Ref
+		if ref, err = stores.ParseRef(path); err != nil {
+			break
+		}
+		// 設定ファイルが要るのは kv:// だけ
+		var cfg stores.Config
+		if ref.Namespace != "" {
+			cfg, err = stores.LoadConfig(*configPath)
+		}
+		if err == nil {
+			b, _, err = server.New(cfg).ReadRef(ctx, ref, *query)
+		}
+	default:
+		var cfg stores.Config
+		cfg, err = stores.LoadConfig(*configPath)
+		if err == nil {
+			b, _, err = server.New(cfg).Read(ctx, path, *query)
+		}
+	}
+	if errors.Is(err, client.ErrIntegrity) {
+		fmt.Fprintln(os.Stderr, "error:", redact.Global().Error(err))
+		os.Exit(3)
+	} else if err != nil {
+		exitErr(err)
+	}
+
+	if err := writeOutput(outPath, redactPath(path, b)); err != nil {
+		exitErr(err)
+	}
+}
+
+// redactPath は -redact のとき KV パスや URI の値を伏せる
+func redactPath(p string, b []byte) []byte {
+	rd := redact.Global()
+	if rd == nil {
+		return b
+	}
+	// キーを指しているときだけキー名で判定できる
+	var key string
+	if ref, err := stores.ParseRef(p); err == nil {
+		key = ref.Key
+	} else if parts := strings.SplitN(strings.Trim(p, "/"), "/", 3); len(parts) == 3 {
+		key = parts[2]
+	}
+	return rd.JSON(key, b)
+}
+
+// kvPath は KV サーバーに渡すパスを返す。kv:// の URI も受け付ける
+func kvPath(s string) (string, error) {
+	if !stores.IsURI(s) {
+		return s, nil
+	}
+	ref, err := stores.ParseRef(s)
+	if err != nil {
+		return "", err
+	}
+	if ref.Namespace == "" {
+		return "", fmt.Errorf("%s:// URIs cannot be read through a KV server; use kv://<ns>/<store>[/<key>]", ref.Scheme)
+	}
+	p := ref.Namespace + "/" + ref.StoreKey
+	if ref.Key != "" {
+		p += "/" + ref.Key
+	}
+	return p, nil
+}
+
+// writeOutput は検証済みの内容だけを書く。ファイルは rename で置き換えるので途中の状態は残らない
+func writeOutput(path string, b []byte) error {
+	if path == "" {
+		_, err := os.Stdout.Write(b)
+		return err
+	}
+	return fsutil.WriteFileAtomic(path, b, 0o600)
+}
@@ -0,0 +1,261 @@
+package commands
+
+import (
+	"bytes"
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"io/fs"
+	"os"
+	"strings"
+	"text/tabwriter"
+	"time"
+
+	"golang.org/x/term"
+
+	"github.com/sasano8/kvtool/internal/localvault"
+	"github.com/sasano8/kvtool/internal/redact"
+)
+
+const localUsage = `Usage:
+  kvtool local init   [-path <file>] [-key-file <file>]
+  kvtool local set    [-ns default] <key> [<value>]     (value from stdin if omitted)
+  kvtool local get    [-ns default] [-version N | -history] <key>
+  kvtool local rm     [-ns default] <key>
+  kvtool local ls     [-ns default] [-l]
+  kvtool local passwd [-new-key-file <file> | -new-passphrase-file <file>]
+
+A local encrypted vault for machines without Vault. Use it as a store with
+  {"type": "local", "args": {"path": "...", "namespace": "default"}}
+
+The vault is unlocked with -key-file, -passphrase-file, KVTOOL_LOCAL_KEY_FILE,
+KVTOOL_LOCAL_PASSPHRASE or, on a terminal, a passphrase prompt.
+init -key-file creates the key file if it does not exist.
+
+Env:
+  KVTOOL_LOCAL_VAULT, KVTOOL_LOCAL_KEY_FILE, KVTOOL_LOCAL_PASSPHRASE`
+
+func LocalCmd(args []string) {
+	if len(args) < 1 {
+		fmt.Fprintln(os.Stderr, localUsage)
+		os.Exit(2)
+	}
+	sub, args := args[0], args[1:]
+
+	fs := flag.NewFlagSet("local "+sub, flag.ContinueOnError)
+	fs.SetOutput(os.Stderr)
+	path := fs.String("path", localvault.DefaultPath(), "vault file (default: KVTOOL_LOCAL_VAULT or the user config dir)")
+	keyFile := fs.String("key-file", "", "unlock with this key file")
+	passFile := fs.String("passphrase-file", "", "unlock with the passphrase in this file")
+	ns := fs.String("ns", "default", "namespace")
+	version := fs.Int("version", 0, "get: this version instead of the current one")
+	history := fs.Bool("history", false, "get: print every version as JSON")
+	long := fs.Bool("l", false, "ls: show version and update time")
+	newKeyFile := fs.String("new-key-file", "", "passwd: switch to this key file (created if missing)")
+	newPassFile := fs.String("new-passphrase-file", "", "passwd: switch to the passphrase in this file")
+	fs.Usage = func() {
+		fmt.Fprintln(os.Stderr, localUsage)
+		fs.PrintDefaults()
+	}
+	if err := fs.Parse(args); err != nil {
+		os.Exit(2)
+	}
+	nargs := func(min, max int) {
+		if fs.NArg() < min || fs.NArg() > max {
+			fs.Usage()
+			os.Exit(2)
+		}
+	}
+	now := time.Now().UTC()
+
+	switch sub {
+	case "init":
+		nargs(0, 0)
+		sec, err := newSecret(*keyFile, *passFile)
+		if err != nil {
+			exitErr(err)
+		}
+		if err := localvault.Init(*path, sec); err != nil {
+			exitErr(err)
+		}
+		fmt.Fprintln(os.Stderr, "created:", *path)
+
+	case "set":
+		nargs(1, 2)
+		key := fs.Arg(0)
+		var value string
+		if fs.NArg() == 2 {
+			value = fs.Arg(1)
+		} else {
+			// 値をコマンドラインや履歴に残さないために stdin から読める
+			b, err := io.ReadAll(os.Stdin)
+			if err != nil {
+				exitErr(err)
+			}
+			value = strings.TrimRight(string(b), "\r\n")
+		}
+		var n int
+		err := localvault.Update(*path, unlockSecret(*path, *keyFile, *passFile), func(v *localvault.Vault) error {
+			n = v.Set(*ns, key, value, now)
+			return nil
+		})
+		if err != nil {
+			exitErr(err)
+		}
+		fmt.Fprintf(os.Stderr, "%s/%s: version %d\n", *ns, key, n)
+
+	case "get":
+		nargs(1, 1)
+		key := fs.Arg(0)
+		v, err := localvault.Open(*path, unlockSecret(*path, *keyFile, *passFile))
+		if err != nil {
+			exitErr(err)
+		}
+		rd := redact.Global()
+		if *history {
+			type item struct {
+				Version int       `json:"version"`
+				Value   string    `json:"value,omitempty"`
+				Deleted bool      `json:"deleted,omitempty"`
+				Created time.Time `json:"created"`
+			}
+			hist := v.History(*ns, key)
+			if len(hist) == 0 {
+				exitErr(fmt.Errorf("%w: %s/%s", localvault.ErrNotFound, *ns, key))
+			}
+			items := make([]item, 0, len(hist))
+			for i, h := range hist {
+				val := h.Value
+				if !h.Deleted {
+					val = rd.Value(key, val).(string)
+				}
+				items = append(items, item{i + 1, val, h.Deleted, h.Created})
+			}
+			writeJSON("", items)
+			return
+		}
+		var value string
+		if *version > 0 {
+			value, err = v.GetVersion(*ns, key, *version)
+		} else {
+			value, _, err = v.Get(*ns, key)
+		}
+		if err != nil {
+			exitErr(err)
+		}
+		fmt.Println(rd.Value(key, value))
+
+	case "rm":
+		nargs(1, 1)
+		key := fs.Arg(0)
+		err := localvault.Update(*path, unlockSecret(*path, *keyFile, *passFile), func(v *localvault.Vault) error {
+			return v.Delete(*ns, key, now)
+		})
+		if err != nil {
+			exitErr(err)
+		}
+
+	case "ls":
+		nargs(0, 0)
+		v, err := localvault.Open(*path, unlockSecret(*path, *keyFile, *passFile))
+		if err != nil {
+			exitErr(err)
+		}
+		if !*long {
+			for _, k := range v.Keys(*ns) {
+				fmt.Println(k)
+			}
+			return
+		}
+		tw := tabwriter.NewWriter(os.Stdout, 0, 4, 2, ' ', 0)
+		fmt.Fprintln(tw, "KEY\tVERSION\tUPDATED")
+		for _, k := range v.Keys(*ns) {
+			hist := v.History(*ns, k)
+			last := hist[len(hist)-1]
+			fmt.Fprintf(tw, "%s\t%d\t%s\n", k, len(hist), last.Created.Local().Format(time.RFC3339))
+		}
+		_ = tw.Flush()
+
+	case "passwd":
+		nargs(0, 0)
+		cur := unlockSecret(*path, *keyFile, *passFile)
+		next, err := newSecret(*newKeyFile, *newPassFile)
+		if err != nil {
+			exitErr(err)
+		}
+		if err := localvault.ChangeSecret(*path, cur, next); err != nil {
+			exitErr(err)
+		}
+		fmt.Fprintln(os.Stderr, "updated:", *path)
+
+	default:
+		fmt.Fprintf(os.Stderr, "unknown local command: %s\n\n", sub)
+		fmt.Fprintln(os.Stderr, localUsage)
+		os.Exit(2)
+	}
+}
+
+// unlockSecret は既存の vault を開く鍵を決める。指定も環境変数も無ければ端末で聞く
+func unlockSecret(path, keyFile, passFile string) localvault.Secret {
+	sec, err := localvault.LoadSecret(keyFile, passFile)
+	if err == nil {
+		return sec
+	}
+	if !errors.Is(err, localvault.ErrNoSecret) {
+		exitErr(err)
+	}
+	if typ, err := localvault.KDFType(path); err == nil && typ == "keyfile" {
+		exitErr(fmt.Errorf("%s is unlocked with a key file; use -key-file or KVTOOL_LOCAL_KEY_FILE", path))
+	}
+	p, err := promptPassphrase("Passphrase: ")
+	if err != nil {
+		exitErr(err)
+	}
+	return localvault.Secret{Passphrase: p}
+}
+
+// newSecret は init / passwd で使う新しい鍵。鍵ファイルが無ければ作る
+func newSecret(keyFile, passFile string) (localvault.Secret, error) {
+	if keyFile != "" {
+		if _, err := os.Stat(keyFile); errors.Is(err, fs.ErrNotExist) {
+			if err := localvault.GenerateKeyFile(keyFile); err != nil {
+				return localvault.Secret{}, err
+			}
+			fmt.Fprintln(os.Stderr, "created key file:", keyFile)
+		}
+		return localvault.Secret{KeyFile: keyFile}, nil
+	}
+	if passFile != "" {
+		return localvault.LoadSecret("", passFile)
+	}
+	if p := os.Getenv("KVTOOL_LOCAL_PASSPHRASE"); p != "" {
+		return localvault.Secret{Passphrase: []byte(p)}, nil
+	}
+	p, err := promptPassphrase("New passphrase: ")
+	if err != nil {
+		return localvault.Secret{}, err
+	}
+	again, err := promptPassphrase("Repeat passphrase: ")
+	if err != nil {
+		return localvault.Secret{}, err
+	}
+	if !bytes.Equal(p, again) {
+		return localvault.Secret{}, errors.New("passphrases do not match")
+	}
+	if len(p) == 0 {
+		return localvault.Secret{}, errors.New("empty passphrase")
+	}
+	return localvault.Secret{Passphrase: p}, nil
+}
+
+func promptPassphrase(prompt string) ([]byte, error) {
+	fd := int(os.Stdin.Fd())
+	if !term.IsTerminal(fd) {
+		return nil, fmt.Errorf("%w (not a terminal: use -passphrase-file or KVTOOL_LOCAL_PASSPHRASE)", localvault.ErrNoSecret)
+	}
+	fmt.Fprint(os.Stderr, prompt)
+	p, err := term.ReadPassword(fd)
+	fmt.Fprintln(os.Stderr)
+	return p, err
+}
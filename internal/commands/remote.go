@@ -0,0 +1,190 @@
+package commands
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"flag"
+	"fmt"
+	"net/http"
+	"os"
+	"os/signal"
+	"strings"
+	"syscall"
+
+	"github.com/sasano8/kvtool/internal/client"
+	"github.com/sasano8/kvtool/internal/kvapi"
+	"github.com/sasano8/kvtool/internal/redact"
+)
+
+const remoteUsage = `Usage:
+  kvtool remote get   [options] <ns>/<store>[/<key>]
+  kvtool remote head  [options] <ns>/<store>[/<key>]
+  kvtool remote ls    [options] [<ns>[/<store>[/<prefix>]]]
+  kvtool remote watch [options] <ns>/<store>[/<key>]
+
+Paths may also be written as kv://<ns>/<store>[/<key>].
+
+The server is reached over gRPC, falling back to its HTTP API when gRPC is
+not available (e.g. behind an HTTP/1.1 proxy); -protocol forces one.
+
+Examples:
+  kvtool remote get -server 127.0.0.1:8080 default/vault | kvtool json2env
+  kvtool remote get -query '$.password' default/vault
+
+Env:
+  KVTOOL_SERVER, KVTOOL_TOKEN`
+
+func RemoteCmd(args []string) {
+	if len(args) < 1 {
+		fmt.Fprintln(os.Stderr, remoteUsage)
+		os.Exit(2)
+	}
+	sub, args := args[0], args[1:]
+
+	fs := flag.NewFlagSet("remote "+sub, flag.ContinueOnError)
+	fs.SetOutput(os.Stderr)
+
+	var outPath string
+	fs.StringVar(&outPath, "o", "", "output file (default: stdout)")
+	fs.StringVar(&outPath, "output", "", "output file (default: stdout)")
+
+	server := fs.String("server", "", "KV server host:port or URL (default: KVTOOL_SERVER or 127.0.0.1:8080)")
+	token := fs.String("token", "", "bearer token (default: KVTOOL_TOKEN)")
+	query := fs.String("query", "", "JSONPath applied on the server (e.g. $.password)")
+	caFile := fs.String("cacert", "", "CA certificate to verify the server (enables TLS)")
+	certFile := fs.String("cert", "", "client certificate for mTLS")
+	keyFile := fs.String("key", "", "client private key for mTLS")
+	serverName := fs.String("server-name", "", "override the TLS server name")
+	etag := fs.String("etag", "", "watch: resume from this etag")
+	protocol := fs.String("protocol", "", "grpc or http (default: gRPC with fallback to HTTP)")
+
+	fs.Usage = func() {
+		fmt.Fprintln(os.Stderr, remoteUsage)
+		fs.PrintDefaults()
+	}
+	if err := fs.Parse(args); err != nil {
+		os.Exit(2)
+	}
+
+	var path string
+	switch {
+	case fs.NArg() == 1:
+		p, err := kvPath(fs.Arg(0))
+		if err != nil {
+			exitErr(err)
+		}
+		path = p
+	case fs.NArg() == 0 && sub == "ls":
+	default:
+		fs.Usage()
+		os.Exit(2)
+	}
+
+	// token は flag > env
+	if *token == "" {
+		*token = os.Getenv("KVTOOL_TOKEN")
+	}
+	if *server == "" {
+		*server = os.Getenv("KVTOOL_SERVER")
+	}
+	if *server == "" {
+		*server = "127.0.0.1:8080"
+	}
+
+	useTLS := *caFile != "" || *certFile != "" || *serverName != ""
+	if !strings.Contains(*server, "://") {
+		if useTLS {
+			*server = "https://" + *server
+		} else {
+			*server = "http://" + *server
+		}
+	}
+
+	c := client.New(*server)
+	c.Token = *token
+	c.Protocol = *protocol
+	if useTLS || strings.HasPrefix(*server, "https://") {
+		tlsCfg, err := client.TLSConfig(*caFile, *certFile, *keyFile, *serverName)
+		if err != nil {
+			exitErr(err)
+		}
+		c.HTTP = &http.Client{Transport: &http.Transport{
+			Proxy:           http.ProxyFromEnvironment,
+			TLSClientConfig: tlsCfg,
+		}}
+		c.TLS = tlsCfg
+	}
+	defer c.Close()
+
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+	defer stop()
+
+	switch sub {
+	case "get":
+		b, _, err := c.Get(ctx, path, *query)
+		if errors.Is(err, client.ErrIntegrity) {
+			fmt.Fprintln(os.Stderr, "error:", redact.Global().Error(err))
+			os.Exit(3)
+		} else if err != nil {
+			exitErr(err)
+		}
+		if err := writeOutput(outPath, redactPath(path, b)); err != nil {
+			exitErr(err)
+		}
+
+	case "head":
+		meta, err := c.Head(ctx, path, *query)
+		if err != nil {
+			exitErr(err)
+		}
+		writeJSON(outPath, meta)
+
+	case "ls":
+		keys, err := c.List(ctx, path)
+		if err != nil {
+			exitErr(err)
+		}
+		out, err := openOutput(outPath)
+		if err != nil {
+			exitErr(err)
+		}
+		defer out.Close()
+		for _, k := range keys {
+			fmt.Fprintln(out, k)
+		}
+
+	case "watch":
+		out, err := openOutput(outPath)
+		if err != nil {
+			exitErr(err)
+		}
+		defer out.Close()
+		enc := json.NewEncoder(out)
+		err = c.Watch(ctx, path, *query, *etag, func(ev kvapi.WatchEvent) error {
+			return enc.Encode(ev)
+		})
+		if err != nil {
+			exitErr(err)
+		}
+
+	default:
+		fmt.Fprintf(os.Stderr, "unknown remote command: %s\n\n", sub)
+		fmt.Fprintln(os.Stderr, remoteUsage)
+		os.Exit(2)
+	}
+}
+
+func writeJSON(path string, v any) {
+	out, err := openOutput(path)
+	if err != nil {
+		exitErr(err)
+	}
+	defer out.Close()
+
+	enc := json.NewEncoder(out)
+	enc.SetIndent("", "  ")
+	if err := enc.Encode(v); err != nil {
+		exitErr(err)
+	}
+}
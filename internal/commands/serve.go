@@ -0,0 +1,145 @@
+package commands
+
+import (
+	"context"
+	"crypto/tls"
+	"crypto/x509"
+	"errors"
+	"flag"
+	"fmt"
+	"net"
+	"net/http"
+	"os"
+	"os/signal"
+	"syscall"
+	"time"
+
+	"github.com/sasano8/kvtool/internal/audit"
+	"github.com/sasano8/kvtool/internal/auth"
+	"github.com/sasano8/kvtool/internal/server"
+	"github.com/sasano8/kvtool/internal/stores"
+)
+
+func ServeCmd(args []string) {
+	fs := flag.NewFlagSet("serve", flag.ContinueOnError)
+	fs.SetOutput(os.Stderr)
+
+	configPath := fs.String("config", ".kvtool.json", "config file path")
+	addr := fs.String("addr", "127.0.0.1:8080", "listen address")
+	watchInterval := fs.Duration("watch-interval", 10*time.Second, "poll interval for stores without native watch")
+	probeTimeout := fs.Duration("probe-timeout", 5*time.Second, "how long /readyz waits for each store")
+	policyPath := fs.String("policy", "", "ACL policy file (tokens and rules); without it every request is allowed")
+	tlsCert := fs.String("tls-cert", "", "server certificate (enables TLS)")
+	tlsKey := fs.String("tls-key", "", "server private key")
+	clientCA := fs.String("client-ca", "", "CA to verify client certificates (mTLS identities cert:<CN>)")
+	auditSpec := fs.String("audit", os.Getenv("KVTOOL_AUDIT"), "audit sinks, comma separated: stdout, stderr, file:<path>, syslog[:<tag>] (default: KVTOOL_AUDIT)")
+	auditKey := fs.String("audit-hmac-key", "", "file holding the audit HMAC key (default: KVTOOL_AUDIT_HMAC_KEY)")
+
+	fs.Usage = func() {
+		fmt.Fprintln(os.Stderr, `Usage:
+  kvtool serve [-config .kvtool.json] [-addr 127.0.0.1:8080] [-policy policy.yml]
+              [-tls-cert server.pem -tls-key server-key.pem [-client-ca ca.pem]]
+
+gRPC (kv.v1.KV in kv.proto) and its HTTP mapping share the address;
+without TLS gRPC is served over cleartext HTTP/2 (h2c).
+
+Endpoints (HTTP mapping of kv.proto):
+  HEAD /v1/kv/<ns>/<store>[/<key>]
+  GET  /v1/kv/<ns>/<store>[/<key>][?jsonpath=$.a.b]
+  GET  /v1/list/[<ns>[/<store>[/<prefix>]]]   (or GET /v1/kv/...?list)
+  PUT  /v1/kv/<ns>/<store>[/<key>]      (If-Match: "<etag>")
+  DELETE /v1/kv/<ns>/<store>/<key>      (If-Match: "<etag>")
+  GET  /v1/watch/<ns>/<store>[/<key>]   Server-Sent Events
+
+Operational endpoints (no authentication):
+  GET  /metrics   Prometheus text format
+  GET  /healthz   liveness
+  GET  /readyz    503 unless every configured store answers a probe`)
+		fs.PrintDefaults()
+	}
+
+	if err := fs.Parse(args); err != nil {
+		os.Exit(2)
+	}
+
+	cfg, err := stores.LoadConfig(*configPath)
+	if err != nil {
+		exitErr(err)
+	}
+
+	s := server.New(cfg)
+	s.WatchInterval = *watchInterval
+	s.ProbeTimeout = *probeTimeout
+	if *policyPath != "" {
+		if s.Policy, err = auth.LoadPolicy(*policyPath); err != nil {
+			exitErr(err)
+		}
+	}
+
+	if s.Audit, err = audit.Open(*auditSpec, *auditKey); err != nil {
+		exitErr(err)
+	}
+	defer s.Audit.Close()
+	if s.Audit != nil && !s.Audit.Signed() {
+		s.Logger.Print("WARNING: audit entries are not signed; set -audit-hmac-key or KVTOOL_AUDIT_HMAC_KEY")
+	}
+
+	if (*tlsCert == "") != (*tlsKey == "") {
+		exitErr(errors.New("-tls-cert and -tls-key must be given together"))
+	}
+	if *clientCA != "" && *tlsCert == "" {
+		exitErr(errors.New("-client-ca requires -tls-cert/-tls-key"))
+	}
+	var tlsCfg *tls.Config
+	if *clientCA != "" {
+		pem, err := os.ReadFile(*clientCA)
+		if err != nil {
+			exitErr(err)
+		}
+		pool := x509.NewCertPool()
+		if !pool.AppendCertsFromPEM(pem) {
+			exitErr(fmt.Errorf("no certificates found in %s", *clientCA))
+		}
+		// 証明書なしのクライアントもトークンで認証できるように、提示された場合だけ検証する
+		tlsCfg = &tls.Config{
+			MinVersion: tls.VersionTLS12,
+			ClientCAs:  pool,
+			ClientAuth: tls.VerifyClientCertIfGiven,
+		}
+	}
+
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+	defer stop()
+
+	srv := &http.Server{
+		Addr:              *addr,
+		Handler:           s.Handler(),
+		ReadHeaderTimeout: 10 * time.Second,
+		TLSConfig:         tlsCfg,
+		// シグナルでリクエストの ctx も閉じる（watch の SSE が Shutdown を待たせないように）
+		BaseContext: func(net.Listener) context.Context { return ctx },
+	}
+
+	errc := make(chan error, 1)
+	go func() {
+		s.Logger.Printf("listening on %s", *addr)
+		if *tlsCert != "" {
+			errc <- srv.ListenAndServeTLS(*tlsCert, *tlsKey)
+			return
+		}
+		errc <- srv.ListenAndServe()
+	}()
+
+	select {
+	case err := <-errc:
+		if !errors.Is(err, http.ErrServerClosed) {
+			exitErr(err)
+		}
+	case <-ctx.Done():
+		shutdownCtx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+		defer cancel()
+		if err := srv.Shutdown(shutdownCtx); err != nil {
+			exitErr(err)
+		}
+	}
+}
@@ -8,10 +8,10 @@ import (
 	"os"
 	"sort"
 	"strconv"
-	"strings"
 	"time"
 
-	vaultapi "github.com/hashicorp/vault/api"
+	"github.com/sasano8/kvtool/internal/redact"
+	"github.com/sasano8/kvtool/internal/stores"
 )
 
 func VaultCmd(args []string) {
@@ -40,7 +40,7 @@ func VaultCmd(args []string) {
 	timeout := fs.Duration("timeout", 10*time.Second, "request timeout")
 
 	fs.Usage = func() {
-		fmt.Fprintln(os.Stderr, `Usage:
+		fmt.Fprint(os.Stderr, `Usage:
   kvtool vault -mount <mount> -path <path> [-kv 1|2] [-version N] [-field KEY] [-o <file>]
 
 Examples:
@@ -53,6 +53,9 @@ Examples:
   # 1キーだけ取り出す
   kvtool vault -mount secret -path app/prod -field password
 
+  # URI でも指定できる（?kv=1&version=3 も可）
+  kvtool vault vault://secret/app/prod#password
+
 Env:
   VAULT_ADDR, VAULT_TOKEN, VAULT_NAMESPACE, VAULT_* TLS vars are supported by vault/api config.
 `)
@@ -81,13 +84,27 @@ Env:
 		}
 	}
 
+	// vault://<mount>/<path>[?kv=&version=][#field]
+	if stores.IsURI(secretPath) {
+		ref, err := stores.ParseRef(secretPath)
+		if err != nil {
+			exitErr(err)
+		}
+		if ref.Scheme != "vault" {
+			exitErr(fmt.Errorf("%s:// URI given to vault (want vault://<mount>/<path>)", ref.Scheme))
+		}
+		if err := applyVaultRef(ref, addr, token, namespace, mount, &secretPath, kvVer, version, field); err != nil {
+			exitErr(err)
+		}
+	}
+
 	out, err := openOutput(outPath)
 	if err != nil {
 		exitErr(err)
 	}
 	defer out.Close()
 
-	data, err := readVaultKV(
+	data, err := stores.ReadVaultKV(
 		context.Background(),
 		*addr,
 		*token,
@@ -109,7 +126,7 @@ Env:
 			exitErr(fmt.Errorf("field %q not found in secret (available keys: %v)", *field, sortedKeys(data)))
 		}
 		// 文字列は素直に1行、それ以外はJSONで
-		switch x := v.(type) {
+		switch x := redact.Global().Value(*field, v).(type) {
 		case string:
 			_, _ = fmt.Fprintln(out, x)
 		default:
@@ -129,128 +146,46 @@ Env:
 	if *pretty {
 		enc.SetIndent("", "  ")
 	}
-	if err := enc.Encode(data); err != nil {
+	if err := enc.Encode(redact.Global().Map(data)); err != nil {
 		exitErr(err)
 	}
 }
 
-func readVaultKV(
-	parent context.Context,
-	addr, token, ns, mount, secretPath string,
-	kvVer int,
-	version int,
-	timeout time.Duration,
-) (map[string]any, error) {
-	cfg := vaultapi.DefaultConfig()
-	// VAULT_ADDR や TLS 系環境変数（VAULT_CACERT等）を反映
-	_ = cfg.ReadEnvironment()
-
-	client, err := vaultapi.NewClient(cfg)
-	if err != nil {
-		return nil, fmt.Errorf("vault client: %w", err)
-	}
-
-	if addr != "" {
-		if err := client.SetAddress(addr); err != nil {
-			return nil, fmt.Errorf("set addr: %w", err)
+// applyVaultRef は URI の内容でフラグを上書きする。フラグで指定した -field が優先
+func applyVaultRef(ref stores.Ref, addr, token, namespace, mount, path *string, kvVer, version *int, field *string) error {
+	a := ref.Store.Args
+	str := func(dst *string, key string) {
+		if v, ok := a[key].(string); ok {
+			*dst = v
 		}
 	}
-
-	// namespace は flag > env
-	if ns == "" {
-		ns = os.Getenv("VAULT_NAMESPACE")
-	}
-	if ns != "" {
-		client.SetNamespace(ns)
-	}
-
-	// token は flag > env（vault/api は token を自動では拾わないので明示）
-	if token == "" {
-		token = os.Getenv("VAULT_TOKEN")
-	}
-	if token == "" {
-		return nil, fmt.Errorf("missing Vault token: set -token or VAULT_TOKEN")
-	}
-	client.SetToken(token)
-
-	mount = strings.Trim(mount, "/")
-	secretPath = strings.Trim(secretPath, "/")
-
-	ctx, cancel := context.WithTimeout(parent, timeout)
-	defer cancel()
-
-	switch kvVer {
-	case 1:
-		sec, err := client.KVv1(mount).Get(ctx, secretPath)
-		if err != nil {
-			return nil, err
-		}
-		if sec == nil || sec.Data == nil {
-			return nil, fmt.Errorf("secret has no data (not found or empty)")
-		}
-		return toAnyMap(sec.Data), nil
-
-	case 2:
-		kv := client.KVv2(mount)
-		var sec *vaultapi.KVSecret
-
-		if version > 0 {
-			sec, err = kv.GetVersion(ctx, secretPath, version)
-		} else {
-			sec, err = kv.Get(ctx, secretPath)
+	num := func(dst *int, key string) error {
+		v, ok := a[key].(string)
+		if !ok {
+			return nil
 		}
-
-		// KVv2 helper が古いVaultで metadata 互換が崩れるケースがあるので、
-		// 失敗したら HTTP API の /data を直接叩くフォールバックに落とす（data だけ取る）
+		n, err := strconv.Atoi(v)
 		if err != nil {
-			raw, err2 := readVaultKVv2Raw(ctx, client, mount, secretPath, version)
-			if err2 == nil {
-				return raw, nil
-			}
-			return nil, err
-		}
-
-		if sec == nil || sec.Data == nil {
-			return nil, fmt.Errorf("secret has no data (deleted or empty)")
+			return fmt.Errorf("%s: %s=%q: %w", ref.Store.Name, key, v, err)
 		}
-		return toAnyMap(sec.Data), nil
-
-	default:
-		return nil, fmt.Errorf("invalid -kv %d (must be 1 or 2)", kvVer)
-	}
-}
-
-// KV v2 の HTTP API を直接叩いて data だけ抜くフォールバック
-// v2 の Read API は /<mount>/data/<path> を使う :contentReference[oaicite:1]{index=1}
-func readVaultKVv2Raw(ctx context.Context, client *vaultapi.Client, mount, secretPath string, version int) (map[string]any, error) {
-	apiPath := fmt.Sprintf("%s/data/%s", strings.Trim(mount, "/"), strings.Trim(secretPath, "/"))
-	q := map[string][]string{}
-	if version > 0 {
-		q["version"] = []string{strconv.Itoa(version)}
-	}
-
-	sec, err := client.Logical().ReadWithDataWithContext(ctx, apiPath, q)
-	if err != nil {
-		return nil, err
+		*dst = n
+		return nil
 	}
-	if sec == nil || sec.Data == nil {
-		return nil, fmt.Errorf("secret not found")
+	str(addr, "addr")
+	str(token, "token")
+	str(namespace, "namespace")
+	str(mount, "mount")
+	str(path, "path")
+	if err := num(kvVer, "kv"); err != nil {
+		return err
 	}
-
-	// KV v2 のレスポンスは Data["data"] に本体が入る :contentReference[oaicite:2]{index=2}
-	rawData, ok := sec.Data["data"].(map[string]interface{})
-	if !ok || rawData == nil {
-		return nil, fmt.Errorf("unexpected KV v2 response format at %s", apiPath)
+	if err := num(version, "version"); err != nil {
+		return err
 	}
-	return toAnyMap(rawData), nil
-}
-
-func toAnyMap(m map[string]interface{}) map[string]any {
-	out := make(map[string]any, len(m))
-	for k, v := range m {
-		out[k] = v
+	if *field == "" {
+		*field = ref.Key
 	}
-	return out
+	return nil
 }
 
 func sortedKeys(m map[string]any) []string {
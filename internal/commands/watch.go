@@ -0,0 +1,165 @@
+package commands
+
+import (
+	"context"
+	"encoding/json"
+	"flag"
+	"fmt"
+	"os"
+	"os/signal"
+	"sort"
+	"sync"
+	"sync/atomic"
+	"syscall"
+	"time"
+
+	"github.com/sasano8/kvtool/internal/redact"
+	"github.com/sasano8/kvtool/internal/stores"
+)
+
+func WatchCmd(args []string) {
+	fs := flag.NewFlagSet("watch", flag.ContinueOnError)
+	fs.SetOutput(os.Stderr)
+
+	var outPath string
+	fs.StringVar(&outPath, "o", "", "output file (default: stdout)")
+	fs.StringVar(&outPath, "output", "", "output file (default: stdout)")
+
+	configPath := fs.String("config", ".kvtool.json", "config file path")
+	ns := fs.String("ns", "default", "namespace name")
+	interval := fs.Duration("interval", 10*time.Second, "poll interval for stores without native watch")
+	initial := fs.Bool("initial", false, "emit every existing key as an event on start")
+
+	fs.Usage = func() {
+		fmt.Fprintln(os.Stderr, `Usage:
+  kvtool watch [-config .kvtool.json] [-ns default] [storeKey|uri ...]
+
+URIs (dotenv://./.env, vault://secret/app#password, kv://default/.env/KEY)
+watch a store without a config entry; a key in the URI limits the events to it.
+
+Streams one JSON event per line:
+  {"key":"A","old_hash":"sha256:...","new_hash":"sha256:...","source":"default/.env","timestamp":"..."}`)
+		fs.PrintDefaults()
+	}
+
+	if err := fs.Parse(args); err != nil {
+		os.Exit(2)
+	}
+
+	keys := fs.Args()
+	// 設定ファイルが要らないのは kv:// 以外の URI だけのとき
+	var cfg stores.Config
+	needConfig := len(keys) == 0
+	for _, k := range keys {
+		if ref, err := stores.ParseRef(k); err != nil || ref.Namespace != "" {
+			needConfig = true
+		}
+	}
+	if needConfig {
+		var err error
+		if cfg, err = stores.LoadConfig(*configPath); err != nil {
+			exitErr(err)
+		}
+	}
+
+	if len(keys) == 0 {
+		nsStores, ok := cfg.Namespaces[*ns]
+		if !ok {
+			exitErr(fmt.Errorf("namespace %q not found", *ns))
+		}
+		for k := range nsStores {
+			keys = append(keys, k)
+		}
+		sort.Strings(keys)
+	}
+
+	out, err := openOutput(outPath)
+	if err != nil {
+		exitErr(err)
+	}
+	defer out.Close()
+
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+	defer stop()
+
+	events := make(chan stores.Event)
+	var (
+		wg     sync.WaitGroup
+		failed atomic.Bool
+	)
+	// URI でキーを指定したストアはそのキーのイベントだけ流す（source -> keys）
+	only := map[string]map[string]bool{}
+	for _, key := range keys {
+		var (
+			st     stores.Store
+			source string
+		)
+		if stores.IsURI(key) {
+			ref, err := stores.ParseRef(key)
+			if err != nil {
+				exitErr(err)
+			}
+			source = ref.Store.Name
+			if _, dup := only[source]; dup {
+				// 同じストアの別のキー
+				if only[source] != nil && ref.Key != "" {
+					only[source][ref.Key] = true
+				} else {
+					only[source] = nil
+				}
+				continue
+			}
+			only[source] = nil
+			if ref.Key != "" {
+				only[source] = map[string]bool{ref.Key: true}
+			}
+			if st, err = ref.Open(cfg); err != nil {
+				exitErr(fmt.Errorf("store %q: %w", source, err))
+			}
+		} else {
+			k, sc, err := cfg.Lookup(*ns, key)
+			if err != nil {
+				exitErr(err)
+			}
+			if st, err = stores.Open(sc); err != nil {
+				exitErr(fmt.Errorf("store %q: %w", k, err))
+			}
+			source = *ns + "/" + k
+		}
+
+		opts := stores.WatchOptions{
+			Source:   source,
+			Interval: *interval,
+			Initial:  *initial,
+			OnError: func(err error) {
+				fmt.Fprintln(os.Stderr, "warn:", redact.Global().Error(err))
+			},
+		}
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			if err := stores.Watch(ctx, st, opts, events); err != nil {
+				fmt.Fprintln(os.Stderr, "error:", redact.Global().Error(err))
+				failed.Store(true)
+				stop()
+			}
+		}()
+	}
+	go func() {
+		wg.Wait()
+		close(events)
+	}()
+
+	enc := json.NewEncoder(out)
+	for ev := range events {
+		if keys := only[ev.Source]; keys != nil && !keys[ev.Key] {
+			continue
+		}
+		if err := enc.Encode(ev); err != nil {
+			exitErr(err)
+		}
+	}
+	if failed.Load() {
+		os.Exit(1)
+	}
+}
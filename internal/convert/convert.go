@@ -8,7 +8,10 @@ import (
 	"fmt"
 	"io"
 	"os"
+	"sort"
 	"strings"
+
+	"github.com/sasano8/kvtool/internal/redact"
 )
 
 // JSONToEnv converts a flat JSON object into .env format.
@@ -19,9 +22,11 @@ func JSONToEnv(r io.Reader, w io.Writer) error {
 		return err
 	}
 
+	// -redact のときは秘密の値を伏せる
+	rd := redact.Global()
 	for k, v := range m {
-		val := fmt.Sprint(v)           // JSON の値を文字列に
-		escaped := escapeEnvValue(val) // ダブルクォート用にエスケープ
+		val := fmt.Sprint(rd.Value(k, v)) // JSON の値を文字列に
+		escaped := escapeEnvValue(val)    // ダブルクォート用にエスケープ
 
 		if _, err := fmt.Fprintf(w, "%s=\"%s\"\n", k, escaped); err != nil {
 			return err
@@ -30,6 +35,30 @@ func JSONToEnv(r io.Reader, w io.Writer) error {
 	return nil
 }
 
+// WriteDotenv writes m as KEY="value" lines sorted by key for people to
+// read; secret values are masked in -redact mode. Use FormatDotenv for
+// files that are read back.
+func WriteDotenv(w io.Writer, m map[string]any) error {
+	return FormatDotenv(w, redact.Global().Map(m))
+}
+
+// FormatDotenv writes m as KEY="value" lines sorted by key, unredacted.
+func FormatDotenv(w io.Writer, m map[string]any) error {
+	keys := make([]string, 0, len(m))
+	for k := range m {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+
+	for _, k := range keys {
+		val := fmt.Sprint(m[k])
+		if _, err := fmt.Fprintf(w, "%s=\"%s\"\n", k, escapeEnvValue(val)); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
 func EnvToJSON(w io.Writer) error {
 	var buf bytes.Buffer
 
@@ -43,6 +72,45 @@ func EnvToJSON(w io.Writer) error {
 
 // EnvToJSON converts .env-style lines into a JSON object.
 func DotenvToJSON(r io.Reader, w io.Writer) error {
+	result, err := ParseDotenv(r)
+	if err != nil {
+		return err
+	}
+
+	enc := json.NewEncoder(w)
+	enc.SetIndent("", "  ")
+	return enc.Encode(redact.Global().StringMap(result))
+}
+
+// EnvMap returns the current process environment as a map.
+func EnvMap() (map[string]string, error) {
+	var buf bytes.Buffer
+
+	for _, kv := range os.Environ() {
+		if _, err := buf.WriteString(kv + "\n"); err != nil {
+			return nil, err
+		}
+	}
+	return ParseDotenv(&buf)
+}
+
+// ParseJSON parses a JSON object into a map. Numbers are kept as
+// json.Number so large integers survive.
+func ParseJSON(r io.Reader) (map[string]any, error) {
+	dec := json.NewDecoder(r)
+	dec.UseNumber()
+	var m map[string]any
+	if err := dec.Decode(&m); err != nil {
+		return nil, err
+	}
+	if m == nil {
+		return nil, errors.New("expected a JSON object, got null")
+	}
+	return m, nil
+}
+
+// ParseDotenv parses .env-style lines into a map.
+func ParseDotenv(r io.Reader) (map[string]string, error) {
 	scanner := bufio.NewScanner(r)
 	result := make(map[string]string)
 
@@ -54,13 +122,13 @@ func DotenvToJSON(r io.Reader, w io.Writer) error {
 
 		idx := strings.Index(line, "=")
 		if idx <= 0 {
-			return fmt.Errorf("invalid line: %q", line)
+			return nil, fmt.Errorf("invalid line: %q", line)
 		}
 
 		key := strings.TrimSpace(line[:idx])
 		val := strings.TrimSpace(line[idx+1:])
 		if key == "" {
-			return errors.New("empty key")
+			return nil, errors.New("empty key")
 		}
 
 		// quoted value の処理
@@ -79,12 +147,9 @@ func DotenvToJSON(r io.Reader, w io.Writer) error {
 	}
 
 	if err := scanner.Err(); err != nil {
-		return err
+		return nil, err
 	}
-
-	enc := json.NewEncoder(w)
-	enc.SetIndent("", "  ")
-	return enc.Encode(result)
+	return result, nil
 }
 
 // .env のダブルクォート値として安全になるようにエスケープ
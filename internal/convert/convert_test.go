@@ -2,8 +2,11 @@ package convert
 
 import (
 	"bytes"
+	"fmt"
 	"strings"
 	"testing"
+
+	"github.com/sasano8/kvtool/internal/redact"
 )
 
 func TestJSONToEnv(t *testing.T) {
@@ -56,3 +59,54 @@ NUM=123
 		t.Errorf("expected NUM in json, got:\n%s", out)
 	}
 }
+
+func TestRedact(t *testing.T) {
+	redact.SetGlobal(redact.New(0))
+	t.Cleanup(func() { redact.SetGlobal(nil) })
+
+	m := map[string]any{"DB_PASSWORD": "hunter22", "USER": "app"}
+
+	var buf bytes.Buffer
+	if err := WriteDotenv(&buf, m); err != nil {
+		t.Fatal(err)
+	}
+	if got := buf.String(); got != "DB_PASSWORD=\"****\"\nUSER=\"app\"\n" {
+		t.Errorf("WriteDotenv: got:\n%s", got)
+	}
+
+	// 保存用は伏せない
+	buf.Reset()
+	if err := FormatDotenv(&buf, m); err != nil {
+		t.Fatal(err)
+	}
+	if !strings.Contains(buf.String(), `DB_PASSWORD="hunter22"`) {
+		t.Errorf("FormatDotenv: got:\n%s", buf.String())
+	}
+
+	buf.Reset()
+	if err := DotenvToJSON(strings.NewReader("API_TOKEN=abc123\n"), &buf); err != nil {
+		t.Fatal(err)
+	}
+	if strings.Contains(buf.String(), "abc123") {
+		t.Errorf("DotenvToJSON: got:\n%s", buf.String())
+	}
+}
+
+func TestParseJSON(t *testing.T) {
+	m, err := ParseJSON(strings.NewReader(`{"FOO": "bar", "ID": 12345678901234567890}`))
+	if err != nil {
+		t.Fatalf("ParseJSON error: %v", err)
+	}
+	if m["FOO"] != "bar" {
+		t.Errorf("FOO = %v", m["FOO"])
+	}
+	if fmt.Sprint(m["ID"]) != "12345678901234567890" {
+		t.Errorf("ID = %v", m["ID"])
+	}
+
+	for _, in := range []string{`null`, `[1]`, `"x"`, `{`} {
+		if _, err := ParseJSON(strings.NewReader(in)); err == nil {
+			t.Errorf("ParseJSON(%s): expected error", in)
+		}
+	}
+}
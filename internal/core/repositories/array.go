@@ -2,45 +2,170 @@ package repository
 
 import (
 	"context"
+	"errors"
 	"fmt"
-	"time"
+	"strings"
 )
 
+// FS is a directory of entries. An entry that is itself an FS (or a
+// Repository, a *Concurrent, a Mounter or, in an FS[any], a map[string]any)
+// is a sub directory; anything else is a leaf.
+// Paths separate the levels with "/", which is why keys created here may not
+// contain it. Keys read from a store may: resolving tries the longest key
+// that matches the start of the path first, so "a/b" finds a flat "a/b" as
+// well as "b" inside "a".
 type FS[T any] map[string]T
 
+// Mounter is an entry whose children are produced on demand, e.g. a store
+// that is only read when a path goes through it.
+type Mounter[T any] interface {
+	Mount(ctx context.Context) (FS[T], error)
+}
+
+var (
+	// パスの途中に葉があって、その先に進めない
+	ErrNotDir = errors.New("not a directory")
+	// ディレクトリを T として返せない
+	ErrIsDir = errors.New("is a directory")
+)
+
+// ResolveFs walks path down nested directories of fs and returns the last
+// directory reached with the part of path left inside it: "" when path
+// names a directory, or the key of a leaf.
 func ResolveFs[T any](fs FS[T], path string) (FS[T], string, error) {
-	parentContext := context.Background()
-	timeoutContext, cancel := context.WithTimeout(parentContext, 5*time.Second)
-	defer cancel()
+	return ResolveFsContext(context.Background(), fs, path)
+}
 
+// ResolveFsContext is ResolveFs that stops when ctx is done, e.g. while a
+// Mounter is fetching a store.
+func ResolveFsContext[T any](ctx context.Context, fs FS[T], path string) (FS[T], string, error) {
 	resolved_fs := fs
 	remain_path := path
 	var err error
 
 	for {
-		if err == ErrSuccess {
-			break
+		if err := ctx.Err(); err != nil {
+			return nil, remain_path, err
 		}
-
-		select {
-		case <-timeoutContext.Done():
-			return nil, "", fmt.Errorf("Operation timed out")
-		default:
-			resolved_fs, remain_path, err = resolvedFs(parentContext, resolved_fs, remain_path)
+		resolved_fs, remain_path, err = resolvedFs(ctx, resolved_fs, remain_path)
+		if err != nil {
+			break
 		}
 	}
 
 	if err == ErrSuccess {
 		return resolved_fs, remain_path, nil
-	} else {
-		if err == nil {
-			panic("Invalid status.")
-		}
-		return nil, remain_path, err
 	}
+	return nil, remain_path, err
 }
 
+// resolvedFs は1段だけ進む。終端に着いたら ErrSuccess を返す
 func resolvedFs[T any](ctx context.Context, fs FS[T], path string) (FS[T], string, error) {
-	resolved_fs := fs
-	return resolved_fs, "remain_path", fmt.Errorf("")
+	path = strings.TrimLeft(path, "/")
+	if path == "" {
+		return fs, "", ErrSuccess
+	}
+	name, rest, ok := LongestKey(fs, path)
+	if !ok {
+		name, _, _ = strings.Cut(path, "/")
+		return nil, path, fmt.Errorf("%w: %s", ErrNotFound, name)
+	}
+	v := fs[name]
+	child, isDir, err := asFS(ctx, v)
+	if err != nil {
+		return nil, path, fmt.Errorf("%s: %w", name, err)
+	}
+	if !isDir {
+		if strings.Trim(rest, "/") != "" {
+			return nil, path, fmt.Errorf("%w: %s", ErrNotDir, name)
+		}
+		return fs, name, ErrSuccess
+	}
+	return child, rest, nil
+}
+
+// LongestKey returns the longest key of fs that path starts with (a whole
+// "/"-separated prefix) and the rest of path.
+func LongestKey[T any](fs FS[T], path string) (string, string, bool) {
+	for i := len(path); i > 0; i = strings.LastIndex(path[:i], "/") {
+		if _, ok := fs[path[:i]]; ok {
+			return path[:i], strings.TrimPrefix(path[i:], "/"), true
+		}
+	}
+	return "", path, false
+}
+
+func asFS[T any](ctx context.Context, v T) (FS[T], bool, error) {
+	// ストアから読んだ入れ子の値（JSON のオブジェクトなど）
+	if m, ok := any(v).(map[string]any); ok {
+		if fs, ok := any(FS[any](m)).(FS[T]); ok {
+			return fs, true, nil
+		}
+	}
+	switch x := any(v).(type) {
+	case FS[T]:
+		return x, true, nil
+	case Repository[T]:
+		return FS[T](x), true, nil
+	case *Concurrent[T]:
+		fs, err := x.Snapshot(ctx)
+		return fs, err == nil, err
+	case Mounter[T]:
+		fs, err := x.Mount(ctx)
+		return fs, err == nil, err
+	default:
+		return nil, false, nil
+	}
+}
+
+// Lookup returns the entry at path. A directory is returned as T when T can
+// hold it (e.g. T is any), otherwise ErrIsDir.
+func Lookup[T any](ctx context.Context, fs FS[T], path string) (T, error) {
+	var zero T
+	dir, name, err := ResolveFsContext(ctx, fs, path)
+	if err != nil {
+		return zero, err
+	}
+	if name != "" {
+		return dir.Get(name)
+	}
+	if v, ok := any(dir).(T); ok {
+		return v, nil
+	}
+	return zero, fmt.Errorf("%w: %s", ErrIsDir, path)
+}
+
+// Get returns the entry called key in this directory only.
+func (fs FS[T]) Get(key string) (T, error) {
+	return Repository[T](fs).Get(key)
+}
+
+// Mount puts v at path, creating the directories on the way. T must be able
+// to hold an FS[T] (e.g. any) for paths with more than one level.
+func (fs FS[T]) Mount(path string, v T) error {
+	parts := strings.Split(strings.Trim(path, "/"), "/")
+	dir := fs
+	for _, name := range parts[:len(parts)-1] {
+		if err := ValidatePath(name); err != nil {
+			return err
+		}
+		cur, ok := dir[name]
+		if !ok {
+			sub := FS[T]{}
+			t, ok := any(sub).(T)
+			if !ok {
+				return fmt.Errorf("%w: cannot create directory %q in FS[%T]", ErrNotDir, name, cur)
+			}
+			dir[name] = t
+			dir = sub
+			continue
+		}
+		sub, ok := any(cur).(FS[T])
+		if !ok {
+			return fmt.Errorf("%w: %s", ErrNotDir, name)
+		}
+		dir = sub
+	}
+	_, err := Repository[T](dir).Create(parts[len(parts)-1], v)
+	return err
 }
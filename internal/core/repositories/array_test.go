@@ -0,0 +1,121 @@
+package repository
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+)
+
+type lazyDir struct {
+	fs    FS[any]
+	err   error
+	calls *int
+}
+
+func (d lazyDir) Mount(ctx context.Context) (FS[any], error) {
+	*d.calls++
+	return d.fs, d.err
+}
+
+func TestResolveFs(t *testing.T) {
+	r := require.New(t)
+
+	var calls int
+	root := FS[any]{
+		"default": FS[any]{
+			"vault": lazyDir{fs: FS[any]{"password": "pw"}, calls: &calls},
+			".env":  Repository[any]{"A": "1"},
+		},
+		"top": "leaf",
+	}
+
+	fs, name, err := ResolveFs(root, "/default/vault/password")
+	r.NoError(err)
+	r.Equal("password", name)
+	r.Equal("pw", fs["password"])
+	r.Equal(1, calls)
+
+	fs, name, err = ResolveFs(root, "default/.env/")
+	r.NoError(err)
+	r.Equal("", name)
+	r.Equal(FS[any]{"A": "1"}, fs)
+
+	fs, name, err = ResolveFs(root, "/")
+	r.NoError(err)
+	r.Equal("", name)
+	r.Equal(root, fs)
+
+	_, name, err = ResolveFs(root, "top")
+	r.NoError(err)
+	r.Equal("top", name)
+
+	_, _, err = ResolveFs(root, "/default/nope/x")
+	r.ErrorIs(err, ErrNotFound)
+
+	_, _, err = ResolveFs(root, "/top/x")
+	r.ErrorIs(err, ErrNotDir)
+
+	boom := errors.New("boom")
+	root["broken"] = lazyDir{err: boom, calls: &calls}
+	_, _, err = ResolveFs(root, "/broken/x")
+	r.ErrorIs(err, boom)
+}
+
+func TestResolveFsContext(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+
+	start := time.Now()
+	_, _, err := ResolveFsContext(ctx, FS[int]{"a": 1}, "/a")
+	require.ErrorIs(t, err, context.Canceled)
+	require.Less(t, time.Since(start), time.Second)
+}
+
+func TestLookup(t *testing.T) {
+	r := require.New(t)
+	ctx := context.Background()
+
+	root := FS[any]{}
+	r.NoError(root.Mount("/default/vault/password", "pw"))
+	r.NoError(root.Mount("default/.env", FS[any]{"A": "1"}))
+	r.ErrorIs(root.Mount("default/vault/password", "again"), ErrKeyExists)
+	r.ErrorIs(root.Mount("default/vault/password/x", "y"), ErrNotDir)
+	r.ErrorIs(root.Mount("bad*/x", "y"), ErrBadChar)
+
+	v, err := Lookup(ctx, root, "/default/vault/password")
+	r.NoError(err)
+	r.Equal("pw", v)
+
+	v, err = Lookup(ctx, root, "/default/.env")
+	r.NoError(err)
+	r.Equal(FS[any]{"A": "1"}, v)
+
+	_, err = Lookup(ctx, root, "/default/vault/user")
+	r.ErrorIs(err, ErrNotFound)
+
+	// ストアから読んだ入れ子の map と "/" を含むキー
+	data := FS[any]{"db": map[string]any{"password": "pw"}, "a/b": "flat", "a": map[string]any{"c": "nested"}}
+	v, err = Lookup(ctx, data, "db/password")
+	r.NoError(err)
+	r.Equal("pw", v)
+	v, err = Lookup(ctx, data, "a/b")
+	r.NoError(err)
+	r.Equal("flat", v)
+	v, err = Lookup(ctx, data, "a/c")
+	r.NoError(err)
+	r.Equal("nested", v)
+	_, err = Lookup(ctx, data, "db/password/x")
+	r.ErrorIs(err, ErrNotDir)
+
+	// T がディレクトリを持てない場合
+	ints := FS[int]{"a": 1}
+	n, err := Lookup(ctx, ints, "a")
+	r.NoError(err)
+	r.Equal(1, n)
+	_, err = Lookup(ctx, ints, "/")
+	r.ErrorIs(err, ErrIsDir)
+	r.ErrorIs(ints.Mount("x/y", 2), ErrNotDir)
+}
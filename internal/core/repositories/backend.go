@@ -0,0 +1,17 @@
+package repository
+
+// Backend is the Get/Create/Put/Delete contract of Repository, shared by
+// the persistent implementations (FileRepository, BoltRepository).
+//
+//   - Get of a missing key returns ErrNotFound.
+//   - Create of an existing key returns ErrKeyExists and keeps the value.
+//   - Put and Create reject keys that fail ValidatePath (ErrEmptyPath, ErrBadChar).
+//   - Delete of a missing key returns ErrNotFound.
+type Backend[T any] interface {
+	Get(key string) (T, error)
+	Create(key string, value T) (T, error)
+	Put(key string, value T) (T, error)
+	Delete(key string) error
+}
+
+var _ Backend[int] = Repository[int]{}
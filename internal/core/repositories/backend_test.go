@@ -0,0 +1,159 @@
+package repository
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+type item struct {
+	Name string `json:"name"`
+	N    int    `json:"n"`
+}
+
+// backends は適合テストを流す実装の一覧。reopen は同じ保存先を開き直す
+var backends = []struct {
+	name string
+	open func(t *testing.T) (repo Backend[item], reopen func() Backend[item])
+}{
+	{"memory", func(t *testing.T) (Backend[item], func() Backend[item]) {
+		m := New[item]()
+		return m, func() Backend[item] { return m }
+	}},
+	{"file", func(t *testing.T) (Backend[item], func() Backend[item]) {
+		path := filepath.Join(t.TempDir(), "sub", "repo.json")
+		return NewFile[item](path), func() Backend[item] { return NewFile[item](path) }
+	}},
+	{"bolt", func(t *testing.T) (Backend[item], func() Backend[item]) {
+		path := filepath.Join(t.TempDir(), "repo.db")
+		open := func() *BoltRepository[item] {
+			r, err := OpenBolt[item](path, "items")
+			require.NoError(t, err)
+			return r
+		}
+		cur := open()
+		t.Cleanup(func() { cur.Close() })
+		return cur, func() Backend[item] {
+			// bbolt はファイルをロックするので閉じてから開き直す
+			require.NoError(t, cur.Close())
+			cur = open()
+			return cur
+		}
+	}},
+}
+
+func TestBackendConformance(t *testing.T) {
+	for _, b := range backends {
+		t.Run(b.name, func(t *testing.T) {
+			r := require.New(t)
+			repo, reopen := b.open(t)
+
+			_, err := repo.Get("a")
+			r.ErrorIs(err, ErrNotFound)
+
+			v, err := repo.Create("a", item{"x", 1})
+			r.NoError(err)
+			r.Equal(item{"x", 1}, v)
+
+			_, err = repo.Create("a", item{"y", 2})
+			r.ErrorIs(err, ErrKeyExists)
+			v, err = repo.Get("a")
+			r.NoError(err)
+			r.Equal(item{"x", 1}, v)
+
+			v, err = repo.Put("a", item{"z", 3})
+			r.NoError(err)
+			r.Equal(item{"z", 3}, v)
+
+			for _, bad := range []string{"a/b", "a*", `a"b`, "a?"} {
+				_, err = repo.Put(bad, item{})
+				r.ErrorIs(err, ErrBadChar, bad)
+				_, err = repo.Create(bad, item{})
+				r.ErrorIs(err, ErrBadChar, bad)
+			}
+			_, err = repo.Put("", item{})
+			r.ErrorIs(err, ErrEmptyPath)
+
+			_, err = repo.Put("b", item{"b", 4})
+			r.NoError(err)
+
+			// 開き直しても残っている
+			repo = reopen()
+			v, err = repo.Get("a")
+			r.NoError(err)
+			r.Equal(item{"z", 3}, v)
+
+			r.NoError(repo.Delete("a"))
+			r.ErrorIs(repo.Delete("a"), ErrNotFound)
+			_, err = repo.Get("a")
+			r.ErrorIs(err, ErrNotFound)
+
+			repo = reopen()
+			_, err = repo.Get("a")
+			r.ErrorIs(err, ErrNotFound)
+			v, err = repo.Get("b")
+			r.NoError(err)
+			r.Equal(item{"b", 4}, v)
+		})
+	}
+}
+
+func TestFileRepositoryAtomic(t *testing.T) {
+	r := require.New(t)
+	dir := t.TempDir()
+	path := filepath.Join(dir, "repo.json")
+	repo := NewFile[int](path)
+
+	_, err := repo.Put("a", 1)
+	r.NoError(err)
+	fi, err := os.Stat(path)
+	r.NoError(err)
+	r.Equal(os.FileMode(0o600), fi.Mode().Perm())
+
+	// 既存ファイルの権限は保つ
+	r.NoError(os.Chmod(path, 0o640))
+	_, err = repo.Put("b", 2)
+	r.NoError(err)
+	fi, err = os.Stat(path)
+	r.NoError(err)
+	r.Equal(os.FileMode(0o640), fi.Mode().Perm())
+
+	// 失敗した操作はファイルに触らない
+	before, err := os.ReadFile(path)
+	r.NoError(err)
+	_, err = repo.Create("a", 9)
+	r.ErrorIs(err, ErrKeyExists)
+	after, err := os.ReadFile(path)
+	r.NoError(err)
+	r.Equal(before, after)
+
+	// 一時ファイルが残らない
+	entries, err := os.ReadDir(dir)
+	r.NoError(err)
+	r.Len(entries, 1)
+
+	all, err := repo.Load()
+	r.NoError(err)
+	r.Equal(Repository[int]{"a": 1, "b": 2}, all)
+
+	r.NoError(os.WriteFile(path, []byte("{broken"), 0o600))
+	_, err = repo.Get("a")
+	r.ErrorContains(err, "parse")
+}
+
+func TestBoltLoad(t *testing.T) {
+	r := require.New(t)
+	repo, err := OpenBolt[int](filepath.Join(t.TempDir(), "repo.db"), "nums")
+	r.NoError(err)
+	defer repo.Close()
+
+	_, err = repo.Put("a", 1)
+	r.NoError(err)
+	_, err = repo.Put("b", 2)
+	r.NoError(err)
+	all, err := repo.Load()
+	r.NoError(err)
+	r.Equal(Repository[int]{"a": 1, "b": 2}, all)
+}
@@ -0,0 +1,113 @@
+package repository
+
+import (
+	"encoding/json"
+	"fmt"
+	"time"
+
+	bolt "go.etcd.io/bbolt"
+)
+
+// BoltRepository stores the entries in a bucket of a bbolt database (an
+// embedded, pure Go key/value file). Values are JSON encoded.
+type BoltRepository[T any] struct {
+	db     *bolt.DB
+	bucket []byte
+}
+
+var _ Backend[int] = (*BoltRepository[int])(nil)
+
+// OpenBolt opens (or creates) the database at path and the bucket in it.
+// The file is locked while open; another process waits up to a second.
+func OpenBolt[T any](path, bucket string) (*BoltRepository[T], error) {
+	db, err := bolt.Open(path, 0o600, &bolt.Options{Timeout: time.Second})
+	if err != nil {
+		return nil, fmt.Errorf("open %s: %w", path, err)
+	}
+	r := &BoltRepository[T]{db: db, bucket: []byte(bucket)}
+	err = db.Update(func(tx *bolt.Tx) error {
+		_, err := tx.CreateBucketIfNotExists(r.bucket)
+		return err
+	})
+	if err != nil {
+		db.Close()
+		return nil, fmt.Errorf("bucket %q: %w", bucket, err)
+	}
+	return r, nil
+}
+
+func (r *BoltRepository[T]) Close() error {
+	return r.db.Close()
+}
+
+func (r *BoltRepository[T]) Get(key string) (T, error) {
+	var v T
+	err := r.db.View(func(tx *bolt.Tx) error {
+		b := tx.Bucket(r.bucket).Get([]byte(key))
+		if b == nil {
+			return fmt.Errorf("%w: %s", ErrNotFound, key)
+		}
+		return json.Unmarshal(b, &v)
+	})
+	if err != nil {
+		var zero T
+		return zero, err
+	}
+	return v, nil
+}
+
+func (r *BoltRepository[T]) Create(key string, value T) (T, error) {
+	return r.put(key, value, true)
+}
+
+func (r *BoltRepository[T]) Put(key string, value T) (T, error) {
+	return r.put(key, value, false)
+}
+
+func (r *BoltRepository[T]) put(key string, value T, create bool) (T, error) {
+	var zero T
+	if err := ValidatePath(key); err != nil {
+		return zero, err
+	}
+	b, err := json.Marshal(value)
+	if err != nil {
+		return zero, err
+	}
+	err = r.db.Update(func(tx *bolt.Tx) error {
+		bk := tx.Bucket(r.bucket)
+		if create && bk.Get([]byte(key)) != nil {
+			return fmt.Errorf("%w: %s", ErrKeyExists, key)
+		}
+		return bk.Put([]byte(key), b)
+	})
+	if err != nil {
+		return zero, err
+	}
+	return value, nil
+}
+
+func (r *BoltRepository[T]) Delete(key string) error {
+	return r.db.Update(func(tx *bolt.Tx) error {
+		bk := tx.Bucket(r.bucket)
+		if bk.Get([]byte(key)) == nil {
+			return fmt.Errorf("%w: %s", ErrNotFound, key)
+		}
+		return bk.Delete([]byte(key))
+	})
+}
+
+// Load returns all entries.
+func (r *BoltRepository[T]) Load() (Repository[T], error) {
+	m := New[T]()
+	err := r.db.View(func(tx *bolt.Tx) error {
+		return tx.Bucket(r.bucket).ForEach(func(k, b []byte) error {
+			var v T
+			if err := json.Unmarshal(b, &v); err != nil {
+				return fmt.Errorf("%s: %w", k, err)
+			}
+			m[string(k)] = v
+			return nil
+		})
+	})
+	return m, err
+}
@@ -0,0 +1,254 @@
+package repository
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sort"
+	"strings"
+	"sync"
+)
+
+// ErrConflict is returned by CompareAndSwap / CompareAndDelete when the
+// entry is no longer at the expected revision.
+var ErrConflict = errors.New("revision conflict")
+
+// Entry is a value with the revision of its last change.
+type Entry[T any] struct {
+	Key      string
+	Value    T
+	Revision uint64
+}
+
+type EventType string
+
+const (
+	EventPut    EventType = "put"
+	EventDelete EventType = "delete"
+)
+
+// Event is a change sent to subscribers. Value is the zero value on delete.
+type Event[T any] struct {
+	Type     EventType
+	Key      string
+	Value    T
+	Revision uint64
+}
+
+// Concurrent is a Repository that is safe for use by multiple goroutines.
+// Every change gets a new revision from a counter shared by all keys, so
+// revisions also order the events.
+type Concurrent[T any] struct {
+	mu    sync.RWMutex
+	items map[string]Entry[T]
+	rev   uint64
+	subs  map[*subscriber[T]]struct{}
+}
+
+type subscriber[T any] struct {
+	prefix string
+	ch     chan Event[T]
+}
+
+func NewConcurrent[T any]() *Concurrent[T] {
+	return &Concurrent[T]{
+		items: map[string]Entry[T]{},
+		subs:  map[*subscriber[T]]struct{}{},
+	}
+}
+
+// Revision returns the revision of the latest change.
+func (c *Concurrent[T]) Revision() uint64 {
+	c.mu.RLock()
+	defer c.mu.RUnlock()
+	return c.rev
+}
+
+func (c *Concurrent[T]) Len() int {
+	c.mu.RLock()
+	defer c.mu.RUnlock()
+	return len(c.items)
+}
+
+func (c *Concurrent[T]) Get(ctx context.Context, key string) (T, error) {
+	e, err := c.GetEntry(ctx, key)
+	return e.Value, err
+}
+
+func (c *Concurrent[T]) GetEntry(ctx context.Context, key string) (Entry[T], error) {
+	if err := ctx.Err(); err != nil {
+		return Entry[T]{}, err
+	}
+	c.mu.RLock()
+	defer c.mu.RUnlock()
+	if e, ok := c.items[key]; ok {
+		return e, nil
+	}
+	return Entry[T]{}, fmt.Errorf("%w: %s", ErrNotFound, key)
+}
+
+func (c *Concurrent[T]) Create(ctx context.Context, key string, value T) (Entry[T], error) {
+	return c.CompareAndSwap(ctx, key, 0, value)
+}
+
+func (c *Concurrent[T]) Put(ctx context.Context, key string, value T) (Entry[T], error) {
+	if err := ctx.Err(); err != nil {
+		return Entry[T]{}, err
+	}
+	if err := ValidatePath(key); err != nil {
+		return Entry[T]{}, err
+	}
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.put(key, value), nil
+}
+
+// CompareAndSwap stores value only if the entry is at revision rev.
+// rev 0 means the key must not exist yet.
+func (c *Concurrent[T]) CompareAndSwap(ctx context.Context, key string, rev uint64, value T) (Entry[T], error) {
+	if err := ctx.Err(); err != nil {
+		return Entry[T]{}, err
+	}
+	if err := ValidatePath(key); err != nil {
+		return Entry[T]{}, err
+	}
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	cur, ok := c.items[key]
+	switch {
+	case rev == 0 && ok:
+		return cur, fmt.Errorf("%w: %s", ErrKeyExists, key)
+	case rev != 0 && !ok:
+		return Entry[T]{}, fmt.Errorf("%w: %s", ErrNotFound, key)
+	case rev != 0 && cur.Revision != rev:
+		return cur, fmt.Errorf("%w: %s is at revision %d, not %d", ErrConflict, key, cur.Revision, rev)
+	}
+	return c.put(key, value), nil
+}
+
+func (c *Concurrent[T]) Delete(ctx context.Context, key string) error {
+	return c.CompareAndDelete(ctx, key, 0)
+}
+
+// CompareAndDelete deletes the entry only if it is at revision rev.
+// rev 0 deletes whatever revision it has.
+func (c *Concurrent[T]) CompareAndDelete(ctx context.Context, key string, rev uint64) error {
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	cur, ok := c.items[key]
+	if !ok {
+		return fmt.Errorf("%w: %s", ErrNotFound, key)
+	}
+	if rev != 0 && cur.Revision != rev {
+		return fmt.Errorf("%w: %s is at revision %d, not %d", ErrConflict, key, cur.Revision, rev)
+	}
+	delete(c.items, key)
+	c.rev++
+	c.notify(Event[T]{Type: EventDelete, Key: key, Revision: c.rev})
+	return nil
+}
+
+// put と notify は c.mu を持った状態で呼ぶ
+func (c *Concurrent[T]) put(key string, value T) Entry[T] {
+	c.rev++
+	e := Entry[T]{Key: key, Value: value, Revision: c.rev}
+	c.items[key] = e
+	c.notify(Event[T]{Type: EventPut, Key: key, Value: value, Revision: c.rev})
+	return e
+}
+
+// Range calls fn for a snapshot of the entries in key order until fn
+// returns false or ctx is done. fn may modify the repository.
+func (c *Concurrent[T]) Range(ctx context.Context, fn func(Entry[T]) bool) error {
+	entries, err := c.List(ctx, "")
+	if err != nil {
+		return err
+	}
+	for _, e := range entries {
+		if err := ctx.Err(); err != nil {
+			return err
+		}
+		if !fn(e) {
+			return nil
+		}
+	}
+	return nil
+}
+
+// List returns the entries whose key starts with prefix, in key order.
+func (c *Concurrent[T]) List(ctx context.Context, prefix string) ([]Entry[T], error) {
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+	c.mu.RLock()
+	out := make([]Entry[T], 0, len(c.items))
+	for k, e := range c.items {
+		if strings.HasPrefix(k, prefix) {
+			out = append(out, e)
+		}
+	}
+	c.mu.RUnlock()
+	sort.Slice(out, func(i, j int) bool { return out[i].Key < out[j].Key })
+	return out, nil
+}
+
+// Snapshot copies the current values into an FS.
+func (c *Concurrent[T]) Snapshot(ctx context.Context) (FS[T], error) {
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+	c.mu.RLock()
+	defer c.mu.RUnlock()
+	fs := make(FS[T], len(c.items))
+	for k, e := range c.items {
+		fs[k] = e.Value
+	}
+	return fs, nil
+}
+
+// Subscribe sends the changes of keys starting with prefix, in revision
+// order, until ctx is done; then the channel is closed. Writers never wait
+// for subscribers: one that lets more than buffer events pile up is closed
+// early and has to re-read (List) and subscribe again.
+func (c *Concurrent[T]) Subscribe(ctx context.Context, prefix string, buffer int) <-chan Event[T] {
+	if buffer <= 0 {
+		buffer = 64
+	}
+	s := &subscriber[T]{prefix: prefix, ch: make(chan Event[T], buffer)}
+
+	c.mu.Lock()
+	c.subs[s] = struct{}{}
+	c.mu.Unlock()
+
+	go func() {
+		<-ctx.Done()
+		c.mu.Lock()
+		defer c.mu.Unlock()
+		c.unsubscribe(s)
+	}()
+	return s.ch
+}
+
+func (c *Concurrent[T]) notify(ev Event[T]) {
+	for s := range c.subs {
+		if !strings.HasPrefix(ev.Key, s.prefix) {
+			continue
+		}
+		select {
+		case s.ch <- ev:
+		default:
+			// 追いつけない購読者は切る（書き込み側を止めない）
+			c.unsubscribe(s)
+		}
+	}
+}
+
+func (c *Concurrent[T]) unsubscribe(s *subscriber[T]) {
+	if _, ok := c.subs[s]; ok {
+		delete(c.subs, s)
+		close(s.ch)
+	}
+}
@@ -0,0 +1,156 @@
+package repository
+
+import (
+	"context"
+	"fmt"
+	"sync"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestConcurrent(t *testing.T) {
+	r := require.New(t)
+	ctx := context.Background()
+	c := NewConcurrent[int]()
+
+	e, err := c.Create(ctx, "a", 1)
+	r.NoError(err)
+	r.Equal(uint64(1), e.Revision)
+	_, err = c.Create(ctx, "a", 2)
+	r.ErrorIs(err, ErrKeyExists)
+
+	v, err := c.Get(ctx, "a")
+	r.NoError(err)
+	r.Equal(1, v)
+
+	// 古いリビジョンでは書けない
+	e, err = c.CompareAndSwap(ctx, "a", 1, 10)
+	r.NoError(err)
+	r.Equal(uint64(2), e.Revision)
+	_, err = c.CompareAndSwap(ctx, "a", 1, 20)
+	r.ErrorIs(err, ErrConflict)
+	_, err = c.CompareAndSwap(ctx, "missing", 1, 20)
+	r.ErrorIs(err, ErrNotFound)
+	r.ErrorIs(c.CompareAndDelete(ctx, "a", 1), ErrConflict)
+
+	_, err = c.Put(ctx, "bad/key", 1)
+	r.ErrorIs(err, ErrBadChar)
+
+	_, err = c.Put(ctx, "b.x", 2)
+	r.NoError(err)
+	_, err = c.Put(ctx, "b.y", 3)
+	r.NoError(err)
+
+	list, err := c.List(ctx, "b.")
+	r.NoError(err)
+	r.Equal([]Entry[int]{{"b.x", 2, 3}, {"b.y", 3, 4}}, list)
+
+	var keys []string
+	r.NoError(c.Range(ctx, func(e Entry[int]) bool {
+		keys = append(keys, e.Key)
+		return e.Key != "b.x"
+	}))
+	r.Equal([]string{"a", "b.x"}, keys)
+
+	r.NoError(c.CompareAndDelete(ctx, "a", 2))
+	r.ErrorIs(c.Delete(ctx, "a"), ErrNotFound)
+	r.Equal(2, c.Len())
+	r.Equal(uint64(5), c.Revision())
+
+	canceled, cancel := context.WithCancel(ctx)
+	cancel()
+	_, err = c.Get(canceled, "b.x")
+	r.ErrorIs(err, context.Canceled)
+	_, err = c.Put(canceled, "c", 1)
+	r.ErrorIs(err, context.Canceled)
+	r.ErrorIs(c.Range(canceled, func(Entry[int]) bool { return true }), context.Canceled)
+
+	// FS として辿れる
+	root := FS[any]{"c": NewConcurrent[any]()}
+	_, err = root["c"].(*Concurrent[any]).Put(ctx, "k", "v")
+	r.NoError(err)
+	got, err := Lookup(ctx, root, "/c/k")
+	r.NoError(err)
+	r.Equal("v", got)
+}
+
+func TestConcurrentSubscribe(t *testing.T) {
+	r := require.New(t)
+	ctx, cancel := context.WithCancel(context.Background())
+	c := NewConcurrent[string]()
+
+	events := c.Subscribe(ctx, "app.", 10)
+	_, err := c.Put(ctx, "app.a", "1")
+	r.NoError(err)
+	_, err = c.Put(ctx, "other", "x")
+	r.NoError(err)
+	r.NoError(c.Delete(ctx, "app.a"))
+
+	r.Equal(Event[string]{Type: EventPut, Key: "app.a", Value: "1", Revision: 1}, <-events)
+	r.Equal(Event[string]{Type: EventDelete, Key: "app.a", Revision: 3}, <-events)
+
+	cancel()
+	for range events {
+	}
+
+	// 溢れた購読者は閉じられ、書き込みは止まらない
+	slow := c.Subscribe(context.Background(), "", 1)
+	for i := 0; i < 5; i++ {
+		_, err := c.Put(context.Background(), fmt.Sprint("k", i), "v")
+		r.NoError(err)
+	}
+	n := 0
+	for range slow {
+		n++
+	}
+	r.Equal(1, n)
+}
+
+func TestConcurrentRace(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	c := NewConcurrent[int]()
+	events := c.Subscribe(ctx, "", 10000)
+
+	const workers, per = 8, 100
+	var wg sync.WaitGroup
+	for w := 0; w < workers; w++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for i := 0; i < per; i++ {
+				// 同じキーを CAS で加算する
+				for {
+					e, err := c.GetEntry(ctx, "counter")
+					if err != nil {
+						if _, err := c.Create(ctx, "counter", 1); err == nil {
+							break
+						}
+						continue
+					}
+					if _, err := c.CompareAndSwap(ctx, "counter", e.Revision, e.Value+1); err == nil {
+						break
+					}
+				}
+				_, _ = c.Put(ctx, fmt.Sprintf("w%d", w), i)
+				_, _ = c.List(ctx, "w")
+				_ = c.Range(ctx, func(Entry[int]) bool { return true })
+			}
+		}()
+	}
+	wg.Wait()
+
+	v, err := c.Get(ctx, "counter")
+	require.NoError(t, err)
+	require.Equal(t, workers*per, v)
+
+	// イベントはリビジョン順に全部届く
+	var last uint64
+	for i := uint64(0); i < c.Revision(); i++ {
+		ev := <-events
+		require.Greater(t, ev.Revision, last)
+		last = ev.Revision
+	}
+	require.Equal(t, c.Revision(), last)
+}
@@ -0,0 +1,115 @@
+package repository
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io/fs"
+	"os"
+	"sync"
+
+	"github.com/sasano8/kvtool/internal/fsutil"
+)
+
+// FileRepository keeps the entries in one JSON object on disk. Every change
+// rewrites the file through a temporary file and a rename, so readers see
+// either the old or the new content, never a partial write.
+type FileRepository[T any] struct {
+	Path string
+	// 新しく作るファイルの権限（既定 0600）
+	Perm os.FileMode
+
+	// 同じプロセス内の読み書きを直列化する（プロセス間の排他はしない）
+	mu sync.Mutex
+}
+
+func NewFile[T any](path string) *FileRepository[T] {
+	return &FileRepository[T]{Path: path, Perm: 0o600}
+}
+
+var _ Backend[int] = (*FileRepository[int])(nil)
+
+func (r *FileRepository[T]) Get(key string) (T, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	m, err := r.load()
+	if err != nil {
+		var zero T
+		return zero, err
+	}
+	return m.Get(key)
+}
+
+func (r *FileRepository[T]) Create(key string, value T) (T, error) {
+	return r.update(func(m Repository[T]) (T, error) { return m.Create(key, value) })
+}
+
+func (r *FileRepository[T]) Put(key string, value T) (T, error) {
+	return r.update(func(m Repository[T]) (T, error) { return m.Put(key, value) })
+}
+
+func (r *FileRepository[T]) Delete(key string) error {
+	_, err := r.update(func(m Repository[T]) (T, error) {
+		var zero T
+		return zero, m.Delete(key)
+	})
+	return err
+}
+
+// Load returns all entries.
+func (r *FileRepository[T]) Load() (Repository[T], error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	return r.load()
+}
+
+// update はメモリ上の Repository に同じ操作をしてから、成功したときだけ書き戻す
+func (r *FileRepository[T]) update(fn func(Repository[T]) (T, error)) (T, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	var zero T
+	m, err := r.load()
+	if err != nil {
+		return zero, err
+	}
+	v, err := fn(m)
+	if err != nil {
+		return zero, err
+	}
+	if err := r.save(m); err != nil {
+		return zero, err
+	}
+	return v, nil
+}
+
+func (r *FileRepository[T]) load() (Repository[T], error) {
+	b, err := os.ReadFile(r.Path)
+	if errors.Is(err, fs.ErrNotExist) {
+		return New[T](), nil
+	} else if err != nil {
+		return nil, err
+	}
+	m := New[T]()
+	if err := json.Unmarshal(b, &m); err != nil {
+		return nil, fmt.Errorf("parse %s: %w", r.Path, err)
+	}
+	return m, nil
+}
+
+func (r *FileRepository[T]) save(m Repository[T]) error {
+	b, err := json.MarshalIndent(m, "", "  ")
+	if err != nil {
+		return fmt.Errorf("marshal json: %w", err)
+	}
+	b = append(b, '\n')
+
+	perm := r.Perm
+	if perm == 0 {
+		perm = 0o600
+	}
+	if fi, err := os.Stat(r.Path); err == nil {
+		perm = fi.Mode().Perm()
+	}
+
+	return fsutil.WriteFileAtomic(r.Path, b, perm)
+}
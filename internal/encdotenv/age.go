@@ -0,0 +1,135 @@
+package encdotenv
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"filippo.io/age"
+)
+
+// AgeRecipient wraps the data key for an age X25519 public key (age1...).
+type AgeRecipient struct {
+	*age.X25519Recipient
+}
+
+func ParseAgeRecipient(s string) (AgeRecipient, error) {
+	r, err := age.ParseX25519Recipient(strings.TrimSpace(s))
+	if err != nil {
+		return AgeRecipient{}, err
+	}
+	return AgeRecipient{r}, nil
+}
+
+// ParseAgeRecipients reads one recipient per line; blank lines and # comments
+// are skipped, as in age recipients files.
+func ParseAgeRecipients(r io.Reader) ([]AgeRecipient, error) {
+	b, err := io.ReadAll(r)
+	if err != nil {
+		return nil, err
+	}
+	var out []AgeRecipient
+	for _, line := range strings.Split(string(b), "\n") {
+		line = strings.TrimSpace(line)
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+		rcpt, err := ParseAgeRecipient(line)
+		if err != nil {
+			return nil, err
+		}
+		out = append(out, rcpt)
+	}
+	return out, nil
+}
+
+func (r AgeRecipient) Wrap(_ context.Context, dataKey []byte) (Stanza, error) {
+	var buf bytes.Buffer
+	w, err := age.Encrypt(&buf, r.X25519Recipient)
+	if err != nil {
+		return Stanza{}, err
+	}
+	if _, err := w.Write(dataKey); err != nil {
+		return Stanza{}, err
+	}
+	if err := w.Close(); err != nil {
+		return Stanza{}, err
+	}
+	return Stanza{Type: "age", Fields: map[string]string{
+		"recipient": r.String(),
+		"enc":       b64.EncodeToString(buf.Bytes()),
+	}}, nil
+}
+
+// AgeIdentity unwraps age stanzas with an X25519 private key (AGE-SECRET-KEY-1...).
+type AgeIdentity struct {
+	*age.X25519Identity
+}
+
+func (id AgeIdentity) Unwrap(_ context.Context, s Stanza) ([]byte, error) {
+	// recipient が違うものは復号を試すまでもない
+	if s.Type != "age" || s.Fields["recipient"] != id.Recipient().String() {
+		return nil, ErrNoMatch
+	}
+	enc, err := b64.DecodeString(s.Fields["enc"])
+	if err != nil {
+		return nil, fmt.Errorf("age stanza: %w", err)
+	}
+	r, err := age.Decrypt(bytes.NewReader(enc), id.X25519Identity)
+	if err != nil {
+		return nil, err
+	}
+	return io.ReadAll(io.LimitReader(r, 1024))
+}
+
+// ParseAgeIdentities reads an age identity file (AGE-SECRET-KEY-1... lines).
+func ParseAgeIdentities(r io.Reader) ([]Identity, error) {
+	ids, err := age.ParseIdentities(r)
+	if err != nil {
+		return nil, err
+	}
+	var out []Identity
+	for _, id := range ids {
+		if x, ok := id.(*age.X25519Identity); ok {
+			out = append(out, AgeIdentity{x})
+		}
+	}
+	return out, nil
+}
+
+// LoadAgeIdentities reads identities from path, or when path is empty from
+// $KVTOOL_AGE_KEY (the key itself), $KVTOOL_AGE_KEY_FILE or
+// <user config dir>/kvtool/age.key.
+func LoadAgeIdentities(path string) ([]Identity, error) {
+	if path == "" {
+		if key := os.Getenv("KVTOOL_AGE_KEY"); key != "" {
+			return ParseAgeIdentities(strings.NewReader(key))
+		}
+		path = os.Getenv("KVTOOL_AGE_KEY_FILE")
+	}
+	if path == "" {
+		dir, err := os.UserConfigDir()
+		if err != nil {
+			return nil, err
+		}
+		path = filepath.Join(dir, "kvtool", "age.key")
+	}
+
+	f, err := os.Open(path)
+	if errors.Is(err, os.ErrNotExist) {
+		return nil, fmt.Errorf("age identity %s not found (set -identity, KVTOOL_AGE_KEY or KVTOOL_AGE_KEY_FILE)", path)
+	} else if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+	ids, err := ParseAgeIdentities(f)
+	if err != nil {
+		return nil, fmt.Errorf("age identity %s: %w", path, err)
+	}
+	return ids, nil
+}
@@ -0,0 +1,408 @@
+// Package encdotenv implements encrypted-at-rest .env files.
+//
+// Keys stay in plain text so the file diffs well in git. Each value is
+// encrypted with a per-file AES-256-GCM data key (the key name is the
+// additional data, so values cannot be moved between keys), and the data key
+// is wrapped for one or more recipients. A MAC over every line detects added,
+// removed or swapped entries.
+//
+//	DB_PASSWORD="ENC[AES256_GCM,data:...,iv:...,tag:...,type:str]"
+//	kvtool_age_0_enc="..."
+//	kvtool_age_0_recipient="age1..."
+//	kvtool_lastmodified="2024-01-02T03:04:05Z"
+//	kvtool_mac="hmac-sha256:..."
+//	kvtool_version="1"
+package encdotenv
+
+import (
+	"bytes"
+	"context"
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"io"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/sasano8/kvtool/internal/convert"
+)
+
+const (
+	Version = "1"
+
+	// MetaPrefix marks the keys the format reserves for itself.
+	MetaPrefix = "kvtool_"
+
+	keyVersion      = MetaPrefix + "version"
+	keyLastModified = MetaPrefix + "lastmodified"
+	keyMAC          = MetaPrefix + "mac"
+
+	dataKeySize = 32
+)
+
+var (
+	// ErrNoIdentity means none of the identities could unwrap the data key.
+	ErrNoIdentity = errors.New("no identity can decrypt this file")
+	// ErrNoMatch is returned by Identity.Unwrap for stanzas it does not handle.
+	ErrNoMatch = errors.New("stanza is not for this identity")
+	// ErrMAC means the file was modified outside of kvtool.
+	ErrMAC = errors.New("MAC mismatch: file was modified")
+)
+
+// Stanza is a wrapped copy of the data key, stored as
+// kvtool_<type>_<n>_<field>=<value> lines.
+type Stanza struct {
+	Type   string
+	Fields map[string]string
+}
+
+// Recipient wraps the data key for someone who can later unwrap it.
+type Recipient interface {
+	Wrap(ctx context.Context, dataKey []byte) (Stanza, error)
+}
+
+// Identity unwraps stanzas made for it and returns ErrNoMatch for others.
+type Identity interface {
+	Unwrap(ctx context.Context, s Stanza) ([]byte, error)
+}
+
+// File is a parsed encrypted .env file. Values hold the ENC[...] strings.
+type File struct {
+	Values       map[string]string
+	Stanzas      []Stanza
+	LastModified time.Time
+	MAC          string
+}
+
+// Encrypt encrypts plain with a new data key wrapped for every recipient.
+func Encrypt(ctx context.Context, plain map[string]string, recipients ...Recipient) (*File, error) {
+	if len(recipients) == 0 {
+		return nil, errors.New("encrypt: no recipients")
+	}
+	dataKey, err := newDataKey()
+	if err != nil {
+		return nil, err
+	}
+
+	f := &File{Values: map[string]string{}}
+	if err := f.Wrap(ctx, dataKey, recipients...); err != nil {
+		return nil, err
+	}
+	if err := f.Update(dataKey, plain); err != nil {
+		return nil, err
+	}
+	return f, nil
+}
+
+func newDataKey() ([]byte, error) {
+	dataKey := make([]byte, dataKeySize)
+	if _, err := rand.Read(dataKey); err != nil {
+		return nil, err
+	}
+	return dataKey, nil
+}
+
+// Wrap replaces the stanzas with dataKey wrapped for recipients. Values are
+// not touched. The data key stays the same, so this is only right when no
+// recipient loses access, e.g. after a Vault Transit key rotation; use Rekey
+// to remove recipients.
+func (f *File) Wrap(ctx context.Context, dataKey []byte, recipients ...Recipient) error {
+	stanzas := make([]Stanza, 0, len(recipients))
+	for _, r := range recipients {
+		s, err := r.Wrap(ctx, dataKey)
+		if err != nil {
+			return fmt.Errorf("wrap data key: %w", err)
+		}
+		if s.Type == "" || strings.Contains(s.Type, "_") {
+			return fmt.Errorf("wrap data key: invalid stanza type %q", s.Type)
+		}
+		stanzas = append(stanzas, s)
+	}
+	f.Stanzas = stanzas
+	f.touch(dataKey)
+	return nil
+}
+
+// Rekey re-encrypts every value with a new data key wrapped for recipients
+// and returns the new key. A recipient dropped with Wrap could still decrypt
+// the file with a data key it unwrapped earlier; after Rekey it cannot.
+func (f *File) Rekey(ctx context.Context, oldKey []byte, recipients ...Recipient) ([]byte, error) {
+	if len(recipients) == 0 {
+		return nil, errors.New("rekey: no recipients")
+	}
+	plain, err := f.decryptWith(oldKey)
+	if err != nil {
+		return nil, err
+	}
+	dataKey, err := newDataKey()
+	if err != nil {
+		return nil, err
+	}
+	if err := f.Wrap(ctx, dataKey, recipients...); err != nil {
+		return nil, err
+	}
+	// 古い暗号文を引き継がないように空にしてから暗号化し直す
+	f.Values = map[string]string{}
+	if err := f.Update(dataKey, plain); err != nil {
+		return nil, err
+	}
+	return dataKey, nil
+}
+
+// DataKey unwraps the data key with the first identity that matches a stanza.
+func (f *File) DataKey(ctx context.Context, ids ...Identity) ([]byte, error) {
+	var errs []error
+	for _, s := range f.Stanzas {
+		for _, id := range ids {
+			key, err := id.Unwrap(ctx, s)
+			if errors.Is(err, ErrNoMatch) {
+				continue
+			}
+			if err != nil {
+				errs = append(errs, fmt.Errorf("%s stanza: %w", s.Type, err))
+				continue
+			}
+			if len(key) != dataKeySize {
+				errs = append(errs, fmt.Errorf("%s stanza: data key has %d bytes", s.Type, len(key)))
+				continue
+			}
+			if err := f.verify(key); err != nil {
+				return nil, err
+			}
+			return key, nil
+		}
+	}
+	return nil, errors.Join(append([]error{ErrNoIdentity}, errs...)...)
+}
+
+// Decrypt verifies the MAC and returns the plain values.
+func (f *File) Decrypt(ctx context.Context, ids ...Identity) (map[string]string, error) {
+	key, err := f.DataKey(ctx, ids...)
+	if err != nil {
+		return nil, err
+	}
+	return f.decryptWith(key)
+}
+
+func (f *File) decryptWith(dataKey []byte) (map[string]string, error) {
+	aead, err := newAEAD(dataKey)
+	if err != nil {
+		return nil, err
+	}
+	out := make(map[string]string, len(f.Values))
+	for k, v := range f.Values {
+		plain, err := openValue(aead, k, v)
+		if err != nil {
+			return nil, err
+		}
+		out[k] = plain
+	}
+	return out, nil
+}
+
+// Update sets the plain values. Values that did not change keep their
+// ciphertext so an edit only touches the lines that changed.
+func (f *File) Update(dataKey []byte, plain map[string]string) error {
+	aead, err := newAEAD(dataKey)
+	if err != nil {
+		return err
+	}
+	next := make(map[string]string, len(plain))
+	for k, v := range plain {
+		if err := checkKey(k); err != nil {
+			return err
+		}
+		if old, ok := f.Values[k]; ok {
+			if p, err := openValue(aead, k, old); err == nil && p == v {
+				next[k] = old
+				continue
+			}
+		}
+		enc, err := sealValue(aead, k, v)
+		if err != nil {
+			return err
+		}
+		next[k] = enc
+	}
+	f.Values = next
+	f.touch(dataKey)
+	return nil
+}
+
+func checkKey(k string) error {
+	if strings.HasPrefix(k, MetaPrefix) {
+		return fmt.Errorf("key %q: the %s prefix is reserved", k, MetaPrefix)
+	}
+	if k == "" || strings.ContainsAny(k, "=\n \t#") {
+		return fmt.Errorf("invalid key %q", k)
+	}
+	return nil
+}
+
+func (f *File) touch(dataKey []byte) {
+	f.LastModified = time.Now().UTC().Truncate(time.Second)
+	f.MAC = f.computeMAC(dataKey)
+}
+
+// lines は kvtool_mac 以外のすべての行
+func (f *File) lines() map[string]string {
+	m := make(map[string]string, len(f.Values)+2*len(f.Stanzas)+2)
+	for k, v := range f.Values {
+		m[k] = v
+	}
+	for i, s := range f.Stanzas {
+		for field, v := range s.Fields {
+			m[fmt.Sprintf("%s%s_%d_%s", MetaPrefix, s.Type, i, field)] = v
+		}
+	}
+	m[keyVersion] = Version
+	m[keyLastModified] = f.LastModified.Format(time.RFC3339)
+	return m
+}
+
+func (f *File) computeMAC(dataKey []byte) string {
+	// データ鍵をそのまま HMAC に使わず、用途ごとに派生させる
+	d := hmac.New(sha256.New, dataKey)
+	d.Write([]byte("kvtool encdotenv mac"))
+	mac := hmac.New(sha256.New, d.Sum(nil))
+
+	lines := f.lines()
+	keys := make([]string, 0, len(lines))
+	for k := range lines {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	for _, k := range keys {
+		fmt.Fprintf(mac, "%s=%s\n", k, strconv.Quote(lines[k]))
+	}
+	return "hmac-sha256:" + hex.EncodeToString(mac.Sum(nil))
+}
+
+func (f *File) verify(dataKey []byte) error {
+	if !hmac.Equal([]byte(f.MAC), []byte(f.computeMAC(dataKey))) {
+		return ErrMAC
+	}
+	return nil
+}
+
+// Parse reads an encrypted .env file.
+func Parse(r io.Reader) (*File, error) {
+	m, err := convert.ParseDotenv(r)
+	if err != nil {
+		return nil, err
+	}
+	if v := m[keyVersion]; v != Version {
+		return nil, fmt.Errorf("not an encrypted .env file (kvtool_version=%q, want %q)", v, Version)
+	}
+
+	f := &File{Values: map[string]string{}, MAC: m[keyMAC]}
+	if f.LastModified, err = time.Parse(time.RFC3339, m[keyLastModified]); err != nil {
+		return nil, fmt.Errorf("kvtool_lastmodified: %w", err)
+	}
+
+	stanzas := map[int]*Stanza{}
+	for k, v := range m {
+		rest, ok := strings.CutPrefix(k, MetaPrefix)
+		if !ok {
+			f.Values[k] = v
+			continue
+		}
+		if k == keyVersion || k == keyLastModified || k == keyMAC {
+			continue
+		}
+		// <type>_<n>_<field>
+		parts := strings.SplitN(rest, "_", 3)
+		if len(parts) != 3 {
+			return nil, fmt.Errorf("unknown metadata key %q", k)
+		}
+		n, err := strconv.Atoi(parts[1])
+		if err != nil || n < 0 {
+			return nil, fmt.Errorf("unknown metadata key %q", k)
+		}
+		s, ok := stanzas[n]
+		if !ok {
+			s = &Stanza{Type: parts[0], Fields: map[string]string{}}
+			stanzas[n] = s
+		}
+		if s.Type != parts[0] {
+			return nil, fmt.Errorf("metadata key %q: stanza %d is %s", k, n, s.Type)
+		}
+		s.Fields[parts[2]] = v
+	}
+	for i := range len(stanzas) {
+		s, ok := stanzas[i]
+		if !ok {
+			return nil, fmt.Errorf("stanza %d is missing", i)
+		}
+		f.Stanzas = append(f.Stanzas, *s)
+	}
+	if len(f.Stanzas) == 0 {
+		return nil, errors.New("encrypted .env file has no recipients")
+	}
+	return f, nil
+}
+
+// Marshal returns the file in .env syntax, sorted by key.
+func (f *File) Marshal() []byte {
+	lines := f.lines()
+	m := make(map[string]any, len(lines)+1)
+	for k, v := range lines {
+		m[k] = v
+	}
+	m[keyMAC] = f.MAC
+	var buf bytes.Buffer
+	_ = convert.FormatDotenv(&buf, m)
+	return buf.Bytes()
+}
+
+func newAEAD(key []byte) (cipher.AEAD, error) {
+	block, err := aes.NewCipher(key)
+	if err != nil {
+		return nil, err
+	}
+	return cipher.NewGCM(block)
+}
+
+var b64 = base64.StdEncoding
+
+func sealValue(aead cipher.AEAD, key, plain string) (string, error) {
+	iv := make([]byte, aead.NonceSize())
+	if _, err := rand.Read(iv); err != nil {
+		return "", err
+	}
+	sealed := aead.Seal(nil, iv, []byte(plain), []byte(key))
+	data, tag := sealed[:len(sealed)-aead.Overhead()], sealed[len(sealed)-aead.Overhead():]
+	return fmt.Sprintf("ENC[AES256_GCM,data:%s,iv:%s,tag:%s,type:str]",
+		b64.EncodeToString(data), b64.EncodeToString(iv), b64.EncodeToString(tag)), nil
+}
+
+func openValue(aead cipher.AEAD, key, enc string) (string, error) {
+	inner, ok := strings.CutPrefix(enc, "ENC[AES256_GCM,")
+	if !ok || !strings.HasSuffix(inner, "]") {
+		return "", fmt.Errorf("key %q: value is not encrypted", key)
+	}
+	fields := map[string]string{}
+	for _, part := range strings.Split(strings.TrimSuffix(inner, "]"), ",") {
+		name, v, _ := strings.Cut(part, ":")
+		fields[name] = v
+	}
+	data, err1 := b64.DecodeString(fields["data"])
+	iv, err2 := b64.DecodeString(fields["iv"])
+	tag, err3 := b64.DecodeString(fields["tag"])
+	if err := errors.Join(err1, err2, err3); err != nil || len(iv) != aead.NonceSize() || len(tag) != aead.Overhead() {
+		return "", fmt.Errorf("key %q: malformed ENC value", key)
+	}
+	plain, err := aead.Open(nil, iv, append(data, tag...), []byte(key))
+	if err != nil {
+		return "", fmt.Errorf("key %q: %w", key, err)
+	}
+	return string(plain), nil
+}
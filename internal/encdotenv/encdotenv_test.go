@@ -0,0 +1,152 @@
+package encdotenv
+
+import (
+	"bytes"
+	"context"
+	"strings"
+	"testing"
+
+	"filippo.io/age"
+	"github.com/stretchr/testify/require"
+)
+
+func newAgeKey(t *testing.T) (AgeRecipient, AgeIdentity) {
+	t.Helper()
+	id, err := age.GenerateX25519Identity()
+	require.NoError(t, err)
+	return AgeRecipient{id.Recipient()}, AgeIdentity{id}
+}
+
+func roundTrip(t *testing.T, f *File) *File {
+	t.Helper()
+	got, err := Parse(bytes.NewReader(f.Marshal()))
+	require.NoError(t, err)
+	return got
+}
+
+func TestEncryptDecrypt(t *testing.T) {
+	r := require.New(t)
+	ctx := context.Background()
+	alice, aliceID := newAgeKey(t)
+	bob, bobID := newAgeKey(t)
+	_, malloryID := newAgeKey(t)
+
+	plain := map[string]string{"DB_PASSWORD": "hunter2", "EMPTY": "", "MULTI": "a\nb \"c\""}
+	f, err := Encrypt(ctx, plain, alice, bob)
+	r.NoError(err)
+
+	text := string(f.Marshal())
+	r.Contains(text, "DB_PASSWORD=\"ENC[AES256_GCM,data:")
+	r.NotContains(text, "hunter2")
+	r.Contains(text, `kvtool_age_0_recipient="`+alice.String()+`"`)
+	r.Contains(text, `kvtool_version="1"`)
+
+	got := roundTrip(t, f)
+	for _, id := range []Identity{aliceID, bobID} {
+		out, err := got.Decrypt(ctx, id)
+		r.NoError(err)
+		r.Equal(plain, out)
+	}
+	_, err = got.Decrypt(ctx, malloryID)
+	r.ErrorIs(err, ErrNoIdentity)
+
+	_, err = Encrypt(ctx, map[string]string{"kvtool_x": "1"}, alice)
+	r.ErrorContains(err, "reserved")
+	_, err = Encrypt(ctx, plain)
+	r.Error(err)
+}
+
+func TestTamper(t *testing.T) {
+	ctx := context.Background()
+	alice, aliceID := newAgeKey(t)
+	f, err := Encrypt(ctx, map[string]string{"A": "1", "B": "2"}, alice)
+	require.NoError(t, err)
+	text := string(f.Marshal())
+
+	lineOf := func(key string) string {
+		for _, l := range strings.Split(text, "\n") {
+			if strings.HasPrefix(l, key+"=") {
+				return l
+			}
+		}
+		t.Fatalf("no line for %s", key)
+		return ""
+	}
+	a, b := lineOf("A"), lineOf("B")
+
+	for name, mutate := range map[string]func(string) string{
+		"swap values": func(s string) string {
+			s = strings.Replace(s, a, "\x00", 1)
+			s = strings.Replace(s, b, "B="+strings.TrimPrefix(a, "A="), 1)
+			return strings.Replace(s, "\x00", "A="+strings.TrimPrefix(b, "B="), 1)
+		},
+		"remove key": func(s string) string { return strings.Replace(s, b+"\n", "", 1) },
+		"add key":    func(s string) string { return s + "C=" + strings.TrimPrefix(a, "A=") + "\n" },
+		"lastmodified": func(s string) string {
+			return strings.Replace(s, lineOf("kvtool_lastmodified"), `kvtool_lastmodified="2000-01-01T00:00:00Z"`, 1)
+		},
+	} {
+		t.Run(name, func(t *testing.T) {
+			f, err := Parse(strings.NewReader(mutate(text)))
+			require.NoError(t, err)
+			_, err = f.Decrypt(ctx, aliceID)
+			require.ErrorIs(t, err, ErrMAC)
+		})
+	}
+
+	_, err = Parse(strings.NewReader("A=1\n"))
+	require.ErrorContains(t, err, "not an encrypted")
+}
+
+func TestUpdateKeepsUnchanged(t *testing.T) {
+	r := require.New(t)
+	ctx := context.Background()
+	alice, aliceID := newAgeKey(t)
+	f, err := Encrypt(ctx, map[string]string{"A": "1", "B": "2", "C": "3"}, alice)
+	r.NoError(err)
+	before := f.Values
+
+	key, err := f.DataKey(ctx, aliceID)
+	r.NoError(err)
+	r.NoError(f.Update(key, map[string]string{"A": "1", "B": "changed", "D": "4"}))
+	r.Equal(before["A"], f.Values["A"])
+	r.NotEqual(before["B"], f.Values["B"])
+	r.NotContains(f.Values, "C")
+
+	out, err := roundTrip(t, f).Decrypt(ctx, aliceID)
+	r.NoError(err)
+	r.Equal(map[string]string{"A": "1", "B": "changed", "D": "4"}, out)
+}
+
+func TestRekey(t *testing.T) {
+	r := require.New(t)
+	ctx := context.Background()
+	alice, aliceID := newAgeKey(t)
+	bob, bobID := newAgeKey(t)
+	plain := map[string]string{"A": "1", "B": "2"}
+	f, err := Encrypt(ctx, plain, alice, bob)
+	r.NoError(err)
+	r.True(f.WrappedFor(bob, alice))
+	r.False(f.WrappedFor(alice))
+	before := f.Values
+
+	oldKey, err := f.DataKey(ctx, bobID)
+	r.NoError(err)
+	newKey, err := f.Rekey(ctx, oldKey, alice)
+	r.NoError(err)
+	r.NotEqual(oldKey, newKey)
+	r.True(f.WrappedFor(alice))
+	for k := range plain {
+		r.NotEqual(before[k], f.Values[k])
+	}
+
+	got := roundTrip(t, f)
+	out, err := got.Decrypt(ctx, aliceID)
+	r.NoError(err)
+	r.Equal(plain, out)
+	_, err = got.Decrypt(ctx, bobID)
+	r.ErrorIs(err, ErrNoIdentity)
+	// bob が前に取り出したデータ鍵ではもう読めない
+	_, err = got.decryptWith(oldKey)
+	r.Error(err)
+}
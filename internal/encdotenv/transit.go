@@ -0,0 +1,164 @@
+package encdotenv
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"slices"
+	"strings"
+
+	vaultapi "github.com/hashicorp/vault/api"
+)
+
+// TransitKey wraps and unwraps the data key with Vault Transit encrypt/decrypt,
+// so the data key is only readable by whoever Vault lets use the key.
+// It is both a Recipient and an Identity.
+type TransitKey struct {
+	Client *vaultapi.Client
+	// 既定は "transit"
+	Mount string
+	Name  string
+}
+
+// ParseTransitKey parses "<name>" or "<mount>/<name>".
+func ParseTransitKey(client *vaultapi.Client, s string) (TransitKey, error) {
+	s = strings.Trim(s, "/")
+	mount, name := "transit", s
+	if i := strings.LastIndex(s, "/"); i >= 0 {
+		mount, name = s[:i], s[i+1:]
+	}
+	if name == "" {
+		return TransitKey{}, fmt.Errorf("transit key %q: missing key name", s)
+	}
+	return TransitKey{Client: client, Mount: mount, Name: name}, nil
+}
+
+func (k TransitKey) String() string {
+	return k.mount() + "/" + k.Name
+}
+
+func (k TransitKey) mount() string {
+	if k.Mount == "" {
+		return "transit"
+	}
+	return k.Mount
+}
+
+func (k TransitKey) Wrap(ctx context.Context, dataKey []byte) (Stanza, error) {
+	secret, err := k.Client.Logical().WriteWithContext(ctx, k.mount()+"/encrypt/"+k.Name, map[string]any{
+		"plaintext": b64.EncodeToString(dataKey),
+	})
+	if err != nil {
+		return Stanza{}, fmt.Errorf("transit encrypt %s: %w", k, err)
+	}
+	ct, err := field(secret, "ciphertext")
+	if err != nil {
+		return Stanza{}, fmt.Errorf("transit encrypt %s: %w", k, err)
+	}
+	return Stanza{Type: "transit", Fields: map[string]string{
+		"mount": k.mount(),
+		"key":   k.Name,
+		"enc":   ct,
+	}}, nil
+}
+
+func (k TransitKey) Unwrap(ctx context.Context, s Stanza) ([]byte, error) {
+	if s.Type != "transit" || s.Fields["mount"] != k.mount() || s.Fields["key"] != k.Name {
+		return nil, ErrNoMatch
+	}
+	secret, err := k.Client.Logical().WriteWithContext(ctx, k.mount()+"/decrypt/"+k.Name, map[string]any{
+		"ciphertext": s.Fields["enc"],
+	})
+	if err != nil {
+		return nil, fmt.Errorf("transit decrypt %s: %w", k, err)
+	}
+	pt, err := field(secret, "plaintext")
+	if err != nil {
+		return nil, fmt.Errorf("transit decrypt %s: %w", k, err)
+	}
+	return b64.DecodeString(pt)
+}
+
+func field(secret *vaultapi.Secret, name string) (string, error) {
+	if secret == nil || secret.Data == nil {
+		return "", errors.New("empty response")
+	}
+	v, ok := secret.Data[name].(string)
+	if !ok || v == "" {
+		return "", fmt.Errorf("response has no %s", name)
+	}
+	return v, nil
+}
+
+// TransitKeys returns the transit keys the file is wrapped for.
+func (f *File) TransitKeys(client *vaultapi.Client) []TransitKey {
+	var out []TransitKey
+	for _, s := range f.Stanzas {
+		if s.Type == "transit" {
+			out = append(out, TransitKey{Client: client, Mount: s.Fields["mount"], Name: s.Fields["key"]})
+		}
+	}
+	return out
+}
+
+// HasStanza reports whether the data key is wrapped with the given stanza type.
+func (f *File) HasStanza(typ string) bool {
+	for _, s := range f.Stanzas {
+		if s.Type == typ {
+			return true
+		}
+	}
+	return false
+}
+
+// Recipients rebuilds the recipients of the file in stanza order, e.g. to
+// re-wrap the data key after a transit key rotation. client is only used
+// for transit stanzas.
+func (f *File) Recipients(client *vaultapi.Client) ([]Recipient, error) {
+	var out []Recipient
+	for _, s := range f.Stanzas {
+		switch s.Type {
+		case "age":
+			r, err := ParseAgeRecipient(s.Fields["recipient"])
+			if err != nil {
+				return nil, err
+			}
+			out = append(out, r)
+		case "transit":
+			out = append(out, TransitKey{Client: client, Mount: s.Fields["mount"], Name: s.Fields["key"]})
+		default:
+			return nil, fmt.Errorf("unknown stanza type %q", s.Type)
+		}
+	}
+	return out, nil
+}
+
+// WrappedFor reports whether the stanzas are for exactly recipients, in any
+// order. Recipients other than AgeRecipient and TransitKey never match.
+func (f *File) WrappedFor(recipients ...Recipient) bool {
+	have := make([]string, 0, len(f.Stanzas))
+	for _, s := range f.Stanzas {
+		switch s.Type {
+		case "age":
+			have = append(have, "age:"+s.Fields["recipient"])
+		case "transit":
+			have = append(have, "transit:"+s.Fields["mount"]+"/"+s.Fields["key"])
+		default:
+			return false
+		}
+	}
+	want := make([]string, 0, len(recipients))
+	for _, r := range recipients {
+		switch r := r.(type) {
+		case AgeRecipient:
+			want = append(want, "age:"+r.String())
+		case TransitKey:
+			want = append(want, "transit:"+r.String())
+		default:
+			return false
+		}
+	}
+	slices.Sort(have)
+	slices.Sort(want)
+	return slices.Equal(slices.Compact(have), slices.Compact(want))
+}
@@ -0,0 +1,144 @@
+package encdotenv
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"testing"
+
+	vaultapi "github.com/hashicorp/vault/api"
+	"github.com/stretchr/testify/require"
+)
+
+// fakeTransit implements transit/encrypt, transit/decrypt and
+// transit/keys/<name>/rotate for a single token.
+type fakeTransit struct {
+	mu       sync.Mutex
+	versions map[string]int
+	plain    map[string]string
+	calls    []string
+}
+
+func newFakeTransit(t *testing.T) (*fakeTransit, *vaultapi.Client) {
+	t.Helper()
+	f := &fakeTransit{versions: map[string]int{}, plain: map[string]string{}}
+	ts := httptest.NewServer(f)
+	t.Cleanup(ts.Close)
+
+	cfg := vaultapi.DefaultConfig()
+	cfg.Address = ts.URL
+	client, err := vaultapi.NewClient(cfg)
+	require.NoError(t, err)
+	client.SetToken("root")
+	return f, client
+}
+
+func (f *fakeTransit) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	reply := func(code int, v any) {
+		w.Header().Set("Content-Type", "application/json")
+		w.WriteHeader(code)
+		_ = json.NewEncoder(w).Encode(v)
+	}
+	if r.Header.Get("X-Vault-Token") != "root" {
+		reply(http.StatusForbidden, map[string]any{"errors": []string{"permission denied"}})
+		return
+	}
+	var body map[string]string
+	_ = json.NewDecoder(r.Body).Decode(&body)
+
+	// /v1/<mount>/<op>/<name>
+	parts := strings.Split(strings.TrimPrefix(r.URL.Path, "/v1/"), "/")
+	if len(parts) < 3 {
+		reply(http.StatusNotFound, map[string]any{"errors": []string{"not found"}})
+		return
+	}
+	mount, op, name := parts[0], parts[1], parts[2]
+	f.calls = append(f.calls, op+" "+mount+"/"+name)
+	if f.versions[name] == 0 {
+		f.versions[name] = 1
+	}
+
+	switch {
+	case op == "encrypt":
+		ct := fmt.Sprintf("vault:v%d:%s:%d", f.versions[name], name, len(f.plain))
+		f.plain[ct] = body["plaintext"]
+		reply(http.StatusOK, map[string]any{"data": map[string]any{"ciphertext": ct}})
+	case op == "decrypt":
+		pt, ok := f.plain[body["ciphertext"]]
+		if !ok || !strings.Contains(body["ciphertext"], ":"+name+":") {
+			reply(http.StatusBadRequest, map[string]any{"errors": []string{"invalid ciphertext"}})
+			return
+		}
+		reply(http.StatusOK, map[string]any{"data": map[string]any{"plaintext": pt}})
+	case op == "keys" && len(parts) == 4 && parts[3] == "rotate":
+		f.versions[name]++
+		w.WriteHeader(http.StatusNoContent)
+	default:
+		reply(http.StatusNotFound, map[string]any{"errors": []string{"unsupported path"}})
+	}
+}
+
+func TestTransit(t *testing.T) {
+	r := require.New(t)
+	ctx := context.Background()
+	fake, client := newFakeTransit(t)
+	alice, _ := newAgeKey(t)
+
+	tk, err := ParseTransitKey(client, "app")
+	r.NoError(err)
+	r.Equal("transit/app", tk.String())
+
+	plain := map[string]string{"A": "1", "B": "2"}
+	f, err := Encrypt(ctx, plain, alice, tk)
+	r.NoError(err)
+	r.True(f.HasStanza("transit"))
+	text := string(f.Marshal())
+	r.Contains(text, `kvtool_transit_1_enc="vault:v1:`)
+	r.Contains(text, `kvtool_transit_1_key="app"`)
+	r.Contains(text, `kvtool_transit_1_mount="transit"`)
+
+	// age の鍵が無くても Vault で開ける
+	got := roundTrip(t, f)
+	out, err := got.Decrypt(ctx, got.TransitKeys(client)[0])
+	r.NoError(err)
+	r.Equal(plain, out)
+
+	// 鍵のローテーション後に wrap し直しても値は変わらない
+	_, err = client.Logical().Write("transit/keys/app/rotate", nil)
+	r.NoError(err)
+	key, err := got.DataKey(ctx, tk)
+	r.NoError(err)
+	values := got.Values
+	rcpts, err := got.Recipients(client)
+	r.NoError(err)
+	r.Len(rcpts, 2)
+	r.NoError(got.Wrap(ctx, key, rcpts...))
+	r.Equal(values, got.Values)
+
+	rotated := roundTrip(t, got)
+	r.Contains(string(rotated.Marshal()), `kvtool_transit_1_enc="vault:v2:`)
+	r.Contains(string(rotated.Marshal()), `kvtool_age_0_recipient="`+alice.String()+`"`)
+	out, err = rotated.Decrypt(ctx, tk)
+	r.NoError(err)
+	r.Equal(plain, out)
+
+	// 別の鍵名の stanza には手を出さない
+	other := TransitKey{Client: client, Name: "other"}
+	_, err = rotated.Decrypt(ctx, other)
+	r.ErrorIs(err, ErrNoIdentity)
+	for _, c := range fake.calls {
+		r.NotContains(c, "other")
+	}
+
+	client.SetToken("wrong")
+	_, err = rotated.Decrypt(ctx, tk)
+	r.ErrorIs(err, ErrNoIdentity)
+	r.ErrorContains(err, "permission denied")
+}
@@ -0,0 +1,38 @@
+package fsutil
+
+import (
+	"os"
+	"path/filepath"
+	"runtime"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestWriteFileAtomic(t *testing.T) {
+	r := require.New(t)
+	dir := t.TempDir()
+	path := filepath.Join(dir, "sub", "out.json")
+
+	r.NoError(WriteFileAtomic(path, []byte("one\n"), 0o600))
+	r.NoError(WriteFileAtomic(path, []byte("two\n"), 0o600))
+	b, err := os.ReadFile(path)
+	r.NoError(err)
+	r.Equal("two\n", string(b))
+	if runtime.GOOS != "windows" {
+		fi, err := os.Stat(path)
+		r.NoError(err)
+		r.Equal(os.FileMode(0o600), fi.Mode().Perm())
+	}
+
+	// 一時ファイルは残らない
+	entries, err := os.ReadDir(filepath.Dir(path))
+	r.NoError(err)
+	r.Len(entries, 1)
+
+	// 書けなければ元のファイルはそのまま
+	r.Error(WriteFileAtomic(filepath.Join(path, "x"), []byte("three\n"), 0o600))
+	b, err = os.ReadFile(path)
+	r.NoError(err)
+	r.Equal("two\n", string(b))
+}
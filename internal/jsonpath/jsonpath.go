@@ -0,0 +1,114 @@
+// Package jsonpath implements the small JSONPath subset used by kvtool:
+// "$", ".key", "['key']" and "[index]".
+package jsonpath
+
+import (
+	"errors"
+	"fmt"
+	"strconv"
+	"strings"
+)
+
+var ErrNoMatch = errors.New("jsonpath: no match")
+
+// Get evaluates expr against v (a value decoded by encoding/json).
+func Get(v any, expr string) (any, error) {
+	steps, err := parse(expr)
+	if err != nil {
+		return nil, err
+	}
+
+	cur := v
+	for _, st := range steps {
+		switch x := cur.(type) {
+		case map[string]any:
+			if st.isIndex {
+				return nil, fmt.Errorf("%w: %s: index on object", ErrNoMatch, expr)
+			}
+			next, ok := x[st.key]
+			if !ok {
+				return nil, fmt.Errorf("%w: %s: key %q", ErrNoMatch, expr, st.key)
+			}
+			cur = next
+		case []any:
+			if !st.isIndex {
+				return nil, fmt.Errorf("%w: %s: key %q on array", ErrNoMatch, expr, st.key)
+			}
+			i := st.index
+			if i < 0 {
+				i += len(x)
+			}
+			if i < 0 || i >= len(x) {
+				return nil, fmt.Errorf("%w: %s: index %d out of range", ErrNoMatch, expr, st.index)
+			}
+			cur = x[i]
+		default:
+			return nil, fmt.Errorf("%w: %s: cannot descend into %T", ErrNoMatch, expr, cur)
+		}
+	}
+	return cur, nil
+}
+
+type step struct {
+	key     string
+	index   int
+	isIndex bool
+}
+
+func parse(expr string) ([]step, error) {
+	s := strings.TrimSpace(expr)
+	if s == "" {
+		return nil, nil
+	}
+	if s[0] == '$' {
+		s = s[1:]
+	} else if s[0] != '.' && s[0] != '[' {
+		// "a.b" のように $ を省略した書き方も許容
+		s = "." + s
+	}
+
+	var steps []step
+	for len(s) > 0 {
+		switch s[0] {
+		case '.':
+			s = s[1:]
+			end := strings.IndexAny(s, ".[")
+			if end < 0 {
+				end = len(s)
+			}
+			if end == 0 {
+				return nil, fmt.Errorf("jsonpath: empty key in %q", expr)
+			}
+			steps = append(steps, step{key: s[:end]})
+			s = s[end:]
+		case '[':
+			end := strings.IndexByte(s, ']')
+			if end < 0 {
+				return nil, fmt.Errorf("jsonpath: missing ']' in %q", expr)
+			}
+			inner := strings.TrimSpace(s[1:end])
+			s = s[end+1:]
+			if len(inner) >= 2 && (inner[0] == '\'' || inner[0] == '"') && inner[len(inner)-1] == inner[0] {
+				steps = append(steps, step{key: inner[1 : len(inner)-1]})
+				continue
+			}
+			n, err := strconv.Atoi(inner)
+			if err != nil {
+				return nil, fmt.Errorf("jsonpath: unsupported selector [%s] in %q", inner, expr)
+			}
+			steps = append(steps, step{index: n, isIndex: true})
+		default:
+			return nil, fmt.Errorf("jsonpath: unexpected %q in %q", s[0], expr)
+		}
+	}
+	return steps, nil
+}
+
+// Root returns the first object key selected by expr ("$.a.b" -> "a").
+func Root(expr string) (string, bool) {
+	steps, err := parse(expr)
+	if err != nil || len(steps) == 0 || steps[0].isIndex {
+		return "", false
+	}
+	return steps[0].key, true
+}
@@ -0,0 +1,44 @@
+package jsonpath
+
+import (
+	"encoding/json"
+	"errors"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestGet(t *testing.T) {
+	r := require.New(t)
+
+	var doc any
+	r.NoError(json.Unmarshal([]byte(`{"a":{"b":[1,{"c":"x"}]},"d.e":true}`), &doc))
+
+	tests := []struct {
+		expr string
+		want any
+	}{
+		{"$", doc},
+		{"", doc},
+		{"$.a.b[0]", float64(1)},
+		{"$.a.b[-1].c", "x"},
+		{"a.b[1]['c']", "x"},
+		{`$["d.e"]`, true},
+	}
+	for _, tt := range tests {
+		got, err := Get(doc, tt.expr)
+		r.NoError(err, tt.expr)
+		r.Equal(tt.want, got, tt.expr)
+	}
+
+	for _, expr := range []string{"$.nope", "$.a.b[5]", "$.a[0]", "$.a.b.c"} {
+		_, err := Get(doc, expr)
+		r.True(errors.Is(err, ErrNoMatch), expr)
+	}
+
+	for _, expr := range []string{"$.a[", "$.a[*]", "$..a"} {
+		_, err := Get(doc, expr)
+		r.Error(err, expr)
+		r.False(errors.Is(err, ErrNoMatch), expr)
+	}
+}
@@ -0,0 +1,69 @@
+// Package kvapi mirrors the kv.proto messages and the details of their HTTP
+// mapping shared by the server and the client.
+package kvapi
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"hash"
+)
+
+// FileMeta mirrors kv.v1.FileMeta.
+type FileMeta struct {
+	ContentType   string `json:"content_type,omitempty"`
+	ContentLength int64  `json:"content_length"` // 未指定は-1
+	Etag          string `json:"etag,omitempty"`
+}
+
+// FileMetaFinal mirrors kv.v1.FileMetaFinal.
+type FileMetaFinal struct {
+	ContentLength int64  `json:"content_length"`
+	Hash          string `json:"hash"` // "sha256:<hex>"
+}
+
+// WatchEvent mirrors kv.v1.WatchEvent.
+type WatchEvent struct {
+	Type string `json:"type"` // PUT or DELETE
+	Path string `json:"path"`
+	Etag string `json:"etag,omitempty"`
+}
+
+const (
+	EventPut    = "PUT"
+	EventDelete = "DELETE"
+)
+
+// ListResponse mirrors kv.v1.ListResponse.
+type ListResponse struct {
+	Keys []string `json:"keys"`
+}
+
+// HTTP では FileMetaFinal をトレーラーで送る
+const (
+	TrailerContentLength = "Kv-Content-Length"
+	TrailerHash          = "Kv-Hash"
+)
+
+const HashAlgorithm = "sha256"
+
+// Hasher computes FileMetaFinal over the bytes written to it.
+type Hasher struct {
+	h hash.Hash
+	n int64
+}
+
+func NewHasher() *Hasher {
+	return &Hasher{h: sha256.New()}
+}
+
+func (h *Hasher) Write(p []byte) (int, error) {
+	h.n += int64(len(p))
+	return h.h.Write(p)
+}
+
+func (h *Hasher) Final() FileMetaFinal {
+	return FileMetaFinal{
+		ContentLength: h.n,
+		Hash:          HashAlgorithm + ":" + hex.EncodeToString(h.h.Sum(nil)),
+	}
+}
@@ -0,0 +1,7 @@
+// Package kvpb holds the protobuf and gRPC bindings generated from kv.proto.
+//
+// kv.proto is registered as kv/v1/kv.proto: etcd's client already
+// registers a "kv.proto" in the same process.
+package kvpb
+
+//go:generate protoc -I kv/v1=../.. -I ${GOOGLEAPIS} --go_out=../.. --go_opt=module=github.com/sasano8/kvtool --go-grpc_out=../.. --go-grpc_opt=module=github.com/sasano8/kvtool kv/v1/kv.proto
@@ -0,0 +1,766 @@
+// Code generated by protoc-gen-go. DO NOT EDIT.
+// versions:
+// 	protoc-gen-go v1.36.8
+// 	protoc        (unknown)
+// source: kv/v1/kv.proto
+
+package kvpb
+
+import (
+	_ "google.golang.org/genproto/googleapis/api/annotations"
+	protoreflect "google.golang.org/protobuf/reflect/protoreflect"
+	protoimpl "google.golang.org/protobuf/runtime/protoimpl"
+	reflect "reflect"
+	sync "sync"
+	unsafe "unsafe"
+)
+
+const (
+	// Verify that this generated code is sufficiently up-to-date.
+	_ = protoimpl.EnforceVersion(20 - protoimpl.MinVersion)
+	// Verify that runtime/protoimpl is sufficiently up-to-date.
+	_ = protoimpl.EnforceVersion(protoimpl.MaxVersion - 20)
+)
+
+type WatchEvent_Type int32
+
+const (
+	WatchEvent_TYPE_UNSPECIFIED WatchEvent_Type = 0
+	WatchEvent_PUT              WatchEvent_Type = 1
+	WatchEvent_DELETE           WatchEvent_Type = 2
+)
+
+// Enum value maps for WatchEvent_Type.
+var (
+	WatchEvent_Type_name = map[int32]string{
+		0: "TYPE_UNSPECIFIED",
+		1: "PUT",
+		2: "DELETE",
+	}
+	WatchEvent_Type_value = map[string]int32{
+		"TYPE_UNSPECIFIED": 0,
+		"PUT":              1,
+		"DELETE":           2,
+	}
+)
+
+func (x WatchEvent_Type) Enum() *WatchEvent_Type {
+	p := new(WatchEvent_Type)
+	*p = x
+	return p
+}
+
+func (x WatchEvent_Type) String() string {
+	return protoimpl.X.EnumStringOf(x.Descriptor(), protoreflect.EnumNumber(x))
+}
+
+func (WatchEvent_Type) Descriptor() protoreflect.EnumDescriptor {
+	return file_kv_v1_kv_proto_enumTypes[0].Descriptor()
+}
+
+func (WatchEvent_Type) Type() protoreflect.EnumType {
+	return &file_kv_v1_kv_proto_enumTypes[0]
+}
+
+func (x WatchEvent_Type) Number() protoreflect.EnumNumber {
+	return protoreflect.EnumNumber(x)
+}
+
+// Deprecated: Use WatchEvent_Type.Descriptor instead.
+func (WatchEvent_Type) EnumDescriptor() ([]byte, []int) {
+	return file_kv_v1_kv_proto_rawDescGZIP(), []int{8, 0}
+}
+
+type FileRequest struct {
+	state         protoimpl.MessageState `protogen:"open.v1"`
+	Path          string                 `protobuf:"bytes,1,opt,name=path,proto3" json:"path,omitempty"`
+	Jsonpath      string                 `protobuf:"bytes,2,opt,name=jsonpath,proto3" json:"jsonpath,omitempty"`
+	Etag          string                 `protobuf:"bytes,3,opt,name=etag,proto3" json:"etag,omitempty"`
+	unknownFields protoimpl.UnknownFields
+	sizeCache     protoimpl.SizeCache
+}
+
+func (x *FileRequest) Reset() {
+	*x = FileRequest{}
+	mi := &file_kv_v1_kv_proto_msgTypes[0]
+	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+	ms.StoreMessageInfo(mi)
+}
+
+func (x *FileRequest) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*FileRequest) ProtoMessage() {}
+
+func (x *FileRequest) ProtoReflect() protoreflect.Message {
+	mi := &file_kv_v1_kv_proto_msgTypes[0]
+	if x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use FileRequest.ProtoReflect.Descriptor instead.
+func (*FileRequest) Descriptor() ([]byte, []int) {
+	return file_kv_v1_kv_proto_rawDescGZIP(), []int{0}
+}
+
+func (x *FileRequest) GetPath() string {
+	if x != nil {
+		return x.Path
+	}
+	return ""
+}
+
+func (x *FileRequest) GetJsonpath() string {
+	if x != nil {
+		return x.Jsonpath
+	}
+	return ""
+}
+
+func (x *FileRequest) GetEtag() string {
+	if x != nil {
+		return x.Etag
+	}
+	return ""
+}
+
+type FileMeta struct {
+	state         protoimpl.MessageState `protogen:"open.v1"`
+	ContentType   string                 `protobuf:"bytes,1,opt,name=content_type,json=contentType,proto3" json:"content_type,omitempty"`
+	ContentLength int64                  `protobuf:"varint,2,opt,name=content_length,json=contentLength,proto3" json:"content_length,omitempty"`
+	Etag          string                 `protobuf:"bytes,3,opt,name=etag,proto3" json:"etag,omitempty"`
+	LastModified  int64                  `protobuf:"varint,4,opt,name=last_modified,json=lastModified,proto3" json:"last_modified,omitempty"`
+	Headers       map[string]string      `protobuf:"bytes,10,rep,name=headers,proto3" json:"headers,omitempty" protobuf_key:"bytes,1,opt,name=key" protobuf_val:"bytes,2,opt,name=value"`
+	unknownFields protoimpl.UnknownFields
+	sizeCache     protoimpl.SizeCache
+}
+
+func (x *FileMeta) Reset() {
+	*x = FileMeta{}
+	mi := &file_kv_v1_kv_proto_msgTypes[1]
+	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+	ms.StoreMessageInfo(mi)
+}
+
+func (x *FileMeta) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*FileMeta) ProtoMessage() {}
+
+func (x *FileMeta) ProtoReflect() protoreflect.Message {
+	mi := &file_kv_v1_kv_proto_msgTypes[1]
+	if x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use FileMeta.ProtoReflect.Descriptor instead.
+func (*FileMeta) Descriptor() ([]byte, []int) {
+	return file_kv_v1_kv_proto_rawDescGZIP(), []int{1}
+}
+
+func (x *FileMeta) GetContentType() string {
+	if x != nil {
+		return x.ContentType
+	}
+	return ""
+}
+
+func (x *FileMeta) GetContentLength() int64 {
+	if x != nil {
+		return x.ContentLength
+	}
+	return 0
+}
+
+func (x *FileMeta) GetEtag() string {
+	if x != nil {
+		return x.Etag
+	}
+	return ""
+}
+
+func (x *FileMeta) GetLastModified() int64 {
+	if x != nil {
+		return x.LastModified
+	}
+	return 0
+}
+
+func (x *FileMeta) GetHeaders() map[string]string {
+	if x != nil {
+		return x.Headers
+	}
+	return nil
+}
+
+type FileMetaFinal struct {
+	state         protoimpl.MessageState `protogen:"open.v1"`
+	ContentLength int64                  `protobuf:"varint,1,opt,name=content_length,json=contentLength,proto3" json:"content_length,omitempty"`
+	Hash          string                 `protobuf:"bytes,2,opt,name=hash,proto3" json:"hash,omitempty"`
+	unknownFields protoimpl.UnknownFields
+	sizeCache     protoimpl.SizeCache
+}
+
+func (x *FileMetaFinal) Reset() {
+	*x = FileMetaFinal{}
+	mi := &file_kv_v1_kv_proto_msgTypes[2]
+	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+	ms.StoreMessageInfo(mi)
+}
+
+func (x *FileMetaFinal) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*FileMetaFinal) ProtoMessage() {}
+
+func (x *FileMetaFinal) ProtoReflect() protoreflect.Message {
+	mi := &file_kv_v1_kv_proto_msgTypes[2]
+	if x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use FileMetaFinal.ProtoReflect.Descriptor instead.
+func (*FileMetaFinal) Descriptor() ([]byte, []int) {
+	return file_kv_v1_kv_proto_rawDescGZIP(), []int{2}
+}
+
+func (x *FileMetaFinal) GetContentLength() int64 {
+	if x != nil {
+		return x.ContentLength
+	}
+	return 0
+}
+
+func (x *FileMetaFinal) GetHash() string {
+	if x != nil {
+		return x.Hash
+	}
+	return ""
+}
+
+type FileResponse struct {
+	state protoimpl.MessageState `protogen:"open.v1"`
+	// Types that are valid to be assigned to Part:
+	//
+	//	*FileResponse_Meta
+	//	*FileResponse_Chunk
+	//	*FileResponse_Final
+	Part          isFileResponse_Part `protobuf_oneof:"part"`
+	unknownFields protoimpl.UnknownFields
+	sizeCache     protoimpl.SizeCache
+}
+
+func (x *FileResponse) Reset() {
+	*x = FileResponse{}
+	mi := &file_kv_v1_kv_proto_msgTypes[3]
+	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+	ms.StoreMessageInfo(mi)
+}
+
+func (x *FileResponse) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*FileResponse) ProtoMessage() {}
+
+func (x *FileResponse) ProtoReflect() protoreflect.Message {
+	mi := &file_kv_v1_kv_proto_msgTypes[3]
+	if x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use FileResponse.ProtoReflect.Descriptor instead.
+func (*FileResponse) Descriptor() ([]byte, []int) {
+	return file_kv_v1_kv_proto_rawDescGZIP(), []int{3}
+}
+
+func (x *FileResponse) GetPart() isFileResponse_Part {
+	if x != nil {
+		return x.Part
+	}
+	return nil
+}
+
+func (x *FileResponse) GetMeta() *FileMeta {
+	if x != nil {
+		if x, ok := x.Part.(*FileResponse_Meta); ok {
+			return x.Meta
+		}
+	}
+	return nil
+}
+
+func (x *FileResponse) GetChunk() []byte {
+	if x != nil {
+		if x, ok := x.Part.(*FileResponse_Chunk); ok {
+			return x.Chunk
+		}
+	}
+	return nil
+}
+
+func (x *FileResponse) GetFinal() *FileMetaFinal {
+	if x != nil {
+		if x, ok := x.Part.(*FileResponse_Final); ok {
+			return x.Final
+		}
+	}
+	return nil
+}
+
+type isFileResponse_Part interface {
+	isFileResponse_Part()
+}
+
+type FileResponse_Meta struct {
+	Meta *FileMeta `protobuf:"bytes,1,opt,name=meta,proto3,oneof"`
+}
+
+type FileResponse_Chunk struct {
+	Chunk []byte `protobuf:"bytes,2,opt,name=chunk,proto3,oneof"`
+}
+
+type FileResponse_Final struct {
+	Final *FileMetaFinal `protobuf:"bytes,3,opt,name=final,proto3,oneof"`
+}
+
+func (*FileResponse_Meta) isFileResponse_Part() {}
+
+func (*FileResponse_Chunk) isFileResponse_Part() {}
+
+func (*FileResponse_Final) isFileResponse_Part() {}
+
+type PutRequest struct {
+	state protoimpl.MessageState `protogen:"open.v1"`
+	// Types that are valid to be assigned to Part:
+	//
+	//	*PutRequest_Head
+	//	*PutRequest_Chunk
+	Part          isPutRequest_Part `protobuf_oneof:"part"`
+	unknownFields protoimpl.UnknownFields
+	sizeCache     protoimpl.SizeCache
+}
+
+func (x *PutRequest) Reset() {
+	*x = PutRequest{}
+	mi := &file_kv_v1_kv_proto_msgTypes[4]
+	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+	ms.StoreMessageInfo(mi)
+}
+
+func (x *PutRequest) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*PutRequest) ProtoMessage() {}
+
+func (x *PutRequest) ProtoReflect() protoreflect.Message {
+	mi := &file_kv_v1_kv_proto_msgTypes[4]
+	if x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use PutRequest.ProtoReflect.Descriptor instead.
+func (*PutRequest) Descriptor() ([]byte, []int) {
+	return file_kv_v1_kv_proto_rawDescGZIP(), []int{4}
+}
+
+func (x *PutRequest) GetPart() isPutRequest_Part {
+	if x != nil {
+		return x.Part
+	}
+	return nil
+}
+
+func (x *PutRequest) GetHead() *FileRequest {
+	if x != nil {
+		if x, ok := x.Part.(*PutRequest_Head); ok {
+			return x.Head
+		}
+	}
+	return nil
+}
+
+func (x *PutRequest) GetChunk() []byte {
+	if x != nil {
+		if x, ok := x.Part.(*PutRequest_Chunk); ok {
+			return x.Chunk
+		}
+	}
+	return nil
+}
+
+type isPutRequest_Part interface {
+	isPutRequest_Part()
+}
+
+type PutRequest_Head struct {
+	Head *FileRequest `protobuf:"bytes,1,opt,name=head,proto3,oneof"`
+}
+
+type PutRequest_Chunk struct {
+	Chunk []byte `protobuf:"bytes,2,opt,name=chunk,proto3,oneof"`
+}
+
+func (*PutRequest_Head) isPutRequest_Part() {}
+
+func (*PutRequest_Chunk) isPutRequest_Part() {}
+
+type DeleteResponse struct {
+	state         protoimpl.MessageState `protogen:"open.v1"`
+	unknownFields protoimpl.UnknownFields
+	sizeCache     protoimpl.SizeCache
+}
+
+func (x *DeleteResponse) Reset() {
+	*x = DeleteResponse{}
+	mi := &file_kv_v1_kv_proto_msgTypes[5]
+	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+	ms.StoreMessageInfo(mi)
+}
+
+func (x *DeleteResponse) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*DeleteResponse) ProtoMessage() {}
+
+func (x *DeleteResponse) ProtoReflect() protoreflect.Message {
+	mi := &file_kv_v1_kv_proto_msgTypes[5]
+	if x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use DeleteResponse.ProtoReflect.Descriptor instead.
+func (*DeleteResponse) Descriptor() ([]byte, []int) {
+	return file_kv_v1_kv_proto_rawDescGZIP(), []int{5}
+}
+
+type ListRequest struct {
+	state         protoimpl.MessageState `protogen:"open.v1"`
+	Prefix        string                 `protobuf:"bytes,1,opt,name=prefix,proto3" json:"prefix,omitempty"`
+	unknownFields protoimpl.UnknownFields
+	sizeCache     protoimpl.SizeCache
+}
+
+func (x *ListRequest) Reset() {
+	*x = ListRequest{}
+	mi := &file_kv_v1_kv_proto_msgTypes[6]
+	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+	ms.StoreMessageInfo(mi)
+}
+
+func (x *ListRequest) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*ListRequest) ProtoMessage() {}
+
+func (x *ListRequest) ProtoReflect() protoreflect.Message {
+	mi := &file_kv_v1_kv_proto_msgTypes[6]
+	if x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use ListRequest.ProtoReflect.Descriptor instead.
+func (*ListRequest) Descriptor() ([]byte, []int) {
+	return file_kv_v1_kv_proto_rawDescGZIP(), []int{6}
+}
+
+func (x *ListRequest) GetPrefix() string {
+	if x != nil {
+		return x.Prefix
+	}
+	return ""
+}
+
+type ListResponse struct {
+	state         protoimpl.MessageState `protogen:"open.v1"`
+	Keys          []string               `protobuf:"bytes,1,rep,name=keys,proto3" json:"keys,omitempty"`
+	unknownFields protoimpl.UnknownFields
+	sizeCache     protoimpl.SizeCache
+}
+
+func (x *ListResponse) Reset() {
+	*x = ListResponse{}
+	mi := &file_kv_v1_kv_proto_msgTypes[7]
+	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+	ms.StoreMessageInfo(mi)
+}
+
+func (x *ListResponse) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*ListResponse) ProtoMessage() {}
+
+func (x *ListResponse) ProtoReflect() protoreflect.Message {
+	mi := &file_kv_v1_kv_proto_msgTypes[7]
+	if x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use ListResponse.ProtoReflect.Descriptor instead.
+func (*ListResponse) Descriptor() ([]byte, []int) {
+	return file_kv_v1_kv_proto_rawDescGZIP(), []int{7}
+}
+
+func (x *ListResponse) GetKeys() []string {
+	if x != nil {
+		return x.Keys
+	}
+	return nil
+}
+
+type WatchEvent struct {
+	state         protoimpl.MessageState `protogen:"open.v1"`
+	Type          WatchEvent_Type        `protobuf:"varint,1,opt,name=type,proto3,enum=kv.v1.WatchEvent_Type" json:"type,omitempty"`
+	Path          string                 `protobuf:"bytes,2,opt,name=path,proto3" json:"path,omitempty"`
+	Etag          string                 `protobuf:"bytes,3,opt,name=etag,proto3" json:"etag,omitempty"`
+	unknownFields protoimpl.UnknownFields
+	sizeCache     protoimpl.SizeCache
+}
+
+func (x *WatchEvent) Reset() {
+	*x = WatchEvent{}
+	mi := &file_kv_v1_kv_proto_msgTypes[8]
+	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+	ms.StoreMessageInfo(mi)
+}
+
+func (x *WatchEvent) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*WatchEvent) ProtoMessage() {}
+
+func (x *WatchEvent) ProtoReflect() protoreflect.Message {
+	mi := &file_kv_v1_kv_proto_msgTypes[8]
+	if x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use WatchEvent.ProtoReflect.Descriptor instead.
+func (*WatchEvent) Descriptor() ([]byte, []int) {
+	return file_kv_v1_kv_proto_rawDescGZIP(), []int{8}
+}
+
+func (x *WatchEvent) GetType() WatchEvent_Type {
+	if x != nil {
+		return x.Type
+	}
+	return WatchEvent_TYPE_UNSPECIFIED
+}
+
+func (x *WatchEvent) GetPath() string {
+	if x != nil {
+		return x.Path
+	}
+	return ""
+}
+
+func (x *WatchEvent) GetEtag() string {
+	if x != nil {
+		return x.Etag
+	}
+	return ""
+}
+
+var File_kv_v1_kv_proto protoreflect.FileDescriptor
+
+const file_kv_v1_kv_proto_rawDesc = "" +
+	"\n" +
+	"\x0ekv/v1/kv.proto\x12\x05kv.v1\x1a\x1cgoogle/api/annotations.proto\"Q\n" +
+	"\vFileRequest\x12\x12\n" +
+	"\x04path\x18\x01 \x01(\tR\x04path\x12\x1a\n" +
+	"\bjsonpath\x18\x02 \x01(\tR\bjsonpath\x12\x12\n" +
+	"\x04etag\x18\x03 \x01(\tR\x04etag\"\x81\x02\n" +
+	"\bFileMeta\x12!\n" +
+	"\fcontent_type\x18\x01 \x01(\tR\vcontentType\x12%\n" +
+	"\x0econtent_length\x18\x02 \x01(\x03R\rcontentLength\x12\x12\n" +
+	"\x04etag\x18\x03 \x01(\tR\x04etag\x12#\n" +
+	"\rlast_modified\x18\x04 \x01(\x03R\flastModified\x126\n" +
+	"\aheaders\x18\n" +
+	" \x03(\v2\x1c.kv.v1.FileMeta.HeadersEntryR\aheaders\x1a:\n" +
+	"\fHeadersEntry\x12\x10\n" +
+	"\x03key\x18\x01 \x01(\tR\x03key\x12\x14\n" +
+	"\x05value\x18\x02 \x01(\tR\x05value:\x028\x01\"J\n" +
+	"\rFileMetaFinal\x12%\n" +
+	"\x0econtent_length\x18\x01 \x01(\x03R\rcontentLength\x12\x12\n" +
+	"\x04hash\x18\x02 \x01(\tR\x04hash\"\x83\x01\n" +
+	"\fFileResponse\x12%\n" +
+	"\x04meta\x18\x01 \x01(\v2\x0f.kv.v1.FileMetaH\x00R\x04meta\x12\x16\n" +
+	"\x05chunk\x18\x02 \x01(\fH\x00R\x05chunk\x12,\n" +
+	"\x05final\x18\x03 \x01(\v2\x14.kv.v1.FileMetaFinalH\x00R\x05finalB\x06\n" +
+	"\x04part\"V\n" +
+	"\n" +
+	"PutRequest\x12(\n" +
+	"\x04head\x18\x01 \x01(\v2\x12.kv.v1.FileRequestH\x00R\x04head\x12\x16\n" +
+	"\x05chunk\x18\x02 \x01(\fH\x00R\x05chunkB\x06\n" +
+	"\x04part\"\x10\n" +
+	"\x0eDeleteResponse\"%\n" +
+	"\vListRequest\x12\x16\n" +
+	"\x06prefix\x18\x01 \x01(\tR\x06prefix\"\"\n" +
+	"\fListResponse\x12\x12\n" +
+	"\x04keys\x18\x01 \x03(\tR\x04keys\"\x93\x01\n" +
+	"\n" +
+	"WatchEvent\x12*\n" +
+	"\x04type\x18\x01 \x01(\x0e2\x16.kv.v1.WatchEvent.TypeR\x04type\x12\x12\n" +
+	"\x04path\x18\x02 \x01(\tR\x04path\x12\x12\n" +
+	"\x04etag\x18\x03 \x01(\tR\x04etag\"1\n" +
+	"\x04Type\x12\x14\n" +
+	"\x10TYPE_UNSPECIFIED\x10\x00\x12\a\n" +
+	"\x03PUT\x10\x01\x12\n" +
+	"\n" +
+	"\x06DELETE\x10\x022\xd7\x03\n" +
+	"\x02KV\x12M\n" +
+	"\x04Head\x12\x12.kv.v1.FileRequest\x1a\x0f.kv.v1.FileMeta\" \x82\xd3\xe4\x93\x02\x1aB\x18\n" +
+	"\x04HEAD\x12\x10/v1/kv/{path=**}\x12K\n" +
+	"\x04Read\x12\x12.kv.v1.FileRequest\x1a\x13.kv.v1.FileResponse\"\x18\x82\xd3\xe4\x93\x02\x12\x12\x10/v1/kv/{path=**}0\x01\x12M\n" +
+	"\x05Watch\x12\x12.kv.v1.FileRequest\x1a\x11.kv.v1.WatchEvent\"\x1b\x82\xd3\xe4\x93\x02\x15\x12\x13/v1/watch/{path=**}0\x01\x12H\n" +
+	"\x03Put\x12\x11.kv.v1.PutRequest\x1a\x0f.kv.v1.FileMeta\"\x1b\x82\xd3\xe4\x93\x02\x15:\x01*\x1a\x10/v1/kv/{path=**}(\x01\x12M\n" +
+	"\x06Delete\x12\x12.kv.v1.FileRequest\x1a\x15.kv.v1.DeleteResponse\"\x18\x82\xd3\xe4\x93\x02\x12*\x10/v1/kv/{path=**}\x12M\n" +
+	"\x04List\x12\x12.kv.v1.ListRequest\x1a\x13.kv.v1.ListResponse\"\x1c\x82\xd3\xe4\x93\x02\x16\x12\x14/v1/list/{prefix=**}B)Z'github.com/sasano8/kvtool/internal/kvpbb\x06proto3"
+
+var (
+	file_kv_v1_kv_proto_rawDescOnce sync.Once
+	file_kv_v1_kv_proto_rawDescData []byte
+)
+
+func file_kv_v1_kv_proto_rawDescGZIP() []byte {
+	file_kv_v1_kv_proto_rawDescOnce.Do(func() {
+		file_kv_v1_kv_proto_rawDescData = protoimpl.X.CompressGZIP(unsafe.Slice(unsafe.StringData(file_kv_v1_kv_proto_rawDesc), len(file_kv_v1_kv_proto_rawDesc)))
+	})
+	return file_kv_v1_kv_proto_rawDescData
+}
+
+var file_kv_v1_kv_proto_enumTypes = make([]protoimpl.EnumInfo, 1)
+var file_kv_v1_kv_proto_msgTypes = make([]protoimpl.MessageInfo, 10)
+var file_kv_v1_kv_proto_goTypes = []any{
+	(WatchEvent_Type)(0),   // 0: kv.v1.WatchEvent.Type
+	(*FileRequest)(nil),    // 1: kv.v1.FileRequest
+	(*FileMeta)(nil),       // 2: kv.v1.FileMeta
+	(*FileMetaFinal)(nil),  // 3: kv.v1.FileMetaFinal
+	(*FileResponse)(nil),   // 4: kv.v1.FileResponse
+	(*PutRequest)(nil),     // 5: kv.v1.PutRequest
+	(*DeleteResponse)(nil), // 6: kv.v1.DeleteResponse
+	(*ListRequest)(nil),    // 7: kv.v1.ListRequest
+	(*ListResponse)(nil),   // 8: kv.v1.ListResponse
+	(*WatchEvent)(nil),     // 9: kv.v1.WatchEvent
+	nil,                    // 10: kv.v1.FileMeta.HeadersEntry
+}
+var file_kv_v1_kv_proto_depIdxs = []int32{
+	10, // 0: kv.v1.FileMeta.headers:type_name -> kv.v1.FileMeta.HeadersEntry
+	2,  // 1: kv.v1.FileResponse.meta:type_name -> kv.v1.FileMeta
+	3,  // 2: kv.v1.FileResponse.final:type_name -> kv.v1.FileMetaFinal
+	1,  // 3: kv.v1.PutRequest.head:type_name -> kv.v1.FileRequest
+	0,  // 4: kv.v1.WatchEvent.type:type_name -> kv.v1.WatchEvent.Type
+	1,  // 5: kv.v1.KV.Head:input_type -> kv.v1.FileRequest
+	1,  // 6: kv.v1.KV.Read:input_type -> kv.v1.FileRequest
+	1,  // 7: kv.v1.KV.Watch:input_type -> kv.v1.FileRequest
+	5,  // 8: kv.v1.KV.Put:input_type -> kv.v1.PutRequest
+	1,  // 9: kv.v1.KV.Delete:input_type -> kv.v1.FileRequest
+	7,  // 10: kv.v1.KV.List:input_type -> kv.v1.ListRequest
+	2,  // 11: kv.v1.KV.Head:output_type -> kv.v1.FileMeta
+	4,  // 12: kv.v1.KV.Read:output_type -> kv.v1.FileResponse
+	9,  // 13: kv.v1.KV.Watch:output_type -> kv.v1.WatchEvent
+	2,  // 14: kv.v1.KV.Put:output_type -> kv.v1.FileMeta
+	6,  // 15: kv.v1.KV.Delete:output_type -> kv.v1.DeleteResponse
+	8,  // 16: kv.v1.KV.List:output_type -> kv.v1.ListResponse
+	11, // [11:17] is the sub-list for method output_type
+	5,  // [5:11] is the sub-list for method input_type
+	5,  // [5:5] is the sub-list for extension type_name
+	5,  // [5:5] is the sub-list for extension extendee
+	0,  // [0:5] is the sub-list for field type_name
+}
+
+func init() { file_kv_v1_kv_proto_init() }
+func file_kv_v1_kv_proto_init() {
+	if File_kv_v1_kv_proto != nil {
+		return
+	}
+	file_kv_v1_kv_proto_msgTypes[3].OneofWrappers = []any{
+		(*FileResponse_Meta)(nil),
+		(*FileResponse_Chunk)(nil),
+		(*FileResponse_Final)(nil),
+	}
+	file_kv_v1_kv_proto_msgTypes[4].OneofWrappers = []any{
+		(*PutRequest_Head)(nil),
+		(*PutRequest_Chunk)(nil),
+	}
+	type x struct{}
+	out := protoimpl.TypeBuilder{
+		File: protoimpl.DescBuilder{
+			GoPackagePath: reflect.TypeOf(x{}).PkgPath(),
+			RawDescriptor: unsafe.Slice(unsafe.StringData(file_kv_v1_kv_proto_rawDesc), len(file_kv_v1_kv_proto_rawDesc)),
+			NumEnums:      1,
+			NumMessages:   10,
+			NumExtensions: 0,
+			NumServices:   1,
+		},
+		GoTypes:           file_kv_v1_kv_proto_goTypes,
+		DependencyIndexes: file_kv_v1_kv_proto_depIdxs,
+		EnumInfos:         file_kv_v1_kv_proto_enumTypes,
+		MessageInfos:      file_kv_v1_kv_proto_msgTypes,
+	}.Build()
+	File_kv_v1_kv_proto = out.File
+	file_kv_v1_kv_proto_goTypes = nil
+	file_kv_v1_kv_proto_depIdxs = nil
+}
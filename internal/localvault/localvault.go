@@ -0,0 +1,496 @@
+// Package localvault implements the encrypted file behind the "local"
+// store type: namespaced key/values with a version history per key,
+// unlocked with a passphrase (scrypt) or a key file.
+//
+// The values are encrypted with a random data key (AES-256-GCM). The data
+// key is stored wrapped with a key derived from the passphrase or read from
+// the key file, so changing the passphrase only re-wraps the data key.
+package localvault
+
+import (
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/rand"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"time"
+
+	"golang.org/x/crypto/scrypt"
+
+	"github.com/sasano8/kvtool/internal/fsutil"
+)
+
+const FormatVersion = 1
+
+var (
+	ErrNotFound  = errors.New("key not found")
+	ErrExists    = errors.New("vault file already exists")
+	ErrBadSecret = errors.New("wrong passphrase or key file")
+	ErrNoSecret  = errors.New("no passphrase or key file given")
+)
+
+// scrypt のパラメータ。テストでは小さくする
+var (
+	ScryptN = 1 << 15
+	ScryptR = 8
+	ScryptP = 1
+)
+
+// Secret unlocks a vault: either a passphrase or a key file holding 32
+// random bytes in hex.
+type Secret struct {
+	Passphrase []byte
+	KeyFile    string
+}
+
+func (s Secret) kdfType() (string, error) {
+	switch {
+	case s.KeyFile != "":
+		return "keyfile", nil
+	case len(s.Passphrase) > 0:
+		return "scrypt", nil
+	default:
+		return "", ErrNoSecret
+	}
+}
+
+// KDF records how the key-encryption key is derived.
+type KDF struct {
+	Type string `json:"type"` // "scrypt" | "keyfile"
+	Salt []byte `json:"salt,omitempty"`
+	N    int    `json:"n,omitempty"`
+	R    int    `json:"r,omitempty"`
+	P    int    `json:"p,omitempty"`
+}
+
+func newKDF(s Secret) (KDF, error) {
+	typ, err := s.kdfType()
+	if err != nil {
+		return KDF{}, err
+	}
+	if typ == "keyfile" {
+		return KDF{Type: typ}, nil
+	}
+	salt := make([]byte, 16)
+	if _, err := rand.Read(salt); err != nil {
+		return KDF{}, err
+	}
+	return KDF{Type: typ, Salt: salt, N: ScryptN, R: ScryptR, P: ScryptP}, nil
+}
+
+func (k KDF) key(s Secret) ([]byte, error) {
+	switch k.Type {
+	case "scrypt":
+		if len(s.Passphrase) == 0 {
+			return nil, fmt.Errorf("%w: the vault needs a passphrase", ErrNoSecret)
+		}
+		return scrypt.Key(s.Passphrase, k.Salt, k.N, k.R, k.P, 32)
+	case "keyfile":
+		if s.KeyFile == "" {
+			return nil, fmt.Errorf("%w: the vault needs a key file", ErrNoSecret)
+		}
+		return ReadKeyFile(s.KeyFile)
+	default:
+		return nil, fmt.Errorf("unknown kdf %q", k.Type)
+	}
+}
+
+// GenerateKeyFile writes a new random key file (mode 0600). It fails if
+// the file exists.
+func GenerateKeyFile(path string) error {
+	key := make([]byte, 32)
+	if _, err := rand.Read(key); err != nil {
+		return err
+	}
+	if err := os.MkdirAll(filepath.Dir(path), 0o700); err != nil {
+		return err
+	}
+	f, err := os.OpenFile(path, os.O_WRONLY|os.O_CREATE|os.O_EXCL, 0o600)
+	if err != nil {
+		return err
+	}
+	if _, err := f.WriteString(hex.EncodeToString(key) + "\n"); err != nil {
+		f.Close()
+		return err
+	}
+	return f.Close()
+}
+
+func ReadKeyFile(path string) ([]byte, error) {
+	b, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	key, err := hex.DecodeString(strings.TrimSpace(string(b)))
+	if err != nil || len(key) != 32 {
+		return nil, fmt.Errorf("key file %s: want 32 bytes in hex", path)
+	}
+	return key, nil
+}
+
+// Version is one value of a key. A deleted key keeps its history and gets
+// a version with Deleted set.
+type Version struct {
+	Value   string    `json:"value,omitempty"`
+	Deleted bool      `json:"deleted,omitempty"`
+	Created time.Time `json:"created"`
+}
+
+// Vault is the decrypted content: namespace -> key -> versions (oldest first).
+type Vault struct {
+	Namespaces map[string]map[string][]Version `json:"namespaces"`
+}
+
+func newVault() *Vault {
+	return &Vault{Namespaces: map[string]map[string][]Version{}}
+}
+
+// Get returns the current value of key and its version number (1-based).
+func (v *Vault) Get(ns, key string) (string, int, error) {
+	hist := v.Namespaces[ns][key]
+	if len(hist) == 0 || hist[len(hist)-1].Deleted {
+		return "", 0, fmt.Errorf("%w: %s/%s", ErrNotFound, ns, key)
+	}
+	return hist[len(hist)-1].Value, len(hist), nil
+}
+
+// GetVersion returns version n (1-based) of key.
+func (v *Vault) GetVersion(ns, key string, n int) (string, error) {
+	hist := v.Namespaces[ns][key]
+	if n < 1 || n > len(hist) || hist[n-1].Deleted {
+		return "", fmt.Errorf("%w: %s/%s version %d", ErrNotFound, ns, key, n)
+	}
+	return hist[n-1].Value, nil
+}
+
+func (v *Vault) History(ns, key string) []Version {
+	return v.Namespaces[ns][key]
+}
+
+// Set adds a version to key unless value is already current. It returns
+// the current version number.
+func (v *Vault) Set(ns, key, value string, now time.Time) int {
+	if cur, n, err := v.Get(ns, key); err == nil && cur == value {
+		return n
+	}
+	if v.Namespaces[ns] == nil {
+		v.Namespaces[ns] = map[string][]Version{}
+	}
+	v.Namespaces[ns][key] = append(v.Namespaces[ns][key], Version{Value: value, Created: now})
+	return len(v.Namespaces[ns][key])
+}
+
+func (v *Vault) Delete(ns, key string, now time.Time) error {
+	if _, _, err := v.Get(ns, key); err != nil {
+		return err
+	}
+	v.Namespaces[ns][key] = append(v.Namespaces[ns][key], Version{Deleted: true, Created: now})
+	return nil
+}
+
+// Keys returns the keys of ns that currently have a value, sorted.
+func (v *Vault) Keys(ns string) []string {
+	var out []string
+	for k := range v.Namespaces[ns] {
+		if _, _, err := v.Get(ns, k); err == nil {
+			out = append(out, k)
+		}
+	}
+	sort.Strings(out)
+	return out
+}
+
+// Values returns the current values of ns.
+func (v *Vault) Values(ns string) map[string]string {
+	out := map[string]string{}
+	for _, k := range v.Keys(ns) {
+		out[k], _, _ = v.Get(ns, k)
+	}
+	return out
+}
+
+// Replace makes values the current content of ns: changed keys get a new
+// version and missing keys are deleted.
+func (v *Vault) Replace(ns string, values map[string]string, now time.Time) {
+	for _, k := range v.Keys(ns) {
+		if _, ok := values[k]; !ok {
+			_ = v.Delete(ns, k, now)
+		}
+	}
+	for k, val := range values {
+		v.Set(ns, k, val, now)
+	}
+}
+
+// file はディスク上の形式。Data は Vault の JSON を暗号化したもの
+type file struct {
+	Version    int    `json:"version"`
+	KDF        KDF    `json:"kdf"`
+	WrappedKey sealed `json:"wrapped_key"`
+	Data       sealed `json:"data"`
+}
+
+type sealed struct {
+	Nonce      []byte `json:"nonce"`
+	Ciphertext []byte `json:"ciphertext"`
+}
+
+func seal(key, plain []byte, aad string) (sealed, error) {
+	gcm, err := newGCM(key)
+	if err != nil {
+		return sealed{}, err
+	}
+	nonce := make([]byte, gcm.NonceSize())
+	if _, err := rand.Read(nonce); err != nil {
+		return sealed{}, err
+	}
+	return sealed{Nonce: nonce, Ciphertext: gcm.Seal(nil, nonce, plain, []byte(aad))}, nil
+}
+
+func (s sealed) open(key []byte, aad string) ([]byte, error) {
+	gcm, err := newGCM(key)
+	if err != nil {
+		return nil, err
+	}
+	if len(s.Nonce) != gcm.NonceSize() {
+		return nil, errors.New("bad nonce")
+	}
+	return gcm.Open(nil, s.Nonce, s.Ciphertext, []byte(aad))
+}
+
+func newGCM(key []byte) (cipher.AEAD, error) {
+	block, err := aes.NewCipher(key)
+	if err != nil {
+		return nil, err
+	}
+	return cipher.NewGCM(block)
+}
+
+// AAD で用途を分けて、鍵とデータの入れ替えを防ぐ
+const (
+	aadKey  = "kvtool-local-v1 key"
+	aadData = "kvtool-local-v1 data"
+)
+
+func readFile(path string) (*file, error) {
+	b, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	var f file
+	if err := json.Unmarshal(b, &f); err != nil {
+		return nil, fmt.Errorf("parse %s: %w", path, err)
+	}
+	if f.Version != FormatVersion {
+		return nil, fmt.Errorf("%s: unsupported format version %d", path, f.Version)
+	}
+	return &f, nil
+}
+
+func (f *file) dataKey(s Secret) ([]byte, error) {
+	kek, err := f.KDF.key(s)
+	if err != nil {
+		return nil, err
+	}
+	key, err := f.WrappedKey.open(kek, aadKey)
+	if err != nil {
+		return nil, ErrBadSecret
+	}
+	return key, nil
+}
+
+func (f *file) decrypt(key []byte) (*Vault, error) {
+	plain, err := f.Data.open(key, aadData)
+	if err != nil {
+		return nil, fmt.Errorf("decrypt: %w", err)
+	}
+	v := newVault()
+	if err := json.Unmarshal(plain, v); err != nil {
+		return nil, err
+	}
+	if v.Namespaces == nil {
+		v.Namespaces = map[string]map[string][]Version{}
+	}
+	return v, nil
+}
+
+func (f *file) encrypt(key []byte, v *Vault) error {
+	plain, err := json.Marshal(v)
+	if err != nil {
+		return err
+	}
+	f.Data, err = seal(key, plain, aadData)
+	return err
+}
+
+func (f *file) write(path string) error {
+	b, err := json.MarshalIndent(f, "", "  ")
+	if err != nil {
+		return err
+	}
+	// 保管庫のディレクトリは本人だけが読めるように先に作る
+	if err := os.MkdirAll(filepath.Dir(path), 0o700); err != nil {
+		return err
+	}
+	return fsutil.WriteFileAtomic(path, append(b, '\n'), 0o600)
+}
+
+// Init creates an empty vault at path unlocked by s.
+func Init(path string, s Secret) error {
+	unlock, err := lock(path)
+	if err != nil {
+		return err
+	}
+	defer unlock()
+
+	if _, err := os.Stat(path); err == nil {
+		return fmt.Errorf("%w: %s", ErrExists, path)
+	} else if !errors.Is(err, fs.ErrNotExist) {
+		return err
+	}
+
+	kdf, err := newKDF(s)
+	if err != nil {
+		return err
+	}
+	kek, err := kdf.key(s)
+	if err != nil {
+		return err
+	}
+	key := make([]byte, 32)
+	if _, err := rand.Read(key); err != nil {
+		return err
+	}
+	f := &file{Version: FormatVersion, KDF: kdf}
+	if f.WrappedKey, err = seal(kek, key, aadKey); err != nil {
+		return err
+	}
+	if err := f.encrypt(key, newVault()); err != nil {
+		return err
+	}
+	return f.write(path)
+}
+
+// Open decrypts the vault at path.
+func Open(path string, s Secret) (*Vault, error) {
+	f, err := readFile(path)
+	if err != nil {
+		return nil, err
+	}
+	key, err := f.dataKey(s)
+	if err != nil {
+		return nil, err
+	}
+	return f.decrypt(key)
+}
+
+// Update decrypts the vault, calls fn and writes the result back, holding
+// the file lock throughout so concurrent updates do not lose changes.
+// Nothing is written when fn fails.
+func Update(path string, s Secret, fn func(*Vault) error) error {
+	unlock, err := lock(path)
+	if err != nil {
+		return err
+	}
+	defer unlock()
+
+	f, err := readFile(path)
+	if err != nil {
+		return err
+	}
+	key, err := f.dataKey(s)
+	if err != nil {
+		return err
+	}
+	v, err := f.decrypt(key)
+	if err != nil {
+		return err
+	}
+	if err := fn(v); err != nil {
+		return err
+	}
+	if err := f.encrypt(key, v); err != nil {
+		return err
+	}
+	return f.write(path)
+}
+
+// ChangeSecret re-wraps the data key for next (a new passphrase or key file).
+func ChangeSecret(path string, cur, next Secret) error {
+	unlock, err := lock(path)
+	if err != nil {
+		return err
+	}
+	defer unlock()
+
+	f, err := readFile(path)
+	if err != nil {
+		return err
+	}
+	key, err := f.dataKey(cur)
+	if err != nil {
+		return err
+	}
+	if f.KDF, err = newKDF(next); err != nil {
+		return err
+	}
+	kek, err := f.KDF.key(next)
+	if err != nil {
+		return err
+	}
+	if f.WrappedKey, err = seal(kek, key, aadKey); err != nil {
+		return err
+	}
+	return f.write(path)
+}
+
+// KDFType returns how the vault at path is unlocked ("scrypt" or "keyfile").
+func KDFType(path string) (string, error) {
+	f, err := readFile(path)
+	if err != nil {
+		return "", err
+	}
+	return f.KDF.Type, nil
+}
+
+// DefaultPath is KVTOOL_LOCAL_VAULT or <user config dir>/kvtool/local.vault.
+func DefaultPath() string {
+	if p := os.Getenv("KVTOOL_LOCAL_VAULT"); p != "" {
+		return p
+	}
+	dir, err := os.UserConfigDir()
+	if err != nil {
+		return "local.vault"
+	}
+	return filepath.Join(dir, "kvtool", "local.vault")
+}
+
+// LoadSecret picks the secret without asking: keyFile, then passFile (its
+// first line), then KVTOOL_LOCAL_KEY_FILE and KVTOOL_LOCAL_PASSPHRASE.
+func LoadSecret(keyFile, passFile string) (Secret, error) {
+	if keyFile == "" && passFile == "" {
+		keyFile = os.Getenv("KVTOOL_LOCAL_KEY_FILE")
+	}
+	if keyFile != "" {
+		return Secret{KeyFile: keyFile}, nil
+	}
+	if passFile != "" {
+		b, err := os.ReadFile(passFile)
+		if err != nil {
+			return Secret{}, err
+		}
+		line, _, _ := strings.Cut(string(b), "\n")
+		return Secret{Passphrase: []byte(strings.TrimRight(line, "\r"))}, nil
+	}
+	if p := os.Getenv("KVTOOL_LOCAL_PASSPHRASE"); p != "" {
+		return Secret{Passphrase: []byte(p)}, nil
+	}
+	return Secret{}, ErrNoSecret
+}
@@ -0,0 +1,169 @@
+package localvault
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+)
+
+func init() {
+	// テストでは scrypt を軽くする
+	ScryptN = 1 << 10
+}
+
+func TestVault(t *testing.T) {
+	r := require.New(t)
+	path := filepath.Join(t.TempDir(), "local.vault")
+	pass := Secret{Passphrase: []byte("correct horse")}
+	now := time.Date(2026, 1, 2, 3, 4, 5, 0, time.UTC)
+
+	r.NoError(Init(path, pass))
+	r.ErrorIs(Init(path, pass), ErrExists)
+	fi, err := os.Stat(path)
+	r.NoError(err)
+	r.Equal(os.FileMode(0o600), fi.Mode().Perm())
+
+	r.NoError(Update(path, pass, func(v *Vault) error {
+		r.Equal(1, v.Set("default", "DB_PASSWORD", "one", now))
+		r.Equal(2, v.Set("default", "DB_PASSWORD", "two", now))
+		// 同じ値では版を増やさない
+		r.Equal(2, v.Set("default", "DB_PASSWORD", "two", now))
+		v.Set("prod", "DB_PASSWORD", "p", now)
+		return nil
+	}))
+
+	// 平文はファイルに残らない
+	raw, err := os.ReadFile(path)
+	r.NoError(err)
+	r.NotContains(string(raw), "DB_PASSWORD")
+
+	v, err := Open(path, pass)
+	r.NoError(err)
+	val, n, err := v.Get("default", "DB_PASSWORD")
+	r.NoError(err)
+	r.Equal("two", val)
+	r.Equal(2, n)
+	val, err = v.GetVersion("default", "DB_PASSWORD", 1)
+	r.NoError(err)
+	r.Equal("one", val)
+	r.Equal(map[string]string{"DB_PASSWORD": "p"}, v.Values("prod"))
+
+	_, err = Open(path, Secret{Passphrase: []byte("wrong")})
+	r.ErrorIs(err, ErrBadSecret)
+	_, err = Open(path, Secret{})
+	r.ErrorIs(err, ErrNoSecret)
+
+	// 失敗した更新は書き込まない
+	before, err := os.ReadFile(path)
+	r.NoError(err)
+	r.ErrorIs(Update(path, pass, func(v *Vault) error {
+		return v.Delete("default", "missing", now)
+	}), ErrNotFound)
+	after, err := os.ReadFile(path)
+	r.NoError(err)
+	r.Equal(before, after)
+
+	// 削除しても履歴は残る
+	r.NoError(Update(path, pass, func(v *Vault) error {
+		v.Replace("default", map[string]string{"USER": "app"}, now)
+		return nil
+	}))
+	v, err = Open(path, pass)
+	r.NoError(err)
+	r.Equal([]string{"USER"}, v.Keys("default"))
+	_, _, err = v.Get("default", "DB_PASSWORD")
+	r.ErrorIs(err, ErrNotFound)
+	r.Len(v.History("default", "DB_PASSWORD"), 3)
+	_, err = v.GetVersion("default", "DB_PASSWORD", 3)
+	r.ErrorIs(err, ErrNotFound)
+
+	// 鍵ファイルに切り替え
+	keyFile := filepath.Join(t.TempDir(), "local.key")
+	r.NoError(GenerateKeyFile(keyFile))
+	r.Error(GenerateKeyFile(keyFile))
+	byKey := Secret{KeyFile: keyFile}
+	r.NoError(ChangeSecret(path, pass, byKey))
+	_, err = Open(path, pass)
+	r.ErrorIs(err, ErrNoSecret)
+	v, err = Open(path, byKey)
+	r.NoError(err)
+	r.Equal(map[string]string{"USER": "app"}, v.Values("default"))
+	typ, err := KDFType(path)
+	r.NoError(err)
+	r.Equal("keyfile", typ)
+
+	other := filepath.Join(t.TempDir(), "other.key")
+	r.NoError(GenerateKeyFile(other))
+	_, err = Open(path, Secret{KeyFile: other})
+	r.ErrorIs(err, ErrBadSecret)
+}
+
+func TestUpdateLocking(t *testing.T) {
+	r := require.New(t)
+	path := filepath.Join(t.TempDir(), "local.vault")
+	pass := Secret{Passphrase: []byte("pw")}
+	r.NoError(Init(path, pass))
+
+	// ロックが無いと読み込みと書き込みの間に他の更新が入って失われる
+	const n = 20
+	var wg sync.WaitGroup
+	errs := make(chan error, n)
+	for i := 0; i < n; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			errs <- Update(path, pass, func(v *Vault) error {
+				v.Set("default", fmt.Sprint("K", i), "v", time.Now())
+				return nil
+			})
+		}()
+	}
+	wg.Wait()
+	close(errs)
+	for err := range errs {
+		r.NoError(err)
+	}
+
+	v, err := Open(path, pass)
+	r.NoError(err)
+	r.Len(v.Keys("default"), n)
+
+	// 一時ファイルが残らない
+	entries, err := os.ReadDir(filepath.Dir(path))
+	r.NoError(err)
+	for _, e := range entries {
+		r.False(strings.Contains(e.Name(), ".tmp"), e.Name())
+	}
+}
+
+func TestLoadSecret(t *testing.T) {
+	r := require.New(t)
+	dir := t.TempDir()
+	t.Setenv("KVTOOL_LOCAL_KEY_FILE", "")
+	t.Setenv("KVTOOL_LOCAL_PASSPHRASE", "")
+
+	_, err := LoadSecret("", "")
+	r.ErrorIs(err, ErrNoSecret)
+
+	passFile := filepath.Join(dir, "pass")
+	r.NoError(os.WriteFile(passFile, []byte("secret pass\r\nignored\n"), 0o600))
+	s, err := LoadSecret("", passFile)
+	r.NoError(err)
+	r.Equal("secret pass", string(s.Passphrase))
+
+	t.Setenv("KVTOOL_LOCAL_PASSPHRASE", "from env")
+	s, err = LoadSecret("", "")
+	r.NoError(err)
+	r.Equal("from env", string(s.Passphrase))
+
+	t.Setenv("KVTOOL_LOCAL_KEY_FILE", "/k")
+	s, err = LoadSecret("", "")
+	r.NoError(err)
+	r.Equal("/k", s.KeyFile)
+}
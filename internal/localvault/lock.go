@@ -0,0 +1,13 @@
+package localvault
+
+import (
+	"os"
+	"path/filepath"
+)
+
+func openLockFile(path string) (*os.File, error) {
+	if err := os.MkdirAll(filepath.Dir(path), 0o700); err != nil {
+		return nil, err
+	}
+	return os.OpenFile(path+".lock", os.O_RDWR|os.O_CREATE, 0o600)
+}
@@ -0,0 +1,12 @@
+//go:build plan9
+
+package localvault
+
+// plan9 ではロックしない（ロックファイルだけ作る）
+func lock(path string) (func() error, error) {
+	f, err := openLockFile(path)
+	if err != nil {
+		return nil, err
+	}
+	return f.Close, nil
+}
@@ -0,0 +1,24 @@
+//go:build !windows && !plan9
+
+package localvault
+
+import (
+	"os"
+	"syscall"
+)
+
+// lock は <path>.lock に排他ロックをかける。本体は rename で置き換えるので別ファイルにする
+func lock(path string) (func() error, error) {
+	f, err := openLockFile(path)
+	if err != nil {
+		return nil, err
+	}
+	if err := syscall.Flock(int(f.Fd()), syscall.LOCK_EX); err != nil {
+		f.Close()
+		return nil, &os.PathError{Op: "flock", Path: f.Name(), Err: err}
+	}
+	return func() error {
+		_ = syscall.Flock(int(f.Fd()), syscall.LOCK_UN)
+		return f.Close()
+	}, nil
+}
@@ -0,0 +1,26 @@
+//go:build windows
+
+package localvault
+
+import (
+	"os"
+
+	"golang.org/x/sys/windows"
+)
+
+func lock(path string) (func() error, error) {
+	f, err := openLockFile(path)
+	if err != nil {
+		return nil, err
+	}
+	ol := new(windows.Overlapped)
+	h := windows.Handle(f.Fd())
+	if err := windows.LockFileEx(h, windows.LOCKFILE_EXCLUSIVE_LOCK, 0, 1, 0, ol); err != nil {
+		f.Close()
+		return nil, &os.PathError{Op: "LockFileEx", Path: f.Name(), Err: err}
+	}
+	return func() error {
+		_ = windows.UnlockFileEx(h, 0, 1, 0, ol)
+		return f.Close()
+	}, nil
+}
@@ -0,0 +1,307 @@
+// Package redact masks secret values before they reach terminals, files
+// written for people, logs and error messages.
+//
+// A value is secret when its key matches one of the patterns (glob,
+// case-insensitive) or when it looks like a generated credential (long,
+// no whitespace, letters and digits, high Shannon entropy).
+package redact
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"math"
+	"path"
+	"sort"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"unicode"
+)
+
+// Mask replaces the hidden part of a value. Its length never depends on the value.
+const Mask = "****"
+
+// DefaultPatterns are the key patterns treated as secret.
+var DefaultPatterns = []string{"*PASSWORD*", "*TOKEN*", "*SECRET*"}
+
+// Redactor masks secret values. A nil *Redactor passes everything through.
+type Redactor struct {
+	// キー名のパターン（大文字小文字を区別しない glob）
+	Patterns []string
+	// 0 以下なら高エントロピー判定をしない（bits/文字）
+	MinEntropy float64
+	// 高エントロピー判定の対象にする最短の長さ
+	MinLength int
+	// 先頭と末尾をこの文字数だけ見せる（pa****rd）。短い値は全部隠す。
+	Reveal int
+
+	// マスクした値。エラーメッセージなど自由なテキストからも消す。
+	mu   sync.Mutex
+	seen map[string]bool
+}
+
+// New returns a Redactor with the default patterns and entropy detection.
+// reveal > 0 shows that many characters at both ends of long values.
+func New(reveal int) *Redactor {
+	return &Redactor{
+		Patterns:   DefaultPatterns,
+		MinEntropy: 3.5,
+		MinLength:  20,
+		Reveal:     reveal,
+	}
+}
+
+var global atomic.Pointer[Redactor]
+
+// SetGlobal turns the -redact mode on (or off with nil) for the process.
+func SetGlobal(r *Redactor) { global.Store(r) }
+
+// Global returns the process-wide Redactor, or nil when -redact is off.
+// All methods of a nil *Redactor pass values through unchanged.
+func Global() *Redactor { return global.Load() }
+
+// ParseMode parses the -redact / KVTOOL_REDACT value: "", "0", "false" and
+// "off" turn redaction off, "1", "true", "on" and "full" hide whole values,
+// "partial" reveals two characters at both ends.
+func ParseMode(s string) (*Redactor, error) {
+	switch strings.ToLower(strings.TrimSpace(s)) {
+	case "", "0", "false", "off":
+		return nil, nil
+	case "1", "true", "on", "full":
+		return New(0), nil
+	case "partial":
+		return New(2), nil
+	default:
+		return nil, fmt.Errorf("unknown redact mode %q (want full or partial)", s)
+	}
+}
+
+// KeyMatches reports whether key matches one of the patterns.
+func (r *Redactor) KeyMatches(key string) bool {
+	if r == nil {
+		return false
+	}
+	k := strings.ToUpper(key)
+	for _, p := range r.Patterns {
+		if ok, _ := path.Match(strings.ToUpper(p), k); ok {
+			return true
+		}
+	}
+	return false
+}
+
+// HighEntropy reports whether v looks like a generated credential.
+func (r *Redactor) HighEntropy(v string) bool {
+	if r == nil || r.MinEntropy <= 0 || len(v) < r.MinLength {
+		return false
+	}
+	var letter, digit bool
+	for _, c := range v {
+		switch {
+		case unicode.IsSpace(c):
+			return false
+		case unicode.IsLetter(c):
+			letter = true
+		case unicode.IsDigit(c):
+			digit = true
+		}
+	}
+	return letter && digit && entropy(v) >= r.MinEntropy
+}
+
+// entropy は1文字あたりのシャノンエントロピー
+func entropy(s string) float64 {
+	counts := map[rune]int{}
+	n := 0
+	for _, c := range s {
+		counts[c]++
+		n++
+	}
+	var h float64
+	for _, c := range counts {
+		p := float64(c) / float64(n)
+		h -= p * math.Log2(p)
+	}
+	return h
+}
+
+// MaskString hides v, revealing Reveal characters at both ends when v is
+// at least four times that long.
+func (r *Redactor) MaskString(v string) string {
+	if r == nil {
+		return v
+	}
+	r.remember(v)
+	rs := []rune(v)
+	if r.Reveal <= 0 || len(rs) < 4*r.Reveal {
+		return Mask
+	}
+	return string(rs[:r.Reveal]) + Mask + string(rs[len(rs)-r.Reveal:])
+}
+
+// Value masks v if key is secret or (for strings) v looks like one.
+// Maps and slices are walked; their own keys decide for nested values.
+func (r *Redactor) Value(key string, v any) any {
+	if r == nil {
+		return v
+	}
+	secret := r.KeyMatches(key)
+	switch x := v.(type) {
+	case map[string]any:
+		out := make(map[string]any, len(x))
+		for k, e := range x {
+			if secret {
+				// 秘密のキーの下はすべて隠す
+				out[k] = r.Value(key, e)
+				continue
+			}
+			out[k] = r.Value(k, e)
+		}
+		return out
+	case []any:
+		out := make([]any, len(x))
+		for i, e := range x {
+			out[i] = r.Value(key, e)
+		}
+		return out
+	case string:
+		if secret || r.HighEntropy(x) {
+			return r.MaskString(x)
+		}
+		return x
+	case nil:
+		return nil
+	default:
+		if secret {
+			return r.MaskString(fmt.Sprint(x))
+		}
+		return x
+	}
+}
+
+// Map returns a redacted copy of m.
+func (r *Redactor) Map(m map[string]any) map[string]any {
+	if r == nil {
+		return m
+	}
+	return r.Value("", m).(map[string]any)
+}
+
+// StringMap returns a redacted copy of m.
+func (r *Redactor) StringMap(m map[string]string) map[string]string {
+	if r == nil {
+		return m
+	}
+	out := make(map[string]string, len(m))
+	for k, v := range m {
+		out[k] = r.Value(k, v).(string)
+	}
+	return out
+}
+
+// JSON redacts a JSON document found under key ("" for a whole store).
+// Input that is not JSON is masked whole when it looks like a secret.
+func (r *Redactor) JSON(key string, b []byte) []byte {
+	if r == nil {
+		return b
+	}
+	var v any
+	if err := json.Unmarshal(b, &v); err != nil {
+		if t := strings.TrimSpace(string(b)); r.KeyMatches(key) || r.HighEntropy(t) {
+			return []byte(r.MaskString(t) + "\n")
+		}
+		return b
+	}
+	out, err := json.MarshalIndent(r.Value(key, v), "", "  ")
+	if err != nil {
+		return b
+	}
+	return append(out, '\n')
+}
+
+// String removes every value masked so far, and anything that looks like a
+// credential, from free text such as an error message or a log line.
+func (r *Redactor) String(s string) string {
+	if r == nil {
+		return s
+	}
+	r.mu.Lock()
+	seen := make([]string, 0, len(r.seen))
+	for v := range r.seen {
+		seen = append(seen, v)
+	}
+	r.mu.Unlock()
+	// 長いものから置き換える（部分一致で短いものが先に消えないように）
+	sort.Slice(seen, func(i, j int) bool { return len(seen[i]) > len(seen[j]) })
+	for _, v := range seen {
+		s = strings.ReplaceAll(s, v, Mask)
+	}
+
+	fields := strings.FieldsFunc(s, func(c rune) bool {
+		return unicode.IsSpace(c) || strings.ContainsRune(`"'=:,;()[]{}`, c)
+	})
+	for _, f := range fields {
+		if r.HighEntropy(f) {
+			s = strings.ReplaceAll(s, f, Mask)
+		}
+	}
+	return s
+}
+
+// Error returns err with its message passed through String. The result
+// still matches the original with errors.Is / errors.As.
+func (r *Redactor) Error(err error) error {
+	if r == nil || err == nil {
+		return err
+	}
+	msg := r.String(err.Error())
+	if msg == err.Error() {
+		return err
+	}
+	return &redactedError{msg: msg, err: err}
+}
+
+type redactedError struct {
+	msg string
+	err error
+}
+
+func (e *redactedError) Error() string { return e.msg }
+func (e *redactedError) Unwrap() error { return e.err }
+
+// 値がごく短いと普通の単語まで消してしまうので覚えない
+const minRemember = 4
+
+func (r *Redactor) remember(v string) {
+	if len(v) < minRemember {
+		return
+	}
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if r.seen == nil {
+		r.seen = map[string]bool{}
+	}
+	r.seen[v] = true
+}
+
+// Writer returns a writer that passes each write through String, for
+// loggers. A nil Redactor returns w itself.
+func (r *Redactor) Writer(w io.Writer) io.Writer {
+	if r == nil {
+		return w
+	}
+	return &writer{r: r, w: w}
+}
+
+type writer struct {
+	r *Redactor
+	w io.Writer
+}
+
+func (w *writer) Write(p []byte) (int, error) {
+	if _, err := io.WriteString(w.w, w.r.String(string(p))); err != nil {
+		return 0, err
+	}
+	return len(p), nil
+}
@@ -0,0 +1,124 @@
+package redact
+
+import (
+	"errors"
+	"io/fs"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestKeyMatches(t *testing.T) {
+	r := New(0)
+	for _, k := range []string{"password", "DB_PASSWORD", "GitHubToken", "client_secret_id"} {
+		require.True(t, r.KeyMatches(k), k)
+	}
+	for _, k := range []string{"USER", "HOST", "PASS"} {
+		require.False(t, r.KeyMatches(k), k)
+	}
+	require.False(t, (*Redactor)(nil).KeyMatches("PASSWORD"))
+}
+
+func TestHighEntropy(t *testing.T) {
+	r := New(0)
+	require.True(t, r.HighEntropy("ghp_9fK2xQ7vLm3Zp8RtY4bN1cWd"))
+	require.True(t, r.HighEntropy("AKIAIOSFODNN7EXAMPLE9x"))
+	// 短い・空白あり・数字なし・繰り返し
+	require.False(t, r.HighEntropy("abc123"))
+	require.False(t, r.HighEntropy("this is a long sentence 12345"))
+	require.False(t, r.HighEntropy("postgres-primary-hostname"))
+	require.False(t, r.HighEntropy("aaaaaaaaaa1111111111"))
+}
+
+func TestValue(t *testing.T) {
+	r := New(0)
+	in := map[string]any{
+		"USER":        "app",
+		"DB_PASSWORD": "hunter22",
+		"PORT":        5432.0,
+		"API_TOKEN":   1234.0,
+		"nested": map[string]any{
+			"secret": map[string]any{"a": "x", "b": []any{"y"}},
+			"name":   "n",
+		},
+		"KEY": "ghp_9fK2xQ7vLm3Zp8RtY4bN1cWd",
+	}
+	got := r.Map(in)
+	require.Equal(t, map[string]any{
+		"USER":        "app",
+		"DB_PASSWORD": Mask,
+		"PORT":        5432.0,
+		"API_TOKEN":   Mask,
+		"nested": map[string]any{
+			"secret": map[string]any{"a": Mask, "b": []any{Mask}},
+			"name":   "n",
+		},
+		"KEY": Mask,
+	}, got)
+	// 元の map は変えない
+	require.Equal(t, "hunter22", in["DB_PASSWORD"])
+
+	var off *Redactor
+	require.Equal(t, in, off.Map(in))
+}
+
+func TestPartial(t *testing.T) {
+	r := New(2)
+	require.Equal(t, "pa****rd", r.MaskString("password"))
+	require.Equal(t, Mask, r.MaskString("short"))
+	require.Equal(t, "hu****22", r.Value("PASSWORD", "hunter22"))
+}
+
+func TestJSON(t *testing.T) {
+	r := New(0)
+	require.JSONEq(t, `{"USER":"app","PASSWORD":"****"}`, string(r.JSON("", []byte(`{"USER":"app","PASSWORD":"pw"}`))))
+	require.JSONEq(t, `"****"`, string(r.JSON("PASSWORD", []byte(`"pw"`))))
+	require.Equal(t, "****\n", string(r.JSON("password", []byte("plain text"))))
+	require.Equal(t, "plain text", string(r.JSON("", []byte("plain text"))))
+}
+
+func TestError(t *testing.T) {
+	r := New(0)
+	r.Map(map[string]any{"DB_PASSWORD": "hunter22"})
+
+	err := r.Error(errors.New(`connect: password "hunter22" rejected; token=ghp_9fK2xQ7vLm3Zp8RtY4bN1cWd`))
+	require.NotContains(t, err.Error(), "hunter22")
+	require.NotContains(t, err.Error(), "ghp_")
+	require.Contains(t, err.Error(), "connect: password")
+
+	// 元のエラーはたどれる
+	wrapped := r.Error(&fs.PathError{Op: "open", Path: "hunter22", Err: fs.ErrNotExist})
+	require.ErrorIs(t, wrapped, fs.ErrNotExist)
+	require.Equal(t, "open ****: file does not exist", wrapped.Error())
+
+	plain := errors.New("nothing to hide")
+	require.Same(t, plain, r.Error(plain))
+	require.Nil(t, r.Error(nil))
+}
+
+func TestWriter(t *testing.T) {
+	r := New(0)
+	r.MaskString("hunter22")
+	var b strings.Builder
+	n, err := r.Writer(&b).Write([]byte("login with hunter22\n"))
+	require.NoError(t, err)
+	require.Equal(t, len("login with hunter22\n"), n)
+	require.Equal(t, "login with ****\n", b.String())
+}
+
+func TestParseMode(t *testing.T) {
+	for _, s := range []string{"", "0", "off", "false"} {
+		r, err := ParseMode(s)
+		require.NoError(t, err)
+		require.Nil(t, r)
+	}
+	r, err := ParseMode("1")
+	require.NoError(t, err)
+	require.Equal(t, 0, r.Reveal)
+	r, err = ParseMode("partial")
+	require.NoError(t, err)
+	require.Equal(t, 2, r.Reveal)
+	_, err = ParseMode("some")
+	require.Error(t, err)
+}
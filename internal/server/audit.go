@@ -0,0 +1,132 @@
+package server
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/sasano8/kvtool/internal/audit"
+	"github.com/sasano8/kvtool/internal/auth"
+)
+
+// auditWriter writes the audit entry right before the response starts.
+// If the entry cannot be recorded the response is replaced by an error,
+// so nothing is served without an audit trail.
+type auditWriter struct {
+	http.ResponseWriter
+	s     *Server
+	r     *http.Request
+	start time.Time
+
+	keys   []string
+	err    error
+	logged bool
+	failed bool
+}
+
+func (w *auditWriter) WriteHeader(code int) {
+	if !w.logged {
+		w.logged = true
+		if err := w.log(code); err != nil {
+			w.failed = true
+			w.s.Logger.Printf("audit: %v", err)
+			h := w.ResponseWriter.Header()
+			for _, k := range []string{"ETag", "Trailer", "Content-Length"} {
+				h.Del(k)
+			}
+			h.Set("Content-Type", "application/json")
+			w.ResponseWriter.WriteHeader(http.StatusInternalServerError)
+			_, _ = w.ResponseWriter.Write([]byte(`{"error":"audit log failed"}` + "\n"))
+			return
+		}
+	}
+	if w.failed {
+		return
+	}
+	w.ResponseWriter.WriteHeader(code)
+}
+
+func (w *auditWriter) Write(b []byte) (int, error) {
+	if !w.logged {
+		w.WriteHeader(http.StatusOK)
+	}
+	if w.failed {
+		return 0, audit.ErrAuditFailed
+	}
+	return w.ResponseWriter.Write(b)
+}
+
+func (w *auditWriter) Flush() {
+	if !w.logged {
+		w.WriteHeader(http.StatusOK)
+	}
+	if f, ok := w.ResponseWriter.(http.Flusher); ok && !w.failed {
+		f.Flush()
+	}
+}
+
+func (w *auditWriter) log(code int) error {
+	return w.s.audit(w.r.Context(), operation(w.r), w.r.PathValue("path"), w.keys, w.start, code, w.err)
+}
+
+// audit は 1 リクエストの監査エントリを書く。code は HTTP のステータス
+// （gRPC でも statusOf で同じ対応のものを渡す）
+func (s *Server) audit(ctx context.Context, op, path string, keys []string, start time.Time, code int, err error) error {
+	id := auth.FromContext(ctx)
+	if errors.Is(err, auth.ErrUnauthenticated) {
+		id = auth.Identity{Name: "unauthenticated"}
+	}
+
+	path = strings.Trim(path, "/")
+	parts := strings.SplitN(path, "/", 3)
+	e := audit.Entry{
+		Identity:   id.Name,
+		AuthMethod: id.Method,
+		Command:    "serve",
+		Operation:  op,
+		Namespace:  parts[0],
+		Path:       path,
+		Keys:       keys,
+		Outcome:    audit.OutcomeSuccess,
+		DurationMS: float64(time.Since(start).Microseconds()) / 1000,
+	}
+	if len(parts) > 1 {
+		e.Store = parts[1]
+	}
+	switch {
+	case code == http.StatusUnauthorized || code == http.StatusForbidden:
+		e.Outcome = audit.OutcomeDenied
+	case code >= 400:
+		e.Outcome = audit.OutcomeError
+	}
+	if err != nil {
+		e.Error = err.Error()
+	}
+	return s.Audit.Log(ctx, e)
+}
+
+func operation(r *http.Request) string {
+	switch {
+	case strings.HasPrefix(r.URL.Path, "/v1/watch/"):
+		return "watch"
+	case strings.HasPrefix(r.URL.Path, "/v1/list/"), r.URL.Query().Has("list"):
+		return "list"
+	case r.Method == http.MethodHead:
+		return "head"
+	case r.Method == http.MethodPut:
+		return "write"
+	case r.Method == http.MethodDelete:
+		return "delete"
+	default:
+		return "read"
+	}
+}
+
+// setAuditKeys は監査ログに残すキー名を記録する（値は残さない）
+func setAuditKeys(w http.ResponseWriter, keys []string) {
+	if aw, ok := w.(*auditWriter); ok {
+		aw.keys = keys
+	}
+}
@@ -0,0 +1,89 @@
+package server
+
+import (
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+
+	"github.com/sasano8/kvtool/internal/audit"
+)
+
+type memSink struct {
+	entries []audit.Entry
+	err     error
+}
+
+func (s *memSink) Write(line []byte) error {
+	if s.err != nil {
+		return s.err
+	}
+	var e audit.Entry
+	if err := json.Unmarshal(line, &e); err != nil {
+		return err
+	}
+	s.entries = append(s.entries, e)
+	return nil
+}
+
+func (s *memSink) Close() error { return nil }
+
+func TestAudit(t *testing.T) {
+	r := require.New(t)
+	sink := &memSink{}
+	s := newPolicyServer(t)
+	s.Audit = audit.New(nil, sink)
+	ts := httptest.NewServer(s.Handler())
+	defer ts.Close()
+
+	res, body := do(t, http.MethodGet, ts.URL+"/v1/kv/default/.env", "", map[string]string{"Authorization": "Bearer w"})
+	r.Equal(http.StatusOK, res.StatusCode)
+	r.NotContains(sink.entries[0].Keys, "secret")
+	r.Contains(body, "secret")
+
+	do(t, http.MethodHead, ts.URL+"/v1/kv/default/.env/USER", "", map[string]string{"Authorization": "Bearer r"})
+	do(t, http.MethodGet, ts.URL+"/v1/kv/default/.env/PASSWORD", "", map[string]string{"Authorization": "Bearer r"})
+	do(t, http.MethodGet, ts.URL+"/v1/kv/default/.env", "", map[string]string{"Authorization": "Bearer bogus"})
+	do(t, http.MethodGet, ts.URL+"/v1/kv/default/.env/NOPE", "", map[string]string{"Authorization": "Bearer w"})
+
+	r.Len(sink.entries, 5)
+	e := sink.entries[0]
+	r.Equal("writer", e.Identity)
+	r.Equal("token", e.AuthMethod)
+	r.Equal("read", e.Operation)
+	r.Equal("default", e.Namespace)
+	r.Equal(".env", e.Store)
+	r.ElementsMatch([]string{"USER", "PASSWORD"}, e.Keys)
+	r.Equal(audit.OutcomeSuccess, e.Outcome)
+
+	r.Equal("head", sink.entries[1].Operation)
+	r.Equal([]string{"USER"}, sink.entries[1].Keys)
+	r.Equal(audit.OutcomeSuccess, sink.entries[1].Outcome)
+
+	r.Equal(audit.OutcomeDenied, sink.entries[2].Outcome)
+	r.Equal("reader", sink.entries[2].Identity)
+	r.Empty(sink.entries[2].Keys)
+
+	r.Equal(audit.OutcomeDenied, sink.entries[3].Outcome)
+	r.Equal("unauthenticated", sink.entries[3].Identity)
+
+	r.Equal(audit.OutcomeError, sink.entries[4].Outcome)
+	r.NotEmpty(sink.entries[4].Error)
+}
+
+func TestAuditFailureFailsRequest(t *testing.T) {
+	r := require.New(t)
+	s := newPolicyServer(t)
+	s.Policy = nil
+	s.Audit = audit.New(nil, &memSink{err: errors.New("disk full")})
+	ts := httptest.NewServer(s.Handler())
+	defer ts.Close()
+
+	res, body := do(t, http.MethodGet, ts.URL+"/v1/kv/default/.env", "", nil)
+	r.Equal(http.StatusInternalServerError, res.StatusCode)
+	r.NotContains(body, "secret")
+	r.Empty(res.Header.Get("ETag"))
+}
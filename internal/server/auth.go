@@ -0,0 +1,75 @@
+package server
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"time"
+
+	"github.com/sasano8/kvtool/internal/auth"
+)
+
+// guard authenticates the request and checks that its identity has c on the
+// requested path. Without a Policy every request is let through.
+// With an Audit logger every request, including denied ones, is audited.
+func (s *Server) guard(c auth.Capability, h http.HandlerFunc) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		if s.Audit != nil {
+			aw := &auditWriter{ResponseWriter: w, s: s, r: r, start: time.Now()}
+			// HEAD などボディを書かないハンドラーもあるので、最後に必ず記録する
+			defer func() {
+				if !aw.logged {
+					aw.WriteHeader(http.StatusOK)
+				}
+			}()
+			w = aw
+		}
+		if s.Policy == nil {
+			h(w, r)
+			return
+		}
+
+		id, err := s.Policy.Authenticate(r)
+		if err != nil {
+			w.Header().Set("WWW-Authenticate", `Bearer realm="kvtool"`)
+			writeError(w, err)
+			return
+		}
+		r = r.WithContext(auth.NewContext(r.Context(), id))
+		if aw, ok := w.(*auditWriter); ok {
+			aw.r = r
+		}
+		if err := s.Policy.Authorize(id, c, r.PathValue("path")); err != nil {
+			writeError(w, err)
+			return
+		}
+		h(w, r)
+	}
+}
+
+// visible removes from data, the content of t's store, the values that a
+// deny rule hides from the request's identity (see auth.Policy.Filter).
+func (s *Server) visible(ctx context.Context, t target, data map[string]any) map[string]any {
+	if s.Policy == nil {
+		return data
+	}
+	v, _ := s.Policy.Filter(auth.FromContext(ctx), t.ns+"/"+t.store, data)
+	return v.(map[string]any)
+}
+
+// checkHidden は t の値に deny で隠れた値が含まれていれば書き換えを拒否する
+// （見えない値をストア全体の置き換えやキーの削除で消せないように）
+func (s *Server) checkHidden(ctx context.Context, t target, data map[string]any) error {
+	if s.Policy == nil {
+		return nil
+	}
+	v, ok := lookup(data, t.key)
+	if !ok {
+		return nil
+	}
+	id := auth.FromContext(ctx)
+	if _, hidden := s.Policy.Filter(id, t.path(), v); hidden {
+		return fmt.Errorf("%w: %s cannot write %q, it contains denied values", auth.ErrPermissionDenied, id.Name, t.path())
+	}
+	return nil
+}
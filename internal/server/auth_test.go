@@ -0,0 +1,182 @@
+package server
+
+import (
+	"bufio"
+	"context"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/tls"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"math/big"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+
+	"github.com/sasano8/kvtool/internal/auth"
+	"github.com/sasano8/kvtool/internal/stores"
+)
+
+func newPolicyServer(t *testing.T) *Server {
+	t.Helper()
+	envPath := filepath.Join(t.TempDir(), ".env")
+	require.NoError(t, os.WriteFile(envPath, []byte("USER=alice\nPASSWORD=secret\n"), 0o644))
+
+	s := New(stores.Config{Namespaces: map[string]map[string]stores.StoreConfig{
+		"default": {".env": {Type: ".env", Args: map[string]any{"input": envPath}}},
+	}})
+	s.Policy = &auth.Policy{
+		Tokens: []auth.Token{{Name: "reader", Token: "r"}, {Name: "writer", Token: "w"}},
+		Rules: []auth.Rule{
+			{Identities: []string{"reader"}, Paths: []string{"default/.env/USER"}, Capabilities: []auth.Capability{auth.CapRead}},
+			{Identities: []string{"writer"}, Paths: []string{"default/**"}, Capabilities: []auth.Capability{auth.CapRead, auth.CapList, auth.CapWrite}},
+			{Identities: []string{"cert:bot"}, Paths: []string{"default/.env"}, Capabilities: []auth.Capability{auth.CapRead}},
+		},
+	}
+	return s
+}
+
+func TestAuthToken(t *testing.T) {
+	ts := httptest.NewServer(newPolicyServer(t).Handler())
+	defer ts.Close()
+
+	tests := []struct {
+		method string
+		path   string
+		token  string
+		want   int
+	}{
+		{http.MethodGet, "/v1/kv/default/.env/USER", "", http.StatusForbidden},
+		{http.MethodGet, "/v1/kv/default/.env/USER", "bogus", http.StatusUnauthorized},
+		{http.MethodGet, "/v1/kv/default/.env/USER", "r", http.StatusOK},
+		{http.MethodGet, "/v1/kv/default/.env/PASSWORD", "r", http.StatusForbidden},
+		{http.MethodGet, "/v1/kv/default/.env", "r", http.StatusForbidden},
+		{http.MethodGet, "/v1/kv/default?list", "r", http.StatusForbidden},
+		{http.MethodPut, "/v1/kv/default/.env/USER", "r", http.StatusForbidden},
+		{http.MethodGet, "/v1/kv/default?list", "w", http.StatusOK},
+		{http.MethodPut, "/v1/kv/default/.env/USER", "w", http.StatusOK},
+	}
+	for _, tt := range tests {
+		header := map[string]string{}
+		if tt.token != "" {
+			header["Authorization"] = "Bearer " + tt.token
+		}
+		res, body := do(t, tt.method, ts.URL+tt.path, `"bob"`, header)
+		require.Equal(t, tt.want, res.StatusCode, "%s %s token=%q: %s", tt.method, tt.path, tt.token, body)
+		if tt.want == http.StatusUnauthorized {
+			require.NotEmpty(t, res.Header.Get("WWW-Authenticate"))
+		}
+	}
+}
+
+func TestAuthClientCert(t *testing.T) {
+	r := require.New(t)
+
+	caKey, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	r.NoError(err)
+	caTmpl := &x509.Certificate{
+		SerialNumber:          big.NewInt(1),
+		Subject:               pkix.Name{CommonName: "test-ca"},
+		NotBefore:             time.Now().Add(-time.Hour),
+		NotAfter:              time.Now().Add(time.Hour),
+		IsCA:                  true,
+		KeyUsage:              x509.KeyUsageCertSign,
+		BasicConstraintsValid: true,
+	}
+	caDER, err := x509.CreateCertificate(rand.Reader, caTmpl, caTmpl, &caKey.PublicKey, caKey)
+	r.NoError(err)
+	caCert, err := x509.ParseCertificate(caDER)
+	r.NoError(err)
+
+	clientKey, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	r.NoError(err)
+	clientDER, err := x509.CreateCertificate(rand.Reader, &x509.Certificate{
+		SerialNumber: big.NewInt(2),
+		Subject:      pkix.Name{CommonName: "bot"},
+		NotBefore:    time.Now().Add(-time.Hour),
+		NotAfter:     time.Now().Add(time.Hour),
+		ExtKeyUsage:  []x509.ExtKeyUsage{x509.ExtKeyUsageClientAuth},
+	}, caCert, &clientKey.PublicKey, caKey)
+	r.NoError(err)
+
+	pool := x509.NewCertPool()
+	pool.AddCert(caCert)
+
+	ts := httptest.NewUnstartedServer(newPolicyServer(t).Handler())
+	ts.TLS = &tls.Config{ClientCAs: pool, ClientAuth: tls.VerifyClientCertIfGiven}
+	ts.StartTLS()
+	defer ts.Close()
+
+	tr := ts.Client().Transport.(*http.Transport).Clone()
+	tr.TLSClientConfig.Certificates = []tls.Certificate{{
+		Certificate: [][]byte{clientDER},
+		PrivateKey:  clientKey,
+	}}
+	withCert := &http.Client{Transport: tr}
+	res, err := withCert.Get(ts.URL + "/v1/kv/default/.env")
+	r.NoError(err)
+	res.Body.Close()
+	r.Equal(http.StatusOK, res.StatusCode)
+
+	res, err = ts.Client().Get(ts.URL + "/v1/kv/default/.env")
+	r.NoError(err)
+	res.Body.Close()
+	r.Equal(http.StatusForbidden, res.StatusCode)
+}
+
+func TestAuthDenyBelowStore(t *testing.T) {
+	r := require.New(t)
+	s := newPolicyServer(t)
+	s.WatchInterval = 50 * time.Millisecond
+	s.Policy.Tokens = append(s.Policy.Tokens, auth.Token{Name: "ci", Token: "c"})
+	s.Policy.Rules = append(s.Policy.Rules,
+		auth.Rule{Identities: []string{"ci"}, Paths: []string{"default/**"}, Capabilities: []auth.Capability{auth.CapRead, auth.CapList, auth.CapWrite}},
+		auth.Rule{Identities: []string{"ci"}, Paths: []string{"default/.env/PASSWORD"}, Capabilities: []auth.Capability{auth.CapDeny}},
+	)
+	ts := httptest.NewServer(s.Handler())
+	defer ts.Close()
+	ci := map[string]string{"Authorization": "Bearer c"}
+
+	res, body := do(t, http.MethodGet, ts.URL+"/v1/kv/default/.env/PASSWORD", "", ci)
+	r.Equal(http.StatusForbidden, res.StatusCode)
+
+	// ストア全体を読んでも deny されたキーは返らない
+	res, body = do(t, http.MethodGet, ts.URL+"/v1/kv/default/.env", "", ci)
+	r.Equal(http.StatusOK, res.StatusCode, body)
+	r.JSONEq(`{"USER":"alice"}`, body)
+	etag := res.Header.Get("ETag")
+
+	res, body = do(t, http.MethodGet, ts.URL+"/v1/kv/default/.env?jsonpath=$.PASSWORD", "", ci)
+	r.Equal(http.StatusNotFound, res.StatusCode, body)
+	r.NotContains(body, "secret")
+
+	res, body = do(t, http.MethodGet, ts.URL+"/v1/kv/default/.env?list", "", ci)
+	r.Equal(http.StatusOK, res.StatusCode, body)
+	r.JSONEq(`{"keys":["USER"]}`, body)
+
+	// 見えない値を消してしまう書き込みは拒否する
+	res, body = do(t, http.MethodPut, ts.URL+"/v1/kv/default/.env", `{"USER":"bob"}`, ci)
+	r.Equal(http.StatusForbidden, res.StatusCode, body)
+	res, body = do(t, http.MethodPut, ts.URL+"/v1/kv/default/.env/USER", `"bob"`, ci)
+	r.Equal(http.StatusOK, res.StatusCode, body)
+
+	// watch の etag は deny された値を除いた内容のもの
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+	req, _ := http.NewRequestWithContext(ctx, http.MethodGet, ts.URL+"/v1/watch/default/.env", nil)
+	req.Header.Set("Authorization", "Bearer c")
+	wres, err := http.DefaultClient.Do(req)
+	r.NoError(err)
+	defer wres.Body.Close()
+	r.Equal(http.StatusOK, wres.StatusCode)
+	ev, _ := (&sseReader{sc: bufio.NewScanner(wres.Body)}).next()
+	res, _ = do(t, http.MethodGet, ts.URL+"/v1/kv/default/.env", "", ci)
+	r.Equal(unquoteETag(res.Header.Get("ETag")), ev.Etag)
+	r.NotEqual(unquoteETag(etag), ev.Etag, "USER changed")
+}
@@ -0,0 +1,324 @@
+package server
+
+import (
+	"context"
+	"crypto/tls"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"strconv"
+	"time"
+
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/credentials"
+	"google.golang.org/grpc/metadata"
+	"google.golang.org/grpc/peer"
+	"google.golang.org/grpc/status"
+
+	"github.com/sasano8/kvtool/internal/auth"
+	"github.com/sasano8/kvtool/internal/kvapi"
+	"github.com/sasano8/kvtool/internal/kvpb"
+	"github.com/sasano8/kvtool/internal/redact"
+	"github.com/sasano8/kvtool/internal/stores"
+)
+
+// GRPC returns the gRPC surface of the KV service (kv.v1.KV). Requests are
+// authenticated, authorized, filtered and audited like the HTTP ones: the
+// bearer token comes from the "authorization" metadata and the client
+// certificate from the TLS connection.
+func (s *Server) GRPC(opts ...grpc.ServerOption) *grpc.Server {
+	g := grpc.NewServer(opts...)
+	kvpb.RegisterKVServer(g, &grpcServer{s: s})
+	return g
+}
+
+type grpcServer struct {
+	kvpb.UnimplementedKVServer
+	s *Server
+}
+
+// call は gRPC の 1 リクエストで、HTTP の guard / auditWriter / instrument に当たる
+type call struct {
+	s     *Server
+	ctx   context.Context
+	op    string
+	path  string
+	start time.Time
+
+	keys  []string
+	code  int
+	bytes int64
+}
+
+// begin authenticates the request and checks that its identity has c on
+// path. The returned call is never nil and its done must be deferred.
+// When begin fails the denial has already been audited.
+func (s *Server) begin(ctx context.Context, op string, c auth.Capability, path string) (*call, error) {
+	cl := &call{s: s, ctx: ctx, op: op, path: path, start: time.Now()}
+	if s.Policy == nil {
+		return cl, nil
+	}
+	id, err := s.Policy.AuthenticateCredentials(grpcCredentials(ctx))
+	if err != nil {
+		return cl, cl.end(err)
+	}
+	cl.ctx = auth.NewContext(ctx, id)
+	if err := s.Policy.Authorize(id, c, path); err != nil {
+		return cl, cl.end(err)
+	}
+	return cl, nil
+}
+
+// grpcCredentials は metadata の authorization と接続の TLS の状態を返す
+func grpcCredentials(ctx context.Context) (string, *tls.ConnectionState) {
+	var authorization string
+	if md, ok := metadata.FromIncomingContext(ctx); ok {
+		if v := md.Get("authorization"); len(v) > 0 {
+			authorization = v[0]
+		}
+	}
+	// Handler 経由（ServeHTTP）でも r.TLS が TLSInfo として入る
+	if p, ok := peer.FromContext(ctx); ok {
+		if info, ok := p.AuthInfo.(credentials.TLSInfo); ok {
+			return authorization, &info.State
+		}
+	}
+	return authorization, nil
+}
+
+// end audits the outcome and returns err as a gRPC status. It must be
+// called before anything is sent, so nothing is served without an audit
+// trail: if the entry cannot be recorded the request fails instead.
+func (c *call) end(err error) error {
+	c.code = http.StatusOK
+	if err != nil {
+		// 返すエラーと監査ログに値が混ざらないように
+		err = redact.Global().Error(err)
+		c.code = statusOf(err)
+	}
+	if c.s.Audit != nil {
+		if aerr := c.s.audit(c.ctx, c.op, c.path, c.keys, c.start, c.code, err); aerr != nil {
+			c.s.Logger.Printf("audit: %v", aerr)
+			c.code = http.StatusInternalServerError
+			return status.Error(codes.Internal, "audit log failed")
+		}
+	}
+	if err != nil {
+		return status.Error(grpcCode(c.code), err.Error())
+	}
+	return nil
+}
+
+// done は HTTP と同じメトリクスを記録する（code は HTTP の対応するステータス）
+func (c *call) done() {
+	rpc := rpcOf(c.op)
+	c.s.metrics.requests.WithLabelValues(rpc, strconv.Itoa(c.code)).Inc()
+	c.s.metrics.duration.WithLabelValues(rpc).Observe(time.Since(c.start).Seconds())
+	c.s.metrics.streamed.WithLabelValues(rpc).Add(float64(c.bytes))
+}
+
+// grpcCode は statusOf の HTTP ステータスに対応する gRPC のコード。
+// Unavailable はクライアントが HTTP に切り替える合図なので使わない
+func grpcCode(code int) codes.Code {
+	switch code {
+	case http.StatusNotFound:
+		return codes.NotFound
+	case http.StatusBadRequest:
+		return codes.InvalidArgument
+	case http.StatusUnauthorized:
+		return codes.Unauthenticated
+	case http.StatusForbidden:
+		return codes.PermissionDenied
+	case http.StatusConflict:
+		return codes.Aborted
+	case http.StatusPreconditionFailed:
+		return codes.FailedPrecondition
+	case http.StatusMethodNotAllowed:
+		return codes.Unimplemented
+	default:
+		return codes.Internal
+	}
+}
+
+func fileMeta(doc *document) *kvpb.FileMeta {
+	return &kvpb.FileMeta{
+		ContentType:   doc.contentType,
+		ContentLength: int64(len(doc.body)),
+		Etag:          doc.etag,
+	}
+}
+
+func (g *grpcServer) Head(ctx context.Context, req *kvpb.FileRequest) (*kvpb.FileMeta, error) {
+	c, err := g.s.begin(ctx, "head", auth.CapRead, req.GetPath())
+	defer c.done()
+	if err != nil {
+		return nil, err
+	}
+	doc, err := g.s.resolve(c.ctx, req.GetPath(), req.GetJsonpath())
+	if err == nil {
+		c.keys = doc.keys
+	}
+	if err := c.end(err); err != nil {
+		return nil, err
+	}
+	return fileMeta(doc), nil
+}
+
+// Read sends FileMeta, the content in chunks and FileMetaFinal.
+func (g *grpcServer) Read(req *kvpb.FileRequest, stream kvpb.KV_ReadServer) error {
+	c, err := g.s.begin(stream.Context(), "read", auth.CapRead, req.GetPath())
+	defer c.done()
+	if err != nil {
+		return err
+	}
+	doc, err := g.s.resolve(c.ctx, req.GetPath(), req.GetJsonpath())
+	if err == nil {
+		c.keys = doc.keys
+	}
+	if err := c.end(err); err != nil {
+		return err
+	}
+
+	if err := stream.Send(&kvpb.FileResponse{Part: &kvpb.FileResponse_Meta{Meta: fileMeta(doc)}}); err != nil {
+		return err
+	}
+	h := kvapi.NewHasher()
+	for b := doc.body; len(b) > 0; {
+		n := min(len(b), chunkSize)
+		_, _ = h.Write(b[:n])
+		if err := stream.Send(&kvpb.FileResponse{Part: &kvpb.FileResponse_Chunk{Chunk: b[:n]}}); err != nil {
+			return err
+		}
+		c.bytes += int64(n)
+		b = b[n:]
+	}
+	final := h.Final()
+	return stream.Send(&kvpb.FileResponse{Part: &kvpb.FileResponse_Final{Final: &kvpb.FileMetaFinal{
+		ContentLength: final.ContentLength,
+		Hash:          final.Hash,
+	}}})
+}
+
+// Watch streams the changes of the path, resuming from FileRequest.etag.
+func (g *grpcServer) Watch(req *kvpb.FileRequest, stream kvpb.KV_WatchServer) error {
+	c, err := g.s.begin(stream.Context(), "watch", auth.CapRead, req.GetPath())
+	defer c.done()
+	if err != nil {
+		return err
+	}
+	t, err := parsePath(req.GetPath())
+	var st stores.Store
+	if err == nil {
+		st, err = g.s.open(t)
+	}
+	if err == nil && t.key != "" {
+		c.keys = []string{t.key}
+	}
+	if err := c.end(err); err != nil {
+		return err
+	}
+	// 接続できたことを先に知らせる（HTTP の 200 + Flush に当たる）
+	if err := stream.SendHeader(metadata.MD{}); err != nil {
+		return err
+	}
+
+	send := func(ev kvapi.WatchEvent) error {
+		typ := kvpb.WatchEvent_PUT
+		if ev.Type == kvapi.EventDelete {
+			typ = kvpb.WatchEvent_DELETE
+		}
+		return stream.Send(&kvpb.WatchEvent{Type: typ, Path: ev.Path, Etag: ev.Etag})
+	}
+	// 接続の維持は gRPC（HTTP/2）に任せるので ping は送らない
+	err = g.s.watch(c.ctx, t, st, req.GetPath(), req.GetJsonpath(), unquoteETag(req.GetEtag()), send, nil)
+	if c.ctx.Err() != nil {
+		return nil
+	}
+	return err
+}
+
+// Put reads the head, then the JSON body from the chunks.
+func (g *grpcServer) Put(stream kvpb.KV_PutServer) error {
+	first, err := stream.Recv()
+	if errors.Is(err, io.EOF) {
+		return status.Error(codes.InvalidArgument, "Put: no head")
+	} else if err != nil {
+		return err
+	}
+	head := first.GetHead()
+	if head == nil {
+		return status.Error(codes.InvalidArgument, "Put: the first message must be head")
+	}
+
+	c, err := g.s.begin(stream.Context(), "write", auth.CapWrite, head.GetPath())
+	defer c.done()
+	if err != nil {
+		return err
+	}
+	meta, keys, err := g.s.put(c.ctx, head.GetPath(), &chunkReader{stream: stream}, precondition{ifMatch: head.GetEtag()})
+	c.keys = keys
+	if err := c.end(err); err != nil {
+		return err
+	}
+	return stream.SendAndClose(&kvpb.FileMeta{
+		ContentType:   meta.ContentType,
+		ContentLength: meta.ContentLength,
+		Etag:          meta.Etag,
+	})
+}
+
+// chunkReader は Put の chunk をつなげて読む（maxPutBytes まで）
+type chunkReader struct {
+	stream kvpb.KV_PutServer
+	buf    []byte
+	n      int64
+}
+
+func (r *chunkReader) Read(p []byte) (int, error) {
+	for len(r.buf) == 0 {
+		req, err := r.stream.Recv()
+		if err != nil {
+			return 0, err
+		}
+		if req.GetHead() != nil {
+			return 0, errors.New("head must be sent only once")
+		}
+		r.buf = req.GetChunk()
+		if r.n += int64(len(r.buf)); r.n > maxPutBytes {
+			return 0, fmt.Errorf("body exceeds %d bytes", maxPutBytes)
+		}
+	}
+	n := copy(p, r.buf)
+	r.buf = r.buf[n:]
+	return n, nil
+}
+
+func (g *grpcServer) Delete(ctx context.Context, req *kvpb.FileRequest) (*kvpb.DeleteResponse, error) {
+	c, err := g.s.begin(ctx, "delete", auth.CapWrite, req.GetPath())
+	defer c.done()
+	if err != nil {
+		return nil, err
+	}
+	_, keys, err := g.s.delete(c.ctx, req.GetPath(), precondition{ifMatch: req.GetEtag()})
+	c.keys = keys
+	if err := c.end(err); err != nil {
+		return nil, err
+	}
+	return &kvpb.DeleteResponse{}, nil
+}
+
+func (g *grpcServer) List(ctx context.Context, req *kvpb.ListRequest) (*kvpb.ListResponse, error) {
+	c, err := g.s.begin(ctx, "list", auth.CapList, req.GetPrefix())
+	defer c.done()
+	if err != nil {
+		return nil, err
+	}
+	res, err := g.s.list(c.ctx, req.GetPrefix())
+	c.keys = res.Keys
+	if err := c.end(err); err != nil {
+		return nil, err
+	}
+	return &kvpb.ListResponse{Keys: res.Keys}, nil
+}
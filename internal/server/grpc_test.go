@@ -0,0 +1,205 @@
+package server
+
+import (
+	"context"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/credentials/insecure"
+	"google.golang.org/grpc/metadata"
+	"google.golang.org/grpc/status"
+
+	"github.com/sasano8/kvtool/internal/audit"
+	"github.com/sasano8/kvtool/internal/auth"
+	"github.com/sasano8/kvtool/internal/kvpb"
+)
+
+// dialGRPC は Handler と同じポートに h2c で gRPC 接続する
+func dialGRPC(t *testing.T, ts *httptest.Server) kvpb.KVClient {
+	t.Helper()
+	conn, err := grpc.NewClient(ts.Listener.Addr().String(), grpc.WithTransportCredentials(insecure.NewCredentials()))
+	require.NoError(t, err)
+	t.Cleanup(func() { conn.Close() })
+	return kvpb.NewKVClient(conn)
+}
+
+func withToken(token string) context.Context {
+	return metadata.AppendToOutgoingContext(context.Background(), "authorization", "Bearer "+token)
+}
+
+// readAll は Read のストリームから本文を集める
+func readAll(ctx context.Context, kv kvpb.KVClient, path string) (string, *kvpb.FileMeta, error) {
+	stream, err := kv.Read(ctx, &kvpb.FileRequest{Path: path})
+	if err != nil {
+		return "", nil, err
+	}
+	var (
+		b    strings.Builder
+		meta *kvpb.FileMeta
+	)
+	for {
+		res, err := stream.Recv()
+		if err == io.EOF {
+			return b.String(), meta, nil
+		} else if err != nil {
+			return "", nil, err
+		}
+		if m := res.GetMeta(); m != nil {
+			meta = m
+		}
+		b.Write(res.GetChunk())
+	}
+}
+
+func putValue(ctx context.Context, kv kvpb.KVClient, path, etag, body string) (*kvpb.FileMeta, error) {
+	stream, err := kv.Put(ctx)
+	if err != nil {
+		return nil, err
+	}
+	if err := stream.Send(&kvpb.PutRequest{Part: &kvpb.PutRequest_Head{Head: &kvpb.FileRequest{Path: path, Etag: etag}}}); err != nil {
+		return nil, err
+	}
+	if err := stream.Send(&kvpb.PutRequest{Part: &kvpb.PutRequest_Chunk{Chunk: []byte(body)}}); err != nil {
+		return nil, err
+	}
+	return stream.CloseAndRecv()
+}
+
+func TestGRPC(t *testing.T) {
+	r := require.New(t)
+	ts, _ := newTestServer(t)
+	kv := dialGRPC(t, ts)
+	ctx := context.Background()
+
+	body, meta, err := readAll(ctx, kv, "default/.env")
+	r.NoError(err)
+	r.JSONEq(`{"USER":"alice","PASSWORD":"secret"}`, body)
+	r.Equal(int64(len(body)), meta.GetContentLength())
+
+	// HTTP と同じ etag
+	res, _ := do(t, http.MethodGet, ts.URL+"/v1/kv/default/.env", "", nil)
+	r.Equal(quoteETag(meta.GetEtag()), res.Header.Get("ETag"))
+
+	head, err := kv.Head(ctx, &kvpb.FileRequest{Path: "default/.env/USER"})
+	r.NoError(err)
+	r.NotEmpty(head.GetEtag())
+
+	_, err = kv.Head(ctx, &kvpb.FileRequest{Path: "default/.env/NOPE"})
+	r.Equal(codes.NotFound, status.Code(err))
+
+	list, err := kv.List(ctx, &kvpb.ListRequest{Prefix: "default/.env"})
+	r.NoError(err)
+	r.Equal([]string{"PASSWORD", "USER"}, list.GetKeys())
+
+	_, err = putValue(ctx, kv, "default/.env/USER", "bogus", `"bob"`)
+	r.Equal(codes.FailedPrecondition, status.Code(err))
+	put, err := putValue(ctx, kv, "default/.env/USER", head.GetEtag(), `"bob"`)
+	r.NoError(err)
+	r.NotEqual(head.GetEtag(), put.GetEtag())
+
+	_, err = kv.Delete(ctx, &kvpb.FileRequest{Path: "default/.env/PASSWORD"})
+	r.NoError(err)
+	body, _, err = readAll(ctx, kv, "default/.env")
+	r.NoError(err)
+	r.JSONEq(`{"USER":"bob"}`, body)
+
+	// HTTP の /v1/list/ も同じ結果
+	res, b := do(t, http.MethodGet, ts.URL+"/v1/list/default/.env", "", nil)
+	r.Equal(http.StatusOK, res.StatusCode)
+	r.JSONEq(`{"keys":["USER"]}`, b)
+}
+
+func TestGRPCWatch(t *testing.T) {
+	r := require.New(t)
+	ts, _ := newTestServer(t)
+	kv := dialGRPC(t, ts)
+
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+	stream, err := kv.Watch(ctx, &kvpb.FileRequest{Path: "default/.env/USER"})
+	r.NoError(err)
+	ev, err := stream.Recv()
+	r.NoError(err)
+	r.Equal(kvpb.WatchEvent_PUT, ev.GetType())
+
+	_, err = putValue(context.Background(), kv, "default/.env/USER", "", `"bob"`)
+	r.NoError(err)
+	next, err := stream.Recv()
+	r.NoError(err)
+	r.NotEqual(ev.GetEtag(), next.GetEtag())
+
+	_, err = kv.Delete(context.Background(), &kvpb.FileRequest{Path: "default/.env/USER"})
+	r.NoError(err)
+	next, err = stream.Recv()
+	r.NoError(err)
+	r.Equal(kvpb.WatchEvent_DELETE, next.GetType())
+}
+
+func TestGRPCAuth(t *testing.T) {
+	r := require.New(t)
+	s := newPolicyServer(t)
+	s.Policy.Tokens = append(s.Policy.Tokens, auth.Token{Name: "ci", Token: "c"})
+	s.Policy.Rules = append(s.Policy.Rules,
+		auth.Rule{Identities: []string{"ci"}, Paths: []string{"default/**"}, Capabilities: []auth.Capability{auth.CapRead, auth.CapList, auth.CapWrite}},
+		auth.Rule{Identities: []string{"ci"}, Paths: []string{"default/.env/PASSWORD"}, Capabilities: []auth.Capability{auth.CapDeny}},
+	)
+	sink := &memSink{}
+	s.Audit = audit.New(nil, sink)
+	ts := httptest.NewServer(s.Handler())
+	defer ts.Close()
+	kv := dialGRPC(t, ts)
+
+	tests := []struct {
+		path  string
+		token string
+		want  codes.Code
+	}{
+		{"default/.env/USER", "", codes.PermissionDenied},
+		{"default/.env/USER", "bogus", codes.Unauthenticated},
+		{"default/.env/USER", "r", codes.OK},
+		{"default/.env/PASSWORD", "r", codes.PermissionDenied},
+		{"default/.env/PASSWORD", "c", codes.PermissionDenied},
+	}
+	for _, tt := range tests {
+		ctx := context.Background()
+		if tt.token != "" {
+			ctx = withToken(tt.token)
+		}
+		_, _, err := readAll(ctx, kv, tt.path)
+		r.Equal(tt.want, status.Code(err), "%s token=%q: %v", tt.path, tt.token, err)
+	}
+
+	// deny された値は HTTP と同じく返さず、消せない
+	body, _, err := readAll(withToken("c"), kv, "default/.env")
+	r.NoError(err)
+	r.JSONEq(`{"USER":"alice"}`, body)
+	list, err := kv.List(withToken("c"), &kvpb.ListRequest{Prefix: "default/.env"})
+	r.NoError(err)
+	r.Equal([]string{"USER"}, list.GetKeys())
+	_, err = putValue(withToken("c"), kv, "default/.env", "", `{"USER":"bob"}`)
+	r.Equal(codes.PermissionDenied, status.Code(err))
+	_, err = putValue(withToken("r"), kv, "default/.env/USER", "", `"bob"`)
+	r.Equal(codes.PermissionDenied, status.Code(err))
+	_, err = putValue(withToken("c"), kv, "default/.env/USER", "", `"bob"`)
+	r.NoError(err)
+
+	r.Len(sink.entries, len(tests)+5)
+	r.Equal("unauthenticated", sink.entries[1].Identity)
+	r.Equal(audit.OutcomeDenied, sink.entries[1].Outcome)
+	e := sink.entries[2]
+	r.Equal("reader", e.Identity)
+	r.Equal("read", e.Operation)
+	r.Equal([]string{"USER"}, e.Keys)
+	r.Equal(audit.OutcomeSuccess, e.Outcome)
+	last := sink.entries[len(sink.entries)-1]
+	r.Equal("ci", last.Identity)
+	r.Equal("write", last.Operation)
+	r.Equal(audit.OutcomeSuccess, last.Outcome)
+}
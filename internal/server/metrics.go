@@ -0,0 +1,229 @@
+package server
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/collectors"
+	"github.com/prometheus/client_golang/prometheus/promauto"
+	"github.com/prometheus/client_golang/prometheus/promhttp"
+
+	"github.com/sasano8/kvtool/internal/redact"
+	"github.com/sasano8/kvtool/internal/stores"
+)
+
+type serverMetrics struct {
+	registry *prometheus.Registry
+
+	requests      *prometheus.CounterVec
+	duration      *prometheus.HistogramVec
+	streamed      *prometheus.CounterVec
+	storeDuration *prometheus.HistogramVec
+	storeErrors   *prometheus.CounterVec
+	cache         *prometheus.CounterVec
+}
+
+func newServerMetrics() *serverMetrics {
+	// テストで Server を何度作っても衝突しないよう、既定のレジストリは使わない
+	r := prometheus.NewRegistry()
+	f := promauto.With(r)
+	r.MustRegister(collectors.NewGoCollector(), collectors.NewProcessCollector(collectors.ProcessCollectorOpts{}))
+	return &serverMetrics{
+		registry: r,
+		requests: f.NewCounterVec(prometheus.CounterOpts{
+			Name: "kvtool_rpc_requests_total",
+			Help: "Requests handled, by RPC and HTTP status code.",
+		}, []string{"rpc", "code"}),
+		duration: f.NewHistogramVec(prometheus.HistogramOpts{
+			Name: "kvtool_rpc_duration_seconds",
+			Help: "Time to serve a request, by RPC. Watch covers the whole stream.",
+		}, []string{"rpc"}),
+		streamed: f.NewCounterVec(prometheus.CounterOpts{
+			Name: "kvtool_streamed_bytes_total",
+			Help: "Response body bytes written, by RPC.",
+		}, []string{"rpc"}),
+		storeDuration: f.NewHistogramVec(prometheus.HistogramOpts{
+			Name: "kvtool_store_duration_seconds",
+			Help: "Latency of store backend calls.",
+		}, []string{"namespace", "store", "type", "op"}),
+		storeErrors: f.NewCounterVec(prometheus.CounterOpts{
+			Name: "kvtool_store_errors_total",
+			Help: "Failed store backend calls (not found is not an error).",
+		}, []string{"namespace", "store", "type", "op"}),
+		cache: f.NewCounterVec(prometheus.CounterOpts{
+			Name: "kvtool_cache_requests_total",
+			Help: "Cache lookups by cache and result. cache=\"store\" is the store cache (hit/miss/stale), cache=\"etag\" counts conditional requests (hit/miss).",
+		}, []string{"cache", "result"}),
+	}
+}
+
+func (m *serverMetrics) handler() http.Handler {
+	return promhttp.HandlerFor(m.registry, promhttp.HandlerOpts{})
+}
+
+// rpcName は kv.proto の RPC 名
+func rpcName(r *http.Request) string {
+	return rpcOf(operation(r))
+}
+
+// rpcOf は監査ログの operation に対応する RPC 名
+func rpcOf(op string) string {
+	switch op {
+	case "watch":
+		return "Watch"
+	case "list":
+		return "List"
+	case "head":
+		return "Head"
+	case "write":
+		return "Put"
+	case "delete":
+		return "Delete"
+	default:
+		return "Read"
+	}
+}
+
+// instrument counts requests, latency and streamed bytes per RPC.
+func (s *Server) instrument(h http.HandlerFunc) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		rpc := rpcName(r)
+		mw := &metricsWriter{ResponseWriter: w}
+		start := time.Now()
+		defer func() {
+			if mw.code == 0 {
+				mw.code = http.StatusOK
+			}
+			s.metrics.requests.WithLabelValues(rpc, strconv.Itoa(mw.code)).Inc()
+			s.metrics.duration.WithLabelValues(rpc).Observe(time.Since(start).Seconds())
+			s.metrics.streamed.WithLabelValues(rpc).Add(float64(mw.bytes))
+		}()
+		h(mw, r)
+	}
+}
+
+type metricsWriter struct {
+	http.ResponseWriter
+	code  int
+	bytes int64
+}
+
+func (w *metricsWriter) WriteHeader(code int) {
+	if w.code == 0 {
+		w.code = code
+	}
+	w.ResponseWriter.WriteHeader(code)
+}
+
+func (w *metricsWriter) Write(b []byte) (int, error) {
+	if w.code == 0 {
+		w.code = http.StatusOK
+	}
+	n, err := w.ResponseWriter.Write(b)
+	w.bytes += int64(n)
+	return n, err
+}
+
+func (w *metricsWriter) Flush() {
+	if f, ok := w.ResponseWriter.(http.Flusher); ok {
+		f.Flush()
+	}
+}
+
+func (w *metricsWriter) Unwrap() http.ResponseWriter { return w.ResponseWriter }
+
+// observeStore times a backend call of the store t points at.
+func (s *Server) observeStore(t target, op string, fn func() error) error {
+	typ := ""
+	if _, sc, err := s.stores.Lookup(t.ns, t.store); err == nil {
+		typ = sc.Type
+	}
+	start := time.Now()
+	err := fn()
+	s.metrics.storeDuration.WithLabelValues(t.ns, t.store, typ, op).Observe(time.Since(start).Seconds())
+	if err != nil && !errors.Is(err, stores.ErrNotFound) {
+		s.metrics.storeErrors.WithLabelValues(t.ns, t.store, typ, op).Inc()
+	}
+	return err
+}
+
+func (s *Server) readStore(ctx context.Context, t target, st stores.Store) (map[string]any, error) {
+	var data map[string]any
+	err := s.observeStore(t, "read", func() (err error) {
+		data, err = st.Read(ctx)
+		return err
+	})
+	return data, err
+}
+
+func (s *Server) writeStore(ctx context.Context, t target, wr stores.Writer, data map[string]any) error {
+	return s.observeStore(t, "write", func() error { return wr.Write(ctx, data) })
+}
+
+func (s *Server) handleHealthz(w http.ResponseWriter, _ *http.Request) {
+	w.Header().Set("Content-Type", "application/json")
+	_, _ = w.Write([]byte(`{"status":"ok"}` + "\n"))
+}
+
+// handleReadyz probes every configured store concurrently and reports 503
+// unless all of them answer within ProbeTimeout. The endpoint is not
+// authenticated, so it only says "ok" or "unavailable" per store; the
+// errors go to the log.
+func (s *Server) handleReadyz(w http.ResponseWriter, r *http.Request) {
+	ctx, cancel := context.WithTimeout(r.Context(), s.ProbeTimeout)
+	defer cancel()
+
+	var (
+		mu      sync.Mutex
+		wg      sync.WaitGroup
+		results = map[string]string{}
+		ready   = true
+	)
+	for ns, m := range s.stores.Namespaces {
+		for key := range m {
+			t := target{ns: ns, store: key}
+			wg.Add(1)
+			go func() {
+				defer wg.Done()
+				err := s.probe(ctx, t)
+				mu.Lock()
+				defer mu.Unlock()
+				results[t.path()] = "ok"
+				if err != nil {
+					ready = false
+					results[t.path()] = "unavailable"
+					s.Logger.Printf("readyz %s: %v", t.path(), redact.Global().Error(err))
+				}
+			}()
+		}
+	}
+	wg.Wait()
+
+	res := struct {
+		Status string            `json:"status"`
+		Stores map[string]string `json:"stores"`
+	}{Status: "ok", Stores: results}
+	code := http.StatusOK
+	if !ready {
+		res.Status, code = "unavailable", http.StatusServiceUnavailable
+	}
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(code)
+	enc := json.NewEncoder(w)
+	enc.SetIndent("", "  ")
+	_ = enc.Encode(res)
+}
+
+func (s *Server) probe(ctx context.Context, t target) error {
+	st, err := s.open(t)
+	if err != nil {
+		return err
+	}
+	return s.observeStore(t, "probe", func() error { return stores.Probe(ctx, st) })
+}
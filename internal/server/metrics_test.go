@@ -0,0 +1,87 @@
+package server
+
+import (
+	"encoding/json"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+
+	"github.com/sasano8/kvtool/internal/stores"
+)
+
+func TestMetrics(t *testing.T) {
+	r := require.New(t)
+	ts, _ := newTestServer(t)
+
+	res, err := http.Get(ts.URL + "/v1/kv/default/.env")
+	r.NoError(err)
+	etag := res.Header.Get("ETag")
+	res.Body.Close()
+
+	req, _ := http.NewRequest(http.MethodGet, ts.URL+"/v1/kv/default/.env", nil)
+	req.Header.Set("If-None-Match", etag)
+	res, err = http.DefaultClient.Do(req)
+	r.NoError(err)
+	res.Body.Close()
+
+	res, err = http.Get(ts.URL + "/v1/kv/default/nope")
+	r.NoError(err)
+	res.Body.Close()
+
+	res, err = http.Get(ts.URL + "/metrics")
+	r.NoError(err)
+	body, _ := io.ReadAll(res.Body)
+	res.Body.Close()
+	r.Equal(http.StatusOK, res.StatusCode)
+	r.Contains(res.Header.Get("Content-Type"), "text/plain; version=0.0.4")
+
+	text := string(body)
+	r.Contains(text, `kvtool_rpc_requests_total{code="200",rpc="Read"} 1`)
+	r.Contains(text, `kvtool_rpc_requests_total{code="304",rpc="Read"} 1`)
+	r.Contains(text, `kvtool_rpc_requests_total{code="404",rpc="Read"} 1`)
+	r.Contains(text, `kvtool_rpc_duration_seconds_count{rpc="Read"} 3`)
+	r.Contains(text, `kvtool_streamed_bytes_total{rpc="Read"}`)
+	r.Contains(text, `kvtool_store_duration_seconds_count{namespace="default",op="read",store=".env",type=".env"} 2`)
+	r.Contains(text, `kvtool_cache_requests_total{cache="etag",result="hit"} 1`)
+	r.NotContains(text, "kvtool_store_errors_total{")
+	r.Contains(text, "go_goroutines")
+}
+
+func TestHealth(t *testing.T) {
+	r := require.New(t)
+	ts, _ := newTestServer(t)
+
+	res, err := http.Get(ts.URL + "/healthz")
+	r.NoError(err)
+	res.Body.Close()
+	r.Equal(http.StatusOK, res.StatusCode)
+
+	var ready struct {
+		Status string            `json:"status"`
+		Stores map[string]string `json:"stores"`
+	}
+	res, err = http.Get(ts.URL + "/readyz")
+	r.NoError(err)
+	r.NoError(json.NewDecoder(res.Body).Decode(&ready))
+	res.Body.Close()
+	r.Equal(http.StatusOK, res.StatusCode)
+	r.Equal(map[string]string{"default/.env": "ok"}, ready.Stores)
+
+	// 存在しないストアタイプは probe に失敗する
+	s := New(stores.Config{Namespaces: map[string]map[string]stores.StoreConfig{
+		"default": {"broken": {Type: "no-such-type"}},
+	}})
+	bad := httptest.NewServer(s.Handler())
+	defer bad.Close()
+	res, err = http.Get(bad.URL + "/readyz")
+	r.NoError(err)
+	r.NoError(json.NewDecoder(res.Body).Decode(&ready))
+	res.Body.Close()
+	r.Equal(http.StatusServiceUnavailable, res.StatusCode)
+	r.Equal("unavailable", ready.Status)
+	// 認証なしの endpoint なのでエラーの中身は返さない
+	r.Equal("unavailable", ready.Stores["default/broken"])
+}
@@ -0,0 +1,366 @@
+// Package server serves the KV service described in kv.proto over gRPC and its HTTP mapping.
+package server
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"net/http"
+	"os"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"golang.org/x/net/http2"
+	"golang.org/x/net/http2/h2c"
+
+	"github.com/sasano8/kvtool/internal/audit"
+	"github.com/sasano8/kvtool/internal/auth"
+	"github.com/sasano8/kvtool/internal/jsonpath"
+	"github.com/sasano8/kvtool/internal/kvapi"
+	"github.com/sasano8/kvtool/internal/redact"
+	"github.com/sasano8/kvtool/internal/stores"
+)
+
+var (
+	ErrNotFound   = errors.New("not found")
+	ErrBadRequest = errors.New("bad request")
+)
+
+type Server struct {
+	stores stores.Config
+
+	// nil なら認証・認可を行わない
+	Policy *auth.Policy
+	// nil なら監査ログを取らない
+	Audit *audit.Logger
+
+	// Put/Delete の read-modify-write を直列化する
+	writeMu sync.Mutex
+
+	// Watcher を実装していないストアのポーリング間隔
+	WatchInterval time.Duration
+	// SSE 接続を維持するためのコメント送信間隔
+	Heartbeat time.Duration
+	// /readyz で各ストアの応答を待つ時間
+	ProbeTimeout time.Duration
+	Logger       *log.Logger
+
+	metrics *serverMetrics
+}
+
+func New(cfg stores.Config) *Server {
+	return &Server{
+		stores:        cfg,
+		WatchInterval: 10 * time.Second,
+		Heartbeat:     15 * time.Second,
+		ProbeTimeout:  5 * time.Second,
+		Logger:        log.New(redact.Global().Writer(os.Stderr), "server: ", log.LstdFlags),
+		metrics:       newServerMetrics(),
+	}
+}
+
+// Handler serves both surfaces of the KV service on one port: gRPC
+// (kv.v1.KV, see GRPC) for HTTP/2 requests with a gRPC content type,
+// and HTTPHandler for everything else. Without TLS HTTP/2 is accepted
+// in cleartext (h2c) so gRPC clients can connect too.
+func (s *Server) Handler() http.Handler {
+	rest, rpc := s.HTTPHandler(), s.GRPC()
+	return h2c.NewHandler(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.ProtoMajor == 2 && strings.HasPrefix(r.Header.Get("Content-Type"), "application/grpc") {
+			rpc.ServeHTTP(w, r)
+			return
+		}
+		rest.ServeHTTP(w, r)
+	}), &http2.Server{})
+}
+
+// HTTPHandler returns the HTTP mapping of the KV service.
+//
+//	HEAD   /v1/kv/{path}       KV.Head
+//	GET    /v1/kv/{path}       KV.Read
+//	GET    /v1/list/{prefix}   KV.List   (GET /v1/kv/{prefix}?list も受け付ける)
+//	PUT    /v1/kv/{path}       KV.Put    (If-Match / If-None-Match: *)
+//	DELETE /v1/kv/{path}       KV.Delete (If-Match)
+//	GET    /v1/watch/{path}    KV.Watch  (Server-Sent Events)
+//
+// and, without authentication, the operational endpoints
+//
+//	GET /metrics  Prometheus text format
+//	GET /healthz  liveness
+//	GET /readyz   every configured store answers a probe
+func (s *Server) HTTPHandler() http.Handler {
+	mux := http.NewServeMux()
+	// GET のパターンは HEAD にもマッチする（HEAD ではボディは捨てられる）
+	list, read := s.guard(auth.CapList, s.handleList), s.guard(auth.CapRead, s.handleRead)
+	mux.HandleFunc("GET /v1/kv/{path...}", s.instrument(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Query().Has("list") {
+			list(w, r)
+			return
+		}
+		read(w, r)
+	}))
+	mux.HandleFunc("GET /v1/list/{path...}", s.instrument(list))
+	mux.HandleFunc("PUT /v1/kv/{path...}", s.instrument(s.guard(auth.CapWrite, s.handlePut)))
+	mux.HandleFunc("DELETE /v1/kv/{path...}", s.instrument(s.guard(auth.CapWrite, s.handleDelete)))
+	mux.HandleFunc("GET /v1/watch/{path...}", s.instrument(s.guard(auth.CapRead, s.handleWatch)))
+	mux.Handle("GET /metrics", s.metrics.handler())
+	mux.HandleFunc("GET /healthz", s.handleHealthz)
+	mux.HandleFunc("GET /readyz", s.handleReadyz)
+	return mux
+}
+
+// Read で送る chunk の大きさ
+const chunkSize = 32 << 10
+
+// document is the resolved content of a path, i.e. FileMeta + chunks.
+type document struct {
+	body        []byte
+	contentType string
+	etag        string
+	// 監査ログ用に、返した値のキー名
+	keys []string
+}
+
+func (s *Server) handleRead(w http.ResponseWriter, r *http.Request) {
+	doc, err := s.resolve(r.Context(), r.PathValue("path"), r.URL.Query().Get("jsonpath"))
+	if err != nil {
+		writeError(w, err)
+		return
+	}
+
+	setAuditKeys(w, doc.keys)
+	w.Header().Set("ETag", quoteETag(doc.etag))
+	if match := r.Header.Get("If-None-Match"); match != "" {
+		if unquoteETag(match) == doc.etag {
+			s.metrics.cache.WithLabelValues("etag", "hit").Inc()
+			w.WriteHeader(http.StatusNotModified)
+			return
+		}
+		s.metrics.cache.WithLabelValues("etag", "miss").Inc()
+	}
+	w.Header().Set("Content-Type", doc.contentType)
+	if r.Method == http.MethodHead {
+		w.Header().Set("Content-Length", fmt.Sprint(len(doc.body)))
+		return
+	}
+
+	// FileMetaFinal はトレーラーで送る（Content-Length を付けると chunked にならず送れない）
+	w.Header().Set("Trailer", kvapi.TrailerContentLength+", "+kvapi.TrailerHash)
+	h := kvapi.NewHasher()
+	out := io.MultiWriter(w, h)
+	for b := doc.body; len(b) > 0; {
+		n := min(len(b), chunkSize)
+		if _, err := out.Write(b[:n]); err != nil {
+			return
+		}
+		b = b[n:]
+	}
+	final := h.Final()
+	w.Header().Set(kvapi.TrailerContentLength, strconv.FormatInt(final.ContentLength, 10))
+	w.Header().Set(kvapi.TrailerHash, final.Hash)
+}
+
+// Read resolves path like GET /v1/kv/{path} and returns the content with its meta.
+func (s *Server) Read(ctx context.Context, path, query string) ([]byte, kvapi.FileMeta, error) {
+	doc, err := s.resolve(ctx, path, query)
+	if err != nil {
+		return nil, kvapi.FileMeta{}, err
+	}
+	return doc.body, kvapi.FileMeta{
+		ContentType:   doc.contentType,
+		ContentLength: int64(len(doc.body)),
+		Etag:          doc.etag,
+	}, nil
+}
+
+// ReadRef is Read for a store URI. kv:// URIs go through the configured
+// stores; other schemes open their store directly.
+func (s *Server) ReadRef(ctx context.Context, ref stores.Ref, query string) ([]byte, kvapi.FileMeta, error) {
+	if ref.Namespace != "" {
+		return s.Read(ctx, ref.Namespace+"/"+ref.StoreKey+"/"+ref.Key, query)
+	}
+	st, err := stores.Open(ref.Store)
+	if err != nil {
+		return nil, kvapi.FileMeta{}, err
+	}
+	data, err := s.readStore(ctx, target{ns: ref.Scheme, store: ref.Store.Name}, st)
+	if err != nil {
+		return nil, kvapi.FileMeta{}, err
+	}
+	doc, err := render(data, ref.Key, query)
+	if err != nil {
+		return nil, kvapi.FileMeta{}, err
+	}
+	return doc.body, kvapi.FileMeta{
+		ContentType:   doc.contentType,
+		ContentLength: int64(len(doc.body)),
+		Etag:          doc.etag,
+	}, nil
+}
+
+// target は "<namespace>/<store>[/<key>]" 形式のパス
+type target struct {
+	ns    string
+	store string
+	key   string
+}
+
+func (t target) path() string {
+	p := t.ns + "/" + t.store
+	if t.key != "" {
+		p += "/" + t.key
+	}
+	return p
+}
+
+func parsePath(p string) (target, error) {
+	parts := strings.SplitN(strings.Trim(p, "/"), "/", 3)
+	if len(parts) < 2 || parts[0] == "" || parts[1] == "" {
+		return target{}, fmt.Errorf("%w: path must be <namespace>/<store>[/<key>]: %q", ErrBadRequest, p)
+	}
+	t := target{ns: parts[0], store: parts[1]}
+	if len(parts) == 3 {
+		t.key = parts[2]
+	}
+	return t, nil
+}
+
+func (s *Server) open(t target) (stores.Store, error) {
+	_, sc, err := s.stores.Lookup(t.ns, t.store)
+	if err != nil {
+		return nil, fmt.Errorf("%w: %v", ErrNotFound, err)
+	}
+	st, err := stores.Open(sc)
+	if err != nil {
+		return nil, err
+	}
+	if c := stores.CacheOf(st); c != nil {
+		c.Observe = func(result string) { s.metrics.cache.WithLabelValues("store", result).Inc() }
+	}
+	return st, nil
+}
+
+func (s *Server) resolve(ctx context.Context, path, query string) (*document, error) {
+	t, err := parsePath(path)
+	if err != nil {
+		return nil, err
+	}
+	st, err := s.open(t)
+	if err != nil {
+		return nil, err
+	}
+	data, err := s.readStore(ctx, t, st)
+	if err != nil {
+		return nil, err
+	}
+	return render(s.visible(ctx, t, data), t.key, query)
+}
+
+// lookup は key の値を返す。key が空ならストア全体。
+// 入れ子の値と "/" を含むキーは kv:// URI と同じように辿る
+func lookup(data map[string]any, key string) (any, bool) {
+	return stores.ValueAt(data, key)
+}
+
+func render(data map[string]any, key, query string) (*document, error) {
+	v, ok := lookup(data, key)
+	if !ok {
+		return nil, fmt.Errorf("%w: key %q", ErrNotFound, key)
+	}
+
+	if query != "" {
+		// jsonpath は encoding/json の型を前提にしているので一度正規化する
+		b, err := json.Marshal(v)
+		if err != nil {
+			return nil, err
+		}
+		var norm any
+		if err := json.Unmarshal(b, &norm); err != nil {
+			return nil, err
+		}
+		v, err = jsonpath.Get(norm, query)
+		if errors.Is(err, jsonpath.ErrNoMatch) {
+			return nil, fmt.Errorf("%w: %v", ErrNotFound, err)
+		} else if err != nil {
+			return nil, fmt.Errorf("%w: %v", ErrBadRequest, err)
+		}
+	}
+
+	b, err := json.Marshal(v)
+	if err != nil {
+		return nil, err
+	}
+	b = append(b, '\n')
+	sum := sha256.Sum256(b)
+	return &document{
+		body:        b,
+		contentType: "application/json",
+		etag:        hex.EncodeToString(sum[:16]),
+		keys:        returnedKeys(data, key, query),
+	}, nil
+}
+
+func returnedKeys(data map[string]any, key, query string) []string {
+	if key != "" {
+		return []string{key}
+	}
+	if query != "" {
+		if root, ok := jsonpath.Root(query); ok {
+			return []string{root}
+		}
+	}
+	keys := make([]string, 0, len(data))
+	for k := range data {
+		keys = append(keys, k)
+	}
+	return keys
+}
+
+func quoteETag(etag string) string {
+	return `"` + etag + `"`
+}
+
+func unquoteETag(s string) string {
+	s = strings.TrimSpace(s)
+	s = strings.TrimPrefix(s, "W/")
+	return strings.Trim(s, `"`)
+}
+
+func statusOf(err error) int {
+	switch {
+	case errors.Is(err, ErrNotFound), errors.Is(err, stores.ErrNotFound):
+		return http.StatusNotFound
+	case errors.Is(err, ErrBadRequest):
+		return http.StatusBadRequest
+	case errors.Is(err, auth.ErrUnauthenticated):
+		return http.StatusUnauthorized
+	case errors.Is(err, auth.ErrPermissionDenied):
+		return http.StatusForbidden
+	case errors.Is(err, stores.ErrConflict):
+		return http.StatusConflict
+	case errors.Is(err, ErrPreconditionFailed):
+		return http.StatusPreconditionFailed
+	case errors.Is(err, ErrNotWritable):
+		return http.StatusMethodNotAllowed
+	default:
+		return http.StatusBadGateway
+	}
+}
+
+func writeError(w http.ResponseWriter, err error) {
+	// 返すエラーと監査ログに値が混ざらないように
+	err = redact.Global().Error(err)
+	if aw, ok := w.(*auditWriter); ok {
+		aw.err = err
+	}
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(statusOf(err))
+	_ = json.NewEncoder(w).Encode(map[string]string{"error": err.Error()})
+}
@@ -0,0 +1,171 @@
+package server
+
+import (
+	"bufio"
+	"context"
+	"encoding/json"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+
+	"github.com/sasano8/kvtool/internal/kvapi"
+	"github.com/sasano8/kvtool/internal/stores"
+)
+
+func newTestServer(t *testing.T) (*httptest.Server, string) {
+	t.Helper()
+	dir := t.TempDir()
+	envPath := filepath.Join(dir, ".env")
+	require.NoError(t, os.WriteFile(envPath, []byte("USER=alice\nPASSWORD=secret\n"), 0o644))
+
+	s := New(stores.Config{
+		Namespaces: map[string]map[string]stores.StoreConfig{
+			"default": {".env": {Type: ".env", Args: map[string]any{"input": envPath}}},
+		},
+	})
+	s.WatchInterval = 50 * time.Millisecond
+	ts := httptest.NewServer(s.Handler())
+	t.Cleanup(ts.Close)
+	return ts, envPath
+}
+
+func TestRead(t *testing.T) {
+	r := require.New(t)
+	ts, _ := newTestServer(t)
+
+	res, err := http.Get(ts.URL + "/v1/kv/default/.env")
+	r.NoError(err)
+	body, _ := io.ReadAll(res.Body)
+	res.Body.Close()
+	r.Equal(http.StatusOK, res.StatusCode)
+	r.JSONEq(`{"USER":"alice","PASSWORD":"secret"}`, string(body))
+	etag := res.Header.Get("ETag")
+	r.NotEmpty(etag)
+
+	res, err = http.Head(ts.URL + "/v1/kv/default/.env")
+	r.NoError(err)
+	res.Body.Close()
+	r.Equal(http.StatusOK, res.StatusCode)
+	r.Equal(etag, res.Header.Get("ETag"))
+
+	req, _ := http.NewRequest(http.MethodGet, ts.URL+"/v1/kv/default/.env", nil)
+	req.Header.Set("If-None-Match", etag)
+	res, err = http.DefaultClient.Do(req)
+	r.NoError(err)
+	res.Body.Close()
+	r.Equal(http.StatusNotModified, res.StatusCode)
+
+	res, err = http.Get(ts.URL + "/v1/kv/default/.env/USER")
+	r.NoError(err)
+	body, _ = io.ReadAll(res.Body)
+	res.Body.Close()
+	r.Equal(`"alice"`+"\n", string(body))
+
+	res, err = http.Get(ts.URL + "/v1/kv/default/.env?jsonpath=$.PASSWORD")
+	r.NoError(err)
+	body, _ = io.ReadAll(res.Body)
+	res.Body.Close()
+	r.Equal(`"secret"`+"\n", string(body))
+
+	for path, code := range map[string]int{
+		"/v1/kv/default/.env/NOPE":       http.StatusNotFound,
+		"/v1/kv/default/nope":            http.StatusNotFound,
+		"/v1/kv/default":                 http.StatusBadRequest,
+		"/v1/kv/default/.env?jsonpath=[": http.StatusBadRequest,
+	} {
+		res, err = http.Get(ts.URL + path)
+		r.NoError(err)
+		res.Body.Close()
+		r.Equal(code, res.StatusCode, path)
+	}
+}
+
+type sseReader struct {
+	sc *bufio.Scanner
+}
+
+func (s *sseReader) next() (kvapi.WatchEvent, string) {
+	var ev kvapi.WatchEvent
+	var id string
+	for s.sc.Scan() {
+		line := s.sc.Text()
+		switch {
+		case line == "" && ev.Type != "":
+			return ev, id
+		case strings.HasPrefix(line, "id: "):
+			id = strings.TrimPrefix(line, "id: ")
+		case strings.HasPrefix(line, "data: "):
+			_ = json.Unmarshal([]byte(strings.TrimPrefix(line, "data: ")), &ev)
+		}
+	}
+	return ev, id
+}
+
+func watch(t *testing.T, ctx context.Context, url, etag string) *sseReader {
+	t.Helper()
+	req, _ := http.NewRequestWithContext(ctx, http.MethodGet, url, nil)
+	if etag != "" {
+		req.Header.Set("Last-Event-ID", etag)
+	}
+	res, err := http.DefaultClient.Do(req)
+	require.NoError(t, err)
+	require.Equal(t, http.StatusOK, res.StatusCode)
+	t.Cleanup(func() { res.Body.Close() })
+	return &sseReader{sc: bufio.NewScanner(res.Body)}
+}
+
+func TestRenderNested(t *testing.T) {
+	r := require.New(t)
+	data := map[string]any{"db": map[string]any{"password": "pw"}, "a/b": "flat"}
+
+	doc, err := render(data, "db/password", "")
+	r.NoError(err)
+	r.Equal("\"pw\"\n", string(doc.body))
+	doc, err = render(data, "db", "$.password")
+	r.NoError(err)
+	r.Equal("\"pw\"\n", string(doc.body))
+	doc, err = render(data, "a/b", "")
+	r.NoError(err)
+	r.Equal("\"flat\"\n", string(doc.body))
+
+	_, err = render(data, "db/user", "")
+	r.ErrorIs(err, ErrNotFound)
+}
+
+func TestWatch(t *testing.T) {
+	r := require.New(t)
+	ts, envPath := newTestServer(t)
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+
+	// etag なしで接続すると現在の状態が最初に届く
+	sse := watch(t, ctx, ts.URL+"/v1/watch/default/.env/USER", "")
+	ev, id := sse.next()
+	r.Equal(kvapi.EventPut, ev.Type)
+	r.Equal("default/.env/USER", ev.Path)
+	r.Equal(ev.Etag, id)
+	first := ev.Etag
+
+	r.NoError(os.WriteFile(envPath, []byte("USER=bob\nPASSWORD=secret\n"), 0o644))
+	ev, _ = sse.next()
+	r.Equal(kvapi.EventPut, ev.Type)
+	r.NotEqual(first, ev.Etag)
+	second := ev.Etag
+
+	// 古い etag で再接続すると取りこぼした変更がすぐに届く
+	sse2 := watch(t, ctx, ts.URL+"/v1/watch/default/.env/USER", first)
+	ev, _ = sse2.next()
+	r.Equal(second, ev.Etag)
+
+	r.NoError(os.WriteFile(envPath, []byte("PASSWORD=secret\n"), 0o644))
+	ev, _ = sse.next()
+	r.Equal(kvapi.EventDelete, ev.Type)
+	r.Empty(ev.Etag)
+}
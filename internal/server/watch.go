@@ -0,0 +1,155 @@
+package server
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"time"
+
+	"github.com/sasano8/kvtool/internal/kvapi"
+	"github.com/sasano8/kvtool/internal/stores"
+)
+
+// handleWatch streams WatchEvent as Server-Sent Events.
+//
+// The client resumes by sending its last seen etag (Last-Event-ID header or
+// ?etag=). If the current etag differs an event is sent immediately, otherwise
+// the stream stays quiet until the next change. Without an etag the current
+// state is sent first.
+func (s *Server) handleWatch(w http.ResponseWriter, r *http.Request) {
+	path := r.PathValue("path")
+	query := r.URL.Query().Get("jsonpath")
+
+	t, err := parsePath(path)
+	if err != nil {
+		writeError(w, err)
+		return
+	}
+	st, err := s.open(t)
+	if err != nil {
+		writeError(w, err)
+		return
+	}
+
+	flusher, ok := w.(http.Flusher)
+	if !ok {
+		writeError(w, errors.New("streaming unsupported"))
+		return
+	}
+
+	last := r.Header.Get("Last-Event-ID")
+	if q := r.URL.Query().Get("etag"); q != "" {
+		last = q
+	}
+	last = unquoteETag(last)
+
+	if t.key != "" {
+		setAuditKeys(w, []string{t.key})
+	}
+	w.Header().Set("Content-Type", "text/event-stream")
+	w.Header().Set("Cache-Control", "no-cache")
+	w.WriteHeader(http.StatusOK)
+	flusher.Flush()
+
+	send := func(ev kvapi.WatchEvent) error { return writeEvent(w, flusher, ev) }
+	ping := func() error {
+		if _, err := fmt.Fprint(w, ": ping\n\n"); err != nil {
+			return err
+		}
+		flusher.Flush()
+		return nil
+	}
+	_ = s.watch(r.Context(), t, st, path, query, last, send, ping)
+}
+
+// watch sends a WatchEvent for path to send whenever its etag differs from
+// the last one sent, starting from last ("" sends the current state first).
+// ping, if not nil, is called every Heartbeat to keep the stream open.
+// It returns when ctx is done or send/ping fails.
+func (s *Server) watch(ctx context.Context, t target, st stores.Store, path, query, last string, send func(kvapi.WatchEvent) error, ping func() error) error {
+	// next は送るイベントを返す（etag が変わっていなければ nil）
+	next := func() (*kvapi.WatchEvent, error) {
+		data, err := s.readStore(ctx, t, st)
+		if err != nil {
+			return nil, err
+		}
+		ev := kvapi.WatchEvent{Type: kvapi.EventPut, Path: path}
+		// deny された値の変更は etag にも出さない
+		doc, err := render(s.visible(ctx, t, data), t.key, query)
+		switch {
+		case errors.Is(err, ErrNotFound):
+			ev.Type = kvapi.EventDelete
+		case err != nil:
+			return nil, err
+		default:
+			ev.Etag = doc.etag
+		}
+
+		if ev.Etag == last {
+			return nil, nil
+		}
+		// 消えたものを初めて見るクライアントには何も送らない
+		if ev.Type == kvapi.EventDelete && last == "" {
+			return nil, nil
+		}
+		last = ev.Etag
+		return &ev, nil
+	}
+
+	onError := func(err error) { s.Logger.Printf("watch %s: %v", path, err) }
+	// ストアのエラーはログに残して続け、送信の失敗（切断）だけで終える
+	check := func() error {
+		ev, err := next()
+		if err != nil {
+			if ctx.Err() == nil {
+				onError(err)
+			}
+			return nil
+		}
+		if ev == nil {
+			return nil
+		}
+		return send(*ev)
+	}
+
+	trigger := stores.Changes(ctx, st, s.WatchInterval, onError)
+	var heartbeat <-chan time.Time
+	if ping != nil {
+		ticker := time.NewTicker(s.Heartbeat)
+		defer ticker.Stop()
+		heartbeat = ticker.C
+	}
+
+	if err := check(); err != nil {
+		return err
+	}
+	for {
+		select {
+		case <-ctx.Done():
+			return ctx.Err()
+		case <-heartbeat:
+			if err := ping(); err != nil {
+				return err
+			}
+		case <-trigger:
+			if err := check(); err != nil {
+				return err
+			}
+		}
+	}
+}
+
+func writeEvent(w http.ResponseWriter, flusher http.Flusher, ev kvapi.WatchEvent) error {
+	b, err := json.Marshal(ev)
+	if err != nil {
+		return err
+	}
+	// id に etag を入れておくと EventSource が再接続時に Last-Event-ID で送ってくる
+	if _, err := fmt.Fprintf(w, "id: %s\nevent: %s\ndata: %s\n\n", ev.Etag, ev.Type, b); err != nil {
+		return err
+	}
+	flusher.Flush()
+	return nil
+}
@@ -0,0 +1,252 @@
+package server
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"sort"
+	"strings"
+
+	"github.com/sasano8/kvtool/internal/kvapi"
+	"github.com/sasano8/kvtool/internal/stores"
+)
+
+var (
+	ErrPreconditionFailed = errors.New("precondition failed")
+	ErrNotWritable        = errors.New("store is not writable")
+)
+
+// PUT で受け付けるボディの上限
+const maxPutBytes = 10 << 20
+
+// handlePut implements KV.Put. "<ns>/<store>" replaces the whole store with a
+// JSON object, "<ns>/<store>/<key>" sets a single key to any JSON value.
+func (s *Server) handlePut(w http.ResponseWriter, r *http.Request) {
+	meta, keys, err := s.put(r.Context(), r.PathValue("path"), http.MaxBytesReader(w, r.Body, maxPutBytes), preconditionOf(r))
+	setAuditKeys(w, keys)
+	if err != nil {
+		writeError(w, err)
+		return
+	}
+	writeMeta(w, meta)
+}
+
+// put は KV.Put の本体。body は JSON で、返すキー名は監査ログ用
+func (s *Server) put(ctx context.Context, path string, body io.Reader, pre precondition) (kvapi.FileMeta, []string, error) {
+	t, err := parsePath(path)
+	if err != nil {
+		return kvapi.FileMeta{}, nil, err
+	}
+
+	var v any
+	dec := json.NewDecoder(body)
+	dec.UseNumber()
+	if err := dec.Decode(&v); err != nil {
+		return kvapi.FileMeta{}, nil, fmt.Errorf("%w: decode body: %v", ErrBadRequest, err)
+	}
+
+	var keys []string
+	meta, err := s.modify(ctx, t, pre, func(data map[string]any) (map[string]any, error) {
+		if t.key != "" {
+			keys = []string{t.key}
+			// 読む時と同じく入れ子の値の中に書く
+			if err := stores.SetValueAt(data, t.key, v); err != nil {
+				return nil, fmt.Errorf("%w: %v", ErrBadRequest, err)
+			}
+			return data, nil
+		}
+		m, ok := v.(map[string]any)
+		if !ok {
+			return nil, fmt.Errorf("%w: body must be a JSON object to replace a store", ErrBadRequest)
+		}
+		keys = returnedKeys(m, "", "")
+		return m, nil
+	})
+	return meta, keys, err
+}
+
+// handleDelete implements KV.Delete for a single key.
+func (s *Server) handleDelete(w http.ResponseWriter, r *http.Request) {
+	meta, keys, err := s.delete(r.Context(), r.PathValue("path"), preconditionOf(r))
+	setAuditKeys(w, keys)
+	if err != nil {
+		writeError(w, err)
+		return
+	}
+	writeMeta(w, meta)
+}
+
+// delete は KV.Delete の本体
+func (s *Server) delete(ctx context.Context, path string, pre precondition) (kvapi.FileMeta, []string, error) {
+	t, err := parsePath(path)
+	if err != nil {
+		return kvapi.FileMeta{}, nil, err
+	}
+	if t.key == "" {
+		return kvapi.FileMeta{}, nil, fmt.Errorf("%w: only keys can be deleted (<ns>/<store>/<key>)", ErrBadRequest)
+	}
+
+	keys := []string{t.key}
+	meta, err := s.modify(ctx, t, pre, func(data map[string]any) (map[string]any, error) {
+		if !stores.DeleteValueAt(data, t.key) {
+			return nil, fmt.Errorf("%w: key %q", ErrNotFound, t.key)
+		}
+		return data, nil
+	})
+	return meta, keys, err
+}
+
+// modify は read -> 条件チェック -> 書き込みを直列化して行う。
+// 返す FileMeta は t が指す位置の新しい状態（削除なら etag は空）。
+func (s *Server) modify(ctx context.Context, t target, pre precondition, fn func(map[string]any) (map[string]any, error)) (kvapi.FileMeta, error) {
+	st, err := s.open(t)
+	if err != nil {
+		return kvapi.FileMeta{}, err
+	}
+	wr, ok := st.(stores.Writer)
+	if !ok {
+		return kvapi.FileMeta{}, fmt.Errorf("%w: %s/%s", ErrNotWritable, t.ns, t.store)
+	}
+
+	s.writeMu.Lock()
+	defer s.writeMu.Unlock()
+
+	// If-Match はキャッシュではなく今の値と比べる
+	data, err := s.readStore(ctx, t, stores.Uncached(st))
+	if errors.Is(err, stores.ErrNotFound) {
+		data = map[string]any{}
+	} else if err != nil {
+		return kvapi.FileMeta{}, err
+	}
+
+	cur := ""
+	if doc, err := render(data, t.key, ""); err == nil {
+		cur = doc.etag
+	}
+	if err := pre.check(cur); err != nil {
+		return kvapi.FileMeta{}, err
+	}
+	if err := s.checkHidden(ctx, t, data); err != nil {
+		return kvapi.FileMeta{}, err
+	}
+
+	next, err := fn(data)
+	if err != nil {
+		return kvapi.FileMeta{}, err
+	}
+	if err := s.checkHidden(ctx, t, next); err != nil {
+		return kvapi.FileMeta{}, err
+	}
+	if err := s.writeStore(ctx, t, wr, next); err != nil {
+		return kvapi.FileMeta{}, err
+	}
+
+	doc, err := render(next, t.key, "")
+	if errors.Is(err, ErrNotFound) {
+		return kvapi.FileMeta{}, nil
+	} else if err != nil {
+		return kvapi.FileMeta{}, err
+	}
+	return kvapi.FileMeta{ContentType: doc.contentType, ContentLength: int64(len(doc.body)), Etag: doc.etag}, nil
+}
+
+// precondition は If-Match / If-None-Match（gRPC では FileRequest.etag が If-Match）
+type precondition struct {
+	ifMatch     string
+	ifNoneMatch string
+}
+
+func preconditionOf(r *http.Request) precondition {
+	return precondition{ifMatch: r.Header.Get("If-Match"), ifNoneMatch: r.Header.Get("If-None-Match")}
+}
+
+// check は条件を評価する。cur が空なら対象は存在しない。
+func (p precondition) check(cur string) error {
+	if m := p.ifMatch; m != "" {
+		if cur == "" {
+			return fmt.Errorf("%w: If-Match %s but target does not exist", ErrPreconditionFailed, m)
+		}
+		if strings.TrimSpace(m) != "*" && unquoteETag(m) != cur {
+			return fmt.Errorf("%w: If-Match %s but current etag is %s", ErrPreconditionFailed, m, quoteETag(cur))
+		}
+	}
+	if m := p.ifNoneMatch; strings.TrimSpace(m) == "*" && cur != "" {
+		return fmt.Errorf("%w: If-None-Match * but target exists", ErrPreconditionFailed)
+	}
+	return nil
+}
+
+func writeMeta(w http.ResponseWriter, meta kvapi.FileMeta) {
+	if meta.Etag != "" {
+		w.Header().Set("ETag", quoteETag(meta.Etag))
+	}
+	w.Header().Set("Content-Type", "application/json")
+	_ = json.NewEncoder(w).Encode(meta)
+}
+
+// list implements KV.List:
+//
+//	""                      -> namespaces
+//	"<ns>"                  -> stores
+//	"<ns>/<store>[/<pfx>]"  -> keys (starting with pfx)
+func (s *Server) list(ctx context.Context, prefix string) (kvapi.ListResponse, error) {
+	parts := strings.SplitN(strings.Trim(prefix, "/"), "/", 3)
+	var keys []string
+
+	switch {
+	case parts[0] == "":
+		for ns := range s.stores.Namespaces {
+			keys = append(keys, ns)
+		}
+	case len(parts) == 1:
+		ns, ok := s.stores.Namespaces[parts[0]]
+		if !ok {
+			return kvapi.ListResponse{}, fmt.Errorf("%w: namespace %q", ErrNotFound, parts[0])
+		}
+		for k := range ns {
+			keys = append(keys, k)
+		}
+	default:
+		t := target{ns: parts[0], store: parts[1]}
+		st, err := s.open(t)
+		if err != nil {
+			return kvapi.ListResponse{}, err
+		}
+		data, err := s.readStore(ctx, t, st)
+		if errors.Is(err, stores.ErrNotFound) {
+			data = nil
+		} else if err != nil {
+			return kvapi.ListResponse{}, err
+		}
+		data = s.visible(ctx, t, data)
+		pfx := ""
+		if len(parts) == 3 {
+			pfx = parts[2]
+		}
+		for k := range data {
+			if strings.HasPrefix(k, pfx) {
+				keys = append(keys, k)
+			}
+		}
+	}
+
+	sort.Strings(keys)
+	if keys == nil {
+		keys = []string{}
+	}
+	return kvapi.ListResponse{Keys: keys}, nil
+}
+
+func (s *Server) handleList(w http.ResponseWriter, r *http.Request) {
+	res, err := s.list(r.Context(), r.PathValue("path"))
+	if err != nil {
+		writeError(w, err)
+		return
+	}
+	setAuditKeys(w, res.Keys)
+	w.Header().Set("Content-Type", "application/json")
+	_ = json.NewEncoder(w).Encode(res)
+}
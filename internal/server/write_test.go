@@ -0,0 +1,197 @@
+package server
+
+import (
+	"context"
+	"encoding/json"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+
+	"github.com/sasano8/kvtool/internal/kvapi"
+	"github.com/sasano8/kvtool/internal/stores"
+)
+
+func do(t *testing.T, method, url, body string, header map[string]string) (*http.Response, string) {
+	t.Helper()
+	req, err := http.NewRequest(method, url, strings.NewReader(body))
+	require.NoError(t, err)
+	for k, v := range header {
+		req.Header.Set(k, v)
+	}
+	res, err := http.DefaultClient.Do(req)
+	require.NoError(t, err)
+	b, _ := io.ReadAll(res.Body)
+	res.Body.Close()
+	return res, string(b)
+}
+
+func TestPutDelete(t *testing.T) {
+	r := require.New(t)
+	ts, envPath := newTestServer(t)
+	url := ts.URL + "/v1/kv/default/.env/TOKEN"
+
+	// 存在しない時だけ作る
+	res, body := do(t, http.MethodPut, url, `"t1"`, map[string]string{"If-None-Match": "*"})
+	r.Equal(http.StatusOK, res.StatusCode, body)
+	etag := res.Header.Get("ETag")
+	r.NotEmpty(etag)
+
+	res, _ = do(t, http.MethodPut, url, `"t2"`, map[string]string{"If-None-Match": "*"})
+	r.Equal(http.StatusPreconditionFailed, res.StatusCode)
+
+	// 古い etag での書き込みは拒否される
+	res, _ = do(t, http.MethodPut, url, `"t2"`, map[string]string{"If-Match": `"stale"`})
+	r.Equal(http.StatusPreconditionFailed, res.StatusCode)
+
+	res, body = do(t, http.MethodPut, url, `"t2"`, map[string]string{"If-Match": etag})
+	r.Equal(http.StatusOK, res.StatusCode, body)
+	var meta kvapi.FileMeta
+	r.NoError(json.Unmarshal([]byte(body), &meta))
+	r.Equal(`"`+meta.Etag+`"`, res.Header.Get("ETag"))
+	r.NotEqual(etag, res.Header.Get("ETag"))
+	current := res.Header.Get("ETag")
+
+	b, err := os.ReadFile(envPath)
+	r.NoError(err)
+	r.Equal("PASSWORD=\"secret\"\nTOKEN=\"t2\"\nUSER=\"alice\"\n", string(b))
+
+	res, _ = do(t, http.MethodDelete, url, "", map[string]string{"If-Match": etag})
+	r.Equal(http.StatusPreconditionFailed, res.StatusCode)
+
+	res, _ = do(t, http.MethodDelete, url, "", map[string]string{"If-Match": current})
+	r.Equal(http.StatusOK, res.StatusCode)
+	res, _ = do(t, http.MethodDelete, url, "", nil)
+	r.Equal(http.StatusNotFound, res.StatusCode)
+
+	// ストア全体の置き換えはオブジェクトのみ
+	res, _ = do(t, http.MethodPut, ts.URL+"/v1/kv/default/.env", `[1]`, nil)
+	r.Equal(http.StatusBadRequest, res.StatusCode)
+	res, _ = do(t, http.MethodPut, ts.URL+"/v1/kv/default/.env", `{"A":"1","N":2}`, nil)
+	r.Equal(http.StatusOK, res.StatusCode)
+	b, err = os.ReadFile(envPath)
+	r.NoError(err)
+	r.Equal("A=\"1\"\nN=\"2\"\n", string(b))
+}
+
+// memStore は入れ子の値を持てる書き込み可能なストア（args の id ごとに 1 つ）
+type memStore struct {
+	mu   sync.Mutex
+	data map[string]any
+}
+
+var memStores sync.Map
+
+func init() {
+	stores.Register("mem", func(args map[string]any) (stores.Store, error) {
+		st, _ := memStores.LoadOrStore(args["id"], &memStore{data: map[string]any{}})
+		return st.(*memStore), nil
+	})
+}
+
+func (s *memStore) Read(ctx context.Context) (map[string]any, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	// 書き込み側と map を共有しないように JSON で複製する
+	b, _ := json.Marshal(s.data)
+	var out map[string]any
+	return out, json.Unmarshal(b, &out)
+}
+
+func (s *memStore) Write(ctx context.Context, data map[string]any) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.data = data
+	return nil
+}
+
+func TestPutDeleteNested(t *testing.T) {
+	r := require.New(t)
+	mem := &memStore{data: map[string]any{"db": map[string]any{"host": "h1"}, "a/b": "flat"}}
+	memStores.Store(t.Name(), mem)
+	s := New(stores.Config{Namespaces: map[string]map[string]stores.StoreConfig{
+		"default": {"m": {Type: "mem", Args: map[string]any{"id": t.Name()}}},
+	}})
+	ts := httptest.NewServer(s.Handler())
+	defer ts.Close()
+	url := ts.URL + "/v1/kv/default/m/"
+
+	// 読む時と同じパスで入れ子の値を書き換える
+	res, body := do(t, http.MethodGet, url+"db/host", "", nil)
+	r.Equal(http.StatusOK, res.StatusCode, body)
+	res, body = do(t, http.MethodPut, url+"db/host", `"h2"`, map[string]string{"If-Match": res.Header.Get("ETag")})
+	r.Equal(http.StatusOK, res.StatusCode, body)
+	res, body = do(t, http.MethodPut, url+"db/port", `5432`, nil)
+	r.Equal(http.StatusOK, res.StatusCode, body)
+	res, body = do(t, http.MethodPut, url+"a/b", `"flat2"`, nil)
+	r.Equal(http.StatusOK, res.StatusCode, body)
+	res, body = do(t, http.MethodGet, url, "", nil)
+	r.Equal(http.StatusOK, res.StatusCode)
+	r.JSONEq(`{"db":{"host":"h2","port":5432},"a/b":"flat2"}`, body)
+
+	// 値の下には書けない
+	res, _ = do(t, http.MethodPut, url+"db/host/x", `"v"`, nil)
+	r.Equal(http.StatusBadRequest, res.StatusCode)
+
+	res, body = do(t, http.MethodDelete, url+"db/host", "", nil)
+	r.Equal(http.StatusOK, res.StatusCode, body)
+	res, _ = do(t, http.MethodDelete, url+"db/host", "", nil)
+	r.Equal(http.StatusNotFound, res.StatusCode)
+	res, body = do(t, http.MethodGet, url, "", nil)
+	r.Equal(http.StatusOK, res.StatusCode)
+	r.JSONEq(`{"db":{"port":5432},"a/b":"flat2"}`, body)
+}
+
+func TestPutCreatesMissingFile(t *testing.T) {
+	r := require.New(t)
+	envPath := filepath.Join(t.TempDir(), "new.env")
+	s := New(stores.Config{Namespaces: map[string]map[string]stores.StoreConfig{
+		"default": {
+			".env": {Type: ".env", Args: map[string]any{"input": envPath}},
+			"env":  {Type: "env"},
+		},
+	}})
+	ts := httptest.NewServer(s.Handler())
+	defer ts.Close()
+
+	res, _ := do(t, http.MethodGet, ts.URL+"/v1/kv/default/.env", "", nil)
+	r.Equal(http.StatusNotFound, res.StatusCode)
+
+	res, _ = do(t, http.MethodPut, ts.URL+"/v1/kv/default/.env/A", `"1"`, map[string]string{"If-Match": "*"})
+	r.Equal(http.StatusPreconditionFailed, res.StatusCode)
+
+	res, _ = do(t, http.MethodPut, ts.URL+"/v1/kv/default/.env/A", `"1"`, nil)
+	r.Equal(http.StatusOK, res.StatusCode)
+	fi, err := os.Stat(envPath)
+	r.NoError(err)
+	r.Equal(os.FileMode(0o600), fi.Mode().Perm())
+
+	res, _ = do(t, http.MethodPut, ts.URL+"/v1/kv/default/env/A", `"1"`, nil)
+	r.Equal(http.StatusMethodNotAllowed, res.StatusCode)
+}
+
+func TestList(t *testing.T) {
+	r := require.New(t)
+	ts, _ := newTestServer(t)
+
+	for path, want := range map[string]string{
+		"":                   `{"keys":["default"]}`,
+		"default":            `{"keys":[".env"]}`,
+		"default/.env":       `{"keys":["PASSWORD","USER"]}`,
+		"default/.env/US":    `{"keys":["USER"]}`,
+		"default/.env/NOPE_": `{"keys":[]}`,
+	} {
+		res, body := do(t, http.MethodGet, ts.URL+"/v1/kv/"+path+"?list", "", nil)
+		r.Equal(http.StatusOK, res.StatusCode, path)
+		r.JSONEq(want, body, path)
+	}
+
+	res, _ := do(t, http.MethodGet, ts.URL+"/v1/kv/nope?list", "", nil)
+	r.Equal(http.StatusNotFound, res.StatusCode)
+}
@@ -0,0 +1,254 @@
+package stores
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"os"
+	"strings"
+	"time"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	awsconfig "github.com/aws/aws-sdk-go-v2/config"
+	"github.com/aws/aws-sdk-go-v2/service/secretsmanager"
+	smtypes "github.com/aws/aws-sdk-go-v2/service/secretsmanager/types"
+	"github.com/aws/aws-sdk-go-v2/service/ssm"
+
+	"github.com/sasano8/kvtool/internal/convert"
+)
+
+func init() {
+	Register("aws-ssm", newSSMStore)
+	Register("aws-secretsmanager", newSecretsManagerStore)
+}
+
+// awsArgs are the connection args shared by the AWS stores. Credentials come
+// from the standard chain (env, shared config / SSO profile, web identity,
+// ECS / EC2 roles).
+type awsArgs struct {
+	Region  string
+	Profile string
+	// ローカルのスタンドインや VPC エンドポイント向け
+	Endpoint string
+	Timeout  time.Duration
+}
+
+func parseAWSArgs(args map[string]any) (awsArgs, error) {
+	var (
+		a   awsArgs
+		err error
+	)
+	if a.Region, err = argString(args, "region", ""); err != nil {
+		return a, err
+	}
+	if a.Profile, err = argString(args, "profile", ""); err != nil {
+		return a, err
+	}
+	if a.Endpoint, err = argString(args, "endpoint", ""); err != nil {
+		return a, err
+	}
+	if a.Timeout, err = argDuration(args, "timeout", 10*time.Second); err != nil {
+		return a, err
+	}
+	return a, nil
+}
+
+func (a awsArgs) config(ctx context.Context) (aws.Config, error) {
+	var opts []func(*awsconfig.LoadOptions) error
+	if a.Region != "" {
+		opts = append(opts, awsconfig.WithRegion(a.Region))
+	}
+	if a.Profile != "" {
+		opts = append(opts, awsconfig.WithSharedConfigProfile(a.Profile))
+	}
+	cfg, err := awsconfig.LoadDefaultConfig(ctx, opts...)
+	if err != nil {
+		return cfg, fmt.Errorf("aws config: %w", err)
+	}
+	if cfg.Region == "" {
+		return cfg, errors.New("aws: no region (set the region arg, AWS_REGION or a profile region)")
+	}
+	return cfg, nil
+}
+
+// identity は AWS_PROFILE / AWS_REGION や profile の region を反映した接続先
+func (a awsArgs) identity() map[string]any {
+	profile := a.Profile
+	if profile == "" {
+		profile = os.Getenv("AWS_PROFILE")
+	}
+	if profile == "" {
+		profile = os.Getenv("AWS_DEFAULT_PROFILE")
+	}
+	region := a.Region
+	if region == "" {
+		// 認証情報は遅延して取りに行くので、ここでは共有設定と環境変数しか読まない
+		if cfg, err := awsconfig.LoadDefaultConfig(context.Background(), awsconfig.WithSharedConfigProfile(profile)); err == nil {
+			region = cfg.Region
+		}
+	}
+	return map[string]any{"profile": profile, "region": region, "endpoint": a.Endpoint}
+}
+
+func (a awsArgs) endpoint() *string {
+	if a.Endpoint == "" {
+		return nil
+	}
+	return aws.String(a.Endpoint)
+}
+
+// SSMStore reads the parameters below a path of SSM Parameter Store.
+// "/app/prod/db/host" read with path "/app/prod" becomes {"db": {"host": ...}};
+// without recursion only the direct children are read. SecureString values
+// are decrypted unless decrypt is false.
+type SSMStore struct {
+	AWS       awsArgs
+	Path      string
+	Recursive bool
+	Decrypt   bool
+}
+
+func newSSMStore(args map[string]any) (Store, error) {
+	var (
+		s   SSMStore
+		err error
+	)
+	if s.AWS, err = parseAWSArgs(args); err != nil {
+		return nil, err
+	}
+	if s.Path, err = argString(args, "path", ""); err != nil {
+		return nil, err
+	}
+	if s.Recursive, err = argBool(args, "recursive", true); err != nil {
+		return nil, err
+	}
+	if s.Decrypt, err = argBool(args, "decrypt", true); err != nil {
+		return nil, err
+	}
+	if s.Path == "" {
+		return nil, fmt.Errorf("aws-ssm store: missing arg \"path\"")
+	}
+	s.Path = "/" + strings.Trim(s.Path, "/")
+	return &s, nil
+}
+
+func (s *SSMStore) Identity() map[string]any {
+	return s.AWS.identity()
+}
+
+func (s *SSMStore) Read(ctx context.Context) (map[string]any, error) {
+	ctx, cancel := context.WithTimeout(ctx, s.AWS.Timeout)
+	defer cancel()
+	cfg, err := s.AWS.config(ctx)
+	if err != nil {
+		return nil, err
+	}
+	client := ssm.NewFromConfig(cfg, func(o *ssm.Options) { o.BaseEndpoint = s.AWS.endpoint() })
+
+	// path が "/" でも "//" にならないように
+	prefix := strings.TrimSuffix(s.Path, "/") + "/"
+	out := map[string]any{}
+	p := ssm.NewGetParametersByPathPaginator(client, &ssm.GetParametersByPathInput{
+		Path:           aws.String(s.Path),
+		Recursive:      aws.Bool(s.Recursive),
+		WithDecryption: aws.Bool(s.Decrypt),
+	})
+	for p.HasMorePages() {
+		page, err := p.NextPage(ctx)
+		if err != nil {
+			return nil, fmt.Errorf("ssm %s: %w", s.Path, err)
+		}
+		for _, prm := range page.Parameters {
+			rel := strings.TrimPrefix(aws.ToString(prm.Name), prefix)
+			if err := setNested(out, strings.Split(rel, "/"), aws.ToString(prm.Value)); err != nil {
+				return nil, fmt.Errorf("ssm %s: %w", s.Path, err)
+			}
+		}
+	}
+	if len(out) == 0 {
+		// パスが無くてもエラーにならず空で返ってくる
+		return nil, fmt.Errorf("%w: ssm path %s", ErrNotFound, s.Path)
+	}
+	return out, nil
+}
+
+// SecretsManagerStore reads one secret of AWS Secrets Manager. A secret
+// string holding a JSON object is expanded into its keys; any other value
+// is returned under Key.
+type SecretsManagerStore struct {
+	AWS          awsArgs
+	SecretID     string
+	VersionStage string
+	VersionID    string
+	// JSON オブジェクトでない値のキー
+	Key string
+}
+
+func newSecretsManagerStore(args map[string]any) (Store, error) {
+	var (
+		s   SecretsManagerStore
+		err error
+	)
+	if s.AWS, err = parseAWSArgs(args); err != nil {
+		return nil, err
+	}
+	if s.SecretID, err = argString(args, "secret_id", ""); err != nil {
+		return nil, err
+	}
+	if s.VersionStage, err = argString(args, "version_stage", ""); err != nil {
+		return nil, err
+	}
+	if s.VersionID, err = argString(args, "version_id", ""); err != nil {
+		return nil, err
+	}
+	if s.Key, err = argString(args, "key", "value"); err != nil {
+		return nil, err
+	}
+	if s.SecretID == "" {
+		return nil, fmt.Errorf("aws-secretsmanager store: missing arg \"secret_id\"")
+	}
+	return &s, nil
+}
+
+func (s *SecretsManagerStore) Identity() map[string]any {
+	return s.AWS.identity()
+}
+
+func (s *SecretsManagerStore) Read(ctx context.Context) (map[string]any, error) {
+	ctx, cancel := context.WithTimeout(ctx, s.AWS.Timeout)
+	defer cancel()
+	cfg, err := s.AWS.config(ctx)
+	if err != nil {
+		return nil, err
+	}
+	client := secretsmanager.NewFromConfig(cfg, func(o *secretsmanager.Options) { o.BaseEndpoint = s.AWS.endpoint() })
+
+	in := &secretsmanager.GetSecretValueInput{SecretId: aws.String(s.SecretID)}
+	// 両方空なら AWSCURRENT
+	if s.VersionStage != "" {
+		in.VersionStage = aws.String(s.VersionStage)
+	}
+	if s.VersionID != "" {
+		in.VersionId = aws.String(s.VersionID)
+	}
+	res, err := client.GetSecretValue(ctx, in)
+	var nf *smtypes.ResourceNotFoundException
+	if errors.As(err, &nf) {
+		return nil, fmt.Errorf("%w: secret %s: %w", ErrNotFound, s.SecretID, err)
+	} else if err != nil {
+		return nil, fmt.Errorf("secret %s: %w", s.SecretID, err)
+	}
+
+	if res.SecretString == nil {
+		return map[string]any{s.Key: string(res.SecretBinary)}, nil
+	}
+	v := aws.ToString(res.SecretString)
+	if strings.HasPrefix(strings.TrimSpace(v), "{") {
+		m, err := convert.ParseJSON(strings.NewReader(v))
+		if err != nil {
+			return nil, fmt.Errorf("secret %s: %w", s.SecretID, err)
+		}
+		return m, nil
+	}
+	return map[string]any{s.Key: v}, nil
+}
@@ -0,0 +1,187 @@
+package stores
+
+import (
+	"context"
+	"encoding/json"
+	"maps"
+	"net/http"
+	"net/http/httptest"
+	"path/filepath"
+	"slices"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+type fakeSSMParam struct {
+	Name, Type, Value string
+}
+
+// fakeAWS は AWS JSON 1.1 プロトコル（POST / + X-Amz-Target）で SSM と
+// Secrets Manager の読み取り API だけを返す
+type fakeAWS struct {
+	params  []fakeSSMParam
+	secrets map[string]map[string]string // id -> stage -> string
+	// 最後の Authorization ヘッダ（署名に使われた認証情報の確認用）
+	auth string
+}
+
+func (f *fakeAWS) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	f.auth = r.Header.Get("Authorization")
+	var in map[string]any
+	if err := json.NewDecoder(r.Body).Decode(&in); err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	w.Header().Set("Content-Type", "application/x-amz-json-1.1")
+	fail := func(typ, msg string) {
+		w.WriteHeader(http.StatusBadRequest)
+		_ = json.NewEncoder(w).Encode(map[string]string{"__type": typ, "message": msg})
+	}
+
+	switch r.Header.Get("X-Amz-Target") {
+	case "AmazonSSM.GetParametersByPath":
+		path := strings.TrimSuffix(in["Path"].(string), "/") + "/"
+		recursive, _ := in["Recursive"].(bool)
+		decrypt, _ := in["WithDecryption"].(bool)
+		var out []map[string]any
+		for _, p := range f.params {
+			rel, ok := strings.CutPrefix(p.Name, path)
+			if !ok || (!recursive && strings.Contains(rel, "/")) {
+				continue
+			}
+			v := p.Value
+			if p.Type == "SecureString" && !decrypt {
+				v = "AQICAHencrypted"
+			}
+			out = append(out, map[string]any{"Name": p.Name, "Type": p.Type, "Value": v})
+		}
+		// 1 件ずつページを分けてページングも通す
+		start := 0
+		if tok, ok := in["NextToken"].(string); ok {
+			start = len(tok)
+		}
+		res := map[string]any{"Parameters": []map[string]any{}}
+		if start < len(out) {
+			res["Parameters"] = out[start : start+1]
+			if start+1 < len(out) {
+				res["NextToken"] = strings.Repeat("x", start+1)
+			}
+		}
+		_ = json.NewEncoder(w).Encode(res)
+
+	case "secretsmanager.GetSecretValue":
+		id := in["SecretId"].(string)
+		stage, _ := in["VersionStage"].(string)
+		if stage == "" {
+			stage = "AWSCURRENT"
+		}
+		v, ok := f.secrets[id][stage]
+		if !ok {
+			fail("ResourceNotFoundException", "Secrets Manager can't find the specified secret.")
+			return
+		}
+		_ = json.NewEncoder(w).Encode(map[string]any{"ARN": "arn:aws:secretsmanager:us-east-1:1:secret:" + id, "Name": id, "SecretString": v})
+
+	default:
+		fail("UnknownOperationException", r.Header.Get("X-Amz-Target"))
+	}
+}
+
+// awsTestEnv は認証情報を環境変数（標準のチェーンの先頭）だけから取らせる
+func awsTestEnv(t *testing.T) {
+	dir := t.TempDir()
+	t.Setenv("AWS_ACCESS_KEY_ID", "AKIDTEST")
+	t.Setenv("AWS_SECRET_ACCESS_KEY", "secret")
+	t.Setenv("AWS_SESSION_TOKEN", "")
+	t.Setenv("AWS_PROFILE", "")
+	t.Setenv("AWS_REGION", "")
+	t.Setenv("AWS_DEFAULT_REGION", "")
+	t.Setenv("AWS_ENDPOINT_URL", "")
+	t.Setenv("AWS_CONFIG_FILE", filepath.Join(dir, "config"))
+	t.Setenv("AWS_SHARED_CREDENTIALS_FILE", filepath.Join(dir, "credentials"))
+	t.Setenv("AWS_EC2_METADATA_DISABLED", "true")
+}
+
+func TestSSMStore(t *testing.T) {
+	r := require.New(t)
+	ctx := context.Background()
+	awsTestEnv(t)
+	fake := &fakeAWS{params: []fakeSSMParam{
+		{"/app/prod/log_level", "String", "info"},
+		{"/app/prod/db/host", "String", "db.internal"},
+		{"/app/prod/db/password", "SecureString", "s3cret"},
+		{"/app/staging/log_level", "String", "debug"},
+	}}
+	srv := httptest.NewServer(fake)
+	defer srv.Close()
+
+	defaults := map[string]any{"region": "us-east-1", "endpoint": srv.URL, "path": "/app/prod"}
+
+	data, err := openStore(t, "aws-ssm", defaults, nil).Read(ctx)
+	r.NoError(err)
+	r.Equal(map[string]any{
+		"log_level": "info",
+		"db":        map[string]any{"host": "db.internal", "password": "s3cret"},
+	}, data)
+	r.Contains(fake.auth, "Credential=AKIDTEST/")
+
+	data, err = openStore(t, "aws-ssm", defaults, map[string]any{"recursive": false}).Read(ctx)
+	r.NoError(err)
+	r.Equal(map[string]any{"log_level": "info"}, data)
+
+	data, err = openStore(t, "aws-ssm", defaults, map[string]any{"path": "app/prod/db/", "decrypt": false}).Read(ctx)
+	r.NoError(err)
+	r.Equal("AQICAHencrypted", data["password"])
+
+	// ルートから読むと最上位のパスがそのままキーになる
+	data, err = openStore(t, "aws-ssm", defaults, map[string]any{"path": "/"}).Read(ctx)
+	r.NoError(err)
+	r.Equal([]string{"app"}, slices.Collect(maps.Keys(data)))
+	r.Equal("debug", data["app"].(map[string]any)["staging"].(map[string]any)["log_level"])
+
+	_, err = openStore(t, "aws-ssm", defaults, map[string]any{"path": "/missing"}).Read(ctx)
+	r.ErrorIs(err, ErrNotFound)
+
+	_, err = openStore(t, "aws-ssm", defaults, map[string]any{"region": nil}).Read(ctx)
+	r.ErrorContains(err, "no region")
+}
+
+func TestSecretsManagerStore(t *testing.T) {
+	r := require.New(t)
+	ctx := context.Background()
+	awsTestEnv(t)
+	fake := &fakeAWS{secrets: map[string]map[string]string{
+		"app/db": {
+			"AWSCURRENT":  `{"username": "app", "password": "new", "port": 5432}`,
+			"AWSPREVIOUS": `{"username": "app", "password": "old", "port": 5432}`,
+		},
+		"app/token": {"AWSCURRENT": "plain-token"},
+	}}
+	srv := httptest.NewServer(fake)
+	defer srv.Close()
+	t.Setenv("AWS_REGION", "eu-west-1")
+
+	defaults := map[string]any{"endpoint": srv.URL}
+
+	data, err := openStore(t, "aws-secretsmanager", defaults, map[string]any{"secret_id": "app/db"}).Read(ctx)
+	r.NoError(err)
+	r.Equal("new", data["password"])
+	r.Equal("5432", data["port"].(json.Number).String())
+	r.Contains(fake.auth, "/eu-west-1/secretsmanager/")
+
+	data, err = openStore(t, "aws-secretsmanager", defaults, map[string]any{"secret_id": "app/db", "version_stage": "AWSPREVIOUS"}).Read(ctx)
+	r.NoError(err)
+	r.Equal("old", data["password"])
+
+	data, err = openStore(t, "aws-secretsmanager", defaults, map[string]any{"secret_id": "app/token", "key": "TOKEN"}).Read(ctx)
+	r.NoError(err)
+	r.Equal(map[string]any{"TOKEN": "plain-token"}, data)
+
+	_, err = openStore(t, "aws-secretsmanager", defaults, map[string]any{"secret_id": "missing"}).Read(ctx)
+	r.ErrorIs(err, ErrNotFound)
+
+	_, err = Open(StoreConfig{Type: "aws-secretsmanager"})
+	r.Error(err)
+}
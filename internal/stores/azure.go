@@ -0,0 +1,189 @@
+package stores
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/url"
+	"os"
+	"path"
+	"strings"
+	"time"
+)
+
+func init() {
+	Register("azure-keyvault", newAzureKeyVaultStore)
+}
+
+const azureKeyVaultAPIVersion = "7.4"
+
+// AzureKeyVaultStore reads secrets from an Azure Key Vault: the named
+// Secrets, or every enabled secret of the vault. Versions pins a secret to a
+// version; others read the current one.
+//
+// Authentication is the client credentials flow with a federated token file
+// (AKS workload identity) or a client secret; tenant_id, client_id and
+// token_file default to the AZURE_* variables the workload identity webhook
+// injects.
+type AzureKeyVaultStore struct {
+	VaultURL string
+	Secrets  []string
+	Versions map[string]string
+	Timeout  time.Duration
+
+	Client *http.Client
+	tokens *tokenCache
+}
+
+func newAzureKeyVaultStore(args map[string]any) (Store, error) {
+	var (
+		s                                   AzureKeyVaultStore
+		tenant, clientID, tokenFile, secret string
+		authority                           string
+		err                                 error
+	)
+	if s.VaultURL, err = argString(args, "vault_url", ""); err != nil {
+		return nil, err
+	}
+	if s.Secrets, err = argStrings(args, "secrets"); err != nil {
+		return nil, err
+	}
+	if s.Versions, err = argStringMap(args, "versions"); err != nil {
+		return nil, err
+	}
+	if s.Timeout, err = argDuration(args, "timeout", 10*time.Second); err != nil {
+		return nil, err
+	}
+	if tenant, err = argString(args, "tenant_id", os.Getenv("AZURE_TENANT_ID")); err != nil {
+		return nil, err
+	}
+	if clientID, err = argString(args, "client_id", os.Getenv("AZURE_CLIENT_ID")); err != nil {
+		return nil, err
+	}
+	if tokenFile, err = argString(args, "token_file", os.Getenv("AZURE_FEDERATED_TOKEN_FILE")); err != nil {
+		return nil, err
+	}
+	if secret, err = argString(args, "client_secret", os.Getenv("AZURE_CLIENT_SECRET")); err != nil {
+		return nil, err
+	}
+	if authority, err = argString(args, "authority_host", os.Getenv("AZURE_AUTHORITY_HOST")); err != nil {
+		return nil, err
+	}
+	if authority == "" {
+		authority = "https://login.microsoftonline.com/"
+	}
+
+	if s.VaultURL == "" {
+		return nil, errors.New("azure-keyvault store: missing arg \"vault_url\"")
+	}
+	s.VaultURL = strings.TrimRight(s.VaultURL, "/")
+	if tenant == "" || clientID == "" {
+		return nil, errors.New("azure-keyvault store: missing arg \"tenant_id\" or \"client_id\" (or AZURE_TENANT_ID / AZURE_CLIENT_ID)")
+	}
+	if tokenFile == "" && secret == "" {
+		return nil, errors.New("azure-keyvault store: need \"token_file\" or \"client_secret\" (or AZURE_FEDERATED_TOKEN_FILE / AZURE_CLIENT_SECRET)")
+	}
+
+	tokenURL := strings.TrimRight(authority, "/") + "/" + url.PathEscape(tenant) + "/oauth2/v2.0/token"
+	s.tokens = &tokenCache{fetch: func(ctx context.Context) (string, time.Duration, error) {
+		form := url.Values{
+			"grant_type": {"client_credentials"},
+			"client_id":  {clientID},
+			"scope":      {"https://vault.azure.net/.default"},
+		}
+		if tokenFile != "" {
+			// トークンファイルはローテートされるので毎回読み直す
+			b, err := os.ReadFile(tokenFile)
+			if err != nil {
+				return "", 0, fmt.Errorf("federated token: %w", err)
+			}
+			form.Set("client_assertion_type", "urn:ietf:params:oauth:client-assertion-type:jwt-bearer")
+			form.Set("client_assertion", strings.TrimSpace(string(b)))
+		} else {
+			form.Set("client_secret", secret)
+		}
+		return postTokenForm(ctx, s.client(), tokenURL, form)
+	}}
+	return &s, nil
+}
+
+func (s *AzureKeyVaultStore) client() *http.Client {
+	if s.Client != nil {
+		return s.Client
+	}
+	return http.DefaultClient
+}
+
+func (s *AzureKeyVaultStore) Identity() map[string]any {
+	return map[string]any{"vault_url": s.VaultURL}
+}
+
+func (s *AzureKeyVaultStore) Read(ctx context.Context) (map[string]any, error) {
+	ctx, cancel := context.WithTimeout(ctx, s.Timeout)
+	defer cancel()
+	token, err := s.tokens.Token(ctx)
+	if err != nil {
+		return nil, fmt.Errorf("azure auth: %w", err)
+	}
+
+	names := s.Secrets
+	if len(names) == 0 {
+		if names, err = s.list(ctx, token); err != nil {
+			return nil, err
+		}
+	}
+
+	out := make(map[string]any, len(names))
+	for _, name := range names {
+		var res struct {
+			Value string `json:"value"`
+		}
+		u := s.VaultURL + "/secrets/" + url.PathEscape(name) + "/" + url.PathEscape(s.Versions[name]) +
+			"?api-version=" + azureKeyVaultAPIVersion
+		err := getJSON(ctx, s.client(), u, token, &res)
+		var he *httpStatusError
+		if errors.As(err, &he) && he.Code == http.StatusNotFound {
+			return nil, fmt.Errorf("%w: key vault secret %s: %w", ErrNotFound, name, err)
+		} else if err != nil {
+			return nil, fmt.Errorf("key vault secret %s: %w", name, err)
+		}
+		out[name] = res.Value
+	}
+	if len(out) == 0 {
+		return nil, fmt.Errorf("%w: no secrets in %s", ErrNotFound, s.VaultURL)
+	}
+	return out, nil
+}
+
+// list は有効なシークレットの名前を nextLink をたどって集める
+func (s *AzureKeyVaultStore) list(ctx context.Context, token string) ([]string, error) {
+	var names []string
+	u := s.VaultURL + "/secrets?api-version=" + azureKeyVaultAPIVersion
+	for u != "" {
+		var page struct {
+			Value []struct {
+				ID         string `json:"id"`
+				Attributes struct {
+					Enabled *bool `json:"enabled"`
+				} `json:"attributes"`
+			} `json:"value"`
+			NextLink string `json:"nextLink"`
+		}
+		if err := getJSON(ctx, s.client(), u, token, &page); err != nil {
+			return nil, fmt.Errorf("key vault list %s: %w", s.VaultURL, err)
+		}
+		for _, it := range page.Value {
+			if it.Attributes.Enabled != nil && !*it.Attributes.Enabled {
+				continue
+			}
+			names = append(names, path.Base(it.ID))
+		}
+		// トークンを別のホストへ送らない
+		if page.NextLink != "" && !strings.HasPrefix(page.NextLink, s.VaultURL+"/") {
+			return nil, fmt.Errorf("key vault list %s: unexpected nextLink %s", s.VaultURL, page.NextLink)
+		}
+		u = page.NextLink
+	}
+	return names, nil
+}
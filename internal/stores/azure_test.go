@@ -0,0 +1,152 @@
+package stores
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+type fakeKVSecret struct {
+	enabled bool
+	// version -> value、"" は現在のバージョン
+	versions map[string]string
+}
+
+// fakeKeyVault は Entra ID のトークンエンドポイントと Key Vault の
+// シークレット list / get だけを返す
+type fakeKeyVault struct {
+	url       string
+	assertion string
+	secret    string
+	secrets   map[string]fakeKVSecret
+	order     []string
+}
+
+func (f *fakeKeyVault) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	write := func(code int, v any) {
+		w.Header().Set("Content-Type", "application/json")
+		w.WriteHeader(code)
+		_ = json.NewEncoder(w).Encode(v)
+	}
+	switch {
+	case r.URL.Path == "/tenant1/oauth2/v2.0/token":
+		_ = r.ParseForm()
+		ok := r.Form.Get("grant_type") == "client_credentials" &&
+			r.Form.Get("client_id") == "client1" &&
+			r.Form.Get("scope") == "https://vault.azure.net/.default"
+		if r.Form.Has("client_assertion") {
+			ok = ok && r.Form.Get("client_assertion_type") == "urn:ietf:params:oauth:client-assertion-type:jwt-bearer" &&
+				r.Form.Get("client_assertion") == f.assertion
+		} else {
+			ok = ok && f.secret != "" && r.Form.Get("client_secret") == f.secret
+		}
+		if !ok {
+			write(http.StatusUnauthorized, map[string]string{"error": "invalid_client"})
+			return
+		}
+		write(http.StatusOK, map[string]any{"token_type": "Bearer", "access_token": "kv-token", "expires_in": 3599})
+
+	case strings.HasPrefix(r.URL.Path, "/secrets"):
+		if r.Header.Get("Authorization") != "Bearer kv-token" || r.URL.Query().Get("api-version") != azureKeyVaultAPIVersion {
+			write(http.StatusUnauthorized, map[string]any{"error": map[string]string{"code": "Unauthorized"}})
+			return
+		}
+		parts := strings.Split(strings.Trim(strings.TrimPrefix(r.URL.Path, "/secrets"), "/"), "/")
+		if parts[0] == "" {
+			// 1 件ずつページを分けて nextLink をたどらせる
+			start := 0
+			if s := r.URL.Query().Get("skip"); s != "" {
+				start = len(s)
+			}
+			res := map[string]any{"value": []any{}}
+			if start < len(f.order) {
+				name := f.order[start]
+				res["value"] = []any{map[string]any{
+					"id":         f.url + "/secrets/" + name,
+					"attributes": map[string]any{"enabled": f.secrets[name].enabled},
+				}}
+				if start+1 < len(f.order) {
+					res["nextLink"] = f.url + "/secrets?api-version=" + azureKeyVaultAPIVersion + "&skip=" + strings.Repeat("x", start+1)
+				}
+			}
+			write(http.StatusOK, res)
+			return
+		}
+		version := ""
+		if len(parts) > 1 {
+			version = parts[1]
+		}
+		v, ok := f.secrets[parts[0]].versions[version]
+		if !ok {
+			write(http.StatusNotFound, map[string]any{"error": map[string]string{"code": "SecretNotFound"}})
+			return
+		}
+		write(http.StatusOK, map[string]any{"id": f.url + "/secrets/" + parts[0] + "/v", "value": v})
+
+	default:
+		http.NotFound(w, r)
+	}
+}
+
+func TestAzureKeyVaultStore(t *testing.T) {
+	r := require.New(t)
+	ctx := context.Background()
+	fake := &fakeKeyVault{
+		assertion: "federated-jwt",
+		secrets: map[string]fakeKVSecret{
+			"db-password": {enabled: true, versions: map[string]string{"": "s3cret", "v1": "old"}},
+			"api-key":     {enabled: true, versions: map[string]string{"": "k-123"}},
+			"retired":     {enabled: false, versions: map[string]string{"": "x"}},
+		},
+		order: []string{"api-key", "db-password", "retired"},
+	}
+	srv := httptest.NewServer(fake)
+	defer srv.Close()
+	fake.url = srv.URL
+
+	tokenFile := filepath.Join(t.TempDir(), "azure-identity-token")
+	r.NoError(os.WriteFile(tokenFile, []byte("federated-jwt\n"), 0o600))
+	// ワークロード ID の Webhook が注入する環境変数
+	t.Setenv("AZURE_TENANT_ID", "tenant1")
+	t.Setenv("AZURE_CLIENT_ID", "client1")
+	t.Setenv("AZURE_FEDERATED_TOKEN_FILE", tokenFile)
+	t.Setenv("AZURE_CLIENT_SECRET", "")
+	t.Setenv("AZURE_AUTHORITY_HOST", srv.URL)
+
+	defaults := map[string]any{"vault_url": srv.URL + "/"}
+
+	data, err := openStore(t, "azure-keyvault", defaults, nil).Read(ctx)
+	r.NoError(err)
+	r.Equal(map[string]any{"api-key": "k-123", "db-password": "s3cret"}, data)
+
+	data, err = openStore(t, "azure-keyvault", defaults, map[string]any{
+		"secrets":  []any{"db-password", "api-key"},
+		"versions": map[string]any{"db-password": "v1"},
+	}).Read(ctx)
+	r.NoError(err)
+	r.Equal(map[string]any{"api-key": "k-123", "db-password": "old"}, data)
+
+	_, err = openStore(t, "azure-keyvault", defaults, map[string]any{"secrets": []any{"missing"}}).Read(ctx)
+	r.ErrorIs(err, ErrNotFound)
+
+	// クライアントシークレットでも取れる
+	fake.secret = "pw"
+	data, err = openStore(t, "azure-keyvault", defaults, map[string]any{"token_file": "", "client_secret": "pw", "secrets": []any{"api-key"}}).Read(ctx)
+	r.NoError(err)
+	r.Equal(map[string]any{"api-key": "k-123"}, data)
+
+	r.NoError(os.WriteFile(tokenFile, []byte("other-jwt"), 0o600))
+	_, err = openStore(t, "azure-keyvault", defaults, nil).Read(ctx)
+	r.ErrorContains(err, "invalid_client")
+
+	t.Setenv("AZURE_FEDERATED_TOKEN_FILE", "")
+	_, err = Open(StoreConfig{Type: "azure-keyvault", Args: map[string]any{"vault_url": srv.URL}})
+	r.Error(err)
+}
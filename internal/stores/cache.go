@@ -0,0 +1,320 @@
+package stores
+
+import (
+	"bytes"
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"maps"
+	"sort"
+	"sync"
+	"time"
+
+	"golang.org/x/sync/singleflight"
+)
+
+// Cache results reported to CachedStore.Observe.
+const (
+	CacheHit   = "hit"
+	CacheMiss  = "miss"
+	CacheStale = "stale"
+)
+
+// CacheEntry is the last successful Read of a store.
+type CacheEntry struct {
+	Key       string         `json:"key"`
+	Name      string         `json:"name"`
+	Type      string         `json:"type"`
+	Data      map[string]any `json:"data"`
+	FetchedAt time.Time      `json:"fetched_at"`
+}
+
+// Cache stores entries by key. Get returns nil, nil for a missing entry.
+type Cache interface {
+	Get(key string) (*CacheEntry, error)
+	Put(e *CacheEntry) error
+	Delete(key string) error
+	List() ([]*CacheEntry, error)
+}
+
+// MemoryCache keeps entries for the life of the process.
+type MemoryCache struct {
+	mu      sync.Mutex
+	entries map[string]*CacheEntry
+}
+
+// DefaultMemoryCache is shared by every store configured with backend "memory".
+var DefaultMemoryCache = NewMemoryCache()
+
+func NewMemoryCache() *MemoryCache {
+	return &MemoryCache{entries: map[string]*CacheEntry{}}
+}
+
+func (c *MemoryCache) Get(key string) (*CacheEntry, error) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.entries[key], nil
+}
+
+func (c *MemoryCache) Put(e *CacheEntry) error {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.entries[e.Key] = e
+	return nil
+}
+
+func (c *MemoryCache) Delete(key string) error {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	delete(c.entries, key)
+	return nil
+}
+
+func (c *MemoryCache) List() ([]*CacheEntry, error) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	out := make([]*CacheEntry, 0, len(c.entries))
+	for _, e := range c.entries {
+		out = append(out, e)
+	}
+	sort.Slice(out, func(i, j int) bool { return out[i].Name < out[j].Name })
+	return out, nil
+}
+
+// 同じストアへの同時取得を1回にまとめる（キーは CacheKey）
+var flight singleflight.Group
+
+// timeout 引数の無いストアの取得の上限
+const defaultFetchTimeout = 30 * time.Second
+
+// CachedStore serves Read from Cache while the entry is younger than TTL,
+// and falls back to an expired entry for StaleIfError when the store fails.
+type CachedStore struct {
+	Inner Store
+	Cache Cache
+
+	Key  string
+	Name string
+	Type string
+
+	TTL          time.Duration
+	StaleIfError time.Duration
+	// 取得の上限。呼び出し元が諦めても取得は続くので、それとは別に区切る
+	Timeout time.Duration
+
+	// nil でなければ Read ごとに CacheHit / CacheMiss / CacheStale を渡す
+	Observe func(result string)
+
+	now func() time.Time
+}
+
+// CacheKey identifies a store by its type, args and, when st is an
+// Identifier, its resolved location, so renaming a store in the config keeps
+// its cache while the same args read from another directory or environment
+// (a relative path, VAULT_ADDR, AWS_PROFILE, ...) get their own entry.
+func CacheKey(cfg StoreConfig, st Store) string {
+	var id map[string]any
+	if i, ok := st.(Identifier); ok {
+		id = i.Identity()
+	}
+	b, _ := json.Marshal(struct {
+		Type     string         `json:"type"`
+		Args     map[string]any `json:"args"`
+		Identity map[string]any `json:"identity,omitempty"`
+	}{cfg.Type, cfg.Args, id})
+	sum := sha256.Sum256(b)
+	return hex.EncodeToString(sum[:16])
+}
+
+func openCached(inner Store, cfg StoreConfig) (Store, error) {
+	var cache Cache
+	switch cfg.Cache.Backend {
+	case "", "disk":
+		dc, err := DefaultDiskCache()
+		if err != nil {
+			return nil, err
+		}
+		cache = dc
+	case "memory":
+		cache = DefaultMemoryCache
+	default:
+		return nil, fmt.Errorf("unknown cache backend %q (want disk or memory)", cfg.Cache.Backend)
+	}
+	return NewCachedStore(inner, cache, cfg), nil
+}
+
+// NewCachedStore wraps inner. The result keeps inner's optional Writer and
+// Watcher capabilities; writes and watch notifications drop the entry.
+func NewCachedStore(inner Store, cache Cache, cfg StoreConfig) Store {
+	c := &CachedStore{
+		Inner: inner,
+		Cache: cache,
+		Key:   CacheKey(cfg, inner),
+		Name:  cfg.Name,
+		Type:  cfg.Type,
+	}
+	if cfg.Cache != nil {
+		c.TTL = time.Duration(cfg.Cache.TTL)
+		c.StaleIfError = time.Duration(cfg.Cache.StaleIfError)
+	}
+	// ストアの timeout 引数に合わせる（不正な値はストア側がエラーにする）
+	if t, err := argDuration(cfg.Args, "timeout", defaultFetchTimeout); err == nil {
+		c.Timeout = t
+	} else {
+		c.Timeout = defaultFetchTimeout
+	}
+
+	_, w := inner.(Writer)
+	_, wa := inner.(Watcher)
+	switch {
+	case w && wa:
+		return cachedWriteWatcher{c}
+	case w:
+		return cachedWriter{c}
+	case wa:
+		return cachedWatcher{c}
+	default:
+		return c
+	}
+}
+
+// CacheOf returns the CachedStore behind st, or nil if st is not cached.
+func CacheOf(st Store) *CachedStore {
+	switch x := st.(type) {
+	case *CachedStore:
+		return x
+	case cachedWriter:
+		return x.CachedStore
+	case cachedWatcher:
+		return x.CachedStore
+	case cachedWriteWatcher:
+		return x.CachedStore
+	}
+	return nil
+}
+
+// Uncached returns the store behind a cache, for reads that must be fresh
+// (e.g. read-modify-write).
+func Uncached(st Store) Store {
+	if c := CacheOf(st); c != nil {
+		return c.Inner
+	}
+	return st
+}
+
+func (c *CachedStore) Read(ctx context.Context) (map[string]any, error) {
+	now := time.Now
+	if c.now != nil {
+		now = c.now
+	}
+
+	// 壊れた・復号できないエントリは無いものとして扱う
+	e, _ := c.Cache.Get(c.Key)
+	var age time.Duration
+	if e != nil {
+		age = now().Sub(e.FetchedAt)
+		if age < c.TTL {
+			c.observe(CacheHit)
+			return maps.Clone(e.Data), nil
+		}
+	}
+
+	ch := flight.DoChan(c.Key, func() (any, error) {
+		// 取得は待っている全員のものなので、最初の呼び出し元のキャンセルでは止めない
+		ctx := context.WithoutCancel(ctx)
+		if c.Timeout > 0 {
+			var cancel context.CancelFunc
+			ctx, cancel = context.WithTimeout(ctx, c.Timeout)
+			defer cancel()
+		}
+		data, err := c.Inner.Read(ctx)
+		if err != nil {
+			return nil, err
+		}
+		data = normalize(data)
+		// 保存に失敗しても値は返す（次回また取りに行くだけ）
+		_ = c.Cache.Put(&CacheEntry{Key: c.Key, Name: c.Name, Type: c.Type, Data: data, FetchedAt: now()})
+		return data, nil
+	})
+	// 各呼び出し元は自分の ctx で待つのをやめられる
+	var res singleflight.Result
+	select {
+	case <-ctx.Done():
+		return nil, ctx.Err()
+	case res = <-ch:
+	}
+	if err := res.Err; err != nil {
+		if e != nil && !errors.Is(err, ErrNotFound) && age < c.TTL+c.StaleIfError {
+			c.observe(CacheStale)
+			return maps.Clone(e.Data), nil
+		}
+		return nil, err
+	}
+	c.observe(CacheMiss)
+	return maps.Clone(res.Val.(map[string]any)), nil
+}
+
+// normalize はディスクキャッシュから読んだ時と同じ形（数値は json.Number）にそろえる。
+// キャッシュの当たり外れで値の型が変わらないように、取得した値もこの形で返す
+func normalize(data map[string]any) map[string]any {
+	b, err := json.Marshal(data)
+	if err != nil {
+		// JSON にできない値はディスクにも保存できないので、そのまま返す
+		return data
+	}
+	dec := json.NewDecoder(bytes.NewReader(b))
+	dec.UseNumber()
+	var out map[string]any
+	if err := dec.Decode(&out); err != nil {
+		return data
+	}
+	return out
+}
+
+func (c *CachedStore) Probe(ctx context.Context) error {
+	return Probe(ctx, c.Inner)
+}
+
+func (c *CachedStore) observe(result string) {
+	if c.Observe != nil {
+		c.Observe(result)
+	}
+}
+
+func (c *CachedStore) write(ctx context.Context, data map[string]any) error {
+	err := c.Inner.(Writer).Write(ctx, data)
+	_ = c.Cache.Delete(c.Key)
+	return err
+}
+
+func (c *CachedStore) watch(ctx context.Context, changed func()) error {
+	return c.Inner.(Watcher).Watch(ctx, func() {
+		_ = c.Cache.Delete(c.Key)
+		changed()
+	})
+}
+
+type cachedWriter struct{ *CachedStore }
+
+func (c cachedWriter) Write(ctx context.Context, data map[string]any) error {
+	return c.write(ctx, data)
+}
+
+type cachedWatcher struct{ *CachedStore }
+
+func (c cachedWatcher) Watch(ctx context.Context, changed func()) error {
+	return c.watch(ctx, changed)
+}
+
+type cachedWriteWatcher struct{ *CachedStore }
+
+func (c cachedWriteWatcher) Write(ctx context.Context, data map[string]any) error {
+	return c.write(ctx, data)
+}
+
+func (c cachedWriteWatcher) Watch(ctx context.Context, changed func()) error {
+	return c.watch(ctx, changed)
+}
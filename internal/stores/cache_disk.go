@@ -0,0 +1,207 @@
+package stores
+
+import (
+	"bytes"
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/rand"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+
+	"github.com/sasano8/kvtool/internal/fsutil"
+)
+
+// DiskCache keeps entries as AES-256-GCM encrypted files, one per store.
+//
+// The key lives in KeyFile, outside Dir by default, so a copied or backed up
+// cache directory alone does not reveal the values.
+type DiskCache struct {
+	Dir     string
+	KeyFile string
+
+	once sync.Once
+	aead cipher.AEAD
+	err  error
+}
+
+const cacheFileExt = ".cache"
+
+// DefaultDiskCache uses $KVTOOL_CACHE_DIR (default <user cache dir>/kvtool)
+// and $KVTOOL_CACHE_KEY_FILE (default <user config dir>/kvtool/cache.key).
+func DefaultDiskCache() (*DiskCache, error) {
+	dir := os.Getenv("KVTOOL_CACHE_DIR")
+	if dir == "" {
+		base, err := os.UserCacheDir()
+		if err != nil {
+			return nil, fmt.Errorf("cache dir: %w", err)
+		}
+		dir = filepath.Join(base, "kvtool")
+	}
+	keyFile := os.Getenv("KVTOOL_CACHE_KEY_FILE")
+	if keyFile == "" {
+		base, err := os.UserConfigDir()
+		if err != nil {
+			return nil, fmt.Errorf("cache key: %w", err)
+		}
+		keyFile = filepath.Join(base, "kvtool", "cache.key")
+	}
+	return &DiskCache{Dir: dir, KeyFile: keyFile}, nil
+}
+
+// cipher は鍵ファイルを読む。無ければ作る。
+func (c *DiskCache) cipher() (cipher.AEAD, error) {
+	c.once.Do(func() {
+		key, err := loadOrCreateKey(c.KeyFile)
+		if err != nil {
+			c.err = err
+			return
+		}
+		block, err := aes.NewCipher(key)
+		if err != nil {
+			c.err = err
+			return
+		}
+		c.aead, c.err = cipher.NewGCM(block)
+	})
+	return c.aead, c.err
+}
+
+func loadOrCreateKey(path string) ([]byte, error) {
+	b, err := os.ReadFile(path)
+	if err == nil {
+		key, err := hex.DecodeString(strings.TrimSpace(string(b)))
+		if err != nil || len(key) != 32 {
+			return nil, fmt.Errorf("cache key %s: want 32 hex-encoded bytes", path)
+		}
+		return key, nil
+	}
+	if !errors.Is(err, os.ErrNotExist) {
+		return nil, fmt.Errorf("cache key: %w", err)
+	}
+
+	key := make([]byte, 32)
+	if _, err := rand.Read(key); err != nil {
+		return nil, err
+	}
+	if err := os.MkdirAll(filepath.Dir(path), 0o700); err != nil {
+		return nil, fmt.Errorf("cache key: %w", err)
+	}
+	// 同時に作られた場合は先に作った方を使う
+	f, err := os.OpenFile(path, os.O_WRONLY|os.O_CREATE|os.O_EXCL, 0o600)
+	if errors.Is(err, os.ErrExist) {
+		return loadOrCreateKey(path)
+	} else if err != nil {
+		return nil, fmt.Errorf("cache key: %w", err)
+	}
+	defer f.Close()
+	if _, err := f.WriteString(hex.EncodeToString(key) + "\n"); err != nil {
+		return nil, fmt.Errorf("cache key: %w", err)
+	}
+	return key, nil
+}
+
+func (c *DiskCache) path(key string) string {
+	return filepath.Join(c.Dir, key+cacheFileExt)
+}
+
+func (c *DiskCache) Get(key string) (*CacheEntry, error) {
+	b, err := os.ReadFile(c.path(key))
+	if errors.Is(err, os.ErrNotExist) {
+		return nil, nil
+	} else if err != nil {
+		return nil, err
+	}
+	return c.decrypt(key, b)
+}
+
+func (c *DiskCache) Put(e *CacheEntry) error {
+	aead, err := c.cipher()
+	if err != nil {
+		return err
+	}
+	plain, err := json.Marshal(e)
+	if err != nil {
+		return err
+	}
+	nonce := make([]byte, aead.NonceSize())
+	if _, err := rand.Read(nonce); err != nil {
+		return err
+	}
+	// キーを AAD にして、別のストアのファイルと入れ替えられないようにする
+	b := aead.Seal(nonce, nonce, plain, []byte(e.Key))
+
+	if err := os.MkdirAll(c.Dir, 0o700); err != nil {
+		return err
+	}
+	return fsutil.WriteFileAtomic(c.path(e.Key), b, 0o600)
+}
+
+func (c *DiskCache) Delete(key string) error {
+	err := os.Remove(c.path(key))
+	if errors.Is(err, os.ErrNotExist) {
+		return nil
+	}
+	return err
+}
+
+// List returns the entries sorted by name. Files that cannot be decrypted
+// (e.g. written with another key) are listed with only their key.
+func (c *DiskCache) List() ([]*CacheEntry, error) {
+	files, err := os.ReadDir(c.Dir)
+	if errors.Is(err, os.ErrNotExist) {
+		return nil, nil
+	} else if err != nil {
+		return nil, err
+	}
+
+	var out []*CacheEntry
+	for _, f := range files {
+		key, ok := strings.CutSuffix(f.Name(), cacheFileExt)
+		if !ok || f.IsDir() {
+			continue
+		}
+		e, err := c.Get(key)
+		if err != nil || e == nil {
+			e = &CacheEntry{Key: key}
+		}
+		out = append(out, e)
+	}
+	sort.Slice(out, func(i, j int) bool {
+		if out[i].Name != out[j].Name {
+			return out[i].Name < out[j].Name
+		}
+		return out[i].Key < out[j].Key
+	})
+	return out, nil
+}
+
+func (c *DiskCache) decrypt(key string, b []byte) (*CacheEntry, error) {
+	aead, err := c.cipher()
+	if err != nil {
+		return nil, err
+	}
+	n := aead.NonceSize()
+	if len(b) < n {
+		return nil, fmt.Errorf("cache entry %s: truncated", key)
+	}
+	plain, err := aead.Open(nil, b[:n], b[n:], []byte(key))
+	if err != nil {
+		return nil, fmt.Errorf("cache entry %s: %w", key, err)
+	}
+
+	dec := json.NewDecoder(bytes.NewReader(plain))
+	// 数値を float64 に丸めない
+	dec.UseNumber()
+	var e CacheEntry
+	if err := dec.Decode(&e); err != nil {
+		return nil, fmt.Errorf("cache entry %s: %w", key, err)
+	}
+	return &e, nil
+}
@@ -0,0 +1,294 @@
+package stores
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+)
+
+type fakeStore struct {
+	reads atomic.Int32
+	err   error
+	data  map[string]any
+	// nil でなければ Read をここで止める
+	block chan struct{}
+	// 止めた後の ctx.Err()
+	ctxErr atomic.Value
+}
+
+func (s *fakeStore) Read(ctx context.Context) (map[string]any, error) {
+	s.reads.Add(1)
+	if s.block != nil {
+		<-s.block
+		s.ctxErr.Store(fmt.Sprint(ctx.Err()))
+	}
+	return s.data, s.err
+}
+
+type fakeWriter struct{ fakeStore }
+
+func (s *fakeWriter) Write(ctx context.Context, data map[string]any) error {
+	s.data = data
+	return nil
+}
+
+func TestCachedStore(t *testing.T) {
+	r := require.New(t)
+	ctx := context.Background()
+
+	inner := &fakeStore{data: map[string]any{"A": "1"}}
+	cfg := StoreConfig{Type: "fake", Name: "default/fake", Cache: &CacheConfig{
+		TTL:          Duration(time.Minute),
+		StaleIfError: Duration(time.Hour),
+	}}
+	st := NewCachedStore(inner, NewMemoryCache(), cfg)
+	c := CacheOf(st)
+	r.NotNil(c)
+	var results []string
+	c.Observe = func(res string) { results = append(results, res) }
+	now := time.Now()
+	c.now = func() time.Time { return now }
+
+	for range 3 {
+		data, err := st.Read(ctx)
+		r.NoError(err)
+		r.Equal(map[string]any{"A": "1"}, data)
+	}
+	r.EqualValues(1, inner.reads.Load())
+
+	// TTL 切れ: 取りに行く
+	now = now.Add(2 * time.Minute)
+	inner.data = map[string]any{"A": "2"}
+	data, err := st.Read(ctx)
+	r.NoError(err)
+	r.Equal("2", data["A"])
+
+	// 失敗しても stale_if_error の間は古い値
+	now = now.Add(30 * time.Minute)
+	inner.err = errors.New("vault down")
+	data, err = st.Read(ctx)
+	r.NoError(err)
+	r.Equal("2", data["A"])
+
+	// stale_if_error も過ぎたらエラー
+	now = now.Add(2 * time.Hour)
+	_, err = st.Read(ctx)
+	r.ErrorContains(err, "vault down")
+
+	// not found は古い値で隠さない
+	inner.err = ErrNotFound
+	_, err = st.Read(ctx)
+	r.ErrorIs(err, ErrNotFound)
+
+	r.Equal([]string{CacheMiss, CacheHit, CacheHit, CacheMiss, CacheStale}, results)
+
+	// 返した map を書き換えてもキャッシュは変わらない
+	inner.err = nil
+	data, err = st.Read(ctx)
+	r.NoError(err)
+	data["A"] = "mutated"
+	data, err = st.Read(ctx)
+	r.NoError(err)
+	r.Equal("2", data["A"])
+}
+
+func TestCachedStoreSingleflight(t *testing.T) {
+	r := require.New(t)
+	inner := &fakeStore{data: map[string]any{"A": "1"}, block: make(chan struct{})}
+	st := NewCachedStore(inner, NewMemoryCache(), StoreConfig{Type: "fake", Args: map[string]any{"t": t.Name()}, Cache: &CacheConfig{TTL: Duration(time.Hour)}})
+
+	var wg sync.WaitGroup
+	for range 10 {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			data, err := st.Read(context.Background())
+			r.NoError(err)
+			r.Equal("1", data["A"])
+		}()
+	}
+	// 全員が flight に入るまで待ってから離す
+	r.Eventually(func() bool { return inner.reads.Load() == 1 }, time.Second, time.Millisecond)
+	time.Sleep(50 * time.Millisecond)
+	close(inner.block)
+	wg.Wait()
+	r.EqualValues(1, inner.reads.Load())
+}
+
+func TestCachedStoreCallerCancel(t *testing.T) {
+	r := require.New(t)
+	inner := &fakeStore{data: map[string]any{"A": "1"}, block: make(chan struct{})}
+	st := NewCachedStore(inner, NewMemoryCache(), StoreConfig{Type: "fake", Args: map[string]any{"t": t.Name(), "timeout": "1m"}, Cache: &CacheConfig{TTL: Duration(time.Hour)}})
+	r.Equal(time.Minute, CacheOf(st).Timeout)
+
+	// 最初の呼び出し元が諦めても、後から来た呼び出し元は値を受け取れる
+	ctx, cancel := context.WithCancel(context.Background())
+	first := make(chan error, 1)
+	go func() {
+		_, err := st.Read(ctx)
+		first <- err
+	}()
+	r.Eventually(func() bool { return inner.reads.Load() == 1 }, time.Second, time.Millisecond)
+	second := make(chan map[string]any, 1)
+	go func() {
+		data, _ := st.Read(context.Background())
+		second <- data
+	}()
+
+	cancel()
+	r.ErrorIs(<-first, context.Canceled)
+	close(inner.block)
+	r.Equal("1", (<-second)["A"])
+	r.Equal("<nil>", inner.ctxErr.Load())
+	r.EqualValues(1, inner.reads.Load())
+}
+
+func TestCachedStoreNumbers(t *testing.T) {
+	r := require.New(t)
+	dir := t.TempDir()
+	cache := &DiskCache{Dir: filepath.Join(dir, "cache"), KeyFile: filepath.Join(dir, "cache.key")}
+	inner := &fakeStore{data: map[string]any{"N": 3.0, "BIG": json.Number("12345678901234567890"), "M": map[string]any{"X": 1}}}
+	st := NewCachedStore(inner, cache, StoreConfig{Type: "fake", Cache: &CacheConfig{TTL: Duration(time.Hour)}})
+
+	// 取得した時（miss）とディスクから読んだ時（hit）で同じ型になる
+	miss, err := st.Read(context.Background())
+	r.NoError(err)
+	hit, err := st.Read(context.Background())
+	r.NoError(err)
+	r.EqualValues(1, inner.reads.Load())
+	r.Equal(miss, hit)
+	r.Equal(json.Number("3"), hit["N"])
+	r.Equal(json.Number("12345678901234567890"), hit["BIG"])
+	r.Equal(map[string]any{"X": json.Number("1")}, hit["M"])
+}
+
+func TestCacheKey(t *testing.T) {
+	r := require.New(t)
+	wd, err := os.Getwd()
+	r.NoError(err)
+	t.Cleanup(func() { _ = os.Chdir(wd) })
+
+	// 同じ相対パスの .env でも作業ディレクトリが違えば別のキー
+	cfg := StoreConfig{Type: ".env", Args: map[string]any{"input": ".env"}}
+	keyIn := func(dir string) string {
+		r.NoError(os.Chdir(dir))
+		st, err := Open(cfg)
+		r.NoError(err)
+		return CacheKey(cfg, st)
+	}
+	dirA, dirB := t.TempDir(), t.TempDir()
+	a := keyIn(dirA)
+	r.NotEqual(a, keyIn(dirB))
+	r.Equal(a, keyIn(dirA))
+
+	// 環境変数で決まる接続先も区別する
+	vault := StoreConfig{Type: "vault", Args: map[string]any{"path": "app"}}
+	st, err := Open(vault)
+	r.NoError(err)
+	t.Setenv("VAULT_ADDR", "https://vault-a:8200")
+	a = CacheKey(vault, st)
+	t.Setenv("VAULT_ADDR", "https://vault-b:8200")
+	r.NotEqual(a, CacheKey(vault, st))
+}
+
+func TestCachedStoreWriter(t *testing.T) {
+	r := require.New(t)
+	ctx := context.Background()
+
+	ro := NewCachedStore(&fakeStore{}, NewMemoryCache(), StoreConfig{Cache: &CacheConfig{}})
+	_, ok := ro.(Writer)
+	r.False(ok)
+	_, ok = ro.(Watcher)
+	r.False(ok)
+
+	inner := &fakeWriter{fakeStore{data: map[string]any{"A": "1"}}}
+	st := NewCachedStore(inner, NewMemoryCache(), StoreConfig{Cache: &CacheConfig{TTL: Duration(time.Hour)}})
+	w, ok := st.(Writer)
+	r.True(ok)
+	r.Same(inner, Uncached(st))
+
+	_, err := st.Read(ctx)
+	r.NoError(err)
+	r.NoError(w.Write(ctx, map[string]any{"A": "2"}))
+	data, err := st.Read(ctx)
+	r.NoError(err)
+	r.Equal("2", data["A"])
+	r.EqualValues(2, inner.reads.Load())
+}
+
+func TestDiskCache(t *testing.T) {
+	r := require.New(t)
+	dir := t.TempDir()
+	c := &DiskCache{Dir: filepath.Join(dir, "cache"), KeyFile: filepath.Join(dir, "config", "cache.key")}
+
+	e := &CacheEntry{Key: "k1", Name: "default/vault", Type: "vault", Data: map[string]any{"PASSWORD": "hunter2"}, FetchedAt: time.Now().UTC()}
+	r.NoError(c.Put(e))
+
+	b, err := os.ReadFile(filepath.Join(c.Dir, "k1.cache"))
+	r.NoError(err)
+	r.NotContains(string(b), "hunter2")
+	r.NotContains(string(b), "PASSWORD")
+	fi, err := os.Stat(c.KeyFile)
+	r.NoError(err)
+	r.Equal(os.FileMode(0o600), fi.Mode().Perm())
+
+	got, err := c.Get("k1")
+	r.NoError(err)
+	r.Equal("hunter2", got.Data["PASSWORD"])
+	r.True(e.FetchedAt.Equal(got.FetchedAt))
+
+	missing, err := c.Get("nope")
+	r.NoError(err)
+	r.Nil(missing)
+
+	// 別のキーのファイルに差し替えても復号できない
+	r.NoError(os.WriteFile(filepath.Join(c.Dir, "k2.cache"), b, 0o600))
+	_, err = c.Get("k2")
+	r.Error(err)
+
+	list, err := c.List()
+	r.NoError(err)
+	r.Len(list, 2)
+	r.Equal("k2", list[0].Key) // 読めないエントリは名前が空
+	r.Equal("default/vault", list[1].Name)
+
+	// 鍵が変わると読めない
+	other := &DiskCache{Dir: c.Dir, KeyFile: filepath.Join(dir, "other.key")}
+	_, err = other.Get("k1")
+	r.Error(err)
+
+	r.NoError(c.Delete("k1"))
+	r.NoError(c.Delete("k1"))
+	got, err = c.Get("k1")
+	r.NoError(err)
+	r.Nil(got)
+}
+
+func TestCacheConfigJSON(t *testing.T) {
+	r := require.New(t)
+	path := filepath.Join(t.TempDir(), "kvtool.json")
+	r.NoError(os.WriteFile(path, []byte(`{"namespaces":{"default":{"vault":{
+		"type":"vault","args":{"path":"app"},
+		"cache":{"ttl":"5m","stale_if_error":86400,"backend":"memory"}}}}}`), 0o644))
+
+	cfg, err := LoadConfig(path)
+	r.NoError(err)
+	_, sc, err := cfg.Lookup("default", "")
+	r.NoError(err)
+	r.Equal("default/vault", sc.Name)
+	r.Equal(Duration(5*time.Minute), sc.Cache.TTL)
+	r.Equal(Duration(24*time.Hour), sc.Cache.StaleIfError)
+
+	st, err := Open(sc)
+	r.NoError(err)
+	r.NotNil(CacheOf(st))
+}
@@ -0,0 +1,127 @@
+package stores
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"os"
+	"os/exec"
+	"strings"
+	"time"
+
+	"github.com/sasano8/kvtool/internal/convert"
+)
+
+func init() {
+	Register("command", newCommandStore)
+}
+
+// CommandStore runs a credential helper (pass, op, an internal CLI, ...)
+// and parses what it prints. The command is an argv and never goes through
+// a shell. Set "cache" in the store config to avoid running it on every read.
+type CommandStore struct {
+	Command []string
+	// 追加の環境変数。os.Environ に上書きする
+	Env     map[string]string
+	Dir     string
+	Timeout time.Duration
+	// json | dotenv | raw
+	Format string
+	// raw のときの値のキー
+	Key string
+}
+
+func newCommandStore(args map[string]any) (Store, error) {
+	var (
+		s   CommandStore
+		err error
+	)
+	if s.Command, err = argStrings(args, "command"); err != nil {
+		return nil, err
+	}
+	if len(s.Command) == 0 || s.Command[0] == "" {
+		return nil, errors.New(`arg "command" is required (an argv list, e.g. ["pass", "show", "app/db"])`)
+	}
+	if s.Env, err = argStringMap(args, "env"); err != nil {
+		return nil, err
+	}
+	if s.Dir, err = argString(args, "dir", ""); err != nil {
+		return nil, err
+	}
+	if s.Timeout, err = argDuration(args, "timeout", 30*time.Second); err != nil {
+		return nil, err
+	}
+	if s.Format, err = argString(args, "format", "json"); err != nil {
+		return nil, err
+	}
+	if s.Key, err = argString(args, "key", "value"); err != nil {
+		return nil, err
+	}
+	switch s.Format {
+	case "json", "dotenv", "raw":
+	default:
+		return nil, fmt.Errorf("arg %q: unknown format %q (want json, dotenv or raw)", "format", s.Format)
+	}
+	return &s, nil
+}
+
+// stderr をエラーに載せるときの上限
+const commandStderrMax = 4 << 10
+
+// Identity は実行するディレクトリ（dir が空なら作業ディレクトリ）
+func (s *CommandStore) Identity() map[string]any {
+	return map[string]any{"dir": absPath(s.Dir)}
+}
+
+func (s *CommandStore) Read(ctx context.Context) (map[string]any, error) {
+	if s.Timeout > 0 {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeout(ctx, s.Timeout)
+		defer cancel()
+	}
+
+	cmd := exec.CommandContext(ctx, s.Command[0], s.Command[1:]...)
+	cmd.Dir = s.Dir
+	cmd.Env = os.Environ()
+	for k, v := range s.Env {
+		cmd.Env = append(cmd.Env, k+"="+v)
+	}
+	var stdout, stderr bytes.Buffer
+	cmd.Stdout = &stdout
+	cmd.Stderr = &stderr
+	// 孫プロセスがパイプを握ったままでも待ち続けない
+	cmd.WaitDelay = time.Second
+
+	if err := cmd.Run(); err != nil {
+		name := s.Command[0]
+		if ctx.Err() != nil {
+			return nil, fmt.Errorf("command %s: %w", name, ctx.Err())
+		}
+		msg := strings.TrimSpace(stderr.String())
+		if len(msg) > commandStderrMax {
+			msg = msg[:commandStderrMax] + "..."
+		}
+		if msg == "" {
+			return nil, fmt.Errorf("command %s: %w", name, err)
+		}
+		return nil, fmt.Errorf("command %s: %w: %s", name, err, msg)
+	}
+
+	switch s.Format {
+	case "dotenv":
+		m, err := convert.ParseDotenv(&stdout)
+		if err != nil {
+			return nil, fmt.Errorf("command %s: parse dotenv: %w", s.Command[0], err)
+		}
+		return stringMap(m), nil
+	case "raw":
+		return map[string]any{s.Key: strings.TrimRight(stdout.String(), "\r\n")}, nil
+	default:
+		m, err := convert.ParseJSON(&stdout)
+		if err != nil {
+			return nil, fmt.Errorf("command %s: parse json: %w", s.Command[0], err)
+		}
+		return m, nil
+	}
+}
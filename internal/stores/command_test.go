@@ -0,0 +1,120 @@
+package stores
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+)
+
+// テストバイナリ自身を資格情報ヘルパーとして起動する
+func TestCommandHelper(t *testing.T) {
+	mode := os.Getenv("KVTOOL_TEST_HELPER")
+	if mode == "" {
+		t.Skip("helper process")
+	}
+	switch mode {
+	case "json":
+		fmt.Printf(`{"user": %q, "port": 5432}`, os.Getenv("HELPER_USER"))
+	case "nested":
+		fmt.Print(`{"db": {"password": "pw"}, "a/b": "flat"}`)
+	case "dotenv":
+		fmt.Println("A=1\nB=\"two words\"")
+	case "raw":
+		fmt.Println("s3cret")
+	case "fail":
+		fmt.Fprintln(os.Stderr, "item not found")
+		os.Exit(3)
+	case "count":
+		f, _ := os.OpenFile(os.Getenv("HELPER_COUNT"), os.O_APPEND|os.O_CREATE|os.O_WRONLY, 0o600)
+		fmt.Fprintln(f, "run")
+		f.Close()
+		fmt.Print(`{"A": "1"}`)
+	case "sleep":
+		time.Sleep(10 * time.Second)
+	}
+	os.Exit(0)
+}
+
+func helperStore(t *testing.T, mode string, args map[string]any) StoreConfig {
+	t.Helper()
+	env := map[string]any{"KVTOOL_TEST_HELPER": mode}
+	if e, ok := args["env"].(map[string]any); ok {
+		for k, v := range e {
+			env[k] = v
+		}
+	}
+	a := map[string]any{
+		"command": []any{os.Args[0], "-test.run=^TestCommandHelper$"},
+		"env":     env,
+	}
+	for k, v := range args {
+		if k != "env" {
+			a[k] = v
+		}
+	}
+	return StoreConfig{Type: "command", Name: "test/" + mode, Args: a}
+}
+
+func TestCommandStore(t *testing.T) {
+	r := require.New(t)
+	ctx := context.Background()
+
+	read := func(cfg StoreConfig) (map[string]any, error) {
+		st, err := Open(cfg)
+		r.NoError(err)
+		return st.Read(ctx)
+	}
+
+	data, err := read(helperStore(t, "json", map[string]any{"env": map[string]any{"HELPER_USER": "app"}}))
+	r.NoError(err)
+	r.Equal("app", data["user"])
+	r.Equal("5432", fmt.Sprint(data["port"]))
+
+	data, err = read(helperStore(t, "dotenv", map[string]any{"format": "dotenv"}))
+	r.NoError(err)
+	r.Equal(map[string]any{"A": "1", "B": "two words"}, data)
+
+	data, err = read(helperStore(t, "raw", map[string]any{"format": "raw", "key": "DB_PASSWORD"}))
+	r.NoError(err)
+	r.Equal(map[string]any{"DB_PASSWORD": "s3cret"}, data)
+
+	_, err = read(helperStore(t, "fail", nil))
+	r.ErrorContains(err, "exit status 3")
+	r.ErrorContains(err, "item not found")
+
+	_, err = read(helperStore(t, "sleep", map[string]any{"timeout": "200ms"}))
+	r.ErrorIs(err, context.DeadlineExceeded)
+
+	_, err = read(helperStore(t, "raw", nil))
+	r.ErrorContains(err, "parse json")
+
+	_, err = Open(StoreConfig{Type: "command"})
+	r.Error(err)
+	_, err = Open(helperStore(t, "raw", map[string]any{"format": "yaml"}))
+	r.Error(err)
+}
+
+func TestCommandStoreCache(t *testing.T) {
+	r := require.New(t)
+	ctx := context.Background()
+	count := filepath.Join(t.TempDir(), "count")
+
+	cfg := helperStore(t, "count", map[string]any{"env": map[string]any{"HELPER_COUNT": count}})
+	cfg.Cache = &CacheConfig{TTL: Duration(time.Hour), Backend: "memory"}
+	st, err := Open(cfg)
+	r.NoError(err)
+
+	for range 3 {
+		data, err := st.Read(ctx)
+		r.NoError(err)
+		r.Equal("1", data["A"])
+	}
+	b, err := os.ReadFile(count)
+	r.NoError(err)
+	r.Equal("run\n", string(b))
+}
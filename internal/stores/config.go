@@ -0,0 +1,160 @@
+package stores
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"time"
+
+	repository "github.com/sasano8/kvtool/internal/core/repositories"
+)
+
+type Config struct {
+	Version    float64                           `json:"version"`
+	Namespaces map[string]map[string]StoreConfig `json:"namespaces"`
+}
+
+type StoreConfig struct {
+	Type  string         `json:"type"`
+	Args  map[string]any `json:"args"`
+	Cache *CacheConfig   `json:"cache,omitempty"`
+
+	// Lookup が "<namespace>/<store>" を入れる（キャッシュの表示名）
+	Name string `json:"-"`
+}
+
+// CacheConfig turns on the caching decorator for a store.
+type CacheConfig struct {
+	// この間はストアに問い合わせずキャッシュを返す
+	TTL Duration `json:"ttl"`
+	// 取得に失敗したとき、TTL 切れからこの間は古い値を返す
+	StaleIfError Duration `json:"stale_if_error"`
+	// "disk"（既定、暗号化して保存）または "memory"
+	Backend string `json:"backend,omitempty"`
+}
+
+// Duration is a time.Duration written as "5m" or as seconds in JSON.
+type Duration time.Duration
+
+func (d *Duration) UnmarshalJSON(b []byte) error {
+	var v any
+	if err := json.Unmarshal(b, &v); err != nil {
+		return err
+	}
+	x, err := argDuration(map[string]any{"duration": v}, "duration", 0)
+	if err != nil {
+		return err
+	}
+	*d = Duration(x)
+	return nil
+}
+
+func (d Duration) MarshalJSON() ([]byte, error) {
+	return json.Marshal(time.Duration(d).String())
+}
+
+func LoadConfig(path string) (Config, error) {
+	b, err := os.ReadFile(path)
+	if err != nil {
+		return Config{}, fmt.Errorf("read %s: %w", path, err)
+	}
+
+	var cfg Config
+	if err := json.Unmarshal(b, &cfg); err != nil {
+		return Config{}, fmt.Errorf("parse json %s: %w", path, err)
+	}
+	if cfg.Namespaces == nil {
+		cfg.Namespaces = map[string]map[string]StoreConfig{}
+	}
+	return cfg, nil
+}
+
+// nsName が空なら "default" 扱い、storeKey が空なら「その namespace に1件だけならそれを採用」
+func (cfg Config) Lookup(nsName, storeKey string) (string, StoreConfig, error) {
+	if nsName == "" {
+		nsName = "default"
+	}
+
+	ns, ok := cfg.Namespaces[nsName]
+	if !ok {
+		return "", StoreConfig{}, fmt.Errorf("namespace %q not found", nsName)
+	}
+	if len(ns) == 0 {
+		return "", StoreConfig{}, fmt.Errorf("namespace %q has no stores", nsName)
+	}
+
+	// storeKey 指定があるならそれを取りに行く
+	if storeKey != "" {
+		st, ok := ns[storeKey]
+		if !ok {
+			return "", StoreConfig{}, fmt.Errorf("store %q not found in namespace %q", storeKey, nsName)
+		}
+		st.Name = nsName + "/" + storeKey
+		return storeKey, st, nil
+	}
+
+	// storeKey 未指定なら「1件だけならそれを採用」、複数ならエラー
+	if len(ns) == 1 {
+		for k, st := range ns {
+			st.Name = nsName + "/" + k
+			return k, st, nil
+		}
+	}
+
+	return "", StoreConfig{}, errors.New(`multiple stores exist; specify -store (e.g. -store ".env")`)
+}
+
+// Tree mounts every configured store at /<namespace>/<store>. A store is
+// only read when a path goes into it.
+func (cfg Config) Tree() repository.FS[any] {
+	root := repository.FS[any]{}
+	for nsName, ns := range cfg.Namespaces {
+		dir := repository.FS[any]{}
+		for k, sc := range ns {
+			sc.Name = nsName + "/" + k
+			dir[k] = storeMount(sc)
+		}
+		root[nsName] = dir
+	}
+	return root
+}
+
+// Walk resolves "/<namespace>/<store>[/<key>]" through Tree: a namespace
+// or store path returns its map, a key its value.
+func (cfg Config) Walk(ctx context.Context, path string) (any, error) {
+	v, err := repository.Lookup(ctx, cfg.Tree(), path)
+	if errors.Is(err, repository.ErrNotFound) {
+		return nil, fmt.Errorf("%w: %s: %w", ErrNotFound, path, err)
+	} else if err != nil {
+		return nil, err
+	}
+	// ディレクトリは map[string]any で返す
+	if fs, ok := v.(repository.FS[any]); ok {
+		out := make(map[string]any, len(fs))
+		for k, e := range fs {
+			if sc, ok := e.(storeMount); ok {
+				e = StoreConfig(sc)
+			}
+			out[k] = e
+		}
+		return out, nil
+	}
+	return v, nil
+}
+
+// storeMount は読まれたときに初めてストアを開く
+type storeMount StoreConfig
+
+func (m storeMount) Mount(ctx context.Context) (repository.FS[any], error) {
+	st, err := Open(StoreConfig(m))
+	if err != nil {
+		return nil, err
+	}
+	data, err := st.Read(ctx)
+	if err != nil {
+		return nil, fmt.Errorf("read store %s: %w", m.Name, err)
+	}
+	return repository.FS[any](data), nil
+}
@@ -0,0 +1,439 @@
+package stores
+
+import (
+	"bytes"
+	"context"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"os"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+func init() {
+	Register("consul", newConsulStore)
+	// consul://<prefix>[#key]（addr などは ?addr= か CONSUL_HTTP_* 環境変数）
+	RegisterScheme("consul", func(ref *Ref, rest string) error {
+		ref.Store = StoreConfig{Type: "consul", Args: map[string]any{"prefix": strings.Trim(rest, "/")}}
+		return nil
+	})
+}
+
+// ConsulStore reads a Consul KV prefix recursively. Keys below the prefix
+// become nested objects ("db/host" -> {"db": {"host": ...}}) and values are
+// strings.
+//
+// Write is check-and-set: every key is written with the ModifyIndex seen by
+// the last Read, so a change made by someone else in between fails with
+// ErrConflict instead of being overwritten, and nothing is applied.
+type ConsulStore struct {
+	Addr       string
+	Token      string
+	Datacenter string
+	Namespace  string
+	Prefix     string
+	Timeout    time.Duration
+	// Watch のブロッキングクエリ 1 回の最大待ち時間
+	Wait time.Duration
+
+	Client *http.Client
+
+	mu sync.Mutex
+	// 最後の Read で見た key -> ModifyIndex（CAS 用）
+	indexes map[string]uint64
+}
+
+func newConsulStore(args map[string]any) (Store, error) {
+	var (
+		s   ConsulStore
+		err error
+	)
+	if s.Addr, err = argString(args, "addr", ""); err != nil {
+		return nil, err
+	}
+	if s.Token, err = argString(args, "token", ""); err != nil {
+		return nil, err
+	}
+	if s.Datacenter, err = argString(args, "datacenter", ""); err != nil {
+		return nil, err
+	}
+	if s.Namespace, err = argString(args, "namespace", ""); err != nil {
+		return nil, err
+	}
+	if s.Prefix, err = argString(args, "prefix", ""); err != nil {
+		return nil, err
+	}
+	if s.Timeout, err = argDuration(args, "timeout", 10*time.Second); err != nil {
+		return nil, err
+	}
+	if s.Wait, err = argDuration(args, "wait", 5*time.Minute); err != nil {
+		return nil, err
+	}
+	s.Prefix = strings.Trim(s.Prefix, "/")
+	if s.Prefix == "" {
+		return nil, fmt.Errorf("consul store: missing arg \"prefix\"")
+	}
+	return &s, nil
+}
+
+// consulPair is an entry of GET /v1/kv/<key>?recurse.
+type consulPair struct {
+	Key         string
+	Value       *string // base64。フォルダは null
+	ModifyIndex uint64
+}
+
+func (s *ConsulStore) Identity() map[string]any {
+	return map[string]any{"addr": s.address(), "namespace": s.namespace()}
+}
+
+func (s *ConsulStore) Read(ctx context.Context) (map[string]any, error) {
+	pairs, _, err := s.list(ctx, 0, s.Timeout)
+	if errors.Is(err, ErrNotFound) {
+		// まだ無い prefix には cas=0 で書ける
+		s.mu.Lock()
+		s.indexes = map[string]uint64{}
+		s.mu.Unlock()
+		return nil, err
+	} else if err != nil {
+		return nil, err
+	}
+
+	indexes := make(map[string]uint64, len(pairs))
+	out := map[string]any{}
+	for _, p := range pairs {
+		// recurse は文字列の前方一致なので "app" に "apple/..." も混ざる
+		rel, ok := strings.CutPrefix(p.Key, s.Prefix+"/")
+		if !ok {
+			continue
+		}
+		indexes[rel] = p.ModifyIndex
+		if rel == "" || strings.HasSuffix(rel, "/") {
+			// フォルダ用の空キーは値として扱わない
+			continue
+		}
+		var v []byte
+		if p.Value != nil {
+			if v, err = base64.StdEncoding.DecodeString(*p.Value); err != nil {
+				return nil, fmt.Errorf("consul %s: %w", p.Key, err)
+			}
+		}
+		if err := setNested(out, strings.Split(rel, "/"), string(v)); err != nil {
+			return nil, fmt.Errorf("consul %s: %w", s.Prefix, err)
+		}
+	}
+
+	s.mu.Lock()
+	s.indexes = indexes
+	s.mu.Unlock()
+	return out, nil
+}
+
+func setNested(m map[string]any, path []string, v string) error {
+	for i, name := range path[:len(path)-1] {
+		sub, ok := m[name]
+		if !ok {
+			next := map[string]any{}
+			m[name] = next
+			m = next
+			continue
+		}
+		next, ok := sub.(map[string]any)
+		if !ok {
+			return fmt.Errorf("%s is both a value and a folder", strings.Join(path[:i+1], "/"))
+		}
+		m = next
+	}
+	last := path[len(path)-1]
+	if _, ok := m[last]; ok {
+		return fmt.Errorf("%s is both a value and a folder", strings.Join(path, "/"))
+	}
+	m[last] = v
+	return nil
+}
+
+// flattenNested は Read の逆。入れ子の map を "a/b" のキーにする
+func flattenNested(prefix string, m map[string]any, out map[string]string) {
+	for k, v := range m {
+		if sub, ok := v.(map[string]any); ok {
+			flattenNested(prefix+k+"/", sub, out)
+			continue
+		}
+		out[prefix+k] = fmt.Sprint(v)
+	}
+}
+
+// consulMaxTxnOps は /v1/txn 1 回に入れられる操作の上限
+const consulMaxTxnOps = 64
+
+// Write makes data the content of the prefix in one /v1/txn transaction:
+// keys are written with "cas" and removed with "delete-cas", so either all
+// of them are applied or, on a conflict, none. A transaction holds at most
+// 64 operations.
+func (s *ConsulStore) Write(ctx context.Context, data map[string]any) error {
+	s.mu.Lock()
+	indexes := s.indexes
+	s.mu.Unlock()
+	if indexes == nil {
+		// Read せずに書くときは今の状態を基準にする
+		if _, err := s.Read(ctx); err != nil && !errors.Is(err, ErrNotFound) {
+			return err
+		}
+		s.mu.Lock()
+		indexes = s.indexes
+		s.mu.Unlock()
+	}
+
+	flat := map[string]string{}
+	flattenNested("", data, flat)
+	keys := make([]string, 0, len(flat))
+	for k := range flat {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+
+	type kvOp struct {
+		Verb  string
+		Key   string
+		Value []byte `json:",omitempty"`
+		Index uint64
+	}
+	var ops []map[string]kvOp
+	for _, k := range keys {
+		// 知らないキーは Index 0（まだ存在しないこと）で作る
+		ops = append(ops, map[string]kvOp{"KV": {Verb: "cas", Key: s.Prefix + "/" + k, Value: []byte(flat[k]), Index: indexes[k]}})
+	}
+	for k, idx := range indexes {
+		if _, ok := flat[k]; ok || k == "" || strings.HasSuffix(k, "/") {
+			continue
+		}
+		ops = append(ops, map[string]kvOp{"KV": {Verb: "delete-cas", Key: s.Prefix + "/" + k, Index: idx}})
+	}
+	if len(ops) == 0 {
+		return nil
+	}
+	if len(ops) > consulMaxTxnOps {
+		return fmt.Errorf("consul %s: %d keys to change, a transaction holds at most %d", s.Prefix, len(ops), consulMaxTxnOps)
+	}
+
+	body, err := json.Marshal(ops)
+	if err != nil {
+		return err
+	}
+	res, b, err := s.do(ctx, http.MethodPut, "/v1/txn", s.query(), body, s.Timeout)
+	if err != nil {
+		return err
+	}
+	var tr struct {
+		Results []struct {
+			KV consulPair
+		}
+		Errors []struct {
+			OpIndex int
+			What    string
+		}
+	}
+	switch res.StatusCode {
+	case http.StatusOK:
+	case http.StatusConflict:
+		// CAS の失敗はロールバックされて 409 で返る。インデックスは残して、読み直すまで失敗させる
+		if json.Unmarshal(b, &tr) == nil && len(tr.Errors) > 0 {
+			return fmt.Errorf("%w: consul %s changed since it was read: %s", ErrConflict, s.Prefix, tr.Errors[0].What)
+		}
+		return fmt.Errorf("%w: consul %s changed since it was read", ErrConflict, s.Prefix)
+	default:
+		return consulError("PUT", "txn", res, b)
+	}
+	if err := json.Unmarshal(b, &tr); err != nil {
+		return fmt.Errorf("consul txn: %w", err)
+	}
+
+	// 書いたキーは新しい ModifyIndex が返るので、次の Write は読み直さずに続けられる
+	next := map[string]uint64{}
+	for k, idx := range indexes {
+		if k == "" || strings.HasSuffix(k, "/") {
+			next[k] = idx
+		}
+	}
+	for _, r := range tr.Results {
+		if rel, ok := strings.CutPrefix(r.KV.Key, s.Prefix+"/"); ok {
+			next[rel] = r.KV.ModifyIndex
+		}
+	}
+	s.mu.Lock()
+	s.indexes = next
+	s.mu.Unlock()
+	return nil
+}
+
+// Probe asks the agent for the raft leader.
+func (s *ConsulStore) Probe(ctx context.Context) error {
+	res, b, err := s.do(ctx, http.MethodGet, "/v1/status/leader", nil, nil, s.Timeout)
+	if err != nil {
+		return err
+	}
+	if res.StatusCode != http.StatusOK {
+		return consulError("GET", "status/leader", res, b)
+	}
+	if strings.Trim(strings.TrimSpace(string(b)), `"`) == "" {
+		return fmt.Errorf("consul: no leader")
+	}
+	return nil
+}
+
+// Watch uses blocking queries: each request returns when X-Consul-Index of
+// the prefix moves past the last one, or after Wait.
+func (s *ConsulStore) Watch(ctx context.Context, changed func()) error {
+	var last uint64
+	for {
+		_, idx, err := s.list(ctx, last, s.Wait+s.Timeout)
+		if ctx.Err() != nil {
+			return nil
+		}
+		if err != nil && !errors.Is(err, ErrNotFound) {
+			return err
+		}
+		switch {
+		case idx < last:
+			// インデックスが戻ったら（スナップショット復元など）最初から
+			last = 0
+			changed()
+			continue
+		case idx != last:
+			// 初回も通知する（Watch 開始前の読み込みとの間の変更を取りこぼさないため）
+			last = idx
+			changed()
+		}
+		if idx == 0 {
+			// インデックスが返らないと待たずに戻ってくるので間を空ける
+			select {
+			case <-ctx.Done():
+				return nil
+			case <-time.After(time.Second):
+			}
+		}
+	}
+}
+
+// list は prefix 以下を取る。index > 0 ならブロッキングクエリ
+func (s *ConsulStore) list(ctx context.Context, index uint64, timeout time.Duration) ([]consulPair, uint64, error) {
+	q := s.query()
+	q.Set("recurse", "true")
+	if index > 0 {
+		q.Set("index", strconv.FormatUint(index, 10))
+		q.Set("wait", fmt.Sprintf("%ds", int(s.Wait.Seconds())))
+	}
+	res, b, err := s.do(ctx, http.MethodGet, consulKeyPath(s.Prefix), q, nil, timeout)
+	if err != nil {
+		return nil, 0, err
+	}
+	idx := consulIndex(res)
+	switch res.StatusCode {
+	case http.StatusOK:
+	case http.StatusNotFound:
+		return nil, idx, fmt.Errorf("%w: consul prefix %s", ErrNotFound, s.Prefix)
+	default:
+		return nil, idx, consulError("GET", s.Prefix, res, b)
+	}
+	var pairs []consulPair
+	if err := json.Unmarshal(b, &pairs); err != nil {
+		return nil, idx, fmt.Errorf("consul %s: %w", s.Prefix, err)
+	}
+	return pairs, idx, nil
+}
+
+func (s *ConsulStore) query() url.Values {
+	q := url.Values{}
+	if s.Datacenter != "" {
+		q.Set("dc", s.Datacenter)
+	}
+	if ns := s.namespace(); ns != "" {
+		q.Set("ns", ns)
+	}
+	return q
+}
+
+func (s *ConsulStore) namespace() string {
+	if s.Namespace != "" {
+		return s.Namespace
+	}
+	return os.Getenv("CONSUL_NAMESPACE")
+}
+
+// address は addr > CONSUL_HTTP_ADDR > ローカルのエージェント
+func (s *ConsulStore) address() string {
+	addr := s.Addr
+	if addr == "" {
+		addr = os.Getenv("CONSUL_HTTP_ADDR")
+	}
+	if addr == "" {
+		addr = "http://127.0.0.1:8500"
+	}
+	if !strings.Contains(addr, "://") {
+		addr = "http://" + addr
+	}
+	return strings.TrimRight(addr, "/")
+}
+
+// do sends one request. Empty addr / token fall back to CONSUL_HTTP_ADDR /
+// CONSUL_HTTP_TOKEN like the consul CLI.
+func (s *ConsulStore) do(ctx context.Context, method, path string, q url.Values, body []byte, timeout time.Duration) (*http.Response, []byte, error) {
+	token := s.Token
+	if token == "" {
+		token = os.Getenv("CONSUL_HTTP_TOKEN")
+	}
+
+	ctx, cancel := context.WithTimeout(ctx, timeout)
+	defer cancel()
+
+	u := s.address() + path
+	if len(q) > 0 {
+		u += "?" + q.Encode()
+	}
+	req, err := http.NewRequestWithContext(ctx, method, u, bytes.NewReader(body))
+	if err != nil {
+		return nil, nil, err
+	}
+	if token != "" {
+		req.Header.Set("X-Consul-Token", token)
+	}
+	client := s.Client
+	if client == nil {
+		client = http.DefaultClient
+	}
+	res, err := client.Do(req)
+	if err != nil {
+		return nil, nil, fmt.Errorf("consul: %w", err)
+	}
+	defer res.Body.Close()
+	b, err := io.ReadAll(res.Body)
+	if err != nil {
+		return nil, nil, fmt.Errorf("consul: %w", err)
+	}
+	return res, b, nil
+}
+
+func consulKeyPath(key string) string {
+	parts := strings.Split(key, "/")
+	for i, p := range parts {
+		parts[i] = url.PathEscape(p)
+	}
+	return "/v1/kv/" + strings.Join(parts, "/")
+}
+
+func consulIndex(res *http.Response) uint64 {
+	n, _ := strconv.ParseUint(res.Header.Get("X-Consul-Index"), 10, 64)
+	return n
+}
+
+func consulError(method, key string, res *http.Response, body []byte) error {
+	return fmt.Errorf("consul %s %s: %s: %s", method, key, res.Status, strings.TrimSpace(string(body)))
+}
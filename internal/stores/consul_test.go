@@ -0,0 +1,274 @@
+package stores
+
+import (
+	"context"
+	"encoding/base64"
+	"encoding/json"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+)
+
+// fakeConsul は /v1/kv/ の最低限（recurse, index/wait）と /v1/txn の
+// cas / delete-cas だけを実装する
+type fakeConsul struct {
+	mu      sync.Mutex
+	kv      map[string]fakeConsulPair
+	index   uint64
+	changed chan struct{}
+	token   string
+	// 最後のリクエストの dc / ns
+	query map[string]string
+}
+
+type fakeConsulPair struct {
+	value       []byte
+	modifyIndex uint64
+}
+
+func newFakeConsul(t *testing.T, token string) (*fakeConsul, *httptest.Server) {
+	f := &fakeConsul{kv: map[string]fakeConsulPair{}, index: 1, changed: make(chan struct{}), token: token}
+	srv := httptest.NewServer(f)
+	t.Cleanup(srv.Close)
+	return f, srv
+}
+
+func (f *fakeConsul) put(key, value string) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	f.index++
+	f.kv[key] = fakeConsulPair{[]byte(value), f.index}
+	close(f.changed)
+	f.changed = make(chan struct{})
+}
+
+func (f *fakeConsul) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	if r.URL.Path == "/v1/status/leader" {
+		_, _ = io.WriteString(w, `"127.0.0.1:8300"`)
+		return
+	}
+	if r.Header.Get("X-Consul-Token") != f.token {
+		http.Error(w, "Permission denied", http.StatusForbidden)
+		return
+	}
+	if r.URL.Path == "/v1/txn" && r.Method == http.MethodPut {
+		f.txn(w, r)
+		return
+	}
+	key, ok := strings.CutPrefix(r.URL.Path, "/v1/kv/")
+	if !ok {
+		http.NotFound(w, r)
+		return
+	}
+	q := r.URL.Query()
+
+	f.mu.Lock()
+	f.query = map[string]string{"dc": q.Get("dc"), "ns": q.Get("ns")}
+	switch r.Method {
+	case http.MethodGet:
+		if idx, _ := strconv.ParseUint(q.Get("index"), 10, 64); idx > 0 && idx >= f.index {
+			ch := f.changed
+			f.mu.Unlock()
+			wait, _ := time.ParseDuration(q.Get("wait"))
+			select {
+			case <-ch:
+			case <-time.After(wait):
+			case <-r.Context().Done():
+			}
+			f.mu.Lock()
+		}
+		defer f.mu.Unlock()
+		w.Header().Set("X-Consul-Index", strconv.FormatUint(f.index, 10))
+		type pair struct {
+			Key         string
+			Value       *string
+			ModifyIndex uint64
+		}
+		var out []pair
+		for k, p := range f.kv {
+			if strings.HasPrefix(k, key) {
+				var v *string
+				if p.value != nil {
+					s := base64.StdEncoding.EncodeToString(p.value)
+					v = &s
+				}
+				out = append(out, pair{k, v, p.modifyIndex})
+			}
+		}
+		if len(out) == 0 {
+			w.WriteHeader(http.StatusNotFound)
+			return
+		}
+		sort.Slice(out, func(i, j int) bool { return out[i].Key < out[j].Key })
+		_ = json.NewEncoder(w).Encode(out)
+
+	default:
+		f.mu.Unlock()
+		w.WriteHeader(http.StatusMethodNotAllowed)
+	}
+}
+
+// txn は全部の CAS が通ったときだけまとめて適用する
+func (f *fakeConsul) txn(w http.ResponseWriter, r *http.Request) {
+	var ops []struct {
+		KV struct {
+			Verb  string
+			Key   string
+			Value []byte
+			Index uint64
+		}
+	}
+	if err := json.NewDecoder(r.Body).Decode(&ops); err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	type txnError struct {
+		OpIndex int
+		What    string
+	}
+	var errs []txnError
+	for i, op := range ops {
+		cur, exists := f.kv[op.KV.Key]
+		switch op.KV.Verb {
+		case "cas", "delete-cas":
+			if (op.KV.Index == 0 && exists) || (op.KV.Index != 0 && cur.modifyIndex != op.KV.Index) {
+				errs = append(errs, txnError{i, "failed to set key " + strconv.Quote(op.KV.Key) + ", index is stale"})
+			}
+		default:
+			errs = append(errs, txnError{i, "unsupported verb " + op.KV.Verb})
+		}
+	}
+	w.Header().Set("Content-Type", "application/json")
+	if len(errs) > 0 {
+		w.WriteHeader(http.StatusConflict)
+		_ = json.NewEncoder(w).Encode(map[string]any{"Results": nil, "Errors": errs})
+		return
+	}
+
+	f.index++
+	var results []map[string]any
+	for _, op := range ops {
+		if op.KV.Verb == "delete-cas" {
+			delete(f.kv, op.KV.Key)
+			continue
+		}
+		f.kv[op.KV.Key] = fakeConsulPair{op.KV.Value, f.index}
+		results = append(results, map[string]any{"KV": map[string]any{"Key": op.KV.Key, "ModifyIndex": f.index}})
+	}
+	close(f.changed)
+	f.changed = make(chan struct{})
+	_ = json.NewEncoder(w).Encode(map[string]any{"Results": results, "Errors": nil})
+}
+
+func TestConsulStore(t *testing.T) {
+	r := require.New(t)
+	ctx := context.Background()
+	fake, srv := newFakeConsul(t, "acl-token")
+	fake.put("app/db/host", "db.local")
+	fake.put("app/db/password", "s3cret")
+	fake.put("app/log_level", "info")
+	fake.put("app/folder/", "")
+	fake.put("apple/x", "other prefix")
+
+	defaults := map[string]any{"addr": srv.URL, "token": "acl-token", "prefix": "app"}
+
+	st := openStore(t, "consul", defaults, map[string]any{"datacenter": "dc2", "namespace": "team"})
+	data, err := st.Read(ctx)
+	r.NoError(err)
+	r.Equal(map[string]any{
+		"db":        map[string]any{"host": "db.local", "password": "s3cret"},
+		"log_level": "info",
+	}, data)
+	r.Equal(map[string]string{"dc": "dc2", "ns": "team"}, fake.query)
+	r.NoError(Probe(ctx, st))
+
+	// CAS: 読んだ後に他で変わったら ErrConflict で、他のキーも書かれない
+	w := st.(Writer)
+	data["log_level"] = "debug"
+	data["db"].(map[string]any)["host"] = "db.changed"
+	data["new"] = "x"
+	fake.put("app/log_level", "warn")
+	r.ErrorIs(w.Write(ctx, data), ErrConflict)
+	r.ErrorIs(w.Write(ctx, data), ErrConflict)
+	r.Equal("db.local", string(fake.kv["app/db/host"].value))
+	r.NotContains(fake.kv, "app/new")
+
+	data, err = st.Read(ctx)
+	r.NoError(err)
+	r.Equal("warn", data["log_level"])
+	data["log_level"] = "debug"
+	data["db"].(map[string]any)["port"] = 5432
+	delete(data["db"].(map[string]any), "password")
+	r.NoError(w.Write(ctx, data))
+	// 返ってきた ModifyIndex で続けて書ける
+	data["log_level"] = "error"
+	r.NoError(w.Write(ctx, data))
+
+	data, err = st.Read(ctx)
+	r.NoError(err)
+	r.Equal(map[string]any{
+		"db":        map[string]any{"host": "db.local", "port": "5432"},
+		"log_level": "error",
+	}, data)
+
+	got, err := Config{}.Get(ctx, "consul://app/db?addr="+srv.URL+"&token=acl-token#host")
+	r.NoError(err)
+	r.Equal("db.local", got)
+
+	_, err = openStore(t, "consul", defaults, map[string]any{"prefix": "missing"}).Read(ctx)
+	r.ErrorIs(err, ErrNotFound)
+	_, err = openStore(t, "consul", defaults, map[string]any{"token": "wrong"}).Read(ctx)
+	r.ErrorContains(err, "403")
+
+	// まだ無い prefix にも書ける
+	nw := openStore(t, "consul", defaults, map[string]any{"prefix": "new"}).(Writer)
+	r.NoError(nw.Write(ctx, map[string]any{"A": "1"}))
+	data, err = openStore(t, "consul", defaults, map[string]any{"prefix": "new"}).Read(ctx)
+	r.NoError(err)
+	r.Equal(map[string]any{"A": "1"}, data)
+}
+
+func TestConsulWatch(t *testing.T) {
+	r := require.New(t)
+	fake, srv := newFakeConsul(t, "")
+	fake.put("app/A", "1")
+
+	st, err := Open(StoreConfig{Type: "consul", Args: map[string]any{"addr": srv.URL, "prefix": "app", "wait": "5s"}})
+	r.NoError(err)
+
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+	events := make(chan Event, 8)
+	errc := make(chan error, 1)
+	go func() {
+		errc <- Watch(ctx, st, WatchOptions{Source: "test", Interval: time.Hour}, events)
+	}()
+
+	// ブロッキングクエリが戻るまで書き直す
+	var ev Event
+	for i, got := 2, false; !got; i++ {
+		fake.put("app/A", strconv.Itoa(i))
+		select {
+		case ev = <-events:
+			got = true
+		case <-time.After(200 * time.Millisecond):
+		case <-ctx.Done():
+			t.Fatal("timeout waiting for event")
+		}
+	}
+	r.Equal("A", ev.Key)
+	r.NotEqual(ev.OldHash, ev.NewHash)
+
+	cancel()
+	r.NoError(<-errc)
+}
@@ -0,0 +1,180 @@
+package stores
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/sasano8/kvtool/internal/fsutil"
+)
+
+func init() {
+	Register("dir", newDirStore)
+	// dir://<path>[#KEY]。dir:///run/secrets#db_password
+	RegisterScheme("dir", func(ref *Ref, rest string) error {
+		if rest == "" {
+			return fmt.Errorf("missing directory path")
+		}
+		ref.Store = StoreConfig{Type: "dir", Args: map[string]any{"path": rest}}
+		return nil
+	})
+}
+
+// DirStore reads a directory with one file per key, as Docker and
+// Kubernetes mount secrets (/run/secrets, projected volumes).
+// Names starting with "." are skipped: hidden files, our temp files and the
+// "..data" / "..<timestamp>" entries Kubernetes uses to swap a volume.
+type DirStore struct {
+	Path string
+	// 末尾の改行を取り除く（echo で作ったファイル向け）
+	TrimNewline bool
+	// ファイル名に対する glob。Include が空なら全部
+	Include []string
+	Exclude []string
+}
+
+func newDirStore(args map[string]any) (Store, error) {
+	var (
+		s   DirStore
+		err error
+	)
+	if s.Path, err = argString(args, "path", "/run/secrets"); err != nil {
+		return nil, err
+	}
+	if s.TrimNewline, err = argBool(args, "trim_newline", true); err != nil {
+		return nil, err
+	}
+	if s.Include, err = argStrings(args, "include"); err != nil {
+		return nil, err
+	}
+	if s.Exclude, err = argStrings(args, "exclude"); err != nil {
+		return nil, err
+	}
+	for _, p := range append(append([]string{}, s.Include...), s.Exclude...) {
+		if _, err := filepath.Match(p, ""); err != nil {
+			return nil, fmt.Errorf("glob %q: %w", p, err)
+		}
+	}
+	return &s, nil
+}
+
+// selected reports whether the file name is a key of this store.
+func (s *DirStore) selected(name string) bool {
+	if strings.HasPrefix(name, ".") {
+		return false
+	}
+	for _, p := range s.Exclude {
+		if ok, _ := filepath.Match(p, name); ok {
+			return false
+		}
+	}
+	if len(s.Include) == 0 {
+		return true
+	}
+	for _, p := range s.Include {
+		if ok, _ := filepath.Match(p, name); ok {
+			return true
+		}
+	}
+	return false
+}
+
+// files は対象のファイル名 -> パス。シンボリックリンクは辿って通常ファイルだけ残す
+func (s *DirStore) files() (map[string]string, error) {
+	entries, err := os.ReadDir(s.Path)
+	if errors.Is(err, fs.ErrNotExist) {
+		return nil, fmt.Errorf("%w: %w", ErrNotFound, err)
+	} else if err != nil {
+		return nil, err
+	}
+	out := map[string]string{}
+	for _, e := range entries {
+		if !s.selected(e.Name()) {
+			continue
+		}
+		p := filepath.Join(s.Path, e.Name())
+		fi, err := os.Stat(p)
+		if errors.Is(err, fs.ErrNotExist) {
+			// 壊れたリンク（入れ替え途中など）
+			continue
+		} else if err != nil {
+			return nil, err
+		}
+		if fi.Mode().IsRegular() {
+			out[e.Name()] = p
+		}
+	}
+	return out, nil
+}
+
+func (s *DirStore) Identity() map[string]any {
+	return map[string]any{"path": absPath(s.Path)}
+}
+
+func (s *DirStore) Read(ctx context.Context) (map[string]any, error) {
+	files, err := s.files()
+	if err != nil {
+		return nil, err
+	}
+	out := make(map[string]any, len(files))
+	for name, p := range files {
+		b, err := os.ReadFile(p)
+		if err != nil {
+			return nil, fmt.Errorf("read %s: %w", p, err)
+		}
+		v := string(b)
+		if s.TrimNewline {
+			v = strings.TrimRight(v, "\r\n")
+		}
+		out[name] = v
+	}
+	return out, nil
+}
+
+// Write makes data the content of the directory: every key is written to
+// its own file atomically and files of keys not in data are removed.
+// Files outside include / exclude are left alone.
+func (s *DirStore) Write(ctx context.Context, data map[string]any) error {
+	for k := range data {
+		if k == "" || strings.ContainsAny(k, `/\`) || !s.selected(k) {
+			return fmt.Errorf("key %q cannot be a file in %s (check include / exclude)", k, s.Path)
+		}
+	}
+	if err := os.MkdirAll(s.Path, 0o700); err != nil {
+		return err
+	}
+	files, err := s.files()
+	if err != nil {
+		return err
+	}
+
+	for k, v := range data {
+		p := filepath.Join(s.Path, k)
+		mode := os.FileMode(0o600)
+		if fi, err := os.Stat(p); err == nil {
+			mode = fi.Mode().Perm()
+		}
+		if err := fsutil.WriteFileAtomic(p, []byte(fmt.Sprint(v)), mode); err != nil {
+			return err
+		}
+	}
+	for name, p := range files {
+		if _, ok := data[name]; ok {
+			continue
+		}
+		if err := os.Remove(p); err != nil && !errors.Is(err, fs.ErrNotExist) {
+			return err
+		}
+	}
+	return nil
+}
+
+// Watch notifies on any change in the directory, including the "..data"
+// symlink swap Kubernetes does when a secret is updated.
+func (s *DirStore) Watch(ctx context.Context, changed func()) error {
+	return watchDir(ctx, s.Path, nil, changed)
+}
@@ -0,0 +1,145 @@
+package stores
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"path/filepath"
+	"runtime"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+)
+
+// Kubernetes の secret volume と同じ構成: KEY -> ..data/KEY, ..data -> ..<ts>
+func k8sSecretDir(t *testing.T, dir, ts string, data map[string]string) {
+	t.Helper()
+	r := require.New(t)
+	r.NoError(os.MkdirAll(filepath.Join(dir, ts), 0o755))
+	for k, v := range data {
+		r.NoError(os.WriteFile(filepath.Join(dir, ts, k), []byte(v), 0o644))
+		link := filepath.Join(dir, k)
+		if _, err := os.Lstat(link); err != nil {
+			r.NoError(os.Symlink(filepath.Join("..data", k), link))
+		}
+	}
+	tmp := filepath.Join(dir, "..data_tmp")
+	r.NoError(os.Symlink(ts, tmp))
+	r.NoError(os.Rename(tmp, filepath.Join(dir, "..data")))
+}
+
+func TestDirStore(t *testing.T) {
+	if runtime.GOOS == "windows" {
+		t.Skip("symlinks")
+	}
+	r := require.New(t)
+	ctx := context.Background()
+	dir := t.TempDir()
+	k8sSecretDir(t, dir, "..2024_01_01", map[string]string{
+		"db_password": "s3cret\n",
+		"api_token":   "tok",
+		"ca.crt":      "-----BEGIN-----\n",
+	})
+	r.NoError(os.WriteFile(filepath.Join(dir, ".hidden"), []byte("x"), 0o600))
+	r.NoError(os.Mkdir(filepath.Join(dir, "sub"), 0o755))
+
+	st, err := Open(StoreConfig{Type: "dir", Args: map[string]any{"path": dir}})
+	r.NoError(err)
+	data, err := st.Read(ctx)
+	r.NoError(err)
+	r.Equal(map[string]any{
+		"db_password": "s3cret",
+		"api_token":   "tok",
+		"ca.crt":      "-----BEGIN-----",
+	}, data)
+
+	st, err = Open(StoreConfig{Type: "dir", Args: map[string]any{
+		"path":         dir,
+		"trim_newline": false,
+		"include":      []any{"*_*"},
+		"exclude":      []any{"api_*"},
+	}})
+	r.NoError(err)
+	data, err = st.Read(ctx)
+	r.NoError(err)
+	r.Equal(map[string]any{"db_password": "s3cret\n"}, data)
+
+	got, err := Config{}.Get(ctx, "dir://"+dir+"#api_token")
+	r.NoError(err)
+	r.Equal("tok", got)
+
+	_, err = Open(StoreConfig{Type: "dir", Args: map[string]any{"include": []any{"["}}})
+	r.Error(err)
+
+	missing, err := Open(StoreConfig{Type: "dir", Args: map[string]any{"path": filepath.Join(dir, "nope")}})
+	r.NoError(err)
+	_, err = missing.Read(ctx)
+	r.ErrorIs(err, ErrNotFound)
+}
+
+func TestDirStoreWrite(t *testing.T) {
+	r := require.New(t)
+	ctx := context.Background()
+	dir := filepath.Join(t.TempDir(), "secrets")
+
+	st, err := Open(StoreConfig{Type: "dir", Args: map[string]any{"path": dir, "exclude": []any{"*.keep"}}})
+	r.NoError(err)
+	w := st.(Writer)
+
+	r.NoError(w.Write(ctx, map[string]any{"A": "1", "B": 2}))
+	r.NoError(os.WriteFile(filepath.Join(dir, "notes.keep"), []byte("x"), 0o600))
+	r.NoError(w.Write(ctx, map[string]any{"A": "changed"}))
+
+	data, err := st.Read(ctx)
+	r.NoError(err)
+	r.Equal(map[string]any{"A": "changed"}, data)
+
+	entries, err := os.ReadDir(dir)
+	r.NoError(err)
+	var names []string
+	for _, e := range entries {
+		names = append(names, e.Name())
+	}
+	r.Equal([]string{"A", "notes.keep"}, names)
+
+	r.Error(w.Write(ctx, map[string]any{"../x": "1"}))
+	r.Error(w.Write(ctx, map[string]any{".hidden": "1"}))
+	r.Error(w.Write(ctx, map[string]any{"x.keep": "1"}))
+}
+
+func TestWatchDirSymlinkSwap(t *testing.T) {
+	if runtime.GOOS == "windows" {
+		t.Skip("symlinks")
+	}
+	r := require.New(t)
+	dir := t.TempDir()
+	k8sSecretDir(t, dir, "..0", map[string]string{"A": "0"})
+
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+
+	events := make(chan Event, 8)
+	errc := make(chan error, 1)
+	go func() {
+		errc <- Watch(ctx, &DirStore{Path: dir, TrimNewline: true}, WatchOptions{Source: "test", Interval: time.Hour}, events)
+	}()
+
+	// watch_test と同じく、拾われるまで ..data の差し替えを繰り返す
+	var ev Event
+	for i, got := 1, false; !got; i++ {
+		k8sSecretDir(t, dir, fmt.Sprintf("..%d", i), map[string]string{"A": fmt.Sprint(i)})
+		select {
+		case ev = <-events:
+			got = true
+		case <-time.After(200 * time.Millisecond):
+		case <-ctx.Done():
+			t.Fatal("timeout waiting for event")
+		}
+	}
+	r.Equal("A", ev.Key)
+	r.NotEqual(ev.OldHash, ev.NewHash)
+
+	cancel()
+	r.NoError(<-errc)
+}
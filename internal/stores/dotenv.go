@@ -0,0 +1,134 @@
+package stores
+
+import (
+	"bytes"
+	"context"
+	"crypto/sha256"
+	"errors"
+	"fmt"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/sasano8/kvtool/internal/convert"
+	"github.com/sasano8/kvtool/internal/fsutil"
+)
+
+func init() {
+	Register(".env", newDotenvStore)
+	Register("env", newEnvStore)
+}
+
+// DotenvStore reads a .env file.
+type DotenvStore struct {
+	Path string
+}
+
+func newDotenvStore(args map[string]any) (Store, error) {
+	p, err := argString(args, "input", ".env")
+	if err != nil {
+		return nil, err
+	}
+	return &DotenvStore{Path: p}, nil
+}
+
+func (s *DotenvStore) Identity() map[string]any {
+	return map[string]any{"path": absPath(s.Path)}
+}
+
+func (s *DotenvStore) Read(ctx context.Context) (map[string]any, error) {
+	f, err := os.Open(s.Path)
+	if errors.Is(err, fs.ErrNotExist) {
+		return nil, fmt.Errorf("%w: %w", ErrNotFound, err)
+	} else if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+
+	m, err := convert.ParseDotenv(f)
+	if err != nil {
+		return nil, fmt.Errorf("parse %s: %w", s.Path, err)
+	}
+	return stringMap(m), nil
+}
+
+// Write rewrites the file with sorted KEY="value" lines.
+// Comments and ordering of the original file are not preserved.
+func (s *DotenvStore) Write(ctx context.Context, data map[string]any) error {
+	var buf bytes.Buffer
+	if err := convert.FormatDotenv(&buf, data); err != nil {
+		return err
+	}
+
+	mode := os.FileMode(0o600)
+	if fi, err := os.Stat(s.Path); err == nil {
+		mode = fi.Mode().Perm()
+	}
+	return fsutil.WriteFileAtomic(s.Path, buf.Bytes(), mode)
+}
+
+// Watch watches the parent directory so that editors which save by
+// rename (vim, sed -i, etc.) are detected as well.
+func (s *DotenvStore) Watch(ctx context.Context, changed func()) error {
+	abs, err := filepath.Abs(s.Path)
+	if err != nil {
+		return err
+	}
+	return watchDir(ctx, filepath.Dir(abs), func(name string) bool { return name == abs }, changed)
+}
+
+// EnvStore reads the process environment.
+type EnvStore struct {
+	// Watch で os.Environ のスナップショットを取る間隔
+	Interval time.Duration
+}
+
+func newEnvStore(args map[string]any) (Store, error) {
+	interval, err := argDuration(args, "watch_interval", 5*time.Second)
+	if err != nil {
+		return nil, err
+	}
+	return &EnvStore{Interval: interval}, nil
+}
+
+// Identity は環境変数そのもの（別の環境のプロセスとキャッシュを共有しない）
+func (s *EnvStore) Identity() map[string]any {
+	env := os.Environ()
+	sort.Strings(env)
+	return map[string]any{"environ": env}
+}
+
+func (s *EnvStore) Read(ctx context.Context) (map[string]any, error) {
+	m, err := convert.EnvMap()
+	if err != nil {
+		return nil, err
+	}
+	return stringMap(m), nil
+}
+
+func (s *EnvStore) Watch(ctx context.Context, changed func()) error {
+	t := time.NewTicker(s.Interval)
+	defer t.Stop()
+
+	prev := environSnapshot()
+	for {
+		select {
+		case <-ctx.Done():
+			return nil
+		case <-t.C:
+			if cur := environSnapshot(); cur != prev {
+				prev = cur
+				changed()
+			}
+		}
+	}
+}
+
+func environSnapshot() [32]byte {
+	env := os.Environ()
+	sort.Strings(env)
+	return sha256.Sum256([]byte(strings.Join(env, "\x00")))
+}
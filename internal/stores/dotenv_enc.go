@@ -0,0 +1,219 @@
+package stores
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io/fs"
+	"os"
+
+	vaultapi "github.com/hashicorp/vault/api"
+
+	"github.com/sasano8/kvtool/internal/encdotenv"
+	"github.com/sasano8/kvtool/internal/fsutil"
+)
+
+func init() {
+	Register(".env.enc", newEncDotenvStore)
+}
+
+// EncKeys says where the keys to an encrypted .env file come from: an age
+// identity and, for files wrapped with Vault Transit, a Vault connection.
+type EncKeys struct {
+	// 空なら KVTOOL_AGE_KEY / KVTOOL_AGE_KEY_FILE / 既定の場所
+	IdentityFile string
+	// 空なら VAULT_ADDR / VAULT_TOKEN / VAULT_NAMESPACE
+	VaultAddr      string
+	VaultToken     string
+	VaultNamespace string
+}
+
+func (k EncKeys) VaultClient() (*vaultapi.Client, error) {
+	return NewVaultClient(k.VaultAddr, k.VaultToken, k.VaultNamespace)
+}
+
+// Identities returns what may unwrap f. A missing age identity is only an
+// error when f cannot be unwrapped with Vault Transit instead.
+func (k EncKeys) Identities(f *encdotenv.File) ([]encdotenv.Identity, error) {
+	transit := f.HasStanza("transit")
+
+	ids, err := encdotenv.LoadAgeIdentities(k.IdentityFile)
+	if err != nil && (k.IdentityFile != "" || !transit) {
+		return nil, err
+	}
+	if transit {
+		client, err := k.VaultClient()
+		if err != nil {
+			if len(ids) > 0 {
+				return ids, nil
+			}
+			return nil, err
+		}
+		for _, t := range f.TransitKeys(client) {
+			ids = append(ids, t)
+		}
+	}
+	return ids, nil
+}
+
+// EncDotenvStore reads an encrypted .env file (see package encdotenv) and
+// decrypts it with an age identity or Vault Transit.
+type EncDotenvStore struct {
+	Path string
+	EncKeys
+	// Write で使う受信者（age1... と transit の鍵）。空なら既存ファイルのまま
+	Recipients []string
+	Transit    []string
+}
+
+func newEncDotenvStore(args map[string]any) (Store, error) {
+	var (
+		s   EncDotenvStore
+		err error
+	)
+	if s.Path, err = argString(args, "input", ".env.enc"); err != nil {
+		return nil, err
+	}
+	if s.IdentityFile, err = argString(args, "identity", ""); err != nil {
+		return nil, err
+	}
+	if s.VaultAddr, err = argString(args, "vault_addr", ""); err != nil {
+		return nil, err
+	}
+	if s.VaultToken, err = argString(args, "vault_token", ""); err != nil {
+		return nil, err
+	}
+	if s.VaultNamespace, err = argString(args, "vault_namespace", ""); err != nil {
+		return nil, err
+	}
+	if s.Recipients, err = argStrings(args, "recipients"); err != nil {
+		return nil, err
+	}
+	if s.Transit, err = argStrings(args, "transit"); err != nil {
+		return nil, err
+	}
+	return &s, nil
+}
+
+func (s *EncDotenvStore) load() (*encdotenv.File, error) {
+	f, err := os.Open(s.Path)
+	if errors.Is(err, fs.ErrNotExist) {
+		return nil, fmt.Errorf("%w: %w", ErrNotFound, err)
+	} else if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+
+	ef, err := encdotenv.Parse(f)
+	if err != nil {
+		return nil, fmt.Errorf("parse %s: %w", s.Path, err)
+	}
+	return ef, nil
+}
+
+func (s *EncDotenvStore) Identity() map[string]any {
+	return map[string]any{"path": absPath(s.Path)}
+}
+
+func (s *EncDotenvStore) Read(ctx context.Context) (map[string]any, error) {
+	ef, err := s.load()
+	if err != nil {
+		return nil, err
+	}
+	ids, err := s.Identities(ef)
+	if err != nil {
+		return nil, err
+	}
+	m, err := ef.Decrypt(ctx, ids...)
+	if err != nil {
+		return nil, fmt.Errorf("decrypt %s: %w", s.Path, err)
+	}
+	return stringMap(m), nil
+}
+
+// Write re-encrypts the file with its existing data key and recipients.
+// A new file is encrypted for Recipients and Transit. When they are set and
+// the file is wrapped for someone else, the values are re-encrypted with a
+// new data key for them, so a removed recipient loses access.
+func (s *EncDotenvStore) Write(ctx context.Context, data map[string]any) error {
+	plain := make(map[string]string, len(data))
+	for k, v := range data {
+		plain[k] = fmt.Sprint(v)
+	}
+
+	ef, err := s.load()
+	switch {
+	case errors.Is(err, ErrNotFound):
+		if len(s.Recipients)+len(s.Transit) == 0 {
+			return fmt.Errorf("%s does not exist and no recipients are configured", s.Path)
+		}
+		rcpts, err := s.recipients()
+		if err != nil {
+			return err
+		}
+		if ef, err = encdotenv.Encrypt(ctx, plain, rcpts...); err != nil {
+			return err
+		}
+	case err != nil:
+		return err
+	default:
+		ids, err := s.Identities(ef)
+		if err != nil {
+			return err
+		}
+		key, err := ef.DataKey(ctx, ids...)
+		if err != nil {
+			return fmt.Errorf("decrypt %s: %w", s.Path, err)
+		}
+		if len(s.Recipients)+len(s.Transit) > 0 {
+			rcpts, err := s.recipients()
+			if err != nil {
+				return err
+			}
+			if !ef.WrappedFor(rcpts...) {
+				if key, err = ef.Rekey(ctx, key, rcpts...); err != nil {
+					return err
+				}
+			}
+		}
+		if err := ef.Update(key, plain); err != nil {
+			return err
+		}
+	}
+
+	mode := os.FileMode(0o600)
+	if fi, err := os.Stat(s.Path); err == nil {
+		mode = fi.Mode().Perm()
+	}
+	return fsutil.WriteFileAtomic(s.Path, ef.Marshal(), mode)
+}
+
+// recipients は設定された受信者（age1... と transit の鍵）
+func (s *EncDotenvStore) recipients() ([]encdotenv.Recipient, error) {
+	var rcpts []encdotenv.Recipient
+	for _, r := range s.Recipients {
+		rcpt, err := encdotenv.ParseAgeRecipient(r)
+		if err != nil {
+			return nil, err
+		}
+		rcpts = append(rcpts, rcpt)
+	}
+	if len(s.Transit) > 0 {
+		client, err := s.VaultClient()
+		if err != nil {
+			return nil, err
+		}
+		for _, t := range s.Transit {
+			k, err := encdotenv.ParseTransitKey(client, t)
+			if err != nil {
+				return nil, err
+			}
+			rcpts = append(rcpts, k)
+		}
+	}
+	return rcpts, nil
+}
+
+func (s *EncDotenvStore) Watch(ctx context.Context, changed func()) error {
+	return (&DotenvStore{Path: s.Path}).Watch(ctx, changed)
+}
@@ -0,0 +1,64 @@
+package stores
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"filippo.io/age"
+	"github.com/stretchr/testify/require"
+)
+
+func TestEncDotenvStore(t *testing.T) {
+	r := require.New(t)
+	ctx := context.Background()
+	id, err := age.GenerateX25519Identity()
+	r.NoError(err)
+	t.Setenv("KVTOOL_AGE_KEY", id.String())
+
+	path := filepath.Join(t.TempDir(), ".env.enc")
+	st, err := Open(StoreConfig{Type: ".env.enc", Args: map[string]any{
+		"input":      path,
+		"recipients": []any{id.Recipient().String()},
+	}})
+	r.NoError(err)
+
+	_, err = st.Read(ctx)
+	r.ErrorIs(err, ErrNotFound)
+
+	w := st.(Writer)
+	r.NoError(w.Write(ctx, map[string]any{"A": "1", "B": "2"}))
+	b, err := os.ReadFile(path)
+	r.NoError(err)
+	r.Contains(string(b), "ENC[AES256_GCM,")
+
+	r.NoError(w.Write(ctx, map[string]any{"A": "1", "B": "3"}))
+	data, err := st.Read(ctx)
+	r.NoError(err)
+	r.Equal(map[string]any{"A": "1", "B": "3"}, data)
+
+	other, err := age.GenerateX25519Identity()
+	r.NoError(err)
+	t.Setenv("KVTOOL_AGE_KEY", other.String())
+	_, err = st.Read(ctx)
+	r.ErrorContains(err, "no identity")
+
+	// 受信者を入れ替えると新しいデータ鍵で暗号化し直す
+	t.Setenv("KVTOOL_AGE_KEY", id.String())
+	st, err = Open(StoreConfig{Type: ".env.enc", Args: map[string]any{
+		"input":      path,
+		"recipients": []any{other.Recipient().String()},
+	}})
+	r.NoError(err)
+	r.NoError(st.(Writer).Write(ctx, map[string]any{"A": "1", "B": "3"}))
+	after, err := os.ReadFile(path)
+	r.NoError(err)
+	r.NotContains(string(after), id.Recipient().String())
+	_, err = st.Read(ctx)
+	r.ErrorContains(err, "no identity")
+	t.Setenv("KVTOOL_AGE_KEY", other.String())
+	data, err = st.Read(ctx)
+	r.NoError(err)
+	r.Equal(map[string]any{"A": "1", "B": "3"}, data)
+}
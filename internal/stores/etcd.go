@@ -0,0 +1,297 @@
+package stores
+
+import (
+	"context"
+	"crypto/tls"
+	"errors"
+	"fmt"
+	"os"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"go.etcd.io/etcd/client/pkg/v3/transport"
+	clientv3 "go.etcd.io/etcd/client/v3"
+	"go.uber.org/zap"
+)
+
+func init() {
+	Register("etcd", newEtcdStore)
+	// etcd://<prefix>[#key]（endpoints などは ?endpoints= か ETCDCTL_* 環境変数）
+	RegisterScheme("etcd", func(ref *Ref, rest string) error {
+		ref.Store = StoreConfig{Type: "etcd", Args: map[string]any{"prefix": strings.Trim(rest, "/")}}
+		return nil
+	})
+}
+
+// EtcdStore reads the keys below an etcd v3 prefix. Like ConsulStore, keys
+// become nested objects ("flags/beta" -> {"flags": {"beta": ...}}).
+//
+// Write is a single transaction that only commits if none of the keys
+// changed since the last Read. With TTL set, written keys are attached to a
+// new lease and disappear unless written again in time.
+type EtcdStore struct {
+	Endpoints []string
+	Prefix    string
+	Username  string
+	Password  string
+	// TLS クライアント証明書
+	CertFile   string
+	KeyFile    string
+	CACertFile string
+	Timeout    time.Duration
+	TTL        time.Duration
+
+	mu sync.Mutex
+	// 最後の Read で見た key -> mod_revision（CAS 用）と、そのときのリビジョン
+	revisions map[string]int64
+	rev       int64
+}
+
+func newEtcdStore(args map[string]any) (Store, error) {
+	var (
+		s   EtcdStore
+		err error
+	)
+	if s.Endpoints, err = argStrings(args, "endpoints"); err != nil {
+		return nil, err
+	}
+	if s.Prefix, err = argString(args, "prefix", ""); err != nil {
+		return nil, err
+	}
+	if s.Username, err = argString(args, "username", ""); err != nil {
+		return nil, err
+	}
+	if s.Password, err = argString(args, "password", ""); err != nil {
+		return nil, err
+	}
+	if s.CertFile, err = argString(args, "cert", os.Getenv("ETCDCTL_CERT")); err != nil {
+		return nil, err
+	}
+	if s.KeyFile, err = argString(args, "key", os.Getenv("ETCDCTL_KEY")); err != nil {
+		return nil, err
+	}
+	if s.CACertFile, err = argString(args, "cacert", os.Getenv("ETCDCTL_CACERT")); err != nil {
+		return nil, err
+	}
+	if s.Timeout, err = argDuration(args, "timeout", 10*time.Second); err != nil {
+		return nil, err
+	}
+	if s.TTL, err = argDuration(args, "ttl", 0); err != nil {
+		return nil, err
+	}
+	if len(s.Endpoints) == 0 {
+		if env := os.Getenv("ETCDCTL_ENDPOINTS"); env != "" {
+			s.Endpoints = strings.Split(env, ",")
+		} else {
+			s.Endpoints = []string{"127.0.0.1:2379"}
+		}
+	}
+	s.Prefix = strings.Trim(s.Prefix, "/")
+	if s.Prefix == "" {
+		return nil, fmt.Errorf("etcd store: missing arg \"prefix\"")
+	}
+	if s.TTL > 0 && s.TTL < time.Second {
+		return nil, fmt.Errorf("etcd store: ttl %s is shorter than the 1s lease granularity", s.TTL)
+	}
+	if (s.CertFile == "") != (s.KeyFile == "") {
+		return nil, fmt.Errorf("etcd store: cert and key must be given together")
+	}
+	return &s, nil
+}
+
+// NewEtcdClient connects to the store's endpoints. The caller closes it.
+func (s *EtcdStore) NewEtcdClient() (*clientv3.Client, error) {
+	cfg := clientv3.Config{
+		Endpoints:   s.Endpoints,
+		DialTimeout: s.Timeout,
+		Username:    s.Username,
+		Password:    s.Password,
+		// リトライのたびに JSON の警告を stderr に出すので黙らせる（エラーは戻り値で返る）
+		Logger: zap.NewNop(),
+	}
+	if s.CertFile != "" || s.CACertFile != "" {
+		info := transport.TLSInfo{CertFile: s.CertFile, KeyFile: s.KeyFile, TrustedCAFile: s.CACertFile}
+		tc, err := info.ClientConfig()
+		if err != nil {
+			return nil, fmt.Errorf("etcd tls: %w", err)
+		}
+		tc.MinVersion = tls.VersionTLS12
+		cfg.TLS = tc
+	}
+	c, err := clientv3.New(cfg)
+	if err != nil {
+		return nil, fmt.Errorf("etcd client: %w", err)
+	}
+	return c, nil
+}
+
+func (s *EtcdStore) dir() string { return s.Prefix + "/" }
+
+// Identity は ETCDCTL_ENDPOINTS を反映した接続先（New で解決済み）
+func (s *EtcdStore) Identity() map[string]any {
+	return map[string]any{"endpoints": s.Endpoints}
+}
+
+func (s *EtcdStore) Read(ctx context.Context) (map[string]any, error) {
+	c, err := s.NewEtcdClient()
+	if err != nil {
+		return nil, err
+	}
+	defer c.Close()
+
+	ctx, cancel := context.WithTimeout(ctx, s.Timeout)
+	defer cancel()
+	res, err := c.Get(ctx, s.dir(), clientv3.WithPrefix())
+	if err != nil {
+		return nil, fmt.Errorf("etcd get %s: %w", s.dir(), err)
+	}
+
+	revisions := make(map[string]int64, len(res.Kvs))
+	out := map[string]any{}
+	for _, kv := range res.Kvs {
+		rel := strings.TrimPrefix(string(kv.Key), s.dir())
+		revisions[rel] = kv.ModRevision
+		if rel == "" || strings.HasSuffix(rel, "/") {
+			continue
+		}
+		if err := setNested(out, strings.Split(rel, "/"), string(kv.Value)); err != nil {
+			return nil, fmt.Errorf("etcd %s: %w", s.Prefix, err)
+		}
+	}
+
+	s.mu.Lock()
+	s.revisions, s.rev = revisions, res.Header.Revision
+	s.mu.Unlock()
+	if len(res.Kvs) == 0 {
+		return nil, fmt.Errorf("%w: etcd prefix %s", ErrNotFound, s.dir())
+	}
+	return out, nil
+}
+
+// Write replaces the keys below the prefix in one transaction.
+func (s *EtcdStore) Write(ctx context.Context, data map[string]any) error {
+	s.mu.Lock()
+	revisions := s.revisions
+	s.mu.Unlock()
+	if revisions == nil {
+		// Read せずに書くときは今の状態を基準にする
+		if _, err := s.Read(ctx); err != nil && !errors.Is(err, ErrNotFound) {
+			return err
+		}
+		s.mu.Lock()
+		revisions = s.revisions
+		s.mu.Unlock()
+	}
+
+	flat := map[string]string{}
+	flattenNested("", data, flat)
+	keys := make([]string, 0, len(flat))
+	for k := range flat {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+
+	c, err := s.NewEtcdClient()
+	if err != nil {
+		return err
+	}
+	defer c.Close()
+	ctx, cancel := context.WithTimeout(ctx, s.Timeout)
+	defer cancel()
+
+	var putOpts []clientv3.OpOption
+	if s.TTL > 0 {
+		lease, err := c.Grant(ctx, int64(s.TTL/time.Second))
+		if err != nil {
+			return fmt.Errorf("etcd lease: %w", err)
+		}
+		putOpts = append(putOpts, clientv3.WithLease(lease.ID))
+	}
+
+	// 読んだキーは mod_revision が同じこと、新しいキーはまだ無いこと（mod_revision 0）
+	var (
+		cmps []clientv3.Cmp
+		ops  []clientv3.Op
+	)
+	for _, k := range keys {
+		cmps = append(cmps, clientv3.Compare(clientv3.ModRevision(s.dir()+k), "=", revisions[k]))
+		ops = append(ops, clientv3.OpPut(s.dir()+k, flat[k], putOpts...))
+	}
+	for k, rev := range revisions {
+		if _, ok := flat[k]; ok || k == "" || strings.HasSuffix(k, "/") {
+			continue
+		}
+		cmps = append(cmps, clientv3.Compare(clientv3.ModRevision(s.dir()+k), "=", rev))
+		ops = append(ops, clientv3.OpDelete(s.dir()+k))
+	}
+
+	res, err := c.Txn(ctx).If(cmps...).Then(ops...).Commit()
+	if err != nil {
+		return fmt.Errorf("etcd txn %s: %w", s.dir(), err)
+	}
+	if !res.Succeeded {
+		// 読み直すまで同じ基準で失敗し続ける（黙って上書きしない）
+		return fmt.Errorf("%w: etcd %s", ErrConflict, s.dir())
+	}
+
+	// 書いたキーはすべてこのトランザクションのリビジョンになる
+	next := make(map[string]int64, len(keys))
+	for _, k := range keys {
+		next[k] = res.Header.Revision
+	}
+	s.mu.Lock()
+	s.revisions, s.rev = next, res.Header.Revision
+	s.mu.Unlock()
+	return nil
+}
+
+// Probe asks the first endpoint for its status.
+func (s *EtcdStore) Probe(ctx context.Context) error {
+	c, err := s.NewEtcdClient()
+	if err != nil {
+		return err
+	}
+	defer c.Close()
+	ctx, cancel := context.WithTimeout(ctx, s.Timeout)
+	defer cancel()
+	if _, err := c.Status(ctx, s.Endpoints[0]); err != nil {
+		return fmt.Errorf("etcd status %s: %w", s.Endpoints[0], err)
+	}
+	return nil
+}
+
+// Watch follows a native etcd watch on the prefix. After a Read it resumes
+// from that revision, so nothing in between is missed.
+func (s *EtcdStore) Watch(ctx context.Context, changed func()) error {
+	c, err := s.NewEtcdClient()
+	if err != nil {
+		return err
+	}
+	defer c.Close()
+
+	opts := []clientv3.OpOption{clientv3.WithPrefix()}
+	s.mu.Lock()
+	rev := s.rev
+	s.mu.Unlock()
+	if rev > 0 {
+		opts = append(opts, clientv3.WithRev(rev+1))
+	} else {
+		changed()
+	}
+
+	ctx = clientv3.WithRequireLeader(ctx)
+	for res := range c.Watch(ctx, s.dir(), opts...) {
+		if err := res.Err(); err != nil {
+			if ctx.Err() != nil {
+				return nil
+			}
+			return fmt.Errorf("etcd watch %s: %w", s.dir(), err)
+		}
+		if len(res.Events) > 0 {
+			changed()
+		}
+	}
+	return nil
+}
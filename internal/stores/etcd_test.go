@@ -0,0 +1,417 @@
+package stores
+
+import (
+	"bytes"
+	"context"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/tls"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/pem"
+	"math/big"
+	"net"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+	pb "go.etcd.io/etcd/api/v3/etcdserverpb"
+	"go.etcd.io/etcd/api/v3/mvccpb"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/credentials"
+	"google.golang.org/grpc/status"
+)
+
+// fakeEtcd は clientv3 が使う KV / Watch / Lease / Maintenance の最低限を
+// メモリ上で実装する（embed の etcd サーバーは依存が大きすぎるため）
+type fakeEtcd struct {
+	pb.UnimplementedKVServer
+	pb.UnimplementedWatchServer
+	pb.UnimplementedLeaseServer
+	pb.UnimplementedMaintenanceServer
+
+	mu      sync.Mutex
+	rev     int64
+	kv      map[string]*mvccpb.KeyValue
+	history []*mvccpb.Event
+	changed chan struct{}
+	leaseID int64
+}
+
+func newFakeEtcd(t *testing.T, creds credentials.TransportCredentials) (*fakeEtcd, string) {
+	t.Helper()
+	f := &fakeEtcd{rev: 1, kv: map[string]*mvccpb.KeyValue{}, changed: make(chan struct{})}
+	var opts []grpc.ServerOption
+	if creds != nil {
+		opts = append(opts, grpc.Creds(creds))
+	}
+	srv := grpc.NewServer(opts...)
+	pb.RegisterKVServer(srv, f)
+	pb.RegisterWatchServer(srv, f)
+	pb.RegisterLeaseServer(srv, f)
+	pb.RegisterMaintenanceServer(srv, f)
+
+	l, err := net.Listen("tcp", "127.0.0.1:0")
+	require.NoError(t, err)
+	go func() { _ = srv.Serve(l) }()
+	t.Cleanup(srv.Stop)
+	return f, l.Addr().String()
+}
+
+func inRange(key, start, end []byte) bool {
+	switch {
+	case len(end) == 0:
+		return bytes.Equal(key, start)
+	case bytes.Equal(end, []byte{0}):
+		return bytes.Compare(key, start) >= 0
+	default:
+		return bytes.Compare(key, start) >= 0 && bytes.Compare(key, end) < 0
+	}
+}
+
+func (f *fakeEtcd) header() *pb.ResponseHeader { return &pb.ResponseHeader{Revision: f.rev} }
+
+// put / del は f.mu を持って、すでに進めたリビジョンで呼ぶ
+func (f *fakeEtcd) put(key, value []byte, lease int64) {
+	kv := &mvccpb.KeyValue{Key: key, Value: value, ModRevision: f.rev, CreateRevision: f.rev, Version: 1, Lease: lease}
+	if cur, ok := f.kv[string(key)]; ok {
+		kv.CreateRevision, kv.Version = cur.CreateRevision, cur.Version+1
+	}
+	f.kv[string(key)] = kv
+	f.history = append(f.history, &mvccpb.Event{Type: mvccpb.PUT, Kv: kv})
+}
+
+func (f *fakeEtcd) del(start, end []byte) int64 {
+	var n int64
+	for k, kv := range f.kv {
+		if inRange(kv.Key, start, end) {
+			delete(f.kv, k)
+			f.history = append(f.history, &mvccpb.Event{Type: mvccpb.DELETE, Kv: &mvccpb.KeyValue{Key: kv.Key, ModRevision: f.rev}})
+			n++
+		}
+	}
+	return n
+}
+
+func (f *fakeEtcd) commit() {
+	close(f.changed)
+	f.changed = make(chan struct{})
+}
+
+func (f *fakeEtcd) set(key, value string) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	f.rev++
+	f.put([]byte(key), []byte(value), 0)
+	f.commit()
+}
+
+func (f *fakeEtcd) Range(ctx context.Context, r *pb.RangeRequest) (*pb.RangeResponse, error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	res := &pb.RangeResponse{Header: f.header()}
+	for _, kv := range f.kv {
+		if inRange(kv.Key, r.Key, r.RangeEnd) {
+			res.Kvs = append(res.Kvs, kv)
+		}
+	}
+	sort.Slice(res.Kvs, func(i, j int) bool { return bytes.Compare(res.Kvs[i].Key, res.Kvs[j].Key) < 0 })
+	res.Count = int64(len(res.Kvs))
+	return res, nil
+}
+
+func (f *fakeEtcd) Txn(ctx context.Context, r *pb.TxnRequest) (*pb.TxnResponse, error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	ok := true
+	for _, c := range r.Compare {
+		if c.Target != pb.Compare_MOD || c.Result != pb.Compare_EQUAL {
+			return nil, status.Errorf(codes.Unimplemented, "fake etcd: compare %s %s", c.Target, c.Result)
+		}
+		var cur int64
+		if kv, found := f.kv[string(c.Key)]; found {
+			cur = kv.ModRevision
+		}
+		ok = ok && cur == c.GetModRevision()
+	}
+	ops := r.Success
+	if !ok {
+		ops = r.Failure
+	}
+	res := &pb.TxnResponse{Succeeded: ok}
+	if len(ops) > 0 {
+		f.rev++
+	}
+	for _, op := range ops {
+		switch {
+		case op.GetRequestPut() != nil:
+			p := op.GetRequestPut()
+			f.put(p.Key, p.Value, p.Lease)
+			res.Responses = append(res.Responses, &pb.ResponseOp{Response: &pb.ResponseOp_ResponsePut{ResponsePut: &pb.PutResponse{}}})
+		case op.GetRequestDeleteRange() != nil:
+			d := op.GetRequestDeleteRange()
+			n := f.del(d.Key, d.RangeEnd)
+			res.Responses = append(res.Responses, &pb.ResponseOp{Response: &pb.ResponseOp_ResponseDeleteRange{ResponseDeleteRange: &pb.DeleteRangeResponse{Deleted: n}}})
+		default:
+			return nil, status.Error(codes.Unimplemented, "fake etcd: txn op")
+		}
+	}
+	if len(ops) > 0 {
+		f.commit()
+	}
+	res.Header = f.header()
+	return res, nil
+}
+
+func (f *fakeEtcd) LeaseGrant(ctx context.Context, r *pb.LeaseGrantRequest) (*pb.LeaseGrantResponse, error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	f.leaseID++
+	return &pb.LeaseGrantResponse{Header: f.header(), ID: f.leaseID, TTL: r.TTL}, nil
+}
+
+func (f *fakeEtcd) Status(ctx context.Context, r *pb.StatusRequest) (*pb.StatusResponse, error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	return &pb.StatusResponse{Header: f.header(), Version: "3.6.4", Leader: 1}, nil
+}
+
+func (f *fakeEtcd) Watch(stream pb.Watch_WatchServer) error {
+	var (
+		sendMu sync.Mutex
+		nextID int64
+	)
+	send := func(res *pb.WatchResponse) error {
+		sendMu.Lock()
+		defer sendMu.Unlock()
+		return stream.Send(res)
+	}
+	ctx := stream.Context()
+	for {
+		req, err := stream.Recv()
+		if err != nil {
+			return nil
+		}
+		cr := req.GetCreateRequest()
+		if cr == nil {
+			continue
+		}
+		id := nextID
+		nextID++
+		f.mu.Lock()
+		next := cr.StartRevision
+		if next == 0 {
+			next = f.rev + 1
+		}
+		hdr := f.header()
+		f.mu.Unlock()
+		if err := send(&pb.WatchResponse{Header: hdr, WatchId: id, Created: true}); err != nil {
+			return nil
+		}
+
+		go func() {
+			for {
+				f.mu.Lock()
+				var evs []*mvccpb.Event
+				for _, ev := range f.history {
+					if ev.Kv.ModRevision >= next && inRange(ev.Kv.Key, cr.Key, cr.RangeEnd) {
+						evs = append(evs, ev)
+					}
+				}
+				hdr, ch := f.header(), f.changed
+				f.mu.Unlock()
+
+				if len(evs) > 0 {
+					next = evs[len(evs)-1].Kv.ModRevision + 1
+					if err := send(&pb.WatchResponse{Header: hdr, WatchId: id, Events: evs}); err != nil {
+						return
+					}
+				}
+				select {
+				case <-ch:
+				case <-ctx.Done():
+					return
+				}
+			}
+		}()
+	}
+}
+
+func TestEtcdStore(t *testing.T) {
+	r := require.New(t)
+	ctx := context.Background()
+	fake, addr := newFakeEtcd(t, nil)
+	fake.set("flags/beta/search", "true")
+	fake.set("flags/rollout", "25")
+	fake.set("flagship/x", "other prefix")
+
+	defaults := map[string]any{"endpoints": []any{addr}, "prefix": "flags", "timeout": "5s"}
+
+	st := openStore(t, "etcd", defaults, nil)
+	data, err := st.Read(ctx)
+	r.NoError(err)
+	r.Equal(map[string]any{
+		"beta":    map[string]any{"search": "true"},
+		"rollout": "25",
+	}, data)
+	r.NoError(Probe(ctx, st))
+
+	// 読んだ後に他で変わったらトランザクションごと失敗する
+	w := st.(Writer)
+	data["rollout"] = "50"
+	fake.set("flags/beta/search", "false")
+	r.ErrorIs(w.Write(ctx, data), ErrConflict)
+	r.ErrorIs(w.Write(ctx, data), ErrConflict)
+	r.Equal("25", string(fake.kv["flags/rollout"].Value))
+
+	data, err = st.Read(ctx)
+	r.NoError(err)
+	data["rollout"] = "50"
+	delete(data, "beta")
+	r.NoError(w.Write(ctx, data))
+	// 続けて書いても自分の書き込みとは衝突しない
+	data["new"] = "1"
+	r.NoError(w.Write(ctx, data))
+
+	data, err = openStore(t, "etcd", defaults, nil).Read(ctx)
+	r.NoError(err)
+	r.Equal(map[string]any{"rollout": "50", "new": "1"}, data)
+
+	got, err := Config{}.Get(ctx, "etcd://flags?endpoints="+addr+"#rollout")
+	r.NoError(err)
+	r.Equal("50", got)
+
+	// ttl 付きの書き込みは lease に紐づく
+	r.NoError(openStore(t, "etcd", defaults, map[string]any{"prefix": "session", "ttl": "30s"}).(Writer).Write(ctx, map[string]any{"A": "1"}))
+	r.NotZero(fake.kv["session/A"].Lease)
+	r.Zero(fake.kv["flags/rollout"].Lease)
+
+	_, err = openStore(t, "etcd", defaults, map[string]any{"prefix": "missing"}).Read(ctx)
+	r.ErrorIs(err, ErrNotFound)
+
+	_, err = Open(StoreConfig{Type: "etcd", Args: map[string]any{"prefix": "x", "ttl": "100ms"}})
+	r.Error(err)
+	_, err = Open(StoreConfig{Type: "etcd", Args: map[string]any{"prefix": "x", "cert": "c.pem"}})
+	r.Error(err)
+}
+
+func TestEtcdWatch(t *testing.T) {
+	r := require.New(t)
+	fake, addr := newFakeEtcd(t, nil)
+	fake.set("flags/A", "1")
+
+	st, err := Open(StoreConfig{Type: "etcd", Args: map[string]any{"endpoints": []any{addr}, "prefix": "flags"}})
+	r.NoError(err)
+
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+	events := make(chan Event, 8)
+	errc := make(chan error, 1)
+	go func() {
+		errc <- Watch(ctx, st, WatchOptions{Source: "test", Interval: time.Hour}, events)
+	}()
+
+	var ev Event
+	for i, got := 2, false; !got; i++ {
+		fake.set("flags/A", strconv.Itoa(i))
+		select {
+		case ev = <-events:
+			got = true
+		case <-time.After(200 * time.Millisecond):
+		case <-ctx.Done():
+			t.Fatal("timeout waiting for event")
+		}
+	}
+	r.Equal("A", ev.Key)
+	r.NotEqual(ev.OldHash, ev.NewHash)
+
+	cancel()
+	r.NoError(<-errc)
+}
+
+func TestEtcdStoreTLS(t *testing.T) {
+	r := require.New(t)
+	ctx := context.Background()
+	dir := t.TempDir()
+	ca, caKey := testCert(t, dir, "ca", nil, nil)
+	testCert(t, dir, "server", ca, caKey)
+	testCert(t, dir, "client", ca, caKey)
+
+	serverCert, err := tls.LoadX509KeyPair(filepath.Join(dir, "server.pem"), filepath.Join(dir, "server-key.pem"))
+	r.NoError(err)
+	pool := x509.NewCertPool()
+	pool.AddCert(ca)
+	fake, addr := newFakeEtcd(t, credentials.NewTLS(&tls.Config{
+		Certificates: []tls.Certificate{serverCert},
+		ClientCAs:    pool,
+		ClientAuth:   tls.RequireAndVerifyClientCert,
+		MinVersion:   tls.VersionTLS12,
+	}))
+	fake.set("app/A", "1")
+
+	st, err := Open(StoreConfig{Type: "etcd", Args: map[string]any{
+		"endpoints": []any{addr},
+		"prefix":    "app",
+		"cert":      filepath.Join(dir, "client.pem"),
+		"key":       filepath.Join(dir, "client-key.pem"),
+		"cacert":    filepath.Join(dir, "ca.pem"),
+	}})
+	r.NoError(err)
+	data, err := st.Read(ctx)
+	r.NoError(err)
+	r.Equal(map[string]any{"A": "1"}, data)
+
+	// クライアント証明書なしでは読めない
+	st, err = Open(StoreConfig{Type: "etcd", Args: map[string]any{
+		"endpoints": []any{addr},
+		"prefix":    "app",
+		"cacert":    filepath.Join(dir, "ca.pem"),
+		"timeout":   "1s",
+	}})
+	r.NoError(err)
+	_, err = st.Read(ctx)
+	r.Error(err)
+}
+
+// testCert は <name>.pem / <name>-key.pem を書く。parent が nil なら自己署名の CA
+func testCert(t *testing.T, dir, name string, parent *x509.Certificate, parentKey *ecdsa.PrivateKey) (*x509.Certificate, *ecdsa.PrivateKey) {
+	t.Helper()
+	r := require.New(t)
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	r.NoError(err)
+	tmpl := &x509.Certificate{
+		SerialNumber: big.NewInt(time.Now().UnixNano()),
+		Subject:      pkix.Name{CommonName: name},
+		NotBefore:    time.Now().Add(-time.Hour),
+		NotAfter:     time.Now().Add(time.Hour),
+		KeyUsage:     x509.KeyUsageDigitalSignature,
+	}
+	switch {
+	case parent == nil:
+		tmpl.IsCA, tmpl.BasicConstraintsValid = true, true
+		tmpl.KeyUsage |= x509.KeyUsageCertSign
+		parent, parentKey = tmpl, key
+	case name == "server":
+		tmpl.ExtKeyUsage = []x509.ExtKeyUsage{x509.ExtKeyUsageServerAuth}
+		tmpl.IPAddresses = []net.IP{net.ParseIP("127.0.0.1")}
+		tmpl.DNSNames = []string{"localhost"}
+	default:
+		tmpl.ExtKeyUsage = []x509.ExtKeyUsage{x509.ExtKeyUsageClientAuth}
+	}
+	der, err := x509.CreateCertificate(rand.Reader, tmpl, parent, &key.PublicKey, parentKey)
+	r.NoError(err)
+	cert, err := x509.ParseCertificate(der)
+	r.NoError(err)
+	keyDER, err := x509.MarshalECPrivateKey(key)
+	r.NoError(err)
+	r.NoError(os.WriteFile(filepath.Join(dir, name+".pem"), pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: der}), 0o600))
+	r.NoError(os.WriteFile(filepath.Join(dir, name+"-key.pem"), pem.EncodeToMemory(&pem.Block{Type: "EC PRIVATE KEY", Bytes: keyDER}), 0o600))
+	return cert, key
+}
@@ -0,0 +1,364 @@
+package stores
+
+import (
+	"bytes"
+	"context"
+	"crypto"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/sha256"
+	"crypto/x509"
+	"encoding/base64"
+	"encoding/json"
+	"encoding/pem"
+	"errors"
+	"fmt"
+	"hash/crc32"
+	"io"
+	"net/http"
+	"net/url"
+	"os"
+	"path"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+)
+
+func init() {
+	Register("gcp-secretmanager", newGCPSecretStore)
+}
+
+const gcpScope = "https://www.googleapis.com/auth/cloud-platform"
+
+// GCPSecretStore reads secrets of one project from GCP Secret Manager: the
+// named Secrets, or every secret matching Labels. Each secret is a key and
+// the payload of Version ("latest" by default) is its value.
+//
+// Credentials are a service-account key or an external_account (workload
+// identity federation) file, from credentials_file or
+// GOOGLE_APPLICATION_CREDENTIALS.
+type GCPSecretStore struct {
+	Project  string
+	Secrets  []string
+	Labels   map[string]string
+	Version  string
+	Endpoint string
+	Timeout  time.Duration
+
+	Client *http.Client
+	tokens *tokenCache
+}
+
+// gcpCredentials は認証情報 JSON のうち使うところだけ
+type gcpCredentials struct {
+	Type string `json:"type"`
+
+	// service_account
+	ProjectID    string `json:"project_id"`
+	PrivateKeyID string `json:"private_key_id"`
+	PrivateKey   string `json:"private_key"`
+	ClientEmail  string `json:"client_email"`
+	TokenURI     string `json:"token_uri"`
+
+	// external_account
+	Audience                       string `json:"audience"`
+	SubjectTokenType               string `json:"subject_token_type"`
+	TokenURL                       string `json:"token_url"`
+	ServiceAccountImpersonationURL string `json:"service_account_impersonation_url"`
+	CredentialSource               struct {
+		File   string `json:"file"`
+		Format struct {
+			Type                  string `json:"type"`
+			SubjectTokenFieldName string `json:"subject_token_field_name"`
+		} `json:"format"`
+	} `json:"credential_source"`
+}
+
+func newGCPSecretStore(args map[string]any) (Store, error) {
+	var (
+		s   GCPSecretStore
+		err error
+	)
+	credFile, err := argString(args, "credentials_file", os.Getenv("GOOGLE_APPLICATION_CREDENTIALS"))
+	if err != nil {
+		return nil, err
+	}
+	if s.Project, err = argString(args, "project", ""); err != nil {
+		return nil, err
+	}
+	if s.Secrets, err = argStrings(args, "secrets"); err != nil {
+		return nil, err
+	}
+	if s.Labels, err = argStringMap(args, "labels"); err != nil {
+		return nil, err
+	}
+	if s.Version, err = argString(args, "version", "latest"); err != nil {
+		return nil, err
+	}
+	if s.Endpoint, err = argString(args, "endpoint", "https://secretmanager.googleapis.com"); err != nil {
+		return nil, err
+	}
+	if s.Timeout, err = argDuration(args, "timeout", 10*time.Second); err != nil {
+		return nil, err
+	}
+	if len(s.Secrets) > 0 && len(s.Labels) > 0 {
+		return nil, errors.New("gcp-secretmanager store: use either \"secrets\" or \"labels\", not both")
+	}
+	if credFile == "" {
+		return nil, errors.New("gcp-secretmanager store: missing arg \"credentials_file\" (or GOOGLE_APPLICATION_CREDENTIALS)")
+	}
+	b, err := os.ReadFile(credFile)
+	if err != nil {
+		return nil, fmt.Errorf("gcp credentials: %w", err)
+	}
+	var creds gcpCredentials
+	if err := json.Unmarshal(b, &creds); err != nil {
+		return nil, fmt.Errorf("gcp credentials %s: %w", credFile, err)
+	}
+	if s.Project == "" {
+		s.Project = creds.ProjectID
+	}
+	if s.Project == "" {
+		s.Project = os.Getenv("GOOGLE_CLOUD_PROJECT")
+	}
+	if s.Project == "" {
+		return nil, errors.New("gcp-secretmanager store: missing arg \"project\"")
+	}
+
+	switch creds.Type {
+	case "service_account":
+		key, err := parseRSAKey(creds.PrivateKey)
+		if err != nil {
+			return nil, fmt.Errorf("gcp credentials %s: %w", credFile, err)
+		}
+		s.tokens = &tokenCache{fetch: func(ctx context.Context) (string, time.Duration, error) {
+			return s.serviceAccountToken(ctx, creds, key)
+		}}
+	case "external_account":
+		if creds.CredentialSource.File == "" {
+			return nil, fmt.Errorf("gcp credentials %s: only file-sourced external accounts are supported", credFile)
+		}
+		s.tokens = &tokenCache{fetch: func(ctx context.Context) (string, time.Duration, error) {
+			return s.externalAccountToken(ctx, creds)
+		}}
+	default:
+		return nil, fmt.Errorf("gcp credentials %s: unsupported type %q (want service_account or external_account)", credFile, creds.Type)
+	}
+	return &s, nil
+}
+
+func parseRSAKey(pemKey string) (*rsa.PrivateKey, error) {
+	block, _ := pem.Decode([]byte(pemKey))
+	if block == nil {
+		return nil, errors.New("private_key is not PEM")
+	}
+	if k, err := x509.ParsePKCS1PrivateKey(block.Bytes); err == nil {
+		return k, nil
+	}
+	k, err := x509.ParsePKCS8PrivateKey(block.Bytes)
+	if err != nil {
+		return nil, fmt.Errorf("private_key: %w", err)
+	}
+	rk, ok := k.(*rsa.PrivateKey)
+	if !ok {
+		return nil, fmt.Errorf("private_key: want RSA, got %T", k)
+	}
+	return rk, nil
+}
+
+func (s *GCPSecretStore) client() *http.Client {
+	if s.Client != nil {
+		return s.Client
+	}
+	return http.DefaultClient
+}
+
+// serviceAccountToken は署名した JWT をアクセストークンに交換する（JWT bearer grant）
+func (s *GCPSecretStore) serviceAccountToken(ctx context.Context, creds gcpCredentials, key *rsa.PrivateKey) (string, time.Duration, error) {
+	now := time.Now()
+	enc := func(v any) string {
+		b, _ := json.Marshal(v)
+		return base64.RawURLEncoding.EncodeToString(b)
+	}
+	signing := enc(map[string]string{"alg": "RS256", "typ": "JWT", "kid": creds.PrivateKeyID}) + "." +
+		enc(map[string]any{
+			"iss":   creds.ClientEmail,
+			"scope": gcpScope,
+			"aud":   creds.TokenURI,
+			"iat":   now.Unix(),
+			"exp":   now.Add(time.Hour).Unix(),
+		})
+	sum := sha256.Sum256([]byte(signing))
+	sig, err := rsa.SignPKCS1v15(rand.Reader, key, crypto.SHA256, sum[:])
+	if err != nil {
+		return "", 0, err
+	}
+	return postTokenForm(ctx, s.client(), creds.TokenURI, url.Values{
+		"grant_type": {"urn:ietf:params:oauth:grant-type:jwt-bearer"},
+		"assertion":  {signing + "." + base64.RawURLEncoding.EncodeToString(sig)},
+	})
+}
+
+// externalAccountToken は Workload Identity 連携: ファイルのトークンを STS で交換し、
+// 指定があればサービスアカウントになりすます
+func (s *GCPSecretStore) externalAccountToken(ctx context.Context, creds gcpCredentials) (string, time.Duration, error) {
+	src := creds.CredentialSource
+	b, err := os.ReadFile(src.File)
+	if err != nil {
+		return "", 0, fmt.Errorf("subject token: %w", err)
+	}
+	subject := strings.TrimSpace(string(b))
+	if src.Format.Type == "json" {
+		var m map[string]any
+		if err := json.Unmarshal(b, &m); err != nil {
+			return "", 0, fmt.Errorf("subject token %s: %w", src.File, err)
+		}
+		v, ok := m[src.Format.SubjectTokenFieldName].(string)
+		if !ok {
+			return "", 0, fmt.Errorf("subject token %s: no field %q", src.File, src.Format.SubjectTokenFieldName)
+		}
+		subject = v
+	}
+
+	tok, ttl, err := postTokenForm(ctx, s.client(), creds.TokenURL, url.Values{
+		"grant_type":           {"urn:ietf:params:oauth:grant-type:token-exchange"},
+		"audience":             {creds.Audience},
+		"scope":                {gcpScope},
+		"requested_token_type": {"urn:ietf:params:oauth:token-type:access_token"},
+		"subject_token":        {subject},
+		"subject_token_type":   {creds.SubjectTokenType},
+	})
+	if err != nil || creds.ServiceAccountImpersonationURL == "" {
+		return tok, ttl, err
+	}
+
+	body, _ := json.Marshal(map[string]any{"scope": []string{gcpScope}})
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, creds.ServiceAccountImpersonationURL, bytes.NewReader(body))
+	if err != nil {
+		return "", 0, err
+	}
+	req.Header.Set("Authorization", "Bearer "+tok)
+	req.Header.Set("Content-Type", "application/json")
+	res, err := s.client().Do(req)
+	if err != nil {
+		return "", 0, fmt.Errorf("impersonate: %w", err)
+	}
+	defer res.Body.Close()
+	rb, _ := io.ReadAll(io.LimitReader(res.Body, 1<<20))
+	if res.StatusCode != http.StatusOK {
+		return "", 0, fmt.Errorf("impersonate: %s: %s", res.Status, strings.TrimSpace(string(rb)))
+	}
+	var ir struct {
+		AccessToken string    `json:"accessToken"`
+		ExpireTime  time.Time `json:"expireTime"`
+	}
+	if err := json.Unmarshal(rb, &ir); err != nil {
+		return "", 0, fmt.Errorf("impersonate: %w", err)
+	}
+	return ir.AccessToken, time.Until(ir.ExpireTime), nil
+}
+
+// Identity は GOOGLE_CLOUD_PROJECT などを反映したプロジェクト（New で解決済み）
+func (s *GCPSecretStore) Identity() map[string]any {
+	return map[string]any{"project": s.Project, "endpoint": s.Endpoint}
+}
+
+func (s *GCPSecretStore) Read(ctx context.Context) (map[string]any, error) {
+	ctx, cancel := context.WithTimeout(ctx, s.Timeout)
+	defer cancel()
+	token, err := s.tokens.Token(ctx)
+	if err != nil {
+		return nil, fmt.Errorf("gcp auth: %w", err)
+	}
+
+	names := s.Secrets
+	listed := len(names) == 0
+	if listed {
+		if names, err = s.list(ctx, token); err != nil {
+			return nil, err
+		}
+	}
+
+	out := make(map[string]any, len(names))
+	for _, name := range names {
+		v, err := s.access(ctx, token, name)
+		var he *httpStatusError
+		if errors.As(err, &he) && he.Code == http.StatusNotFound {
+			if listed {
+				// バージョンがまだ無い（または無効化された）シークレットは飛ばす
+				continue
+			}
+			return nil, fmt.Errorf("%w: gcp secret %s/%s: %w", ErrNotFound, s.Project, name, err)
+		} else if err != nil {
+			return nil, fmt.Errorf("gcp secret %s/%s: %w", s.Project, name, err)
+		}
+		out[name] = v
+	}
+	if len(out) == 0 {
+		return nil, fmt.Errorf("%w: no secrets in project %s", ErrNotFound, s.Project)
+	}
+	return out, nil
+}
+
+// list は Labels に合うシークレットの ID を返す
+func (s *GCPSecretStore) list(ctx context.Context, token string) ([]string, error) {
+	q := url.Values{"pageSize": {"250"}}
+	if len(s.Labels) > 0 {
+		keys := make([]string, 0, len(s.Labels))
+		for k := range s.Labels {
+			keys = append(keys, k)
+		}
+		sort.Strings(keys)
+		var parts []string
+		for _, k := range keys {
+			parts = append(parts, "labels."+k+"="+s.Labels[k])
+		}
+		q.Set("filter", strings.Join(parts, " AND "))
+	}
+
+	var names []string
+	for {
+		var page struct {
+			Secrets []struct {
+				Name string `json:"name"`
+			} `json:"secrets"`
+			NextPageToken string `json:"nextPageToken"`
+		}
+		u := fmt.Sprintf("%s/v1/projects/%s/secrets?%s", strings.TrimRight(s.Endpoint, "/"), url.PathEscape(s.Project), q.Encode())
+		if err := getJSON(ctx, s.client(), u, token, &page); err != nil {
+			return nil, fmt.Errorf("gcp list secrets %s: %w", s.Project, err)
+		}
+		for _, sec := range page.Secrets {
+			names = append(names, path.Base(sec.Name))
+		}
+		if page.NextPageToken == "" {
+			return names, nil
+		}
+		q.Set("pageToken", page.NextPageToken)
+	}
+}
+
+func (s *GCPSecretStore) access(ctx context.Context, token, name string) (string, error) {
+	var res struct {
+		Payload struct {
+			Data       []byte `json:"data"`
+			DataCrc32c string `json:"dataCrc32c"`
+		} `json:"payload"`
+	}
+	u := fmt.Sprintf("%s/v1/projects/%s/secrets/%s/versions/%s:access",
+		strings.TrimRight(s.Endpoint, "/"), url.PathEscape(s.Project), url.PathEscape(name), url.PathEscape(s.Version))
+	if err := getJSON(ctx, s.client(), u, token, &res); err != nil {
+		return "", err
+	}
+	if res.Payload.DataCrc32c != "" {
+		want, err := strconv.ParseUint(res.Payload.DataCrc32c, 10, 32)
+		if err != nil {
+			return "", fmt.Errorf("dataCrc32c: %w", err)
+		}
+		if got := crc32.Checksum(res.Payload.Data, crc32.MakeTable(crc32.Castagnoli)); uint64(got) != want {
+			return "", fmt.Errorf("payload checksum mismatch (crc32c %d, want %d)", got, want)
+		}
+	}
+	return string(res.Payload.Data), nil
+}
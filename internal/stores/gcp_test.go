@@ -0,0 +1,261 @@
+package stores
+
+import (
+	"context"
+	"crypto"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/sha256"
+	"crypto/x509"
+	"encoding/base64"
+	"encoding/json"
+	"encoding/pem"
+	"hash/crc32"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+type fakeGCPSecret struct {
+	labels map[string]string
+	// version -> payload
+	versions map[string]string
+}
+
+// fakeGCP はトークンエンドポイント（JWT bearer と STS）と Secret Manager の
+// list / access だけを返す
+type fakeGCP struct {
+	pub     *rsa.PublicKey
+	subject string
+	secrets map[string]fakeGCPSecret
+	// 発行したトークンの数
+	issued int
+	// access の応答を壊す（チェックサムの確認用）
+	corrupt bool
+}
+
+func (f *fakeGCP) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	write := func(code int, v any) {
+		w.Header().Set("Content-Type", "application/json")
+		w.WriteHeader(code)
+		_ = json.NewEncoder(w).Encode(v)
+	}
+	switch {
+	case r.URL.Path == "/token":
+		// 署名と主要なクレームが合わなければ invalid_grant
+		_ = r.ParseForm()
+		var claims struct {
+			Iss   string `json:"iss"`
+			Scope string `json:"scope"`
+		}
+		parts := strings.Split(r.Form.Get("assertion"), ".")
+		ok := r.Form.Get("grant_type") == "urn:ietf:params:oauth:grant-type:jwt-bearer" && len(parts) == 3
+		if ok {
+			sig, _ := base64.RawURLEncoding.DecodeString(parts[2])
+			sum := sha256.Sum256([]byte(parts[0] + "." + parts[1]))
+			cb, _ := base64.RawURLEncoding.DecodeString(parts[1])
+			ok = rsa.VerifyPKCS1v15(f.pub, crypto.SHA256, sum[:], sig) == nil &&
+				json.Unmarshal(cb, &claims) == nil &&
+				claims.Iss == "app@proj.iam.gserviceaccount.com" && claims.Scope == gcpScope
+		}
+		if !ok {
+			write(http.StatusBadRequest, map[string]string{"error": "invalid_grant"})
+			return
+		}
+		f.issued++
+		write(http.StatusOK, map[string]any{"access_token": "sa-token", "expires_in": 3600})
+
+	case r.URL.Path == "/sts":
+		_ = r.ParseForm()
+		if r.Form.Get("grant_type") != "urn:ietf:params:oauth:grant-type:token-exchange" || r.Form.Get("subject_token") != f.subject {
+			write(http.StatusBadRequest, map[string]string{"error": "invalid_grant"})
+			return
+		}
+		f.issued++
+		write(http.StatusOK, map[string]any{"access_token": "sts-token", "expires_in": 3600})
+
+	case strings.HasPrefix(r.URL.Path, "/v1/projects/proj/secrets"):
+		if a := r.Header.Get("Authorization"); a != "Bearer sa-token" && a != "Bearer sts-token" {
+			write(http.StatusUnauthorized, map[string]any{"error": map[string]any{"code": 401}})
+			return
+		}
+		rest := strings.TrimPrefix(r.URL.Path, "/v1/projects/proj/secrets")
+		if rest == "" {
+			f.list(r, write)
+			return
+		}
+		// /{secret}/versions/{version}:access
+		parts := strings.Split(strings.TrimPrefix(rest, "/"), "/")
+		version, ok := strings.CutSuffix(parts[len(parts)-1], ":access")
+		payload, found := f.secrets[parts[0]].versions[version]
+		if !ok || len(parts) != 3 || !found {
+			write(http.StatusNotFound, map[string]any{"error": map[string]any{"code": 404, "status": "NOT_FOUND"}})
+			return
+		}
+		crc := crc32.Checksum([]byte(payload), crc32.MakeTable(crc32.Castagnoli))
+		if f.corrupt {
+			crc++
+		}
+		write(http.StatusOK, map[string]any{
+			"name": "projects/123/secrets/" + parts[0] + "/versions/1",
+			"payload": map[string]any{
+				"data":       base64.StdEncoding.EncodeToString([]byte(payload)),
+				"dataCrc32c": strconv.FormatUint(uint64(crc), 10),
+			},
+		})
+
+	default:
+		http.NotFound(w, r)
+	}
+}
+
+// list は filter の "labels.k=v AND ..." だけ解釈し、1 件ずつページを分ける
+func (f *fakeGCP) list(r *http.Request, write func(int, any)) {
+	want := map[string]string{}
+	if filter := r.URL.Query().Get("filter"); filter != "" {
+		for _, cond := range strings.Split(filter, " AND ") {
+			k, v, _ := strings.Cut(strings.TrimPrefix(cond, "labels."), "=")
+			want[k] = v
+		}
+	}
+	var names []string
+	for name, s := range f.secrets {
+		match := true
+		for k, v := range want {
+			match = match && s.labels[k] == v
+		}
+		if match {
+			names = append(names, name)
+		}
+	}
+	sort.Strings(names)
+	start, _ := strconv.Atoi(r.URL.Query().Get("pageToken"))
+	res := map[string]any{}
+	if start < len(names) {
+		res["secrets"] = []map[string]any{{"name": "projects/proj/secrets/" + names[start]}}
+		if start+1 < len(names) {
+			res["nextPageToken"] = strconv.Itoa(start + 1)
+		}
+	}
+	write(http.StatusOK, res)
+}
+
+func newFakeGCP(t *testing.T) (*fakeGCP, *rsa.PrivateKey) {
+	key, err := rsa.GenerateKey(rand.Reader, 2048)
+	require.NoError(t, err)
+	return &fakeGCP{
+		pub:     &key.PublicKey,
+		subject: "k8s-projected-token",
+		secrets: map[string]fakeGCPSecret{
+			"db-password": {labels: map[string]string{"app": "api", "env": "prod"}, versions: map[string]string{"latest": "s3cret", "1": "old"}},
+			"api-key":     {labels: map[string]string{"app": "api", "env": "prod"}, versions: map[string]string{"latest": "k-123"}},
+			"staging-key": {labels: map[string]string{"app": "api", "env": "staging"}, versions: map[string]string{"latest": "k-stg"}},
+			// バージョンがまだ無い
+			"empty": {labels: map[string]string{"app": "api", "env": "prod"}},
+		},
+	}, key
+}
+
+func TestGCPSecretStoreServiceAccount(t *testing.T) {
+	r := require.New(t)
+	ctx := context.Background()
+	fake, key := newFakeGCP(t)
+	srv := httptest.NewServer(fake)
+	defer srv.Close()
+
+	der, err := x509.MarshalPKCS8PrivateKey(key)
+	r.NoError(err)
+	credFile := filepath.Join(t.TempDir(), "sa.json")
+	b, err := json.Marshal(map[string]any{
+		"type":           "service_account",
+		"project_id":     "proj",
+		"private_key_id": "kid1",
+		"private_key":    string(pem.EncodeToMemory(&pem.Block{Type: "PRIVATE KEY", Bytes: der})),
+		"client_email":   "app@proj.iam.gserviceaccount.com",
+		"token_uri":      srv.URL + "/token",
+	})
+	r.NoError(err)
+	r.NoError(os.WriteFile(credFile, b, 0o600))
+	t.Setenv("GOOGLE_APPLICATION_CREDENTIALS", credFile)
+
+	defaults := map[string]any{"endpoint": srv.URL}
+
+	st := openStore(t, "gcp-secretmanager", defaults, map[string]any{"labels": map[string]any{"app": "api", "env": "prod"}})
+	data, err := st.Read(ctx)
+	r.NoError(err)
+	r.Equal(map[string]any{"api-key": "k-123", "db-password": "s3cret"}, data)
+	// トークンは使い回す
+	_, err = st.Read(ctx)
+	r.NoError(err)
+	r.Equal(1, fake.issued)
+
+	data, err = openStore(t, "gcp-secretmanager", defaults, map[string]any{"secrets": []any{"db-password"}, "version": "1"}).Read(ctx)
+	r.NoError(err)
+	r.Equal(map[string]any{"db-password": "old"}, data)
+
+	_, err = openStore(t, "gcp-secretmanager", defaults, map[string]any{"secrets": []any{"missing"}}).Read(ctx)
+	r.ErrorIs(err, ErrNotFound)
+
+	_, err = openStore(t, "gcp-secretmanager", defaults, map[string]any{"labels": map[string]any{"env": "dev"}}).Read(ctx)
+	r.ErrorIs(err, ErrNotFound)
+
+	fake.corrupt = true
+	_, err = openStore(t, "gcp-secretmanager", defaults, map[string]any{"secrets": []any{"api-key"}}).Read(ctx)
+	r.ErrorContains(err, "checksum")
+	fake.corrupt = false
+
+	// 別の鍵で署名したトークン要求は拒否される
+	other, err := rsa.GenerateKey(rand.Reader, 2048)
+	r.NoError(err)
+	fake.pub = &other.PublicKey
+	_, err = openStore(t, "gcp-secretmanager", defaults, nil).Read(ctx)
+	r.ErrorContains(err, "invalid_grant")
+
+	_, err = Open(StoreConfig{Type: "gcp-secretmanager", Args: map[string]any{
+		"secrets": []any{"a"}, "labels": map[string]any{"app": "api"},
+	}})
+	r.Error(err)
+}
+
+func TestGCPSecretStoreExternalAccount(t *testing.T) {
+	r := require.New(t)
+	ctx := context.Background()
+	fake, _ := newFakeGCP(t)
+	srv := httptest.NewServer(fake)
+	defer srv.Close()
+
+	dir := t.TempDir()
+	tokenFile := filepath.Join(dir, "token")
+	r.NoError(os.WriteFile(tokenFile, []byte(fake.subject+"\n"), 0o600))
+	credFile := filepath.Join(dir, "wif.json")
+	b, err := json.Marshal(map[string]any{
+		"type":               "external_account",
+		"audience":           "//iam.googleapis.com/projects/123/locations/global/workloadIdentityPools/p/providers/k8s",
+		"subject_token_type": "urn:ietf:params:oauth:token-type:jwt",
+		"token_url":          srv.URL + "/sts",
+		"credential_source":  map[string]any{"file": tokenFile},
+	})
+	r.NoError(err)
+	r.NoError(os.WriteFile(credFile, b, 0o600))
+	t.Setenv("GOOGLE_CLOUD_PROJECT", "proj")
+
+	st, err := Open(StoreConfig{Type: "gcp-secretmanager", Args: map[string]any{
+		"credentials_file": credFile, "endpoint": srv.URL, "secrets": []any{"api-key"},
+	}})
+	r.NoError(err)
+	data, err := st.Read(ctx)
+	r.NoError(err)
+	r.Equal(map[string]any{"api-key": "k-123"}, data)
+
+	// プロジェクトが分からなければ作れない
+	t.Setenv("GOOGLE_CLOUD_PROJECT", "")
+	_, err = Open(StoreConfig{Type: "gcp-secretmanager", Args: map[string]any{"credentials_file": credFile}})
+	r.ErrorContains(err, "project")
+}
@@ -0,0 +1,98 @@
+package stores
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io/fs"
+	"strings"
+	"time"
+
+	"github.com/sasano8/kvtool/internal/localvault"
+)
+
+func init() {
+	Register("local", newLocalStore)
+	// local://<namespace>[#KEY]（ファイルは KVTOOL_LOCAL_VAULT か ?path=）
+	RegisterScheme("local", func(ref *Ref, rest string) error {
+		ns := strings.Trim(rest, "/")
+		if ns == "" {
+			ns = "default"
+		}
+		ref.Store = StoreConfig{Type: "local", Args: map[string]any{"namespace": ns}}
+		return nil
+	})
+}
+
+// LocalStore reads one namespace of a local encrypted vault file (see
+// package localvault). It is unlocked with a key file or a passphrase file,
+// or KVTOOL_LOCAL_KEY_FILE / KVTOOL_LOCAL_PASSPHRASE.
+type LocalStore struct {
+	Path           string
+	Namespace      string
+	KeyFile        string
+	PassphraseFile string
+}
+
+func newLocalStore(args map[string]any) (Store, error) {
+	var (
+		s   LocalStore
+		err error
+	)
+	if s.Path, err = argString(args, "path", localvault.DefaultPath()); err != nil {
+		return nil, err
+	}
+	if s.Namespace, err = argString(args, "namespace", "default"); err != nil {
+		return nil, err
+	}
+	if s.KeyFile, err = argString(args, "key_file", ""); err != nil {
+		return nil, err
+	}
+	if s.PassphraseFile, err = argString(args, "passphrase_file", ""); err != nil {
+		return nil, err
+	}
+	return &s, nil
+}
+
+func (s *LocalStore) secret() (localvault.Secret, error) {
+	return localvault.LoadSecret(s.KeyFile, s.PassphraseFile)
+}
+
+func (s *LocalStore) Identity() map[string]any {
+	return map[string]any{"path": absPath(s.Path), "namespace": s.Namespace}
+}
+
+func (s *LocalStore) Read(ctx context.Context) (map[string]any, error) {
+	sec, err := s.secret()
+	if err != nil {
+		return nil, err
+	}
+	v, err := localvault.Open(s.Path, sec)
+	if errors.Is(err, fs.ErrNotExist) {
+		return nil, fmt.Errorf("%w: %w", ErrNotFound, err)
+	} else if err != nil {
+		return nil, fmt.Errorf("local vault %s: %w", s.Path, err)
+	}
+	return stringMap(v.Values(s.Namespace)), nil
+}
+
+// Write makes data the content of the namespace. Changed keys get a new
+// version; removed keys are marked deleted and keep their history.
+func (s *LocalStore) Write(ctx context.Context, data map[string]any) error {
+	sec, err := s.secret()
+	if err != nil {
+		return err
+	}
+	values := make(map[string]string, len(data))
+	for k, v := range data {
+		values[k] = fmt.Sprint(v)
+	}
+	return localvault.Update(s.Path, sec, func(v *localvault.Vault) error {
+		v.Replace(s.Namespace, values, time.Now().UTC())
+		return nil
+	})
+}
+
+func (s *LocalStore) Watch(ctx context.Context, changed func()) error {
+	return (&DotenvStore{Path: s.Path}).Watch(ctx, changed)
+}
@@ -0,0 +1,60 @@
+package stores
+
+import (
+	"context"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+
+	"github.com/sasano8/kvtool/internal/localvault"
+)
+
+func TestLocalStore(t *testing.T) {
+	r := require.New(t)
+	ctx := context.Background()
+	dir := t.TempDir()
+	path := filepath.Join(dir, "local.vault")
+	keyFile := filepath.Join(dir, "local.key")
+	r.NoError(localvault.GenerateKeyFile(keyFile))
+	r.NoError(localvault.Init(path, localvault.Secret{KeyFile: keyFile}))
+
+	st, err := Open(StoreConfig{Type: "local", Args: map[string]any{
+		"path":      path,
+		"namespace": "app",
+		"key_file":  keyFile,
+	}})
+	r.NoError(err)
+
+	data, err := st.Read(ctx)
+	r.NoError(err)
+	r.Empty(data)
+
+	w := st.(Writer)
+	r.NoError(w.Write(ctx, map[string]any{"A": "1", "B": 2}))
+	r.NoError(w.Write(ctx, map[string]any{"A": "changed"}))
+
+	data, err = st.Read(ctx)
+	r.NoError(err)
+	r.Equal(map[string]any{"A": "changed"}, data)
+
+	v, err := localvault.Open(path, localvault.Secret{KeyFile: keyFile})
+	r.NoError(err)
+	r.Len(v.History("app", "A"), 2)
+	r.Len(v.History("app", "B"), 2)
+	r.Empty(v.Keys("default"))
+
+	ref, err := ParseRef("local://app?path=" + path + "&key_file=" + keyFile + "#A")
+	r.NoError(err)
+	got, err := Config{}.Get(ctx, ref.URI)
+	r.NoError(err)
+	r.Equal("changed", got)
+
+	missing, err := Open(StoreConfig{Type: "local", Args: map[string]any{
+		"path":     filepath.Join(dir, "nope.vault"),
+		"key_file": keyFile,
+	}})
+	r.NoError(err)
+	_, err = missing.Read(ctx)
+	r.ErrorIs(err, ErrNotFound)
+}
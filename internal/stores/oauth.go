@@ -0,0 +1,108 @@
+package stores
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"strings"
+	"sync"
+	"time"
+)
+
+// tokenCache keeps an OAuth access token until shortly before it expires.
+// The cloud stores share one per store so repeated reads (watch, agent
+// re-renders) do not hit the token endpoint every time.
+type tokenCache struct {
+	fetch func(ctx context.Context) (token string, ttl time.Duration, err error)
+
+	mu     sync.Mutex
+	token  string
+	expiry time.Time
+}
+
+func (c *tokenCache) Token(ctx context.Context) (string, error) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	// 期限ぎりぎりのトークンで失敗しないよう 1 分前に取り直す
+	if c.token != "" && time.Until(c.expiry) > time.Minute {
+		return c.token, nil
+	}
+	tok, ttl, err := c.fetch(ctx)
+	if err != nil {
+		return "", err
+	}
+	c.token, c.expiry = tok, time.Now().Add(ttl)
+	return tok, nil
+}
+
+// postTokenForm sends an OAuth 2.0 token request (RFC 6749 / 8693) and
+// returns access_token and expires_in.
+func postTokenForm(ctx context.Context, client *http.Client, tokenURL string, form url.Values) (string, time.Duration, error) {
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, tokenURL, strings.NewReader(form.Encode()))
+	if err != nil {
+		return "", 0, err
+	}
+	req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	res, err := client.Do(req)
+	if err != nil {
+		return "", 0, fmt.Errorf("token %s: %w", tokenURL, err)
+	}
+	defer res.Body.Close()
+	b, err := io.ReadAll(io.LimitReader(res.Body, 1<<20))
+	if err != nil {
+		return "", 0, fmt.Errorf("token %s: %w", tokenURL, err)
+	}
+	if res.StatusCode != http.StatusOK {
+		return "", 0, fmt.Errorf("token %s: %s: %s", tokenURL, res.Status, strings.TrimSpace(string(b)))
+	}
+	var tr struct {
+		AccessToken string `json:"access_token"`
+		ExpiresIn   int64  `json:"expires_in"`
+	}
+	if err := json.Unmarshal(b, &tr); err != nil {
+		return "", 0, fmt.Errorf("token %s: %w", tokenURL, err)
+	}
+	if tr.AccessToken == "" {
+		return "", 0, fmt.Errorf("token %s: no access_token in response", tokenURL)
+	}
+	ttl := time.Duration(tr.ExpiresIn) * time.Second
+	if ttl <= 0 {
+		ttl = 5 * time.Minute
+	}
+	return tr.AccessToken, ttl, nil
+}
+
+// getJSON sends an authorized GET and decodes a 200 response into out.
+// Other statuses are returned as *httpStatusError with the body.
+func getJSON(ctx context.Context, client *http.Client, u, token string, out any) error {
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, u, nil)
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Authorization", "Bearer "+token)
+	req.Header.Set("Accept", "application/json")
+	res, err := client.Do(req)
+	if err != nil {
+		return err
+	}
+	defer res.Body.Close()
+	b, err := io.ReadAll(io.LimitReader(res.Body, 16<<20))
+	if err != nil {
+		return err
+	}
+	if res.StatusCode != http.StatusOK {
+		return &httpStatusError{Code: res.StatusCode, Status: res.Status, Body: strings.TrimSpace(string(b))}
+	}
+	return json.Unmarshal(b, out)
+}
+
+type httpStatusError struct {
+	Code   int
+	Status string
+	Body   string
+}
+
+func (e *httpStatusError) Error() string { return e.Status + ": " + e.Body }
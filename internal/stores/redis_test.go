@@ -0,0 +1,180 @@
+package stores
+
+import (
+	"context"
+	"crypto/tls"
+	"crypto/x509"
+	"path/filepath"
+	"strconv"
+	"testing"
+	"time"
+
+	"github.com/alicebob/miniredis/v2"
+	"github.com/stretchr/testify/require"
+)
+
+func TestRedisStoreHash(t *testing.T) {
+	r := require.New(t)
+	ctx := context.Background()
+	m := miniredis.RunT(t)
+	m.RequireUserAuth("app", "pw")
+	m.Select(2)
+	m.HSet("app:settings", "log_level", "info")
+	m.HSet("app:settings", "rate", "10")
+	m.Select(0)
+
+	st, err := Open(StoreConfig{Type: "redis", Args: map[string]any{
+		"addr": m.Addr(), "username": "app", "password": "pw", "db": 2, "hash": "app:settings",
+	}})
+	r.NoError(err)
+	r.NoError(Probe(ctx, st))
+	data, err := st.Read(ctx)
+	r.NoError(err)
+	r.Equal(map[string]any{"log_level": "info", "rate": "10"}, data)
+
+	r.NoError(st.(Writer).Write(ctx, map[string]any{"log_level": "debug", "burst": 5}))
+	m.Select(2)
+	fields, err := m.HKeys("app:settings")
+	r.NoError(err)
+	r.Equal([]string{"burst", "log_level"}, fields)
+	r.Equal("5", m.HGet("app:settings", "burst"))
+	m.Select(0)
+
+	// url でも同じ設定ができる
+	st, err = Open(StoreConfig{Type: "redis", Args: map[string]any{
+		"url": "redis://app:pw@" + m.Addr() + "/2", "hash": "app:settings",
+	}})
+	r.NoError(err)
+	data, err = st.Read(ctx)
+	r.NoError(err)
+	r.Equal("debug", data["log_level"])
+
+	st, err = Open(StoreConfig{Type: "redis", Args: map[string]any{
+		"addr": m.Addr(), "username": "app", "password": "wrong", "hash": "app:settings",
+	}})
+	r.NoError(err)
+	_, err = st.Read(ctx)
+	r.Error(err)
+
+	st, err = Open(StoreConfig{Type: "redis", Args: map[string]any{
+		"addr": m.Addr(), "username": "app", "password": "pw", "hash": "missing",
+	}})
+	r.NoError(err)
+	_, err = st.Read(ctx)
+	r.ErrorIs(err, ErrNotFound)
+
+	_, err = Open(StoreConfig{Type: "redis", Args: map[string]any{"hash": "a", "prefix": "b"}})
+	r.Error(err)
+}
+
+func TestRedisStorePrefix(t *testing.T) {
+	r := require.New(t)
+	ctx := context.Background()
+	m := miniredis.RunT(t)
+	r.NoError(m.Set("cfg[1]:A", "1"))
+	r.NoError(m.Set("cfg[1]:B", "2"))
+	r.NoError(m.Set("cfg1:other", "glob chars in the prefix are literal"))
+	m.HSet("cfg[1]:hash", "f", "v")
+
+	st, err := Open(StoreConfig{Type: "redis", Args: map[string]any{"addr": m.Addr(), "prefix": "cfg[1]:"}})
+	r.NoError(err)
+	data, err := st.Read(ctx)
+	r.NoError(err)
+	r.Equal(map[string]any{"A": "1", "B": "2"}, data)
+
+	r.NoError(st.(Writer).Write(ctx, map[string]any{"A": "changed", "C": "3"}))
+	data, err = st.Read(ctx)
+	r.NoError(err)
+	r.Equal(map[string]any{"A": "changed", "C": "3"}, data)
+	r.False(m.Exists("cfg[1]:B"))
+	r.True(m.Exists("cfg1:other"))
+}
+
+func TestRedisStoreTLS(t *testing.T) {
+	r := require.New(t)
+	ctx := context.Background()
+	dir := t.TempDir()
+	ca, caKey := testCert(t, dir, "ca", nil, nil)
+	testCert(t, dir, "server", ca, caKey)
+	testCert(t, dir, "client", ca, caKey)
+
+	serverCert, err := tls.LoadX509KeyPair(filepath.Join(dir, "server.pem"), filepath.Join(dir, "server-key.pem"))
+	r.NoError(err)
+	pool := x509.NewCertPool()
+	pool.AddCert(ca)
+	m, err := miniredis.RunTLS(&tls.Config{
+		Certificates: []tls.Certificate{serverCert},
+		ClientCAs:    pool,
+		ClientAuth:   tls.RequireAndVerifyClientCert,
+		MinVersion:   tls.VersionTLS12,
+	})
+	r.NoError(err)
+	t.Cleanup(m.Close)
+	m.HSet("h", "A", "1")
+
+	st, err := Open(StoreConfig{Type: "redis", Args: map[string]any{
+		"addr":   m.Addr(),
+		"hash":   "h",
+		"tls":    true,
+		"cacert": filepath.Join(dir, "ca.pem"),
+		"cert":   filepath.Join(dir, "client.pem"),
+		"key":    filepath.Join(dir, "client-key.pem"),
+	}})
+	r.NoError(err)
+	data, err := st.Read(ctx)
+	r.NoError(err)
+	r.Equal(map[string]any{"A": "1"}, data)
+
+	// クライアント証明書なしでは読めない
+	st, err = Open(StoreConfig{Type: "redis", Args: map[string]any{
+		"addr": m.Addr(), "hash": "h", "cacert": filepath.Join(dir, "ca.pem"), "timeout": "1s",
+	}})
+	r.NoError(err)
+	_, err = st.Read(ctx)
+	r.Error(err)
+}
+
+func TestRedisWatch(t *testing.T) {
+	r := require.New(t)
+	m := miniredis.RunT(t)
+	m.HSet("app:settings", "A", "1")
+
+	st, err := Open(StoreConfig{Type: "redis", Args: map[string]any{"addr": m.Addr(), "hash": "app:settings"}})
+	r.NoError(err)
+
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+	events := make(chan Event, 8)
+	errc := make(chan error, 1)
+	go func() {
+		errc <- Watch(ctx, st, WatchOptions{Source: "test", Interval: time.Hour}, events)
+	}()
+
+	// miniredis はキースペース通知を出さないので、Redis と同じチャンネルに自分で流す
+	var ev Event
+	for i, got := 2, false; !got; i++ {
+		m.HSet("app:settings", "A", strconv.Itoa(i))
+		m.Publish("__keyspace@0__:app:settings", "hset")
+		select {
+		case ev = <-events:
+			got = true
+		case <-time.After(200 * time.Millisecond):
+		case <-ctx.Done():
+			t.Fatal("timeout waiting for event")
+		}
+	}
+	r.Equal("A", ev.Key)
+	r.NotEqual(ev.OldHash, ev.NewHash)
+
+	cancel()
+	r.NoError(<-errc)
+}
+
+func TestMergeNotifyFlags(t *testing.T) {
+	r := require.New(t)
+	r.Equal("Kgh$", mergeNotifyFlags("", "Kgh$"))
+	// 他のクライアントが使っている期限切れ通知（Ex）は残す
+	r.Equal("ExKgh$", mergeNotifyFlags("Ex", "Kgh$"))
+	r.Equal("KEA", mergeNotifyFlags("KEA", "Kgh$"))
+	r.Equal("Kgh$", mergeNotifyFlags("Kgh$", "Kgh$"))
+}
@@ -0,0 +1,236 @@
+package stores
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"path/filepath"
+	"strconv"
+	"time"
+
+	repository "github.com/sasano8/kvtool/internal/core/repositories"
+)
+
+// Store reads the key/values of a single configured store.
+type Store interface {
+	Read(ctx context.Context) (map[string]any, error)
+}
+
+// Writer is an optional capability of a Store that replaces its whole content.
+type Writer interface {
+	Write(ctx context.Context, data map[string]any) error
+}
+
+// Prober is an optional capability of a Store that checks the backend is
+// reachable without reading the values.
+type Prober interface {
+	Probe(ctx context.Context) error
+}
+
+// Identifier is an optional capability of a Store that reports where its
+// data comes from once defaults, env vars and relative paths are resolved
+// (absolute path, effective address, namespace, region, ...).
+type Identifier interface {
+	Identity() map[string]any
+}
+
+// absPath は相対パスを作業ディレクトリから解決する（解決できなければそのまま）
+func absPath(p string) string {
+	if abs, err := filepath.Abs(p); err == nil {
+		return abs
+	}
+	return p
+}
+
+// Probe checks that st answers. Stores without a Prober are read instead;
+// a store that answers "not found" is still reachable.
+func Probe(ctx context.Context, st Store) error {
+	if p, ok := st.(Prober); ok {
+		return p.Probe(ctx)
+	}
+	_, err := st.Read(ctx)
+	if errors.Is(err, ErrNotFound) {
+		return nil
+	}
+	return err
+}
+
+// ErrNotFound is returned by Read when the store has no data yet
+// (missing .env file, missing Vault secret, ...).
+var ErrNotFound = errors.New("store data not found")
+
+// ErrConflict is returned by Write when the backend data changed since it
+// was read (a failed check-and-set).
+var ErrConflict = errors.New("store changed since it was read")
+
+// Factory builds a Store from the "args" of a store config.
+type Factory func(args map[string]any) (Store, error)
+
+// Types maps a store type name (e.g. ".env", "vault") to its factory.
+var Types = repository.New[Factory]()
+
+// Register adds a store type. It panics on duplicate registration.
+func Register(typ string, f Factory) {
+	if _, err := Types.Create(typ, f); err != nil {
+		panic(err)
+	}
+}
+
+// Open builds the Store described by cfg, wrapped in a cache if cfg.Cache is set.
+func Open(cfg StoreConfig) (Store, error) {
+	f, err := Types.Get(cfg.Type)
+	if err != nil {
+		return nil, fmt.Errorf("unknown store type %q: %w", cfg.Type, err)
+	}
+	st, err := f(cfg.Args)
+	if err != nil || cfg.Cache == nil {
+		return st, err
+	}
+	return openCached(st, cfg)
+}
+
+// args は JSON/YAML 由来なので型が揺れる。以下はその吸収用。
+
+func argString(args map[string]any, key, def string) (string, error) {
+	v, ok := args[key]
+	if !ok || v == nil {
+		return def, nil
+	}
+	switch x := v.(type) {
+	case string:
+		return x, nil
+	case float64, int, int64, bool:
+		return fmt.Sprint(x), nil
+	default:
+		return "", fmt.Errorf("arg %q: expected string, got %T", key, v)
+	}
+}
+
+func argInt(args map[string]any, key string, def int) (int, error) {
+	v, ok := args[key]
+	if !ok || v == nil {
+		return def, nil
+	}
+	switch x := v.(type) {
+	case int:
+		return x, nil
+	case int64:
+		return int(x), nil
+	case float64:
+		return int(x), nil
+	case string:
+		n, err := strconv.Atoi(x)
+		if err != nil {
+			return 0, fmt.Errorf("arg %q: %w", key, err)
+		}
+		return n, nil
+	default:
+		return 0, fmt.Errorf("arg %q: expected int, got %T", key, v)
+	}
+}
+
+func argBool(args map[string]any, key string, def bool) (bool, error) {
+	v, ok := args[key]
+	if !ok || v == nil {
+		return def, nil
+	}
+	switch x := v.(type) {
+	case bool:
+		return x, nil
+	case string:
+		b, err := strconv.ParseBool(x)
+		if err != nil {
+			return false, fmt.Errorf("arg %q: %w", key, err)
+		}
+		return b, nil
+	default:
+		return false, fmt.Errorf("arg %q: expected bool, got %T", key, v)
+	}
+}
+
+func argDuration(args map[string]any, key string, def time.Duration) (time.Duration, error) {
+	v, ok := args[key]
+	if !ok || v == nil {
+		return def, nil
+	}
+	switch x := v.(type) {
+	case string:
+		d, err := time.ParseDuration(x)
+		if err != nil {
+			return 0, fmt.Errorf("arg %q: %w", key, err)
+		}
+		return d, nil
+	case float64:
+		// 数値は秒として扱う
+		return time.Duration(x * float64(time.Second)), nil
+	case int:
+		return time.Duration(x) * time.Second, nil
+	default:
+		return 0, fmt.Errorf("arg %q: expected duration, got %T", key, v)
+	}
+}
+
+func argStrings(args map[string]any, key string) ([]string, error) {
+	v, ok := args[key]
+	if !ok || v == nil {
+		return nil, nil
+	}
+	switch x := v.(type) {
+	case []string:
+		return x, nil
+	case []any:
+		out := make([]string, 0, len(x))
+		for _, e := range x {
+			s, ok := e.(string)
+			if !ok {
+				return nil, fmt.Errorf("arg %q: expected string list, got %T element", key, e)
+			}
+			out = append(out, s)
+		}
+		return out, nil
+	case string:
+		// mapToFlagArgs 経由では JSON 文字列で渡ってくる
+		var out []string
+		if err := json.Unmarshal([]byte(x), &out); err != nil {
+			return []string{x}, nil
+		}
+		return out, nil
+	default:
+		return nil, fmt.Errorf("arg %q: expected string list, got %T", key, v)
+	}
+}
+
+func argStringMap(args map[string]any, key string) (map[string]string, error) {
+	v, ok := args[key]
+	if !ok || v == nil {
+		return nil, nil
+	}
+	switch x := v.(type) {
+	case map[string]string:
+		return x, nil
+	case map[string]any:
+		out := make(map[string]string, len(x))
+		for k, e := range x {
+			out[k] = fmt.Sprint(e)
+		}
+		return out, nil
+	case string:
+		// mapToFlagArgs 経由では JSON 文字列で渡ってくる
+		var out map[string]string
+		if err := json.Unmarshal([]byte(x), &out); err != nil {
+			return nil, fmt.Errorf("arg %q: %w", key, err)
+		}
+		return out, nil
+	default:
+		return nil, fmt.Errorf("arg %q: expected string map, got %T", key, v)
+	}
+}
+
+func stringMap(m map[string]string) map[string]any {
+	out := make(map[string]any, len(m))
+	for k, v := range m {
+		out[k] = v
+	}
+	return out
+}
@@ -0,0 +1,18 @@
+package stores
+
+import (
+	"maps"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+// openStore は defaults に overrides を重ねた args で typ のストアを開く
+func openStore(t *testing.T, typ string, defaults, overrides map[string]any) Store {
+	t.Helper()
+	args := maps.Clone(defaults)
+	maps.Copy(args, overrides)
+	st, err := Open(StoreConfig{Type: typ, Args: args})
+	require.NoError(t, err)
+	return st
+}
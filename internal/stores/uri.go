@@ -0,0 +1,267 @@
+package stores
+
+import (
+	"context"
+	"fmt"
+	"maps"
+	"net/url"
+	"strings"
+
+	repository "github.com/sasano8/kvtool/internal/core/repositories"
+)
+
+// Ref is a value (or a whole store) addressed by a URI such as
+//
+//	vault://secret/app/prod#password
+//	dotenv://./.env#DB_HOST
+//	env://HOME
+//	kv://default/vault/password
+//
+// Query parameters become store args (vault://secret/app?kv=1&version=3).
+type Ref struct {
+	URI    string
+	Scheme string
+	// kv:// 以外で開くストア
+	Store StoreConfig
+	// kv:// のとき設定ファイル上の namespace/store
+	Namespace string
+	StoreKey  string
+	// 空ならストア全体
+	Key string
+}
+
+// SchemeFunc fills a Ref from the part of a URI between "<scheme>://" and
+// the query / fragment. A fragment, if any, is already in ref.Key.
+type SchemeFunc func(ref *Ref, rest string) error
+
+// Schemes maps a URI scheme to the function that parses it.
+var Schemes = repository.New[SchemeFunc]()
+
+// RegisterScheme adds a URI scheme. It panics on duplicate registration.
+func RegisterScheme(scheme string, f SchemeFunc) {
+	if _, err := Schemes.Create(scheme, f); err != nil {
+		panic(err)
+	}
+}
+
+func init() {
+	RegisterScheme("kv", parseKVRef)
+	RegisterScheme("vault", parseVaultRef)
+	RegisterScheme("dotenv", fileRef(".env"))
+	RegisterScheme("dotenv+enc", fileRef(".env.enc"))
+	RegisterScheme("env", parseEnvRef)
+}
+
+// IsURI reports whether s starts with a registered "<scheme>://".
+func IsURI(s string) bool {
+	scheme, _, ok := strings.Cut(s, "://")
+	if !ok {
+		return false
+	}
+	_, err := Schemes.Get(scheme)
+	return err == nil
+}
+
+// ParseRef parses a store URI.
+func ParseRef(s string) (Ref, error) {
+	scheme, rest, ok := strings.Cut(s, "://")
+	if !ok {
+		return Ref{}, fmt.Errorf("%q is not a URI (want <scheme>://...)", s)
+	}
+	f, err := Schemes.Get(scheme)
+	if err != nil {
+		return Ref{}, fmt.Errorf("unknown URI scheme %q", scheme)
+	}
+
+	ref := Ref{URI: s, Scheme: scheme}
+	// url.Parse は "./.env" のような相対パスをホストとして扱ってしまうので自前で分ける
+	rest, frag, _ := strings.Cut(rest, "#")
+	rest, rawQuery, _ := strings.Cut(rest, "?")
+	if ref.Key, err = url.PathUnescape(frag); err != nil {
+		return Ref{}, fmt.Errorf("%s: %w", s, err)
+	}
+	q, err := url.ParseQuery(rawQuery)
+	if err != nil {
+		return Ref{}, fmt.Errorf("%s: %w", s, err)
+	}
+	if err := f(&ref, rest); err != nil {
+		return Ref{}, fmt.Errorf("%s: %w", s, err)
+	}
+	// クエリには token などが入りうるので表示名には含めない
+	ref.Store.Name = scheme + "://" + rest
+	if len(q) > 0 {
+		if ref.Namespace != "" {
+			return Ref{}, fmt.Errorf("%s: kv:// does not take query parameters", s)
+		}
+		if ref.Store.Args == nil {
+			ref.Store.Args = map[string]any{}
+		}
+		for k := range q {
+			ref.Store.Args[k] = q.Get(k)
+		}
+	}
+	return ref, nil
+}
+
+// Open opens the store the ref points to. cfg is only used by kv:// refs.
+func (r Ref) Open(cfg Config) (Store, error) {
+	if r.Namespace == "" {
+		return Open(r.Store)
+	}
+	_, sc, err := cfg.Lookup(r.Namespace, r.StoreKey)
+	if err != nil {
+		return nil, err
+	}
+	return Open(sc)
+}
+
+// Value picks the addressed key out of the store data, or returns data
+// itself when the ref names a whole store.
+func (r Ref) Value(data map[string]any) (any, error) {
+	v, ok := ValueAt(data, r.Key)
+	if !ok {
+		return nil, fmt.Errorf("%w: key %q in %s", ErrNotFound, r.Key, r.Store.Name)
+	}
+	return v, nil
+}
+
+// ValueAt returns the value at key, or all of data when key is empty. As in
+// kv:// paths, "db/password" walks into nested maps and also matches a flat
+// "db/password" key.
+func ValueAt(data map[string]any, key string) (any, bool) {
+	if key == "" {
+		return data, true
+	}
+	v, err := repository.Lookup(context.Background(), repository.FS[any](data), key)
+	if err != nil {
+		return nil, false
+	}
+	// 入れ子のディレクトリは読んだときと同じ map[string]any で返す
+	if fs, ok := v.(repository.FS[any]); ok {
+		return map[string]any(fs), true
+	}
+	return v, true
+}
+
+// SetValueAt sets the value at key following the rules of ValueAt: nested
+// maps are walked by their longest matching key, and the part of key that
+// matches nothing becomes one key of the deepest map reached, so flat keys
+// with "/" stay flat. Maps on the way are copied; data itself is modified.
+func SetValueAt(data map[string]any, key string, v any) error {
+	m, name, err := parentAt(data, key)
+	if err != nil {
+		return err
+	}
+	m[name] = v
+	return nil
+}
+
+// DeleteValueAt removes the value ValueAt would return for key and reports
+// whether there was one.
+func DeleteValueAt(data map[string]any, key string) bool {
+	m, name, err := parentAt(data, key)
+	if err != nil {
+		return false
+	}
+	if _, ok := m[name]; !ok {
+		return false
+	}
+	delete(m, name)
+	return true
+}
+
+// parentAt は key の値を持つ map とその中のキー名を返す。
+// 辿った map は複製して差し替えるので、読んだ値を共有している相手には影響しない
+func parentAt(data map[string]any, key string) (map[string]any, string, error) {
+	path := strings.Trim(key, "/")
+	if path == "" {
+		return nil, "", fmt.Errorf("empty key")
+	}
+	m := data
+	for {
+		name, rest, ok := repository.LongestKey(repository.FS[any](m), path)
+		if !ok {
+			return m, path, nil
+		}
+		if rest == "" {
+			return m, name, nil
+		}
+		child, isMap := m[name].(map[string]any)
+		if !isMap {
+			return nil, "", fmt.Errorf("%w: %s", repository.ErrNotDir, name)
+		}
+		child = maps.Clone(child)
+		m[name] = child
+		m, path = child, rest
+	}
+}
+
+// Get reads the value a URI points to.
+func (cfg Config) Get(ctx context.Context, uri string) (any, error) {
+	ref, err := ParseRef(uri)
+	if err != nil {
+		return nil, err
+	}
+	if ref.Namespace != "" {
+		// kv:// は namespace -> store -> key の順に辿る
+		return cfg.Walk(ctx, ref.Namespace+"/"+ref.StoreKey+"/"+ref.Key)
+	}
+	st, err := ref.Open(cfg)
+	if err != nil {
+		return nil, err
+	}
+	data, err := st.Read(ctx)
+	if err != nil {
+		return nil, err
+	}
+	return ref.Value(data)
+}
+
+// kv://<namespace>/<store>[/<key>]
+func parseKVRef(ref *Ref, rest string) error {
+	parts := strings.SplitN(strings.Trim(rest, "/"), "/", 3)
+	if len(parts) < 2 || parts[0] == "" || parts[1] == "" {
+		return fmt.Errorf("want kv://<namespace>/<store>[/<key>]")
+	}
+	ref.Namespace, ref.StoreKey = parts[0], parts[1]
+	if len(parts) == 3 {
+		if ref.Key != "" {
+			return fmt.Errorf("key given twice (%q and #%s)", parts[2], ref.Key)
+		}
+		ref.Key = parts[2]
+	}
+	return nil
+}
+
+// vault://<mount>/<path>[#field]
+func parseVaultRef(ref *Ref, rest string) error {
+	mount, p, _ := strings.Cut(strings.Trim(rest, "/"), "/")
+	if mount == "" || p == "" {
+		return fmt.Errorf("want vault://<mount>/<path>[#field]")
+	}
+	ref.Store = StoreConfig{Type: "vault", Args: map[string]any{"mount": mount, "path": p}}
+	return nil
+}
+
+// dotenv://<path>[#KEY]。dotenv:///etc/app.env のように絶対パスも書ける
+func fileRef(typ string) SchemeFunc {
+	return func(ref *Ref, rest string) error {
+		if rest == "" {
+			return fmt.Errorf("missing file path")
+		}
+		ref.Store = StoreConfig{Type: typ, Args: map[string]any{"input": rest}}
+		return nil
+	}
+}
+
+// env://<NAME>
+func parseEnvRef(ref *Ref, rest string) error {
+	if rest != "" {
+		if ref.Key != "" {
+			return fmt.Errorf("key given twice (%q and #%s)", rest, ref.Key)
+		}
+		ref.Key = rest
+	}
+	ref.Store = StoreConfig{Type: "env"}
+	return nil
+}
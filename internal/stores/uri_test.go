@@ -0,0 +1,178 @@
+package stores
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+
+	repository "github.com/sasano8/kvtool/internal/core/repositories"
+)
+
+func TestParseRef(t *testing.T) {
+	r := require.New(t)
+
+	ref, err := ParseRef("vault://secret/app/prod?kv=1&version=3#password")
+	r.NoError(err)
+	r.Equal("vault", ref.Store.Type)
+	r.Equal(map[string]any{"mount": "secret", "path": "app/prod", "kv": "1", "version": "3"}, ref.Store.Args)
+	r.Equal("password", ref.Key)
+	r.Equal("vault://secret/app/prod", ref.Store.Name)
+
+	ref, err = ParseRef("dotenv://./.env#DB_HOST")
+	r.NoError(err)
+	r.Equal(StoreConfig{Type: ".env", Args: map[string]any{"input": "./.env"}, Name: "dotenv://./.env"}, ref.Store)
+	r.Equal("DB_HOST", ref.Key)
+
+	ref, err = ParseRef("dotenv:///etc/app.env")
+	r.NoError(err)
+	r.Equal("/etc/app.env", ref.Store.Args["input"])
+	r.Empty(ref.Key)
+
+	ref, err = ParseRef("env://HOME")
+	r.NoError(err)
+	r.Equal("env", ref.Store.Type)
+	r.Equal("HOME", ref.Key)
+
+	ref, err = ParseRef("kv://default/vault/password")
+	r.NoError(err)
+	r.Equal("default", ref.Namespace)
+	r.Equal("vault", ref.StoreKey)
+	r.Equal("password", ref.Key)
+
+	ref, err = ParseRef("kv://default/.env#A%20B")
+	r.NoError(err)
+	r.Equal(".env", ref.StoreKey)
+	r.Equal("A B", ref.Key)
+
+	for _, bad := range []string{
+		"default/.env",
+		"nope://x",
+		"vault://secret",
+		"dotenv://",
+		"kv://default",
+		"kv://default/.env/A#B",
+		"kv://default/.env?x=1",
+		"env://A#B",
+	} {
+		_, err := ParseRef(bad)
+		r.Error(err, bad)
+	}
+
+	r.True(IsURI("env://HOME"))
+	r.False(IsURI("default/.env"))
+	r.False(IsURI("https://example.com"))
+}
+
+func TestConfigGet(t *testing.T) {
+	r := require.New(t)
+	ctx := context.Background()
+	dir := t.TempDir()
+	envPath := filepath.Join(dir, ".env")
+	r.NoError(os.WriteFile(envPath, []byte("DB_HOST=db\nDB_PORT=5432\n"), 0o600))
+	t.Setenv("KVTOOL_URI_TEST", "yes")
+
+	cfg := Config{Namespaces: map[string]map[string]StoreConfig{
+		"default": {
+			".env": {Type: ".env", Args: map[string]any{"input": envPath}},
+			"c":    helperStore(t, "nested", nil),
+		},
+	}}
+
+	v, err := cfg.Get(ctx, "dotenv://"+envPath+"#DB_HOST")
+	r.NoError(err)
+	r.Equal("db", v)
+
+	v, err = cfg.Get(ctx, "kv://default/.env/DB_PORT")
+	r.NoError(err)
+	r.Equal("5432", v)
+
+	v, err = cfg.Get(ctx, "kv://default/.env")
+	r.NoError(err)
+	r.Equal(map[string]any{"DB_HOST": "db", "DB_PORT": "5432"}, v)
+
+	// 入れ子の値も "/" を含むキーも同じパスの書き方で辿れる
+	v, err = cfg.Get(ctx, "kv://default/c/db/password")
+	r.NoError(err)
+	r.Equal("pw", v)
+	v, err = cfg.Get(ctx, "kv://default/c/db")
+	r.NoError(err)
+	r.Equal(map[string]any{"password": "pw"}, v)
+	v, err = cfg.Get(ctx, "kv://default/c/a/b")
+	r.NoError(err)
+	r.Equal("flat", v)
+	v, err = Ref{Key: "db/password"}.Value(map[string]any{"db": map[string]any{"password": "pw"}})
+	r.NoError(err)
+	r.Equal("pw", v)
+
+	v, err = cfg.Get(ctx, "env://KVTOOL_URI_TEST")
+	r.NoError(err)
+	r.Equal("yes", v)
+
+	_, err = cfg.Get(ctx, "dotenv://"+envPath+"#MISSING")
+	r.ErrorIs(err, ErrNotFound)
+
+	_, err = cfg.Get(ctx, "kv://other/.env")
+	r.Error(err)
+}
+
+func TestSetValueAt(t *testing.T) {
+	r := require.New(t)
+	nested := map[string]any{"host": "h1"}
+	data := map[string]any{"db": nested, "a/b": "flat"}
+
+	r.NoError(SetValueAt(data, "db/host", "h2"))
+	r.NoError(SetValueAt(data, "db/port", "5432"))
+	r.NoError(SetValueAt(data, "a/b", "flat2"))
+	r.NoError(SetValueAt(data, "x/y", "new"))
+	r.Equal(map[string]any{
+		"db":  map[string]any{"host": "h2", "port": "5432"},
+		"a/b": "flat2",
+		"x/y": "new",
+	}, data)
+	// 読んだ値の map は書き換えない
+	r.Equal(map[string]any{"host": "h1"}, nested)
+	r.ErrorIs(SetValueAt(data, "a/b/c", "v"), repository.ErrNotDir)
+
+	r.True(DeleteValueAt(data, "db/host"))
+	r.False(DeleteValueAt(data, "db/host"))
+	r.True(DeleteValueAt(data, "x/y"))
+	r.Equal(map[string]any{"db": map[string]any{"port": "5432"}, "a/b": "flat2"}, data)
+}
+
+func TestConfigWalk(t *testing.T) {
+	r := require.New(t)
+	ctx := context.Background()
+	dir := t.TempDir()
+	envPath := filepath.Join(dir, ".env")
+	r.NoError(os.WriteFile(envPath, []byte("A=1\n"), 0o600))
+
+	cfg := Config{Namespaces: map[string]map[string]StoreConfig{
+		"default": {
+			".env":    {Type: ".env", Args: map[string]any{"input": envPath}},
+			"missing": {Type: ".env", Args: map[string]any{"input": filepath.Join(dir, "nope")}},
+		},
+	}}
+
+	v, err := cfg.Walk(ctx, "/default/.env/A")
+	r.NoError(err)
+	r.Equal("1", v)
+
+	v, err = cfg.Walk(ctx, "/default/.env")
+	r.NoError(err)
+	r.Equal(map[string]any{"A": "1"}, v)
+
+	// namespace はストアを読まずに一覧できる
+	v, err = cfg.Walk(ctx, "/default")
+	r.NoError(err)
+	r.Len(v, 2)
+
+	_, err = cfg.Walk(ctx, "/default/.env/B")
+	r.ErrorIs(err, ErrNotFound)
+	_, err = cfg.Walk(ctx, "/default/missing/A")
+	r.ErrorIs(err, ErrNotFound)
+	_, err = cfg.Walk(ctx, "/default/.env/A/x")
+	r.ErrorIs(err, repository.ErrNotDir)
+}
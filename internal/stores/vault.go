@@ -0,0 +1,310 @@
+package stores
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"os"
+	"strconv"
+	"strings"
+	"time"
+
+	vaultapi "github.com/hashicorp/vault/api"
+)
+
+func init() {
+	Register("vault", newVaultStore)
+}
+
+// VaultStore reads a single secret from Vault KV.
+type VaultStore struct {
+	Addr      string
+	Token     string
+	Namespace string
+	Mount     string
+	Path      string
+	KV        int
+	Version   int
+	Timeout   time.Duration
+
+	// Watch で metadata をポーリングする間隔
+	WatchInterval time.Duration
+}
+
+func newVaultStore(args map[string]any) (Store, error) {
+	var (
+		s   VaultStore
+		err error
+	)
+	if s.Addr, err = argString(args, "addr", ""); err != nil {
+		return nil, err
+	}
+	if s.Token, err = argString(args, "token", ""); err != nil {
+		return nil, err
+	}
+	if s.Namespace, err = argString(args, "namespace", ""); err != nil {
+		return nil, err
+	}
+	if s.Mount, err = argString(args, "mount", "secret"); err != nil {
+		return nil, err
+	}
+	if s.Path, err = argString(args, "path", ""); err != nil {
+		return nil, err
+	}
+	if s.KV, err = argInt(args, "kv", 2); err != nil {
+		return nil, err
+	}
+	if s.Version, err = argInt(args, "version", 0); err != nil {
+		return nil, err
+	}
+	if s.Timeout, err = argDuration(args, "timeout", 10*time.Second); err != nil {
+		return nil, err
+	}
+	if s.WatchInterval, err = argDuration(args, "watch_interval", 10*time.Second); err != nil {
+		return nil, err
+	}
+	if s.Path == "" {
+		return nil, fmt.Errorf("vault store: missing arg \"path\"")
+	}
+	return &s, nil
+}
+
+// Identity は VAULT_ADDR / VAULT_NAMESPACE を反映した接続先
+func (s *VaultStore) Identity() map[string]any {
+	addr, ns := s.Addr, s.Namespace
+	if addr == "" {
+		// DefaultConfig は VAULT_ADDR を読み、無ければ既定のアドレスになる
+		addr = vaultapi.DefaultConfig().Address
+	}
+	if ns == "" {
+		ns = os.Getenv("VAULT_NAMESPACE")
+	}
+	return map[string]any{"addr": addr, "namespace": ns}
+}
+
+func (s *VaultStore) Read(ctx context.Context) (map[string]any, error) {
+	data, err := ReadVaultKV(ctx, s.Addr, s.Token, s.Namespace, s.Mount, s.Path, s.KV, s.Version, s.Timeout)
+	if errors.Is(err, vaultapi.ErrSecretNotFound) {
+		return nil, fmt.Errorf("%w: %w", ErrNotFound, err)
+	}
+	return data, err
+}
+
+// Probe checks that Vault is reachable, initialized and unsealed.
+func (s *VaultStore) Probe(ctx context.Context) error {
+	client, err := NewVaultClient(s.Addr, s.Token, s.Namespace)
+	if err != nil {
+		return err
+	}
+	ctx, cancel := context.WithTimeout(ctx, s.Timeout)
+	defer cancel()
+	h, err := client.Sys().HealthWithContext(ctx)
+	if err != nil {
+		return fmt.Errorf("vault health: %w", err)
+	}
+	if !h.Initialized || h.Sealed {
+		return fmt.Errorf("vault health: initialized=%t sealed=%t", h.Initialized, h.Sealed)
+	}
+	return nil
+}
+
+// Write stores data as a new version (KV v2) or overwrites it (KV v1).
+func (s *VaultStore) Write(ctx context.Context, data map[string]any) error {
+	if s.Version > 0 {
+		return fmt.Errorf("vault store: cannot write with a pinned version (%d)", s.Version)
+	}
+	client, err := NewVaultClient(s.Addr, s.Token, s.Namespace)
+	if err != nil {
+		return err
+	}
+	mount := strings.Trim(s.Mount, "/")
+	secretPath := strings.Trim(s.Path, "/")
+
+	ctx, cancel := context.WithTimeout(ctx, s.Timeout)
+	defer cancel()
+
+	switch s.KV {
+	case 1:
+		return client.KVv1(mount).Put(ctx, secretPath, data)
+	case 2:
+		_, err := client.KVv2(mount).Put(ctx, secretPath, data)
+		return err
+	default:
+		return fmt.Errorf("invalid -kv %d (must be 1 or 2)", s.KV)
+	}
+}
+
+// Watch polls the KV v2 metadata and reports when current_version changes.
+// KV v1 has no versions, so every tick is reported and the caller diffs the data.
+// A pinned -version never changes, so there is nothing to watch.
+func (s *VaultStore) Watch(ctx context.Context, changed func()) error {
+	client, err := NewVaultClient(s.Addr, s.Token, s.Namespace)
+	if err != nil {
+		return err
+	}
+	mount := strings.Trim(s.Mount, "/")
+	secretPath := strings.Trim(s.Path, "/")
+
+	t := time.NewTicker(s.WatchInterval)
+	defer t.Stop()
+
+	last := -1
+	for {
+		select {
+		case <-ctx.Done():
+			return nil
+		case <-t.C:
+		}
+
+		switch {
+		case s.Version > 0:
+			continue
+		case s.KV == 1:
+			changed()
+			continue
+		}
+
+		pctx, cancel := context.WithTimeout(ctx, s.Timeout)
+		meta, err := client.KVv2(mount).GetMetadata(pctx, secretPath)
+		cancel()
+		if err != nil {
+			if ctx.Err() != nil {
+				return nil
+			}
+			return fmt.Errorf("vault metadata %s/%s: %w", mount, secretPath, err)
+		}
+		// 初回も通知する（Watch 開始前の読み込みとの間の変更を取りこぼさないため）
+		if meta.CurrentVersion != last {
+			last = meta.CurrentVersion
+			changed()
+		}
+	}
+}
+
+// NewVaultClient builds a Vault client. Empty arguments fall back to VAULT_* env vars.
+func NewVaultClient(addr, token, ns string) (*vaultapi.Client, error) {
+	cfg := vaultapi.DefaultConfig()
+	// VAULT_ADDR や TLS 系環境変数（VAULT_CACERT等）を反映
+	_ = cfg.ReadEnvironment()
+
+	client, err := vaultapi.NewClient(cfg)
+	if err != nil {
+		return nil, fmt.Errorf("vault client: %w", err)
+	}
+
+	if addr != "" {
+		if err := client.SetAddress(addr); err != nil {
+			return nil, fmt.Errorf("set addr: %w", err)
+		}
+	}
+
+	// namespace は flag > env
+	if ns == "" {
+		ns = os.Getenv("VAULT_NAMESPACE")
+	}
+	if ns != "" {
+		client.SetNamespace(ns)
+	}
+
+	// token は flag > env（vault/api は token を自動では拾わないので明示）
+	if token == "" {
+		token = os.Getenv("VAULT_TOKEN")
+	}
+	if token == "" {
+		return nil, fmt.Errorf("missing Vault token: set -token or VAULT_TOKEN")
+	}
+	client.SetToken(token)
+	return client, nil
+}
+
+func ReadVaultKV(
+	parent context.Context,
+	addr, token, ns, mount, secretPath string,
+	kvVer int,
+	version int,
+	timeout time.Duration,
+) (map[string]any, error) {
+	client, err := NewVaultClient(addr, token, ns)
+	if err != nil {
+		return nil, err
+	}
+
+	mount = strings.Trim(mount, "/")
+	secretPath = strings.Trim(secretPath, "/")
+
+	ctx, cancel := context.WithTimeout(parent, timeout)
+	defer cancel()
+
+	switch kvVer {
+	case 1:
+		sec, err := client.KVv1(mount).Get(ctx, secretPath)
+		if err != nil {
+			return nil, err
+		}
+		if sec == nil || sec.Data == nil {
+			return nil, fmt.Errorf("secret has no data (not found or empty)")
+		}
+		return toAnyMap(sec.Data), nil
+
+	case 2:
+		kv := client.KVv2(mount)
+		var sec *vaultapi.KVSecret
+
+		if version > 0 {
+			sec, err = kv.GetVersion(ctx, secretPath, version)
+		} else {
+			sec, err = kv.Get(ctx, secretPath)
+		}
+
+		// KVv2 helper が古いVaultで metadata 互換が崩れるケースがあるので、
+		// 失敗したら HTTP API の /data を直接叩くフォールバックに落とす（data だけ取る）
+		if err != nil {
+			raw, err2 := readVaultKVv2Raw(ctx, client, mount, secretPath, version)
+			if err2 == nil {
+				return raw, nil
+			}
+			return nil, err
+		}
+
+		if sec == nil || sec.Data == nil {
+			return nil, fmt.Errorf("secret has no data (deleted or empty)")
+		}
+		return toAnyMap(sec.Data), nil
+
+	default:
+		return nil, fmt.Errorf("invalid -kv %d (must be 1 or 2)", kvVer)
+	}
+}
+
+// KV v2 の HTTP API を直接叩いて data だけ抜くフォールバック
+// v2 の Read API は /<mount>/data/<path> を使う :contentReference[oaicite:1]{index=1}
+func readVaultKVv2Raw(ctx context.Context, client *vaultapi.Client, mount, secretPath string, version int) (map[string]any, error) {
+	apiPath := fmt.Sprintf("%s/data/%s", strings.Trim(mount, "/"), strings.Trim(secretPath, "/"))
+	q := map[string][]string{}
+	if version > 0 {
+		q["version"] = []string{strconv.Itoa(version)}
+	}
+
+	sec, err := client.Logical().ReadWithDataWithContext(ctx, apiPath, q)
+	if err != nil {
+		return nil, err
+	}
+	if sec == nil || sec.Data == nil {
+		return nil, fmt.Errorf("secret not found")
+	}
+
+	// KV v2 のレスポンスは Data["data"] に本体が入る :contentReference[oaicite:2]{index=2}
+	rawData, ok := sec.Data["data"].(map[string]interface{})
+	if !ok || rawData == nil {
+		return nil, fmt.Errorf("unexpected KV v2 response format at %s", apiPath)
+	}
+	return toAnyMap(rawData), nil
+}
+
+func toAnyMap(m map[string]interface{}) map[string]any {
+	out := make(map[string]any, len(m))
+	for k, v := range m {
+		out[k] = v
+	}
+	return out
+}
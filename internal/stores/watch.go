@@ -0,0 +1,239 @@
+package stores
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"path/filepath"
+	"sort"
+	"time"
+
+	"github.com/fsnotify/fsnotify"
+)
+
+// Watcher is an optional capability of a Store.
+// Watch blocks until ctx is cancelled and calls changed whenever the store
+// may have changed. Spurious calls are allowed; callers diff the contents.
+type Watcher interface {
+	Watch(ctx context.Context, changed func()) error
+}
+
+// Event describes a change of a single key.
+// OldHash is empty when the key was added, NewHash is empty when it was removed.
+type Event struct {
+	Key       string    `json:"key"`
+	OldHash   string    `json:"old_hash,omitempty"`
+	NewHash   string    `json:"new_hash,omitempty"`
+	Source    string    `json:"source"`
+	Timestamp time.Time `json:"timestamp"`
+}
+
+type WatchOptions struct {
+	// イベントの source に入る名前（例: "default/.env"）
+	Source string
+	// Watcher を実装していないストアのポーリング間隔
+	Interval time.Duration
+	// 開始時点の全キーを追加イベントとして送る
+	Initial bool
+	// 読み込みや監視のエラー（監視自体は継続する）
+	OnError func(error)
+}
+
+// Watch sends change events of st to out until ctx is cancelled.
+// Only the initial read is fatal; later failures are reported to OnError.
+func Watch(ctx context.Context, st Store, opts WatchOptions, out chan<- Event) error {
+	if opts.Interval <= 0 {
+		opts.Interval = 10 * time.Second
+	}
+	if opts.OnError == nil {
+		opts.OnError = func(error) {}
+	}
+
+	data, err := st.Read(ctx)
+	if err != nil {
+		return fmt.Errorf("read %s: %w", opts.Source, err)
+	}
+	prev := HashValues(data)
+	if opts.Initial {
+		if !send(ctx, out, Diff(opts.Source, nil, prev)) {
+			return nil
+		}
+	}
+
+	trigger := Changes(ctx, st, opts.Interval, opts.OnError)
+
+	for {
+		select {
+		case <-ctx.Done():
+			return nil
+		case <-trigger:
+		}
+
+		data, err := st.Read(ctx)
+		if err != nil {
+			if ctx.Err() != nil {
+				return nil
+			}
+			opts.OnError(fmt.Errorf("read %s: %w", opts.Source, err))
+			continue
+		}
+		cur := HashValues(data)
+		if !send(ctx, out, Diff(opts.Source, prev, cur)) {
+			return nil
+		}
+		prev = cur
+	}
+}
+
+// Changes returns a channel that receives a value whenever st may have changed.
+// Stores implementing Watcher are watched natively, others are polled every interval.
+// The channel is buffered by one, so bursts of changes collapse into a single signal.
+func Changes(ctx context.Context, st Store, interval time.Duration, onError func(error)) <-chan struct{} {
+	trigger := make(chan struct{}, 1)
+	notify := func() {
+		select {
+		case trigger <- struct{}{}:
+		default:
+		}
+	}
+	if onError == nil {
+		onError = func(error) {}
+	}
+
+	if w, ok := st.(Watcher); ok {
+		go runWatcher(ctx, w, notify, onError)
+	} else {
+		go func() {
+			t := time.NewTicker(interval)
+			defer t.Stop()
+			for {
+				select {
+				case <-ctx.Done():
+					return
+				case <-t.C:
+					notify()
+				}
+			}
+		}()
+	}
+	return trigger
+}
+
+// runWatcher は Watcher が落ちたらバックオフして張り直す
+func runWatcher(ctx context.Context, w Watcher, notify func(), onError func(error)) {
+	backoff := time.Duration(0)
+	for {
+		start := time.Now()
+		err := w.Watch(ctx, notify)
+		if ctx.Err() != nil {
+			return
+		}
+		if err != nil {
+			onError(err)
+		}
+		backoff = nextBackoff(backoff, time.Since(start), err)
+		select {
+		case <-ctx.Done():
+			return
+		case <-time.After(backoff):
+		}
+		// 張り直すまでの間の変更を取りこぼさないように一度読み直させる
+		notify()
+	}
+}
+
+// nextBackoff は張り直すまでの待ち時間を返す。正常に終わったか、前回の待ち時間より
+// 長く動いていた Watcher は落ち続けているわけではないので 1 秒からやり直す
+func nextBackoff(backoff, ran time.Duration, err error) time.Duration {
+	if err == nil || ran > backoff || backoff == 0 {
+		return time.Second
+	}
+	return min(backoff*2, time.Minute)
+}
+
+// watchDir は dir を fsnotify で監視し、match が true を返すパスのイベントが
+// 落ち着いたら changed を呼ぶ（match が nil なら全イベント）。監視を張った時点でも
+// 一度呼ぶので、呼び出し元が読んでから張るまでの変更も拾える
+func watchDir(ctx context.Context, dir string, match func(name string) bool, changed func()) error {
+	w, err := fsnotify.NewWatcher()
+	if err != nil {
+		return err
+	}
+	defer w.Close()
+
+	if err := w.Add(dir); err != nil {
+		return fmt.Errorf("watch %s: %w", dir, err)
+	}
+	changed()
+
+	// 書き込み途中（truncate 直後など）を読まないよう、連続したイベントはまとめて通知する
+	debounce := time.NewTimer(time.Hour)
+	debounce.Stop()
+	defer debounce.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return nil
+		case <-debounce.C:
+			changed()
+		case ev, ok := <-w.Events:
+			if !ok {
+				return nil
+			}
+			if match == nil || match(filepath.Clean(ev.Name)) {
+				debounce.Reset(100 * time.Millisecond)
+			}
+		case err, ok := <-w.Errors:
+			if !ok {
+				return nil
+			}
+			return err
+		}
+	}
+}
+
+func send(ctx context.Context, out chan<- Event, events []Event) bool {
+	for _, ev := range events {
+		select {
+		case <-ctx.Done():
+			return false
+		case out <- ev:
+		}
+	}
+	return true
+}
+
+// HashValues returns "sha256:<hex>" of the JSON encoding of each value.
+func HashValues(data map[string]any) map[string]string {
+	out := make(map[string]string, len(data))
+	for k, v := range data {
+		b, err := json.Marshal(v)
+		if err != nil {
+			b = []byte(fmt.Sprint(v))
+		}
+		sum := sha256.Sum256(b)
+		out[k] = "sha256:" + hex.EncodeToString(sum[:])
+	}
+	return out
+}
+
+// Diff returns events for keys whose hash differs, sorted by key.
+func Diff(source string, prev, cur map[string]string) []Event {
+	now := time.Now().UTC()
+	var events []Event
+	for k, h := range cur {
+		if old, ok := prev[k]; !ok || old != h {
+			events = append(events, Event{Key: k, OldHash: prev[k], NewHash: h, Source: source, Timestamp: now})
+		}
+	}
+	for k, old := range prev {
+		if _, ok := cur[k]; !ok {
+			events = append(events, Event{Key: k, OldHash: old, Source: source, Timestamp: now})
+		}
+	}
+	sort.Slice(events, func(i, j int) bool { return events[i].Key < events[j].Key })
+	return events
+}
@@ -0,0 +1,91 @@
+package stores
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestDiff(t *testing.T) {
+	r := require.New(t)
+
+	prev := HashValues(map[string]any{"A": "1", "B": "2", "C": "3"})
+	cur := HashValues(map[string]any{"A": "1", "B": "changed", "D": "4"})
+
+	events := Diff("default/.env", prev, cur)
+	r.Len(events, 3)
+
+	r.Equal("B", events[0].Key)
+	r.Equal(prev["B"], events[0].OldHash)
+	r.Equal(cur["B"], events[0].NewHash)
+
+	r.Equal("C", events[1].Key)
+	r.Empty(events[1].NewHash)
+
+	r.Equal("D", events[2].Key)
+	r.Empty(events[2].OldHash)
+	r.Equal("default/.env", events[2].Source)
+}
+
+func TestNextBackoff(t *testing.T) {
+	r := require.New(t)
+	fail := errors.New("connection lost")
+
+	// すぐ落ち続ける間は倍々で 1 分まで
+	b := time.Duration(0)
+	for _, want := range []time.Duration{time.Second, 2 * time.Second, 4 * time.Second} {
+		b = nextBackoff(b, 0, fail)
+		r.Equal(want, b)
+	}
+	r.Equal(time.Minute, nextBackoff(50*time.Second, 0, fail))
+	r.Equal(time.Minute, nextBackoff(time.Minute, 0, fail))
+
+	// 長く動いてから落ちた・正常に終わった時は 1 秒に戻す
+	r.Equal(time.Second, nextBackoff(time.Minute, 2*time.Hour, fail))
+	r.Equal(time.Second, nextBackoff(time.Minute, 0, nil))
+}
+
+func TestWatchDotenv(t *testing.T) {
+	r := require.New(t)
+	dir := t.TempDir()
+	p := filepath.Join(dir, ".env")
+	r.NoError(os.WriteFile(p, []byte("A=1\nB=2\n"), 0o644))
+
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+
+	events := make(chan Event, 8)
+	errc := make(chan error, 1)
+	go func() {
+		errc <- Watch(ctx, &DotenvStore{Path: p}, WatchOptions{Source: "test", Interval: time.Hour}, events)
+	}()
+
+	// fsnotify の監視開始を待つ手段がないので、変化が拾われるまで書き直す
+	// 開始前に書いた変更は初回読み込みに吸収されるので、毎回違う値にする
+	var ev Event
+	for i, got := 3, false; !got; i++ {
+		tmp := p + ".tmp"
+		r.NoError(os.WriteFile(tmp, []byte(fmt.Sprintf("A=1\nB=%d\n", i)), 0o644))
+		r.NoError(os.Rename(tmp, p))
+		select {
+		case ev = <-events:
+			got = true
+		case <-time.After(200 * time.Millisecond):
+		case <-ctx.Done():
+			t.Fatal("timeout waiting for event")
+		}
+	}
+	r.Equal("B", ev.Key)
+	r.Equal("test", ev.Source)
+	r.NotEmpty(ev.OldHash)
+	r.NotEqual(ev.OldHash, ev.NewHash)
+
+	cancel()
+	r.NoError(<-errc)
+}